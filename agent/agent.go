@@ -216,6 +216,10 @@ type AgentDeps struct {
 	Prefs      *PreferencesStore
 	ParetoMode bool
 	UserID     string
+	// Generations tracks in-flight requests so clients can cancel them.
+	Generations *GenerationRegistry
+	// Approvals holds tool calls waiting for the user to approve them.
+	Approvals *ApprovalRegistry
 }
 
 func HandleSend(ctx context.Context, req ResponseGenerationRequest, deps AgentDeps) error {
@@ -233,6 +237,7 @@ func HandleSend(ctx context.Context, req ResponseGenerationRequest, deps AgentDe
 	cfg := GenerateConfig{
 		MaxToolIterations: userPrefs.MaxToolIterations,
 		EnableTools:       req.EnableTools,
+		EnableStreaming:   req.EnableStreaming,
 		ParetoMode:        deps.ParetoMode && req.UsePareto,
 	}
 
@@ -278,6 +283,7 @@ func HandleRegenerate(ctx context.Context, req ResponseGenerationRequest, deps A
 	cfg := GenerateConfig{
 		MaxToolIterations: userPrefs.MaxToolIterations,
 		EnableTools:       req.EnableTools,
+		EnableStreaming:   req.EnableStreaming,
 		ParetoMode:        deps.ParetoMode && req.UsePareto,
 	}
 
@@ -332,6 +338,7 @@ func HandleEdit(ctx context.Context, req ResponseGenerationRequest, deps AgentDe
 	cfg := GenerateConfig{
 		MaxToolIterations: userPrefs.MaxToolIterations,
 		EnableTools:       req.EnableTools,
+		EnableStreaming:   req.EnableStreaming,
 		ParetoMode:        deps.ParetoMode && req.UsePareto,
 	}
 
@@ -395,9 +402,10 @@ func generateParetoResponse(ctx context.Context, convID, userMsgID, previousID s
 }
 
 func continueResponse(ctx context.Context, convID string, msg *Message, cfg GenerateConfig, deps AgentDeps) error {
+	deps.Generations.Track(ctx, msg.ID)
 	deps.Notifier.SendThinking(ctx, msg.ID, "Continuing response...")
 
-	messages, err := LoadConversationFull(ctx, deps.DB, convID)
+	messages, summary, err := loadBranch(ctx, deps, convID, msg.ID)
 	if err != nil {
 		deps.Notifier.SendError(ctx, msg.ID, fmt.Errorf("load conversation: %w", err))
 		return err
@@ -413,12 +421,16 @@ func continueResponse(ctx context.Context, convID string, msg *Message, cfg Gene
 		if deps.MCP != nil {
 			tools = append(tools, deps.MCP.Tools()...)
 		}
+		if deps.UserID != "" {
+			tools = append(tools, MemoryTools()...)
+		}
 	}
 	// Always add final_answer tool to force responses through function calling API
 	tools = append(tools, FinalAnswerTool())
 
-	llmMsgs, systemPrompt := buildLLMMessages(messages, nil, nil, tools)
+	llmMsgs, systemPrompt := buildLLMMessages(messages, summary, nil, nil, tools)
 	continuePrompt := getContinuePrompt()
+	llmMsgs = fitContext(llmMsgs, tools, deps.LLM.ContextWindow(), deps.LLM.maxTokens+estimateTokens(continuePrompt.Text))
 	llmMsgs = append(llmMsgs, LLMMessage{Role: "user", Content: continuePrompt.Text})
 
 	if systemPrompt.Name != "" {
@@ -440,6 +452,9 @@ func continueResponse(ctx context.Context, convID string, msg *Message, cfg Gene
 		TraceName:      "agent:continue",
 	})
 	if err != nil {
+		if isCancelled(ctx) {
+			return finishCancelled(ctx, deps, msg.ID, msg.Content, msg.Reasoning)
+		}
 		deps.Notifier.SendError(ctx, msg.ID, err)
 		return err
 	}
@@ -489,6 +504,7 @@ func runToolLoop(ctx context.Context, convID, msgID, previousID, userQuery strin
 		}
 	}
 
+	deps.Generations.Track(ctx, msgID)
 	deps.Notifier.SetMessageID(msgID)
 	deps.Notifier.SetPreviousID(previousID)
 	deps.Notifier.SendStartAnswer(ctx, msgID)
@@ -497,7 +513,7 @@ func runToolLoop(ctx context.Context, convID, msgID, previousID, userQuery strin
 	setupCtx, setupSpan := otel.Tracer("alicia-agent").Start(ctx, "response.setup",
 		trace.WithAttributes(attribute.String("conversation_id", convID)))
 
-	messages, err := LoadConversationFull(setupCtx, deps.DB, convID)
+	messages, summary, err := loadBranch(setupCtx, deps, convID, previousID)
 	if err != nil {
 		setupSpan.RecordError(err)
 		setupSpan.End()
@@ -506,29 +522,28 @@ func runToolLoop(ctx context.Context, convID, msgID, previousID, userQuery strin
 		return fmt.Errorf("load conversation: %w", err)
 	}
 
-	var memories []Memory
+	// Without an embedding, memories and notes are still found by keyword.
 	embedding, err := deps.LLM.Embed(setupCtx, userQuery)
 	if err != nil {
 		slog.ErrorContext(setupCtx, "failed to generate embedding for memory search", "error", err)
-	} else if len(embedding) > 0 {
-		userPrefs := deps.Prefs.Get(deps.UserID)
-		memories, err = SearchMemories(setupCtx, deps.DB, embedding, 0.7, userPrefs.MemoryRetrievalCount)
-		if err != nil {
-			slog.ErrorContext(setupCtx, "failed to search memories", "error", err)
-		} else {
-			for _, m := range memories {
-				if err := RecordMemoryUse(setupCtx, deps.DB, NewMemoryUseID(), m.ID, msgID, convID, m.Similarity); err != nil {
-					slog.ErrorContext(setupCtx, "failed to record memory use", "memory_id", m.ID, "error", err)
-				}
-				deps.Notifier.SendMemoryTrace(setupCtx, msgID, m.ID, m.Content, m.Similarity)
+		embedding = nil
+	}
+	memories, err := RetrieveMemories(setupCtx, deps, userQuery, embedding)
+	if err != nil {
+		slog.ErrorContext(setupCtx, "failed to search memories", "error", err)
+	} else {
+		for _, m := range memories {
+			if err := RecordMemoryUse(setupCtx, deps.DB, NewMemoryUseID(), deps.UserID, m.ID, msgID, convID, m.Similarity); err != nil {
+				slog.ErrorContext(setupCtx, "failed to record memory use", "memory_id", m.ID, "error", err)
 			}
+			deps.Notifier.SendMemoryTrace(setupCtx, msgID, m.ID, m.Content, m.Similarity)
 		}
 	}
 
 	var notes []Note
-	if embedding != nil && deps.UserID != "" {
+	if deps.UserID != "" {
 		userPrefs := deps.Prefs.Get(deps.UserID)
-		notes, err = SearchNotes(setupCtx, deps.DB, deps.UserID, embedding, userPrefs.NotesSimilarityThreshold, userPrefs.NotesMaxCount)
+		notes, err = SearchNotes(setupCtx, deps.DB, deps.UserID, userQuery, embedding, userPrefs.NotesSimilarityThreshold, userPrefs.NotesMaxCount, userPrefs.SearchWeights())
 		if err != nil {
 			slog.ErrorContext(setupCtx, "failed to search notes", "error", err)
 		}
@@ -544,15 +559,22 @@ func runToolLoop(ctx context.Context, convID, msgID, previousID, userQuery strin
 		if deps.MCP != nil {
 			tools = append(tools, deps.MCP.Tools()...)
 		}
+		if deps.UserID != "" {
+			tools = append(tools, MemoryTools()...)
+		}
 	}
 	// Always add final_answer tool to force responses through function calling API
 	tools = append(tools, FinalAnswerTool())
 
-	llmMsgs, systemPrompt := buildLLMMessages(messages, memories, notes, tools)
+	llmMsgs, systemPrompt := buildLLMMessages(messages, summary, memories, notes, tools)
+	historyLen := len(llmMsgs)
+	llmMsgs = fitContext(llmMsgs, tools, deps.LLM.ContextWindow(), deps.LLM.maxTokens)
 
 	setupSpan.SetAttributes(
 		attribute.Int("memory_count", len(memories)),
 		attribute.Int("tool_count", len(tools)),
+		attribute.Int("history_messages", historyLen-1),
+		attribute.Int("context_messages", len(llmMsgs)-1),
 	)
 	if systemPrompt.Name != "" {
 		setupSpan.SetAttributes(
@@ -573,6 +595,12 @@ func runToolLoop(ctx context.Context, convID, msgID, previousID, userQuery strin
 		)
 	}
 
+	// Changes the memory tools make are attributed to the user's message.
+	memoryTurn := memoryToolTurn{convID: convID, msgID: msgID, sourceMsgID: previousID}
+	if memoryTurn.sourceMsgID == "" {
+		memoryTurn.sourceMsgID = msgID
+	}
+
 	var finalContent string
 	var totalToolCalls int
 	var reasoningParts []string
@@ -580,7 +608,37 @@ func runToolLoop(ctx context.Context, convID, msgID, previousID, userQuery strin
 	userPrefs := deps.Prefs.Get(deps.UserID)
 	temperature := float32Ptr(userPrefs.Temperature)
 
+	// Content deltas and answer_user arguments are forwarded as they arrive so
+	// clients can render text and voice can start TTS before the loop finishes.
+	// Text the model writes alongside a real tool call is streamed too; the
+	// final AssistantMessage carries the authoritative content.
+	var streamer *answerStreamer
+	if cfg.EnableStreaming {
+		streamer = newAnswerStreamer(ctx, deps.Notifier, msgID)
+	}
+
+	// partialContent is what the user has already seen when a generation is
+	// cancelled: the streamed text, or nothing for non-streaming requests.
+	partialContent := func() string {
+		if streamer == nil {
+			return ""
+		}
+		return strings.TrimSpace(streamer.Text())
+	}
+
+	// cancelled ends the stream, so voice gets the last partial sentence and
+	// clients see it close, before recording the cancellation.
+	cancelled := func() error {
+		if streamer != nil {
+			streamer.Finish()
+		}
+		return finishCancelled(ctx, deps, msgID, partialContent(), strings.Join(reasoningParts, "\n\n"))
+	}
+
 	for i := 0; i < cfg.MaxToolIterations; i++ {
+		if isCancelled(ctx) {
+			return cancelled()
+		}
 		if i > 0 {
 			deps.Notifier.SendThinking(ctx, msgID, fmt.Sprintf("Analyzing results (step %d)...", i+1))
 		}
@@ -598,7 +656,7 @@ func runToolLoop(ctx context.Context, convID, msgID, previousID, userQuery strin
 		llmCtx, llmSpan := otel.Tracer("alicia-agent").Start(ctx, "llm.chat",
 			trace.WithAttributes(llmAttrs...))
 
-		resp, err := MakeLLMCall(llmCtx, deps.LLM, llmMsgs, tools, LLMCallOptions{
+		callOpts := LLMCallOptions{
 			Temperature:    temperature,
 			ToolChoice:     "auto",
 			GenerationName: "agent.tool_loop",
@@ -606,10 +664,17 @@ func runToolLoop(ctx context.Context, convID, msgID, previousID, userQuery strin
 			ConvID:         convID,
 			UserID:         deps.UserID,
 			TraceName:      "agent:tool_loop",
-		})
+		}
+		if streamer != nil {
+			callOpts.Stream = streamer.Handler()
+		}
+		resp, err := MakeLLMCall(llmCtx, deps.LLM, llmMsgs, tools, callOpts)
 		if err != nil {
 			llmSpan.RecordError(err)
 			llmSpan.End()
+			if isCancelled(ctx) {
+				return cancelled()
+			}
 			deps.Notifier.SendError(ctx, msgID, err)
 			return err
 		}
@@ -645,56 +710,104 @@ func runToolLoop(ctx context.Context, convID, msgID, previousID, userQuery strin
 
 		llmMsgs = append(llmMsgs, LLMMessage{Role: "assistant", Content: resp.Content, ToolCalls: resp.ToolCalls})
 
-		for _, tc := range resp.ToolCalls {
-			// Skip final_answer - it's not a real tool to execute
-			if IsFinalAnswerCall(tc) {
-				continue
+		calls := executableToolCalls(resp.ToolCalls)
+		if deps.MCP == nil {
+			for _, tc := range calls {
+				if !isMemoryTool(tc.Name) {
+					deps.Notifier.SendError(ctx, msgID, fmt.Errorf("MCP not available"))
+					return fmt.Errorf("MCP not available for tool call: %s", tc.Name)
+				}
 			}
-			deps.Notifier.SendToolStart(ctx, tc.ID, tc.Name, tc.Arguments)
+		}
 
-			mcpName := tc.Name
-			if strings.HasPrefix(mcpName, "mcp_garden_") {
-				mcpName = strings.TrimPrefix(mcpName, "mcp_garden_")
+		// Calls run concurrently; their results go back to the model in the
+		// order the model made them.
+		type toolResult struct {
+			result any
+			text   string // result as sent to the model, within the tool's size limit
+			err    error
+		}
+		results := runToolCalls(calls, func(tc LLMToolCall) toolResult {
+			toolName := mcpToolName(tc.Name)
+			builtin := isMemoryTool(tc.Name)
+			var limits ToolLimits
+			if !builtin {
+				limits = deps.MCP.Limits(toolName)
+			}
+			if err := startToolCall(ctx, deps, convID, tc, limits.ApprovalPolicy); err != nil {
+				if !isCancelled(ctx) {
+					deps.Notifier.SendToolComplete(ctx, tc.ID, false, nil, err.Error())
+				}
+				return toolResult{err: err}
 			}
 
-			// Create span for tool execution
 			toolCtx, toolSpan := otel.Tracer("alicia-agent").Start(ctx, "tool.execute",
 				trace.WithAttributes(
 					attribute.String("tool.name", tc.Name),
 					attribute.String("tool.id", tc.ID),
 				))
+			defer toolSpan.End()
 
-			if deps.MCP == nil {
-				toolSpan.End()
-				deps.Notifier.SendError(ctx, msgID, fmt.Errorf("MCP not available"))
-				return fmt.Errorf("MCP not available for tool call: %s", tc.Name)
+			var result any
+			var execErr error
+			if builtin {
+				result, execErr = callMemoryTool(toolCtx, deps, memoryTurn, tc)
+			} else {
+				result, execErr = deps.MCP.Call(toolCtx, toolName, tc.Arguments)
+			}
+			switch {
+			case execErr != nil && isCancelled(ctx):
+				// Reported as a cancelled generation once all calls return.
+			case execErr != nil:
+				toolSpan.RecordError(execErr)
+				toolSpan.SetAttributes(attribute.Bool("tool.success", false))
+				deps.Notifier.SendToolComplete(ctx, tc.ID, false, nil, execErr.Error())
+			default:
+				toolSpan.SetAttributes(attribute.Bool("tool.success", true))
+				if content, ok := result.(*ToolContent); ok {
+					// Stored results and client notifications only reference images.
+					if err := SaveToolAttachments(toolCtx, deps.DB, tc.ID, content); err != nil {
+						slog.WarnContext(ctx, "failed to save tool attachments", "tool_use_id", tc.ID, "error", err)
+					}
+				}
+				deps.Notifier.SendToolComplete(ctx, tc.ID, true, result, "")
+			}
+			if execErr != nil {
+				return toolResult{err: execErr}
 			}
+			text := fitToolResult(toolCtx, deps, convID, toolName, limits, toolResultText(result))
+			return toolResult{result: result, text: text}
+		})
 
-			result, execErr := deps.MCP.Call(toolCtx, mcpName, tc.Arguments)
+		var imageMsgs []LLMMessage
+		for j, tc := range calls {
+			res := results[j]
+			if res.err != nil && isCancelled(ctx) {
+				return cancelled()
+			}
 			totalToolCalls++
 
 			tu := ToolUse{ID: tc.ID, ToolName: tc.Name, Arguments: tc.Arguments}
 			var toolMsg LLMMessage
-
-			if execErr != nil {
+			if res.err != nil {
 				tu.Success = false
-				tu.Error = execErr.Error()
-				toolSpan.RecordError(execErr)
-				toolSpan.SetAttributes(attribute.Bool("tool.success", false))
-				deps.Notifier.SendToolComplete(ctx, tc.ID, false, nil, execErr.Error())
-				toolMsg = LLMMessage{Role: "tool", Content: "Error: " + execErr.Error(), ToolCallID: tc.ID}
+				tu.Error = res.err.Error()
+				toolMsg = LLMMessage{Role: "tool", Content: "Error: " + res.err.Error(), ToolCallID: tc.ID}
 			} else {
 				tu.Success = true
-				tu.Result = result
-				toolSpan.SetAttributes(attribute.Bool("tool.success", true))
-				deps.Notifier.SendToolComplete(ctx, tc.ID, true, result, "")
-				toolMsg = LLMMessage{Role: "tool", Content: fmt.Sprintf("%v", result), ToolCallID: tc.ID}
+				tu.Result = res.result
+				toolMsg = LLMMessage{Role: "tool", Content: res.text, ToolCallID: tc.ID}
+				if imgMsg, ok := toolImagesMessage(tc.Name, res.result); ok && deps.LLM.SupportsVision() {
+					imageMsgs = append(imageMsgs, imgMsg)
+				}
 			}
-			toolSpan.End()
 
 			llmMsgs = append(llmMsgs, toolMsg)
 			SaveToolUse(ctx, deps.DB, msgID, tu)
 		}
+		// Images can only follow the tool messages, which must directly answer
+		// the assistant's tool calls.
+		llmMsgs = append(llmMsgs, imageMsgs...)
 
 		if i == cfg.MaxToolIterations-1 {
 			finalContent = resp.Content
@@ -713,6 +826,13 @@ func runToolLoop(ctx context.Context, convID, msgID, previousID, userQuery strin
 		return err
 	}
 
+	if streamer != nil {
+		if !streamer.Streamed() && finalContent != "" {
+			// e.g. "Max tool iterations reached." never came from the model
+			streamer.write(finalContent)
+		}
+		streamer.Finish()
+	}
 	deps.Notifier.SendComplete(ctx, msgID, finalContent)
 	slog.InfoContext(ctx, "response complete", "message_id", msgID, "content_length", len(finalContent))
 
@@ -731,11 +851,14 @@ func runToolLoop(ctx context.Context, convID, msgID, previousID, userQuery strin
 	// Carry span context so Langfuse traces are correlated with the request
 	memCtx := trace.ContextWithSpanContext(context.Background(), trace.SpanFromContext(ctx).SpanContext())
 	go ExtractAndSaveMemories(memCtx, convID, msgID, deps)
+	go SummarizeConversation(memCtx, convID, msgID, deps)
 
 	return nil
 }
 
-func buildLLMMessages(history []Message, newMemories []Memory, notes []Note, tools []Tool) ([]LLMMessage, PromptResult) {
+// buildLLMMessages renders the branch history for the model. Messages covered
+// by summary are replaced with the summary itself.
+func buildLLMMessages(history []Message, summary *ConversationSummary, newMemories []Memory, notes []Note, tools []Tool) ([]LLMMessage, PromptResult) {
 	var msgs []LLMMessage
 
 	memorySet := make(map[string]Memory)
@@ -755,6 +878,10 @@ func buildLLMMessages(history []Message, newMemories []Memory, notes []Note, too
 
 	systemPrompt := getSystemPrompt(memories, notes, tools, "")
 	msgs = append(msgs, LLMMessage{Role: "system", Content: systemPrompt.Text})
+	if summary != nil {
+		msgs = append(msgs, summaryMessage(summary))
+		history = historyAfterSummary(history, summary)
+	}
 
 	for _, m := range history {
 		if m.Role == "system" {
@@ -848,6 +975,10 @@ type LLMCallOptions struct {
 	// Behavior flags
 	NoTelemetry bool // skip Langfuse generation
 	NoRetry     bool // skip token-length retry loop
+
+	// Stream, when set, performs a streaming completion and forwards fragments
+	// to the handler as they arrive. Implies NoRetry.
+	Stream *StreamHandler
 }
 
 func sendGenerationToLangfuse(gen LangfuseGeneration) {
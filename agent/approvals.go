@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// Approval policies for tool calls. An empty policy means approvalAlways.
+const (
+	approvalAlways = "always"
+	approvalNever  = "never"
+	approvalAsk    = "ask"
+)
+
+// toolApprovalTimeout is how long a tool call waits for the user to answer
+// before it is treated as denied.
+const toolApprovalTimeout = 5 * time.Minute
+
+type approvalDecision struct {
+	approved bool
+	reason   string
+}
+
+type pendingApproval struct {
+	convID   string
+	decision chan approvalDecision
+}
+
+// ApprovalRegistry holds the tool calls that are waiting for the user, indexed
+// by tool use ID, so that a ToolApproval from a client can resume the tool
+// loop that asked for it.
+type ApprovalRegistry struct {
+	mu      sync.Mutex
+	pending map[string]pendingApproval
+	timeout time.Duration
+}
+
+func NewApprovalRegistry() *ApprovalRegistry {
+	return &ApprovalRegistry{
+		pending: make(map[string]pendingApproval),
+		timeout: toolApprovalTimeout,
+	}
+}
+
+// Request registers the tool call, announces it with ask, and blocks until
+// the user answers, the timeout passes or ctx is done. A timeout is reported
+// as a denial.
+func (r *ApprovalRegistry) Request(ctx context.Context, convID, toolUseID string, ask func()) (bool, string, error) {
+	p := pendingApproval{convID: convID, decision: make(chan approvalDecision, 1)}
+	r.mu.Lock()
+	r.pending[toolUseID] = p
+	r.mu.Unlock()
+	defer func() {
+		r.mu.Lock()
+		delete(r.pending, toolUseID)
+		r.mu.Unlock()
+	}()
+
+	ask()
+
+	timer := time.NewTimer(r.timeout)
+	defer timer.Stop()
+	select {
+	case d := <-p.decision:
+		return d.approved, d.reason, nil
+	case <-timer.C:
+		return false, fmt.Sprintf("no answer within %s", r.timeout), nil
+	case <-ctx.Done():
+		return false, "", ctx.Err()
+	}
+}
+
+// Resolve delivers the user's answer for a tool call. It reports whether a
+// call in that conversation was waiting for it; an answer that names no
+// conversation, or another one, matches nothing.
+func (r *ApprovalRegistry) Resolve(convID, toolUseID string, approved bool, reason string) bool {
+	r.mu.Lock()
+	p, ok := r.pending[toolUseID]
+	if ok && p.convID == convID {
+		delete(r.pending, toolUseID)
+	} else {
+		ok = false
+	}
+	r.mu.Unlock()
+
+	if ok {
+		p.decision <- approvalDecision{approved: approved, reason: reason}
+	}
+	return ok
+}
+
+// startToolCall applies the tool's approval policy and announces the call to
+// clients once it may run. Under "ask" the call is first announced as
+// awaiting approval and the tool loop blocks until the user answers. The
+// returned error explains why the call must not run; it is given back to the
+// model as the tool's result.
+func startToolCall(ctx context.Context, deps AgentDeps, convID string, tc LLMToolCall, policy string) error {
+	if policy == approvalNever {
+		return fmt.Errorf("tool %s is disabled", tc.Name)
+	}
+	if policy == approvalAsk {
+		if deps.Approvals == nil {
+			return fmt.Errorf("tool %s needs the user's approval, which is not available", tc.Name)
+		}
+		approved, reason, err := deps.Approvals.Request(ctx, convID, tc.ID, func() {
+			deps.Notifier.SendToolApprovalRequest(ctx, tc.ID, tc.Name, tc.Arguments)
+		})
+		if err != nil {
+			return err
+		}
+		if !approved {
+			slog.InfoContext(ctx, "tool call denied", "tool", tc.Name, "tool_use_id", tc.ID, "reason", reason)
+			if reason == "" {
+				return fmt.Errorf("the user denied the call to %s", tc.Name)
+			}
+			return fmt.Errorf("the user denied the call to %s: %s", tc.Name, reason)
+		}
+	}
+
+	deps.Notifier.SendToolStart(ctx, tc.ID, tc.Name, tc.Arguments)
+	return nil
+}
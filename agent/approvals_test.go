@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+// approvalNotifier is a Notifier that records the tool messages it is asked
+// to send.
+type approvalNotifier struct {
+	Notifier
+	asked   chan string
+	started chan string
+}
+
+func newApprovalNotifier() *approvalNotifier {
+	return &approvalNotifier{asked: make(chan string, 4), started: make(chan string, 4)}
+}
+
+func (n *approvalNotifier) SendToolApprovalRequest(ctx context.Context, id, name string, args map[string]any) {
+	n.asked <- id
+}
+
+func (n *approvalNotifier) SendToolStart(ctx context.Context, id, name string, args map[string]any) {
+	n.started <- id
+}
+
+func TestStartToolCallApproval(t *testing.T) {
+	notifier := newApprovalNotifier()
+	deps := AgentDeps{Notifier: notifier, Approvals: NewApprovalRegistry()}
+	tc := LLMToolCall{ID: "tu_1", Name: "garden:execute_sql"}
+
+	done := make(chan error, 1)
+	go func() { done <- startToolCall(testCtx(t), deps, "conv_1", tc, approvalAsk) }()
+	if id := <-notifier.asked; id != "tu_1" {
+		t.Fatalf("approval requested for %q", id)
+	}
+	if deps.Approvals.Resolve("conv_other", "tu_1", true, "") {
+		t.Fatal("approval from another conversation was accepted")
+	}
+	if deps.Approvals.Resolve("", "tu_1", true, "") {
+		t.Fatal("approval without a conversation was accepted")
+	}
+	if !deps.Approvals.Resolve("conv_1", "tu_1", true, "") {
+		t.Fatal("approval was not delivered")
+	}
+	if err := <-done; err != nil {
+		t.Fatalf("approved call: %v", err)
+	}
+	if id := <-notifier.started; id != "tu_1" {
+		t.Errorf("started %q after approval", id)
+	}
+
+	go func() { done <- startToolCall(testCtx(t), deps, "conv_1", tc, approvalAsk) }()
+	<-notifier.asked
+	deps.Approvals.Resolve("conv_1", "tu_1", false, "looks destructive")
+	if err := <-done; err == nil || !strings.Contains(err.Error(), "looks destructive") {
+		t.Errorf("denied call = %v", err)
+	}
+	if len(notifier.started) != 0 {
+		t.Error("denied call was started")
+	}
+}
+
+func TestStartToolCallApprovalTimeout(t *testing.T) {
+	notifier := newApprovalNotifier()
+	deps := AgentDeps{Notifier: notifier, Approvals: NewApprovalRegistry()}
+	deps.Approvals.timeout = 20 * time.Millisecond
+
+	err := startToolCall(testCtx(t), deps, "conv_1", LLMToolCall{ID: "tu_1", Name: "fetch_raw"}, approvalAsk)
+	if err == nil || !strings.Contains(err.Error(), "no answer within") {
+		t.Errorf("unanswered call = %v", err)
+	}
+	if deps.Approvals.Resolve("conv_1", "tu_1", true, "") {
+		t.Error("late approval was accepted")
+	}
+
+	if err := startToolCall(testCtx(t), deps, "conv_1", LLMToolCall{ID: "tu_2", Name: "fetch_raw"}, approvalNever); err == nil {
+		t.Error("call with policy never was allowed")
+	}
+	if len(notifier.started) != 0 {
+		t.Error("disabled call was announced as started")
+	}
+}
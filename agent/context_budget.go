@@ -0,0 +1,134 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"unicode/utf8"
+)
+
+const (
+	defaultContextWindow = 32000
+
+	// Rough per-item costs for what the estimate can't see: message framing
+	// and the tokens an image is billed at by most vision models.
+	messageOverheadTokens = 4
+	imageTokens           = 800
+
+	// omittedNoteTokens covers the note that replaces dropped turns.
+	omittedNoteTokens = 32
+)
+
+// estimateTokens approximates the token count of text without a tokenizer.
+// English averages about four bytes per token; other scripts are closer to a
+// token per character, so non-ASCII runes are counted one each.
+func estimateTokens(s string) int {
+	if s == "" {
+		return 0
+	}
+	ascii, other := 0, 0
+	for _, r := range s {
+		if r < utf8.RuneSelf {
+			ascii++
+		} else {
+			other++
+		}
+	}
+	return ascii/4 + other + 1
+}
+
+func messageTokens(m LLMMessage) int {
+	n := messageOverheadTokens + estimateTokens(m.Content)
+	for _, p := range m.Parts {
+		if p.Type == "image" {
+			n += imageTokens
+		}
+	}
+	for _, tc := range m.ToolCalls {
+		args, _ := json.Marshal(tc.Arguments)
+		n += estimateTokens(tc.Name) + estimateTokens(string(args))
+	}
+	return n
+}
+
+// toolSchemaTokens estimates what the tool definitions sent with every
+// request cost.
+func toolSchemaTokens(tools []Tool) int {
+	n := 0
+	for _, t := range tools {
+		schema, _ := json.Marshal(t.Schema)
+		n += messageOverheadTokens + estimateTokens(t.Name) + estimateTokens(t.Description) + estimateTokens(string(schema))
+	}
+	return n
+}
+
+// ContextWindow is the number of tokens the model accepts per request,
+// prompt and reply together.
+func (c *LLMClient) ContextWindow() int {
+	if c == nil || c.contextWindow <= 0 {
+		return defaultContextWindow
+	}
+	return c.contextWindow
+}
+
+// fitContext drops the oldest turns of msgs until the request fits in window
+// tokens, leaving replyTokens for the answer. The leading system messages,
+// which carry the memories, notes and conversation summary, are always kept,
+// as are the tool schemas. A turn starts at a user message, so tool calls are
+// never separated from their results. The latest turn is kept even when it
+// alone is too big.
+func fitContext(msgs []LLMMessage, tools []Tool, window, replyTokens int) []LLMMessage {
+	budget := window - replyTokens - toolSchemaTokens(tools)
+	head := 0
+	for head < len(msgs) && msgs[head].Role == "system" {
+		budget -= messageTokens(msgs[head])
+		head++
+	}
+	if head == 0 || head == len(msgs) {
+		return msgs
+	}
+
+	// Turn boundaries, oldest first.
+	var starts []int
+	for i := head; i < len(msgs); i++ {
+		if i == head || msgs[i].Role == "user" {
+			starts = append(starts, i)
+		}
+	}
+
+	total := 0
+	for _, m := range msgs[head:] {
+		total += messageTokens(m)
+	}
+	if total <= budget {
+		return msgs
+	}
+
+	budget -= omittedNoteTokens
+	cut := len(msgs)
+	for t := len(starts) - 1; t >= 0; t-- {
+		end := len(msgs)
+		if t+1 < len(starts) {
+			end = starts[t+1]
+		}
+		turn := 0
+		for _, m := range msgs[starts[t]:end] {
+			turn += messageTokens(m)
+		}
+		if turn > budget && cut != len(msgs) {
+			break
+		}
+		budget -= turn
+		cut = starts[t]
+	}
+	if cut == head {
+		return msgs
+	}
+
+	out := make([]LLMMessage, 0, head+1+len(msgs)-cut)
+	out = append(out, msgs[:head]...)
+	out = append(out, LLMMessage{
+		Role:    "system",
+		Content: fmt.Sprintf("%d earlier messages of this conversation were left out to fit the context window.", cut-head),
+	})
+	return append(out, msgs[cut:]...)
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFitContext(t *testing.T) {
+	long := strings.Repeat("word ", 400) // ~500 tokens
+	msgs := []LLMMessage{
+		{Role: "system", Content: "You are helpful."},
+		{Role: "user", Content: long},
+		{Role: "assistant", Content: long},
+		{Role: "user", Content: "look it up"},
+		{Role: "assistant", ToolCalls: []LLMToolCall{{ID: "tu_1", Name: "search", Arguments: map[string]any{"q": "x"}}}},
+		{Role: "tool", ToolCallID: "tu_1", Content: long},
+		{Role: "assistant", Content: "found it"},
+		{Role: "user", Content: "thanks"},
+	}
+
+	if got := fitContext(msgs, nil, 100000, 1000); len(got) != len(msgs) {
+		t.Fatalf("history that fits was trimmed to %d messages", len(got))
+	}
+
+	got := fitContext(msgs, nil, 1800, 1000)
+	if got[0].Content != msgs[0].Content || !strings.Contains(got[1].Content, "2 earlier messages") {
+		t.Fatalf("system prompt or omission note missing: %+v", got[:2])
+	}
+	if got[2].Role != "user" || got[2].Content != "look it up" || got[4].Role != "tool" {
+		t.Errorf("dropped the wrong turns: %+v", got[2:])
+	}
+
+	// Tool schemas take their share of the window too.
+	tools := []Tool{{Name: "search", Description: long}}
+	got = fitContext(msgs, tools, 1800, 1000)
+	if len(got) != 3 || got[2].Content != "thanks" {
+		t.Errorf("with tool schemas kept %d messages: %+v", len(got), got)
+	}
+
+	// The latest turn survives even when it alone is over budget.
+	got = fitContext(msgs, nil, 10, 1000)
+	if last := got[len(got)-1]; last.Content != "thanks" {
+		t.Errorf("latest message dropped: %+v", got)
+	}
+}
@@ -3,12 +3,16 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
 	"time"
 
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/longregen/alicia/shared/db"
+	"github.com/longregen/alicia/shared/search"
 	"github.com/pgvector/pgvector-go"
 )
 
@@ -18,21 +22,36 @@ func ConnectDB(ctx context.Context, databaseURL string) (*pgxpool.Pool, error) {
 
 // --- Messages ---
 
+// LoadConversationChain loads the branch that ends at tipID by following
+// previous_id back to the root, oldest message first. Sibling branches left
+// behind by regenerate and edit are not included.
 // Avoids N+1 queries by batching tool uses and memories.
-func LoadConversationFull(ctx context.Context, pool *pgxpool.Pool, conversationID string) ([]Message, error) {
-	// Query 1: All messages
+func LoadConversationChain(ctx context.Context, pool *pgxpool.Pool, tipID string) ([]Message, error) {
+	// Query 1: The messages of the branch
 	rows, err := pool.Query(ctx, `
+		WITH RECURSIVE chain AS (
+			SELECT id, conversation_id, previous_id, branch_index, role, content, reasoning, status, 0 AS depth
+			FROM messages
+			WHERE id = $1 AND deleted_at IS NULL
+
+			UNION ALL
+
+			SELECT m.id, m.conversation_id, m.previous_id, m.branch_index, m.role, m.content, m.reasoning, m.status, c.depth + 1
+			FROM messages m
+			JOIN chain c ON m.id = c.previous_id
+			WHERE m.deleted_at IS NULL
+		)
 		SELECT id, conversation_id, previous_id, branch_index, role, content, reasoning, status
-		FROM messages
-		WHERE conversation_id = $1 AND deleted_at IS NULL
-		ORDER BY created_at
-	`, conversationID)
+		FROM chain
+		ORDER BY depth DESC
+	`, tipID)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
 	var messages []Message
+	var ids []string
 	msgIndex := make(map[string]int) // message ID -> index in slice
 	for rows.Next() {
 		var m Message
@@ -45,6 +64,7 @@ func LoadConversationFull(ctx context.Context, pool *pgxpool.Pool, conversationI
 		}
 		msgIndex[m.ID] = len(messages)
 		messages = append(messages, m)
+		ids = append(ids, m.ID)
 	}
 	if err := rows.Err(); err != nil {
 		return nil, err
@@ -54,14 +74,13 @@ func LoadConversationFull(ctx context.Context, pool *pgxpool.Pool, conversationI
 		return messages, nil
 	}
 
-	// Query 2: All tool uses for this conversation's messages
+	// Query 2: All tool uses for the branch's messages
 	tuRows, err := pool.Query(ctx, `
-		SELECT tu.id, tu.message_id, tu.tool_name, tu.arguments, tu.result, tu.status, tu.error
-		FROM tool_uses tu
-		JOIN messages m ON m.id = tu.message_id
-		WHERE m.conversation_id = $1 AND m.deleted_at IS NULL
-		ORDER BY tu.created_at
-	`, conversationID)
+		SELECT id, message_id, tool_name, arguments, result, status, error
+		FROM tool_uses
+		WHERE message_id = ANY($1)
+		ORDER BY created_at
+	`, ids)
 	if err != nil {
 		return nil, err
 	}
@@ -92,15 +111,14 @@ func LoadConversationFull(ctx context.Context, pool *pgxpool.Pool, conversationI
 		return nil, err
 	}
 
-	// Query 3: All memories used for this conversation's messages
+	// Query 3: All memories used for the branch's messages
 	memRows, err := pool.Query(ctx, `
 		SELECT mu.message_id, mem.id, mem.content, mu.similarity
 		FROM memory_uses mu
 		JOIN memories mem ON mem.id = mu.memory_id
-		JOIN messages m ON m.id = mu.message_id
-		WHERE m.conversation_id = $1 AND m.deleted_at IS NULL AND mem.deleted_at IS NULL
+		WHERE mu.message_id = ANY($1) AND mem.deleted_at IS NULL
 		ORDER BY mu.similarity DESC
-	`, conversationID)
+	`, ids)
 	if err != nil {
 		return nil, err
 	}
@@ -145,6 +163,14 @@ func GetConversationIDForMessage(ctx context.Context, pool *pgxpool.Pool, messag
 	return convID, err
 }
 
+func GetConversationOwner(ctx context.Context, pool *pgxpool.Pool, conversationID string) (string, error) {
+	var userID string
+	err := pool.QueryRow(ctx, `
+		SELECT user_id FROM conversations WHERE id = $1
+	`, conversationID).Scan(&userID)
+	return userID, err
+}
+
 func GetPreviousUserMessage(ctx context.Context, pool *pgxpool.Pool, assistantMessageID string) (*Message, error) {
 	msg, err := GetMessage(ctx, pool, assistantMessageID)
 	if err != nil {
@@ -225,19 +251,41 @@ func SaveToolUse(ctx context.Context, pool *pgxpool.Pool, messageID string, tu T
 	return err
 }
 
+// SaveToolAttachments stores the images of a tool result apart from the tool
+// use and records their attachment IDs in the parts, so that the stored
+// result only references them.
+func SaveToolAttachments(ctx context.Context, pool *pgxpool.Pool, toolUseID string, content *ToolContent) error {
+	for i := range content.Parts {
+		p := &content.Parts[i]
+		if p.Type != "image" || len(p.Data) == 0 || p.AttachmentID != "" {
+			continue
+		}
+		id := NewAttachmentID()
+		_, err := pool.Exec(ctx, `
+			INSERT INTO tool_use_attachments (id, tool_use_id, mime_type, data, created_at)
+			VALUES ($1, $2, $3, $4, NOW())
+		`, id, toolUseID, p.MimeType, p.Data)
+		if err != nil {
+			return fmt.Errorf("save tool attachment: %w", err)
+		}
+		p.AttachmentID = id
+	}
+	return nil
+}
+
 // --- Memories ---
 
-func SearchMemories(ctx context.Context, pool *pgxpool.Pool, embedding []float32, threshold float32, limit int) ([]Memory, error) {
+func SearchMemories(ctx context.Context, pool *pgxpool.Pool, userID string, embedding []float32, threshold float32, limit int) ([]Memory, error) {
 	vec := pgvector.NewVector(embedding)
 	rows, err := pool.Query(ctx, `
 		SELECT id, content, 1 - (embedding <=> $1) as similarity
 		FROM memories
-		WHERE deleted_at IS NULL AND archived = false
+		WHERE user_id = $4 AND deleted_at IS NULL AND archived = false
 		  AND embedding IS NOT NULL
 		  AND 1 - (embedding <=> $1) >= $2
 		ORDER BY embedding <=> $1
 		LIMIT $3
-	`, vec, threshold, limit)
+	`, vec, threshold, limit, userID)
 	if err != nil {
 		return nil, err
 	}
@@ -254,27 +302,378 @@ func SearchMemories(ctx context.Context, pool *pgxpool.Pool, embedding []float32
 	return memories, rows.Err()
 }
 
-func RecordMemoryUse(ctx context.Context, pool *pgxpool.Pool, id, memoryID, messageID, conversationID string, similarity float32) error {
+func RecordMemoryUse(ctx context.Context, pool *pgxpool.Pool, id, userID, memoryID, messageID, conversationID string, similarity float32) error {
 	_, err := pool.Exec(ctx, `
-		INSERT INTO memory_uses (id, memory_id, message_id, conversation_id, similarity, created_at)
-		VALUES ($1, $2, $3, $4, $5, NOW())
-	`, id, memoryID, messageID, conversationID, similarity)
+		INSERT INTO memory_uses (id, user_id, memory_id, message_id, conversation_id, similarity, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, NOW())
+	`, id, userID, memoryID, messageID, conversationID, similarity)
 	return err
 }
 
-func CreateMemory(ctx context.Context, pool *pgxpool.Pool, id, content string, embedding []float32, importance float32) error {
-	vec := pgvector.NewVector(embedding)
+// MemoryRatings are the 1-5 ratings a memory got on each evaluation
+// dimension. Zero means the dimension wasn't rated.
+type MemoryRatings struct {
+	Importance int
+	Historical int
+	Personal   int
+	Factual    int
+}
+
+func CreateMemory(ctx context.Context, pool *pgxpool.Pool, id, userID, content, sourceMsgID string, embedding Embedding, importance float32, ratings MemoryRatings) error {
 	_, err := pool.Exec(ctx, `
-		INSERT INTO memories (id, content, embedding, importance, pinned, archived, tags, created_at, updated_at)
-		VALUES ($1, $2, $3, $4, false, false, '{}', NOW(), NOW())
-	`, id, content, vec, importance)
+		INSERT INTO memories (id, user_id, content, embedding, embedding_model, importance, pinned, archived, source_msg_id, tags,
+			importance_rating, historical_rating, personal_rating, factual_rating, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $11, $5, false, false, $6, '{}', $7, $8, $9, $10, NOW(), NOW())
+	`, id, userID, content, nilIfNoVector(embedding.Vector), importance, nilIfEmpty(sourceMsgID),
+		nilIfZero(ratings.Importance), nilIfZero(ratings.Historical), nilIfZero(ratings.Personal), nilIfZero(ratings.Factual),
+		embedding.Model)
+	return err
+}
+
+// ReviseMemory replaces a memory's content and embedding, keeping the old
+// content in memory_versions. change says what replaced it (see the
+// memory_versions table) and generationID which extraction did, if any.
+func ReviseMemory(ctx context.Context, pool *pgxpool.Pool, id, userID, content string, embedding Embedding, change, generationID string) error {
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := reviseMemory(ctx, tx, id, userID, content, embedding, change, generationID); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// MergeMemories folds the memories in mergedIDs into keepID: keepID is
+// revised to content and the others are archived as superseded by it.
+func MergeMemories(ctx context.Context, pool *pgxpool.Pool, keepID string, mergedIDs []string, userID, content string, embedding Embedding, generationID string) error {
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := reviseMemory(ctx, tx, keepID, userID, content, embedding, "merge", generationID); err != nil {
+		return err
+	}
+	if err := supersedeMemories(ctx, tx, userID, mergedIDs, keepID); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// SupersedeMemories archives the memories in ids, pointing them at the
+// memory that replaces them.
+func SupersedeMemories(ctx context.Context, pool *pgxpool.Pool, userID string, ids []string, newID string) error {
+	return supersedeMemories(ctx, pool, userID, ids, newID)
+}
+
+func reviseMemory(ctx context.Context, tx pgx.Tx, id, userID, content string, embedding Embedding, change, generationID string) error {
+	tag, err := tx.Exec(ctx, `
+		INSERT INTO memory_versions (id, memory_id, version, content, change, generation_id, created_at)
+		SELECT $1, id, version, content, $4, $5, NOW()
+		FROM memories
+		WHERE id = $2 AND user_id = $3 AND deleted_at IS NULL
+	`, NewMemoryVersionID(), id, userID, change, nilIfEmpty(generationID))
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("memory %s not found", id)
+	}
+	_, err = tx.Exec(ctx, `
+		UPDATE memories SET content = $3, embedding = $4, embedding_model = $5, version = version + 1, updated_at = NOW()
+		WHERE id = $1 AND user_id = $2
+	`, id, userID, content, nilIfNoVector(embedding.Vector), embedding.Model)
+	return err
+}
+
+// DeleteMemory soft-deletes the user's memory, recording why.
+func DeleteMemory(ctx context.Context, pool *pgxpool.Pool, id, userID, reason string) error {
+	tag, err := pool.Exec(ctx, `
+		UPDATE memories SET deleted_at = NOW(), deleted_reason = $3
+		WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL
+	`, id, userID, nilIfEmpty(reason))
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("memory %s not found", id)
+	}
+	return nil
+}
+
+// execer is satisfied by both the pool and a transaction.
+type execer interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+}
+
+func supersedeMemories(ctx context.Context, db execer, userID string, ids []string, newID string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	_, err := db.Exec(ctx, `
+		UPDATE memories SET archived = true, superseded_by = $3, updated_at = NOW()
+		WHERE id = ANY($2) AND user_id = $1 AND id <> $3 AND deleted_at IS NULL
+	`, userID, ids, newID)
+	return err
+}
+
+// MemoryQuery selects the memories offered to the model for a request.
+// Nil minimums don't filter; memories without a rating pass every filter.
+type MemoryQuery struct {
+	Text          string // the request, for keyword matching
+	MinSimilarity float32
+	MinImportance *int
+	MinHistorical *int
+	MinPersonal   *int
+	MinFactual    *int
+	Limit         int // unpinned candidates to fetch from each ranking
+}
+
+// memoryCandidateFilter restricts a hybrid search ranking to the unpinned
+// memories that pass the rating filters of a MemoryQuery.
+const memoryCandidateFilter = `
+	user_id = $2 AND deleted_at IS NULL AND archived = false AND pinned = false
+	AND ($4::int IS NULL OR importance_rating IS NULL OR importance_rating >= $4)
+	AND ($5::int IS NULL OR historical_rating IS NULL OR historical_rating >= $5)
+	AND ($6::int IS NULL OR personal_rating IS NULL OR personal_rating >= $6)
+	AND ($7::int IS NULL OR factual_rating IS NULL OR factual_rating >= $7)`
+
+// LoadMemoryCandidates returns all of the user's pinned memories, whatever
+// their similarity or ratings, and the unpinned memories that pass the
+// query's filters and rank in the top Limit by similarity or by keyword
+// match. Each memory carries its rank in both; see search.Weights. Without
+// an embedding only keywords are matched.
+func LoadMemoryCandidates(ctx context.Context, pool *pgxpool.Pool, userID string, embedding []float32, q MemoryQuery) ([]Memory, error) {
+	var vec any
+	if len(embedding) > 0 {
+		vec = pgvector.NewVector(embedding)
+	}
+	rows, err := pool.Query(ctx, `
+		WITH by_vector AS (
+			SELECT id, row_number() OVER (ORDER BY embedding <=> $1) AS rank
+			FROM memories
+			WHERE `+memoryCandidateFilter+`
+			  AND $1::vector IS NOT NULL AND embedding IS NOT NULL
+			  AND 1 - (embedding <=> $1) >= $3
+			ORDER BY embedding <=> $1
+			LIMIT $8
+		), by_keyword AS (
+			SELECT id, row_number() OVER (ORDER BY ts_rank_cd(search_vector, query) DESC) AS rank
+			FROM memories, to_tsquery('english', $9) query
+			WHERE `+memoryCandidateFilter+`
+			  AND search_vector @@ query
+			ORDER BY ts_rank_cd(search_vector, query) DESC
+			LIMIT $8
+		)
+		SELECT m.id, m.content, COALESCE(1 - (m.embedding <=> $1), 0), m.importance, m.pinned, m.created_at,
+		       COALESCE(v.rank, 0), COALESCE(k.rank, 0)
+		FROM memories m
+		LEFT JOIN by_vector v ON v.id = m.id
+		LEFT JOIN by_keyword k ON k.id = m.id
+		WHERE m.user_id = $2 AND m.deleted_at IS NULL AND m.archived = false
+		  AND (m.pinned OR v.id IS NOT NULL OR k.id IS NOT NULL)
+	`, vec, userID, q.MinSimilarity, q.MinImportance, q.MinHistorical, q.MinPersonal, q.MinFactual, q.Limit, search.Query(q.Text))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var memories []Memory
+	for rows.Next() {
+		var m Memory
+		if err := rows.Scan(&m.ID, &m.Content, &m.Similarity, &m.Importance, &m.Pinned, &m.CreatedAt,
+			&m.VectorRank, &m.KeywordRank); err != nil {
+			return nil, err
+		}
+		memories = append(memories, m)
+	}
+	return memories, rows.Err()
+}
+
+// --- Memory Maintenance ---
+
+// MemoryUsage is what the maintenance job knows about an unpinned memory:
+// how often it was retrieved and how users rated those retrievals.
+type MemoryUsage struct {
+	ID             string
+	UserID         string
+	Importance     float32
+	CreatedAt      time.Time
+	DecayedAt      *time.Time
+	Uses           int
+	LastUsedAt     *time.Time
+	Upvotes        int
+	Downvotes      int
+	LastDownvoteAt *time.Time
+}
+
+// LoadMemoryUsage returns the usage of every active unpinned memory.
+func LoadMemoryUsage(ctx context.Context, pool *pgxpool.Pool) ([]MemoryUsage, error) {
+	rows, err := pool.Query(ctx, `
+		SELECT m.id, m.user_id, m.importance, m.created_at, m.decayed_at,
+		       COUNT(DISTINCT u.id), MAX(u.created_at),
+		       COUNT(f.id) FILTER (WHERE f.rating > 0),
+		       COUNT(f.id) FILTER (WHERE f.rating < 0),
+		       MAX(f.created_at) FILTER (WHERE f.rating < 0)
+		FROM memories m
+		LEFT JOIN memory_uses u ON u.memory_id = m.id
+		LEFT JOIN memory_use_feedback f ON f.memory_use_id = u.id
+		WHERE m.deleted_at IS NULL AND m.archived = false AND m.pinned = false
+		GROUP BY m.id
+		ORDER BY m.user_id, m.created_at
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var usage []MemoryUsage
+	for rows.Next() {
+		var u MemoryUsage
+		if err := rows.Scan(&u.ID, &u.UserID, &u.Importance, &u.CreatedAt, &u.DecayedAt,
+			&u.Uses, &u.LastUsedAt, &u.Upvotes, &u.Downvotes, &u.LastDownvoteAt); err != nil {
+			return nil, err
+		}
+		usage = append(usage, u)
+	}
+	return usage, rows.Err()
+}
+
+// MemoryPair is two of a user's active memories and how similar they are.
+type MemoryPair struct {
+	UserID     string
+	A, B       string
+	Similarity float32
+}
+
+// LoadSimilarMemoryPairs pairs every active memory with those of its
+// nearest neighbours, up to neighbours of them, that are at least
+// minSimilarity similar. Each pair may be returned in both orders.
+func LoadSimilarMemoryPairs(ctx context.Context, pool *pgxpool.Pool, minSimilarity float32, neighbours int) ([]MemoryPair, error) {
+	rows, err := pool.Query(ctx, `
+		SELECT a.user_id, a.id, n.id, n.similarity
+		FROM memories a
+		CROSS JOIN LATERAL (
+			SELECT b.id, 1 - (b.embedding <=> a.embedding) AS similarity
+			FROM memories b
+			WHERE b.user_id = a.user_id AND b.id <> a.id
+			  AND b.deleted_at IS NULL AND b.archived = false AND b.embedding IS NOT NULL
+			ORDER BY b.embedding <=> a.embedding
+			LIMIT $2
+		) n
+		WHERE a.deleted_at IS NULL AND a.archived = false AND a.embedding IS NOT NULL
+		  AND n.similarity >= $1
+	`, minSimilarity, neighbours)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var pairs []MemoryPair
+	for rows.Next() {
+		var p MemoryPair
+		if err := rows.Scan(&p.UserID, &p.A, &p.B, &p.Similarity); err != nil {
+			return nil, err
+		}
+		pairs = append(pairs, p)
+	}
+	return pairs, rows.Err()
+}
+
+// LoadMemoriesByID returns the user's active memories with the given ids.
+func LoadMemoriesByID(ctx context.Context, pool *pgxpool.Pool, userID string, ids []string) ([]Memory, error) {
+	rows, err := pool.Query(ctx, `
+		SELECT id, content, importance, pinned, created_at
+		FROM memories
+		WHERE id = ANY($1) AND user_id = $2 AND deleted_at IS NULL AND archived = false
+		ORDER BY created_at
+	`, ids, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var memories []Memory
+	for rows.Next() {
+		var m Memory
+		if err := rows.Scan(&m.ID, &m.Content, &m.Importance, &m.Pinned, &m.CreatedAt); err != nil {
+			return nil, err
+		}
+		memories = append(memories, m)
+	}
+	return memories, rows.Err()
+}
+
+// ApplyMemoryDecay lowers the importance of decayed memories and archives
+// the archived ones, in one transaction. Pinned memories are never touched,
+// even if they were pinned since the plan was made.
+func ApplyMemoryDecay(ctx context.Context, pool *pgxpool.Pool, decayed []MemoryDecay, archived []MemoryArchive) error {
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	for _, d := range decayed {
+		if _, err := tx.Exec(ctx, `
+			UPDATE memories SET importance = $2, decayed_at = NOW()
+			WHERE id = $1 AND pinned = false AND deleted_at IS NULL
+		`, d.MemoryID, d.After); err != nil {
+			return err
+		}
+	}
+	if len(archived) > 0 {
+		ids := make([]string, len(archived))
+		for i, a := range archived {
+			ids[i] = a.MemoryID
+		}
+		if _, err := tx.Exec(ctx, `
+			UPDATE memories SET archived = true, updated_at = NOW()
+			WHERE id = ANY($1) AND pinned = false AND deleted_at IS NULL
+		`, ids); err != nil {
+			return err
+		}
+	}
+	return tx.Commit(ctx)
+}
+
+func CreateMaintenanceRun(ctx context.Context, pool *pgxpool.Pool, r *MaintenanceReport) error {
+	report, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	merged := 0
+	for _, c := range r.Clusters {
+		if c.MergedContent != "" {
+			merged++
+		}
+	}
+	_, err = pool.Exec(ctx, `
+		INSERT INTO memory_maintenance_runs (id, dry_run, decayed, archived, clusters, merged, report, started_at, finished_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+	`, r.ID, r.DryRun, len(r.Decayed), len(r.Archived), len(r.Clusters), merged, report, r.StartedAt, r.FinishedAt)
 	return err
 }
 
+// LastMaintenanceRun returns when the last run with the given dry-run mode
+// finished, or nil if there was none.
+func LastMaintenanceRun(ctx context.Context, pool *pgxpool.Pool, dryRun bool) (*time.Time, error) {
+	var finished *time.Time
+	err := pool.QueryRow(ctx, `
+		SELECT MAX(finished_at) FROM memory_maintenance_runs WHERE dry_run = $1
+	`, dryRun).Scan(&finished)
+	return finished, err
+}
+
 // --- Memory Generations ---
 
 type MemoryGeneration struct {
 	ID                      string
+	UserID                  string
 	ConversationID          string
 	MessageID               string
 	MemoryContent           string
@@ -301,38 +700,43 @@ type MemoryGeneration struct {
 	RerankPromptVersion     int
 	Accepted                bool
 	MemoryID                *string
+	TargetMemoryIDs         []string // existing memories the decision acted on
+	Source                  string   // extraction (the default) or tool
 }
 
 func CreateMemoryGeneration(ctx context.Context, pool *pgxpool.Pool, g MemoryGeneration) error {
+	if g.TargetMemoryIDs == nil {
+		g.TargetMemoryIDs = []string{}
+	}
 	_, err := pool.Exec(ctx, `
 		INSERT INTO memory_generations (
-			id, conversation_id, message_id, memory_content,
+			id, user_id, conversation_id, message_id, memory_content,
 			extract_prompt_name, extract_prompt_version,
 			importance_rating, importance_thinking, importance_prompt_name, importance_prompt_version,
 			historical_rating, historical_thinking, historical_prompt_name, historical_prompt_version,
 			personal_rating, personal_thinking, personal_prompt_name, personal_prompt_version,
 			factual_rating, factual_thinking, factual_prompt_name, factual_prompt_version,
 			rerank_decision, rerank_prompt_name, rerank_prompt_version,
-			accepted, memory_id
+			accepted, memory_id, target_memory_ids, source
 		) VALUES (
-			$1, $2, $3, $4,
-			$5, $6,
-			$7, $8, $9, $10,
-			$11, $12, $13, $14,
-			$15, $16, $17, $18,
-			$19, $20, $21, $22,
-			$23, $24, $25,
-			$26, $27
+			$1, $2, $3, $4, $5,
+			$6, $7,
+			$8, $9, $10, $11,
+			$12, $13, $14, $15,
+			$16, $17, $18, $19,
+			$20, $21, $22, $23,
+			$24, $25, $26,
+			$27, $28, $29, COALESCE($30, 'extraction')
 		)
 	`,
-		g.ID, g.ConversationID, g.MessageID, g.MemoryContent,
+		g.ID, g.UserID, g.ConversationID, g.MessageID, g.MemoryContent,
 		nilIfEmpty(g.ExtractPromptName), nilIfZero(g.ExtractPromptVersion),
 		g.ImportanceRating, nilIfEmpty(g.ImportanceThinking), nilIfEmpty(g.ImportancePromptName), nilIfZero(g.ImportancePromptVersion),
 		g.HistoricalRating, nilIfEmpty(g.HistoricalThinking), nilIfEmpty(g.HistoricalPromptName), nilIfZero(g.HistoricalPromptVersion),
 		g.PersonalRating, nilIfEmpty(g.PersonalThinking), nilIfEmpty(g.PersonalPromptName), nilIfZero(g.PersonalPromptVersion),
 		g.FactualRating, nilIfEmpty(g.FactualThinking), nilIfEmpty(g.FactualPromptName), nilIfZero(g.FactualPromptVersion),
 		nilIfEmpty(g.RerankDecision), nilIfEmpty(g.RerankPromptName), nilIfZero(g.RerankPromptVersion),
-		g.Accepted, g.MemoryID,
+		g.Accepted, g.MemoryID, g.TargetMemoryIDs, nilIfEmpty(g.Source),
 	)
 	return err
 }
@@ -354,22 +758,50 @@ func nilIfZero(i int) *int {
 // --- Notes ---
 
 type Note struct {
-	ID         string
-	Title      string
-	Content    string
-	Similarity float32
+	ID          string
+	Title       string
+	Content     string
+	Similarity  float32
+	VectorRank  int // 1-based rank by similarity, 0 if not ranked
+	KeywordRank int // 1-based rank by keyword match, 0 if not ranked
 }
 
-func SearchNotes(ctx context.Context, pool *pgxpool.Pool, userID string, embedding []float32, threshold float32, limit int) ([]Note, error) {
-	vec := pgvector.NewVector(embedding)
+// SearchNotes returns up to limit of the user's notes that best match the
+// request by hybrid search: notes at least threshold similar to embedding
+// and notes matching the words of text are ranked separately and the two
+// rankings fused with weights. Without an embedding only keywords are
+// matched.
+func SearchNotes(ctx context.Context, pool *pgxpool.Pool, userID, text string, embedding []float32, threshold float32, limit int, weights search.Weights) ([]Note, error) {
+	if limit <= 0 {
+		return nil, nil
+	}
+	var vec any
+	if len(embedding) > 0 {
+		vec = pgvector.NewVector(embedding)
+	}
 	rows, err := pool.Query(ctx, `
-		SELECT id, title, content, 1 - (embedding <=> $1) as similarity
-		FROM notes
-		WHERE user_id = $2 AND deleted_at IS NULL AND embedding IS NOT NULL
-		      AND 1 - (embedding <=> $1) >= $3
-		ORDER BY embedding <=> $1
-		LIMIT $4
-	`, vec, userID, threshold, limit)
+		WITH by_vector AS (
+			SELECT id, row_number() OVER (ORDER BY embedding <=> $1) AS rank
+			FROM notes
+			WHERE user_id = $2 AND deleted_at IS NULL
+			  AND $1::vector IS NOT NULL AND embedding IS NOT NULL
+			  AND 1 - (embedding <=> $1) >= $3
+			ORDER BY embedding <=> $1
+			LIMIT $4
+		), by_keyword AS (
+			SELECT id, row_number() OVER (ORDER BY ts_rank_cd(search_vector, query) DESC) AS rank
+			FROM notes, to_tsquery('english', $5) query
+			WHERE user_id = $2 AND deleted_at IS NULL AND search_vector @@ query
+			ORDER BY ts_rank_cd(search_vector, query) DESC
+			LIMIT $4
+		)
+		SELECT n.id, n.title, n.content, COALESCE(1 - (n.embedding <=> $1), 0),
+		       COALESCE(v.rank, 0), COALESCE(k.rank, 0)
+		FROM notes n
+		LEFT JOIN by_vector v ON v.id = n.id
+		LEFT JOIN by_keyword k ON k.id = n.id
+		WHERE v.id IS NOT NULL OR k.id IS NOT NULL
+	`, vec, userID, threshold, limit*noteCandidateFactor, search.Query(text))
 	if err != nil {
 		return nil, err
 	}
@@ -378,12 +810,75 @@ func SearchNotes(ctx context.Context, pool *pgxpool.Pool, userID string, embeddi
 	var notes []Note
 	for rows.Next() {
 		var n Note
-		if err := rows.Scan(&n.ID, &n.Title, &n.Content, &n.Similarity); err != nil {
+		if err := rows.Scan(&n.ID, &n.Title, &n.Content, &n.Similarity, &n.VectorRank, &n.KeywordRank); err != nil {
 			return nil, err
 		}
 		notes = append(notes, n)
 	}
-	return notes, rows.Err()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return rankNotes(notes, limit, weights), nil
+}
+
+// LoadNote returns the user's note with the given id.
+func LoadNote(ctx context.Context, pool *pgxpool.Pool, id, userID string) (Note, error) {
+	var n Note
+	err := pool.QueryRow(ctx, `
+		SELECT id, title, content FROM notes WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL
+	`, id, userID).Scan(&n.ID, &n.Title, &n.Content)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return n, fmt.Errorf("note %s not found", id)
+	}
+	return n, err
+}
+
+// CreateNote creates a note for the user, created from the message
+// sourceMsgID.
+func CreateNote(ctx context.Context, pool *pgxpool.Pool, id, userID, title, content, sourceMsgID string, embedding Embedding) error {
+	_, err := pool.Exec(ctx, `
+		INSERT INTO notes (id, user_id, title, content, embedding, embedding_model, source_msg_id, updated_msg_id, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $7, NOW(), NOW())
+	`, id, userID, title, content, nilIfNoVector(embedding.Vector), nilIfEmpty(embedding.Model), nilIfEmpty(sourceMsgID))
+	return err
+}
+
+// UpdateNote replaces the title and content of the user's note, changed by
+// the message msgID.
+func UpdateNote(ctx context.Context, pool *pgxpool.Pool, id, userID, title, content, msgID string, embedding Embedding) error {
+	tag, err := pool.Exec(ctx, `
+		UPDATE notes SET title = $3, content = $4, embedding = $5, embedding_model = $6, updated_msg_id = $7, updated_at = NOW()
+		WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL
+	`, id, userID, title, content, nilIfNoVector(embedding.Vector), nilIfEmpty(embedding.Model), nilIfEmpty(msgID))
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("note %s not found", id)
+	}
+	return nil
+}
+
+// DeleteNote soft-deletes the user's note, deleted by the message msgID.
+func DeleteNote(ctx context.Context, pool *pgxpool.Pool, id, userID, msgID string) error {
+	tag, err := pool.Exec(ctx, `
+		UPDATE notes SET deleted_at = NOW(), updated_msg_id = $3
+		WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL
+	`, id, userID, nilIfEmpty(msgID))
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("note %s not found", id)
+	}
+	return nil
+}
+
+func nilIfNoVector(v []float32) any {
+	if len(v) == 0 {
+		return nil
+	}
+	return pgvector.NewVector(v)
 }
 
 // --- Tools ---
@@ -435,21 +930,90 @@ func UpdateConversationTip(ctx context.Context, pool *pgxpool.Pool, conversation
 	return err
 }
 
+// --- Conversation Summaries ---
+
+type ConversationSummary struct {
+	ID             string
+	ConversationID string
+	MessageID      string // last message covered by the summary
+	Content        string
+	MessageCount   int
+	PromptName     string
+	PromptVersion  int
+}
+
+// LoadBranchSummary returns the valid summary that reaches furthest along the
+// branch, or nil when none of its messages has one.
+func LoadBranchSummary(ctx context.Context, pool *pgxpool.Pool, branch []Message) (*ConversationSummary, error) {
+	ids := make([]string, len(branch))
+	for i, m := range branch {
+		ids[i] = m.ID
+	}
+	var s ConversationSummary
+	err := pool.QueryRow(ctx, `
+		SELECT id, conversation_id, message_id, content, message_count
+		FROM conversation_summaries
+		WHERE message_id = ANY($1) AND invalidated_at IS NULL
+		ORDER BY message_count DESC, created_at DESC
+		LIMIT 1
+	`, ids).Scan(&s.ID, &s.ConversationID, &s.MessageID, &s.Content, &s.MessageCount)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+func CreateConversationSummary(ctx context.Context, pool *pgxpool.Pool, s ConversationSummary) error {
+	_, err := pool.Exec(ctx, `
+		INSERT INTO conversation_summaries (id, conversation_id, message_id, content, message_count, prompt_name, prompt_version, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, NOW())
+	`, s.ID, s.ConversationID, s.MessageID, s.Content, s.MessageCount, nilIfEmpty(s.PromptName), nilIfZero(s.PromptVersion))
+	return err
+}
+
+// InvalidateSummariesOffBranch invalidates the conversation's summaries whose
+// cut point is not on the branch ending at tipID. It returns how many were
+// invalidated.
+func InvalidateSummariesOffBranch(ctx context.Context, pool *pgxpool.Pool, conversationID, tipID string) (int64, error) {
+	tag, err := pool.Exec(ctx, `
+		WITH RECURSIVE chain AS (
+			SELECT id, previous_id FROM messages WHERE id = $2 AND deleted_at IS NULL
+			UNION ALL
+			SELECT m.id, m.previous_id FROM messages m JOIN chain c ON m.id = c.previous_id
+			WHERE m.deleted_at IS NULL
+		)
+		UPDATE conversation_summaries SET invalidated_at = NOW()
+		WHERE conversation_id = $1 AND invalidated_at IS NULL
+			AND message_id NOT IN (SELECT id FROM chain)
+	`, conversationID, tipID)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
 // --- MCP Servers ---
 
 type MCPServerConfig struct {
 	ID            string
 	Name          string
-	TransportType string // "stdio" or "sse"
+	TransportType string // "stdio", "sse" or "streamable-http"
 	Command       string
 	Args          []string
 	URL           string
+	Headers       map[string]string // sent with every request to remote servers
+	Limits        ToolLimits
+	ToolLimits    map[string]ToolLimits // per-tool overrides of Limits
 	Enabled       bool
 }
 
 func LoadEnabledMCPServers(ctx context.Context, pool *pgxpool.Pool) ([]MCPServerConfig, error) {
 	rows, err := pool.Query(ctx, `
-		SELECT id, name, transport_type, command, args, url, enabled
+		SELECT id, name, transport_type, command, args, url, headers,
+			timeout_seconds, max_result_bytes, result_policy, approval_policy, tool_limits, enabled
 		FROM mcp_servers
 		WHERE enabled = true AND deleted_at IS NULL
 		ORDER BY name
@@ -462,7 +1026,9 @@ func LoadEnabledMCPServers(ctx context.Context, pool *pgxpool.Pool) ([]MCPServer
 	var servers []MCPServerConfig
 	for rows.Next() {
 		var s MCPServerConfig
-		if err := rows.Scan(&s.ID, &s.Name, &s.TransportType, &s.Command, &s.Args, &s.URL, &s.Enabled); err != nil {
+		if err := rows.Scan(&s.ID, &s.Name, &s.TransportType, &s.Command, &s.Args, &s.URL, &s.Headers,
+			&s.Limits.TimeoutSeconds, &s.Limits.MaxResultBytes, &s.Limits.ResultPolicy, &s.Limits.ApprovalPolicy,
+			&s.ToolLimits, &s.Enabled); err != nil {
 			return nil, err
 		}
 		servers = append(servers, s)
@@ -470,3 +1036,234 @@ func LoadEnabledMCPServers(ctx context.Context, pool *pgxpool.Pool) ([]MCPServer
 	return servers, rows.Err()
 }
 
+
+// --- Embedding Models ---
+
+// EnsureActiveEmbeddingModel returns the active embedding model. If there is
+// none yet, model becomes active: the embeddings stored so far are taken to
+// be its and are stamped with it.
+func EnsureActiveEmbeddingModel(ctx context.Context, pool *pgxpool.Pool, model string) (string, error) {
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback(ctx)
+
+	tag, err := tx.Exec(ctx, `
+		INSERT INTO embedding_models (model, dims, status, activated_at)
+		SELECT $1, NULLIF(atttypmod, -1), 'active', NOW()
+		FROM pg_attribute
+		WHERE attrelid = 'memories'::regclass AND attname = 'embedding'
+		  AND NOT EXISTS (SELECT 1 FROM embedding_models WHERE status = 'active')
+		ON CONFLICT DO NOTHING
+	`, model)
+	if err != nil {
+		return "", err
+	}
+	if tag.RowsAffected() > 0 {
+		for _, table := range []string{"memories", "notes"} {
+			if _, err := tx.Exec(ctx, `
+				UPDATE `+table+` SET embedding_model = $1 WHERE embedding IS NOT NULL AND embedding_model IS NULL
+			`, model); err != nil {
+				return "", err
+			}
+		}
+	}
+
+	var active string
+	err = tx.QueryRow(ctx, `SELECT model FROM embedding_models WHERE status = 'active'`).Scan(&active)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", fmt.Errorf("no active embedding model, and %s is being backfilled: run the cutover", model)
+	}
+	if err != nil {
+		return "", err
+	}
+	return active, tx.Commit(ctx)
+}
+
+// ActiveEmbeddingModel returns the active embedding model and its dimension,
+// or "" if there is none.
+func ActiveEmbeddingModel(ctx context.Context, pool *pgxpool.Pool) (string, int, error) {
+	var model string
+	var dims *int
+	err := pool.QueryRow(ctx, `SELECT model, dims FROM embedding_models WHERE status = 'active'`).Scan(&model, &dims)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", 0, nil
+	}
+	if err != nil || dims == nil {
+		return model, 0, err
+	}
+	return model, *dims, nil
+}
+
+// RegisterEmbeddingModel records that model makes embeddings of dims
+// dimensions, and marks it as being backfilled unless it is active. It
+// fails if the model was recorded with another dimension.
+func RegisterEmbeddingModel(ctx context.Context, pool *pgxpool.Pool, model string, dims int) error {
+	var recorded int
+	err := pool.QueryRow(ctx, `
+		INSERT INTO embedding_models (model, dims, status)
+		VALUES ($1, $2, 'backfilling')
+		ON CONFLICT (model) DO UPDATE SET
+			dims = COALESCE(embedding_models.dims, EXCLUDED.dims),
+			status = CASE WHEN embedding_models.status = 'active' THEN 'active' ELSE 'backfilling' END
+		RETURNING dims
+	`, model, dims).Scan(&recorded)
+	if err != nil {
+		return err
+	}
+	if recorded != dims {
+		return fmt.Errorf("embedding model %s makes %d-dimensional embeddings, but was recorded with %d", model, dims, recorded)
+	}
+	return nil
+}
+
+// embeddedTable is a table whose rows are embedded, and the SQL expression
+// of the text that is embedded.
+type embeddedTable struct {
+	name string
+	text string
+}
+
+var (
+	memoriesTable = embeddedTable{name: "memories", text: "content"}
+	notesTable    = embeddedTable{name: "notes", text: "title || E'\\n' || content"}
+)
+
+// pendingFilter selects the rows of t that still need an embedding from
+// model ($1). Staged embeddings are compared when staging, the live ones
+// otherwise.
+func (t embeddedTable) pendingFilter(staging bool) string {
+	if staging {
+		return "deleted_at IS NULL AND content <> '' AND embedding_next_model IS DISTINCT FROM $1"
+	}
+	return "deleted_at IS NULL AND content <> '' AND (embedding IS NULL OR embedding_model IS DISTINCT FROM $1)"
+}
+
+// PendingEmbedding is a row that needs embedding, with its current text.
+type PendingEmbedding struct {
+	ID   string
+	Text string
+}
+
+// LoadPendingEmbeddings returns up to limit rows of t with ids after afterID
+// that still need an embedding from model, in id order.
+func LoadPendingEmbeddings(ctx context.Context, pool *pgxpool.Pool, t embeddedTable, model string, staging bool, afterID string, limit int) ([]PendingEmbedding, error) {
+	rows, err := pool.Query(ctx, `
+		SELECT id, `+t.text+`
+		FROM `+t.name+`
+		WHERE `+t.pendingFilter(staging)+` AND id > $2
+		ORDER BY id
+		LIMIT $3
+	`, model, afterID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var pending []PendingEmbedding
+	for rows.Next() {
+		var p PendingEmbedding
+		if err := rows.Scan(&p.ID, &p.Text); err != nil {
+			return nil, err
+		}
+		pending = append(pending, p)
+	}
+	return pending, rows.Err()
+}
+
+// rowQuerier is satisfied by both the pool and a transaction.
+type rowQuerier interface {
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+// CountPendingEmbeddings counts the rows of t that still need an embedding
+// from model.
+func CountPendingEmbeddings(ctx context.Context, q rowQuerier, t embeddedTable, model string, staging bool) (int, error) {
+	var n int
+	err := q.QueryRow(ctx, `SELECT COUNT(*) FROM `+t.name+` WHERE `+t.pendingFilter(staging), model).Scan(&n)
+	return n, err
+}
+
+// StoreEmbedding saves the embedding of a row, staged or live, provided the
+// row still has text. It reports whether the row was updated.
+func StoreEmbedding(ctx context.Context, pool *pgxpool.Pool, t embeddedTable, id, text string, embedding Embedding, staging bool) (bool, error) {
+	set := "embedding = $2, embedding_model = $3"
+	if staging {
+		set = "embedding_next = $2, embedding_next_model = $3"
+	}
+	tag, err := pool.Exec(ctx, `
+		UPDATE `+t.name+` SET `+set+` WHERE id = $1 AND `+t.text+` = $4
+	`, id, pgvector.NewVector(embedding.Vector), embedding.Model, text)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+// CutoverEmbeddingModel makes model, whose embeddings have been backfilled
+// into the staging columns, the active model. In one transaction the staged
+// embeddings replace the live ones, the embedding columns and their indexes
+// are rebuilt for the new dimension and the old model is retired, so search
+// never sees a mix of the two. Writes to memories and notes wait for it.
+func CutoverEmbeddingModel(ctx context.Context, pool *pgxpool.Pool, model string) error {
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, `LOCK TABLE memories, notes IN SHARE ROW EXCLUSIVE MODE`); err != nil {
+		return err
+	}
+
+	var status string
+	var dims *int
+	err = tx.QueryRow(ctx, `SELECT status, dims FROM embedding_models WHERE model = $1 FOR UPDATE`, model).Scan(&status, &dims)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return fmt.Errorf("embedding model %s has not been backfilled", model)
+	}
+	if err != nil {
+		return err
+	}
+	if status != "backfilling" || dims == nil {
+		return fmt.Errorf("embedding model %s is %s, not backfilled", model, status)
+	}
+
+	for _, t := range []embeddedTable{memoriesTable, notesTable} {
+		n, err := CountPendingEmbeddings(ctx, tx, t, model, true)
+		if err != nil {
+			return err
+		}
+		if n > 0 {
+			return fmt.Errorf("%d %s still need embedding with %s; run the backfill again", n, t.name, model)
+		}
+	}
+
+	for _, t := range []embeddedTable{memoriesTable, notesTable} {
+		// Changing the column type rebuilds its vector index too.
+		if _, err := tx.Exec(ctx, fmt.Sprintf(`
+			ALTER TABLE %s ALTER COLUMN embedding TYPE vector(%d) USING embedding_next::vector(%d)
+		`, t.name, *dims, *dims)); err != nil {
+			return fmt.Errorf("switch %s embeddings: %w", t.name, err)
+		}
+		if _, err := tx.Exec(ctx, `
+			UPDATE `+t.name+` SET embedding_model = embedding_next_model, embedding_next = NULL, embedding_next_model = NULL
+			WHERE embedding_next_model IS NOT NULL OR embedding_model IS NOT NULL
+		`); err != nil {
+			return fmt.Errorf("switch %s embedding models: %w", t.name, err)
+		}
+	}
+
+	if _, err := tx.Exec(ctx, `
+		UPDATE embedding_models SET status = 'retired' WHERE status = 'active'
+	`); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, `
+		UPDATE embedding_models SET status = 'active', activated_at = NOW() WHERE model = $1
+	`, model); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
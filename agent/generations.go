@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// errUserCancelled is the cause a generation is cancelled with when the user
+// stops it. Anything else that cancels it, like the agent's connection
+// dropping, isn't a stop: the server hands the job to another worker.
+var errUserCancelled = errors.New("generation cancelled by the user")
+
+// generation is a single in-flight request handled by the agent.
+type generation struct {
+	cancel context.CancelCauseFunc
+	convID string
+	keys   []string
+}
+
+type generationCtxKey struct{}
+
+// GenerationRegistry keeps the cancel function of every in-flight generation,
+// indexed by the message IDs it is known under, so that a GenerationCancel
+// from a client can abort LLM calls, tool calls and Pareto branches.
+type GenerationRegistry struct {
+	mu     sync.Mutex
+	byMsg  map[string]*generation
+	byConv map[string]map[*generation]struct{}
+}
+
+func NewGenerationRegistry() *GenerationRegistry {
+	return &GenerationRegistry{
+		byMsg:  make(map[string]*generation),
+		byConv: make(map[string]map[*generation]struct{}),
+	}
+}
+
+// Start registers a cancellable generation for the request message and returns
+// its context. The returned function must be called when the generation ends.
+func (r *GenerationRegistry) Start(parent context.Context, convID, msgID string) (context.Context, func()) {
+	ctx, cancel := context.WithCancelCause(parent)
+	g := &generation{cancel: cancel, convID: convID}
+	ctx = context.WithValue(ctx, generationCtxKey{}, g)
+
+	r.mu.Lock()
+	if r.byConv[convID] == nil {
+		r.byConv[convID] = make(map[*generation]struct{})
+	}
+	r.byConv[convID][g] = struct{}{}
+	r.mu.Unlock()
+	r.Track(ctx, msgID)
+
+	return ctx, func() {
+		cancel(nil)
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		for _, key := range g.keys {
+			if r.byMsg[key] == g {
+				delete(r.byMsg, key)
+			}
+		}
+		if subs := r.byConv[convID]; subs != nil {
+			delete(subs, g)
+			if len(subs) == 0 {
+				delete(r.byConv, convID)
+			}
+		}
+	}
+}
+
+// Track makes the generation running in ctx cancellable by an additional
+// message ID, typically the assistant message once it has been created.
+func (r *GenerationRegistry) Track(ctx context.Context, msgID string) {
+	if r == nil || msgID == "" {
+		return
+	}
+	g, ok := ctx.Value(generationCtxKey{}).(*generation)
+	if !ok {
+		return
+	}
+	r.mu.Lock()
+	r.byMsg[msgID] = g
+	g.keys = append(g.keys, msgID)
+	r.mu.Unlock()
+}
+
+// Cancel stops the generation known under msgID, or every generation in the
+// conversation when msgID is empty. It reports whether anything was cancelled.
+func (r *GenerationRegistry) Cancel(convID, msgID string) bool {
+	r.mu.Lock()
+	var targets []*generation
+	if msgID != "" {
+		if g, ok := r.byMsg[msgID]; ok && (convID == "" || g.convID == convID) {
+			targets = append(targets, g)
+		}
+	} else {
+		for g := range r.byConv[convID] {
+			targets = append(targets, g)
+		}
+	}
+	r.mu.Unlock()
+
+	for _, g := range targets {
+		g.cancel(errUserCancelled)
+	}
+	return len(targets) > 0
+}
+
+// isCancelled reports whether the generation in ctx was stopped by the user, as
+// opposed to failing on its own or losing the connection.
+func isCancelled(ctx context.Context) bool {
+	_, tracked := ctx.Value(generationCtxKey{}).(*generation)
+	return tracked && errors.Is(context.Cause(ctx), errUserCancelled)
+}
+
+// finishCancelled persists whatever was generated before the user stopped the
+// response and tells clients the message ended early.
+func finishCancelled(ctx context.Context, deps AgentDeps, msgID, content, reasoning string) error {
+	saveCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 10*time.Second)
+	defer cancel()
+
+	if err := UpdateMessage(saveCtx, deps.DB, msgID, content, reasoning, "cancelled"); err != nil {
+		deps.Notifier.SendError(saveCtx, msgID, err)
+		return err
+	}
+	deps.Notifier.SendCancelled(saveCtx, msgID, content)
+	slog.InfoContext(saveCtx, "response cancelled", "message_id", msgID, "content_length", len(content))
+	return nil
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestIsCancelled(t *testing.T) {
+	r := NewGenerationRegistry()
+
+	// Stopped by the user, also as seen from a call's own context.
+	ctx, done := r.Start(context.Background(), "conv_1", "msg_1")
+	defer done()
+	callCtx, cancelCall := context.WithTimeout(ctx, time.Minute)
+	defer cancelCall()
+	if isCancelled(ctx) {
+		t.Fatal("running generation counts as cancelled")
+	}
+	if !r.Cancel("conv_1", "msg_1") {
+		t.Fatal("generation was not cancelled")
+	}
+	if !isCancelled(ctx) || !isCancelled(callCtx) {
+		t.Error("user cancel is not reported as cancelled")
+	}
+
+	// The agent's connection dropping is not a stop.
+	connCtx, dropConn := context.WithCancel(context.Background())
+	ctx, done = r.Start(connCtx, "conv_1", "msg_2")
+	defer done()
+	dropConn()
+	if ctx.Err() == nil {
+		t.Fatal("generation outlived its connection")
+	}
+	if isCancelled(ctx) {
+		t.Error("dropped connection is reported as a user cancel")
+	}
+}
@@ -22,4 +22,10 @@ var (
 	NewToolUseID          = id.NewToolUse
 	NewMemoryTraceID      = id.NewMemoryTrace
 	NewMemoryGenerationID = id.NewMemoryGeneration
+	NewMemoryVersionID    = id.NewMemoryVersion
+	NewSentenceID         = id.NewSentence
+	NewAttachmentID       = id.NewToolUseAttachment
+	NewSummaryID          = id.NewSummary
+	NewMaintenanceRunID   = id.NewMaintenanceRun
+	NewNoteID             = id.NewNote
 )
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// jobHeartbeatInterval is how often the worker tells the server it is still
+// working on its jobs; well within the server's 30 second lease.
+const jobHeartbeatInterval = 10 * time.Second
+
+// activeJobs are the queue jobs this worker is running.
+type activeJobs struct {
+	mu  sync.Mutex
+	ids map[string]struct{}
+}
+
+func newActiveJobs() *activeJobs {
+	return &activeJobs{ids: make(map[string]struct{})}
+}
+
+func (a *activeJobs) Add(id string) {
+	a.mu.Lock()
+	a.ids[id] = struct{}{}
+	a.mu.Unlock()
+}
+
+func (a *activeJobs) Remove(id string) {
+	a.mu.Lock()
+	delete(a.ids, id)
+	a.mu.Unlock()
+}
+
+// IDs returns the running jobs' IDs in order.
+func (a *activeJobs) IDs() []string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	ids := make([]string, 0, len(a.ids))
+	for id := range a.ids {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// runJobHeartbeats keeps the leases of the running jobs alive until ctx is
+// done. A job that stops being heartbeated goes back to the queue.
+func runJobHeartbeats(ctx context.Context, n *WSNotifier, jobs *activeJobs) {
+	ticker := time.NewTicker(jobHeartbeatInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if ids := jobs.IDs(); len(ids) > 0 {
+				n.SendJobHeartbeat(ctx, ids)
+			}
+		}
+	}
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestActiveJobs(t *testing.T) {
+	jobs := newActiveJobs()
+	if ids := jobs.IDs(); len(ids) != 0 {
+		t.Fatalf("expected no jobs, got %v", ids)
+	}
+
+	jobs.Add("job_b")
+	jobs.Add("job_a")
+	jobs.Add("job_b")
+	if ids := jobs.IDs(); !slices.Equal(ids, []string{"job_a", "job_b"}) {
+		t.Errorf("got %v, want [job_a job_b]", ids)
+	}
+
+	jobs.Remove("job_b")
+	jobs.Remove("job_missing")
+	if ids := jobs.IDs(); !slices.Equal(ids, []string{"job_a"}) {
+		t.Errorf("got %v, want [job_a]", ids)
+	}
+}
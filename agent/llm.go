@@ -2,9 +2,14 @@ package main
 
 import (
 	"context"
+	"encoding/base64"
+	"errors"
 	"fmt"
+	"io"
 	"log/slog"
 	"net/http"
+	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/longregen/alicia/pkg/otel"
@@ -19,8 +24,10 @@ type LLMClient struct {
 	baseURL        string
 	apiKey         string
 	model          string
-	embeddingModel string
+	embeddingModel atomic.Pointer[string] // see EmbeddingModel
 	maxTokens      int
+	vision         bool // the model accepts image parts
+	contextWindow  int  // tokens per request; see ContextWindow
 }
 
 func NewLLMClient(baseURL, apiKey, model, embeddingModel string, maxTokens int) *LLMClient {
@@ -30,14 +37,15 @@ func NewLLMClient(baseURL, apiKey, model, embeddingModel string, maxTokens int)
 		llm.WithMaxTokens(maxTokens),
 		llm.WithTransport(otel.NewLangfuseTransport(http.DefaultTransport)),
 	)
-	return &LLMClient{
-		client:         client,
-		baseURL:        baseURL,
-		apiKey:         apiKey,
-		model:          model,
-		embeddingModel: embeddingModel,
-		maxTokens:      maxTokens,
+	c := &LLMClient{
+		client:    client,
+		baseURL:   baseURL,
+		apiKey:    apiKey,
+		model:     model,
+		maxTokens: maxTokens,
 	}
+	c.SetEmbeddingModel(embeddingModel)
+	return c
 }
 
 type ChatOptions struct {
@@ -52,10 +60,40 @@ type ChatOptions struct {
 
 func float32Ptr(f float32) *float32 { return &f }
 
-func (c *LLMClient) ChatWithOptions(ctx context.Context, messages []LLMMessage, tools []Tool, opts ChatOptions) (*LLMResponse, error) {
+// SupportsVision reports whether messages may carry images for this model.
+func (c *LLMClient) SupportsVision() bool {
+	return c != nil && c.vision
+}
+
+// chatMessageParts maps content parts to OpenAI parts, sending images inline
+// as data URLs.
+func chatMessageParts(parts []ContentPart) []openai.ChatMessagePart {
+	out := make([]openai.ChatMessagePart, 0, len(parts))
+	for _, p := range parts {
+		switch p.Type {
+		case "image":
+			out = append(out, openai.ChatMessagePart{
+				Type: openai.ChatMessagePartTypeImageURL,
+				ImageURL: &openai.ChatMessageImageURL{
+					URL:    "data:" + p.MimeType + ";base64," + base64.StdEncoding.EncodeToString(p.Data),
+					Detail: openai.ImageURLDetailAuto,
+				},
+			})
+		default:
+			out = append(out, openai.ChatMessagePart{Type: openai.ChatMessagePartTypeText, Text: p.Text})
+		}
+	}
+	return out
+}
+
+func (c *LLMClient) buildChatRequest(messages []LLMMessage, tools []Tool, opts ChatOptions) openai.ChatCompletionRequest {
 	msgs := make([]openai.ChatCompletionMessage, len(messages))
 	for i, m := range messages {
 		msg := openai.ChatCompletionMessage{Role: m.Role, Content: m.Content}
+		if len(m.Parts) > 0 && c.vision {
+			msg.Content = ""
+			msg.MultiContent = chatMessageParts(m.Parts)
+		}
 		if m.ToolCallID != "" {
 			msg.ToolCallID = m.ToolCallID
 		}
@@ -112,6 +150,11 @@ func (c *LLMClient) ChatWithOptions(ctx context.Context, messages []LLMMessage,
 			req.ToolChoice = opts.ToolChoice
 		}
 	}
+	return req
+}
+
+func (c *LLMClient) ChatWithOptions(ctx context.Context, messages []LLMMessage, tools []Tool, opts ChatOptions) (*LLMResponse, error) {
+	req := c.buildChatRequest(messages, tools, opts)
 
 	resp, err := c.client.CreateChatCompletion(ctx, req)
 	if err != nil {
@@ -141,6 +184,110 @@ func (c *LLMClient) ChatWithOptions(ctx context.Context, messages []LLMMessage,
 	return result, nil
 }
 
+// StreamHandler receives incremental output from ChatStreamWithOptions.
+// Either callback may be nil.
+type StreamHandler struct {
+	OnContent  func(delta string)
+	OnToolCall func(index int, name, argsDelta string)
+}
+
+// ChatStreamWithOptions performs a streaming (SSE) chat completion, invoking the
+// handler for every content and tool-call fragment, and returns the assembled
+// response once the stream ends.
+func (c *LLMClient) ChatStreamWithOptions(ctx context.Context, messages []LLMMessage, tools []Tool, opts ChatOptions, handler StreamHandler) (*LLMResponse, error) {
+	req := c.buildChatRequest(messages, tools, opts)
+	req.Stream = true
+	req.StreamOptions = &openai.StreamOptions{IncludeUsage: true}
+
+	stream, err := c.client.CreateChatCompletionStream(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	defer stream.Close()
+
+	var content, reasoning strings.Builder
+	type partialCall struct {
+		id   string
+		name string
+		args strings.Builder
+	}
+	var calls []*partialCall
+	result := &LLMResponse{}
+
+	for {
+		chunk, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if chunk.Usage != nil {
+			result.PromptTokens = chunk.Usage.PromptTokens
+			result.CompletionTokens = chunk.Usage.CompletionTokens
+			result.TotalTokens = chunk.Usage.TotalTokens
+			if chunk.Usage.CompletionTokensDetails != nil {
+				result.ReasoningTokens = chunk.Usage.CompletionTokensDetails.ReasoningTokens
+			}
+		}
+		if len(chunk.Choices) == 0 {
+			continue
+		}
+
+		choice := chunk.Choices[0]
+		if choice.FinishReason != "" {
+			result.FinishReason = string(choice.FinishReason)
+		}
+		delta := choice.Delta
+		if delta.ReasoningContent != "" {
+			reasoning.WriteString(delta.ReasoningContent)
+		}
+		if delta.Content != "" {
+			content.WriteString(delta.Content)
+			if handler.OnContent != nil {
+				handler.OnContent(delta.Content)
+			}
+		}
+		for _, tc := range delta.ToolCalls {
+			idx := len(calls)
+			if tc.Index != nil {
+				idx = *tc.Index
+			}
+			for len(calls) <= idx {
+				calls = append(calls, &partialCall{})
+			}
+			pc := calls[idx]
+			if tc.ID != "" {
+				pc.id = tc.ID
+			}
+			if tc.Function.Name != "" {
+				pc.name += tc.Function.Name
+			}
+			pc.args.WriteString(tc.Function.Arguments)
+			if handler.OnToolCall != nil {
+				handler.OnToolCall(idx, pc.name, tc.Function.Arguments)
+			}
+		}
+	}
+
+	result.Content = content.String()
+	result.Reasoning = reasoning.String()
+	for _, pc := range calls {
+		if pc.name == "" {
+			continue
+		}
+		result.ToolCalls = append(result.ToolCalls, LLMToolCall{
+			ID:        pc.id,
+			Name:      pc.name,
+			Arguments: jsonutil.ParseJSON(pc.args.String()),
+		})
+	}
+
+	slog.InfoContext(ctx, "llm stream response", "content_length", len(result.Content), "tool_calls", len(result.ToolCalls), "finish_reason", result.FinishReason)
+	return result, nil
+}
+
 // MakeLLMCall is the unified entry point for LLM calls. It handles retry logic
 // (unless NoRetry is set) and automatic Langfuse telemetry (unless NoTelemetry is set).
 func MakeLLMCall(ctx context.Context, llm *LLMClient, msgs []LLMMessage, tools []Tool, opts LLMCallOptions) (*LLMResponse, error) {
@@ -163,7 +310,11 @@ func MakeLLMCall(ctx context.Context, llm *LLMClient, msgs []LLMMessage, tools [
 
 	var resp *LLMResponse
 	var err error
-	if opts.NoRetry {
+	if opts.Stream != nil {
+		// Streamed output has already reached clients, so the token-length
+		// retry loop is skipped: retrying would replay the answer.
+		resp, err = llm.ChatStreamWithOptions(ctx, msgs, tools, chatOpts, *opts.Stream)
+	} else if opts.NoRetry {
 		resp, err = llm.ChatWithOptions(ctx, msgs, tools, chatOpts)
 	} else {
 		resp, err = chatWithTokenRetry(ctx, llm, msgs, tools, chatOpts)
@@ -197,24 +348,56 @@ func MakeLLMCall(ctx context.Context, llm *LLMClient, msgs []LLMMessage, tools [
 			Temperature: opts.Temperature, MaxTokens: llm.maxTokens,
 			Tools: toolNames(tools), ReasoningTokens: resp.ReasoningTokens,
 			Reasoning: resp.Reasoning, FinishReason: resp.FinishReason,
+			Streaming: opts.Stream != nil,
 		})
 	}
 
 	return resp, nil
 }
 
+// EmbeddingModel is the model text is embedded with. It follows the active
+// model in embedding_models, which changes at a re-embedding cutover.
+func (c *LLMClient) EmbeddingModel() string {
+	if m := c.embeddingModel.Load(); m != nil {
+		return *m
+	}
+	return ""
+}
+
+func (c *LLMClient) SetEmbeddingModel(model string) {
+	c.embeddingModel.Store(&model)
+}
+
+// Embedding is a vector together with the model that produced it, which is
+// stored alongside it.
+type Embedding struct {
+	Vector []float32
+	Model  string
+}
+
 func (c *LLMClient) Embed(ctx context.Context, text string) ([]float32, error) {
+	e, err := c.EmbedWith(ctx, c.EmbeddingModel(), text)
+	return e.Vector, err
+}
+
+// EmbedDocument embeds text that is to be stored, with the current model.
+func (c *LLMClient) EmbedDocument(ctx context.Context, text string) (Embedding, error) {
+	return c.EmbedWith(ctx, c.EmbeddingModel(), text)
+}
+
+// EmbedWith embeds text with the given model.
+func (c *LLMClient) EmbedWith(ctx context.Context, model, text string) (Embedding, error) {
 	resp, err := c.client.CreateEmbeddings(ctx, openai.EmbeddingRequest{
-		Model: openai.EmbeddingModel(c.embeddingModel),
+		Model: openai.EmbeddingModel(model),
 		Input: []string{text},
 	})
 	if err != nil {
-		return nil, err
+		return Embedding{}, err
 	}
 	if len(resp.Data) == 0 || len(resp.Data[0].Embedding) == 0 {
-		slog.WarnContext(ctx, "embedding API returned empty vector", "input_length", len(text))
-		return nil, nil
+		slog.WarnContext(ctx, "embedding API returned empty vector", "model", model, "input_length", len(text))
+		return Embedding{Model: model}, nil
 	}
-	return resp.Data[0].Embedding, nil
+	return Embedding{Vector: resp.Data[0].Embedding, Model: model}, nil
 }
 
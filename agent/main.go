@@ -2,9 +2,11 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"flag"
 	"fmt"
 	"log/slog"
+	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
@@ -18,7 +20,14 @@ import (
 	"github.com/vmihailenco/msgpack/v5"
 )
 
-var paretoMode = flag.Bool("pareto", false, "Enable pareto-efficient exploration")
+var (
+	paretoMode       = flag.Bool("pareto", false, "Enable pareto-efficient exploration")
+	maintainMemories = flag.Bool("maintain-memories", false, "Run memory maintenance once, print its report and exit")
+	dryRun           = flag.Bool("dry-run", false, "With -maintain-memories, report what would change without changing it")
+	reembedModel     = flag.String("reembed", "", "Re-embed all memories and notes with this embedding model and exit; resumable")
+	reembedRate      = flag.Float64("reembed-rate", 5, "With -reembed, embedding requests per second")
+	cutoverModel     = flag.String("embedding-cutover", "", "Switch search over to this re-embedded embedding model and exit")
+)
 
 func main() {
 	flag.Parse()
@@ -26,23 +35,31 @@ func main() {
 	cfg := struct {
 		DatabaseURL    string
 		ServerURL      string
+		AgentSecret    string
 		LLMAPIKey      string
 		LLMURL         string
 		LLMModel       string
 		EmbeddingModel string
+		LLMVision      bool
+		ContextWindow  int
 		ParetoMode     bool
 		OTLPEndpoint   string
 		Environment    string
+		Concurrency    int
 	}{
 		DatabaseURL:    config.MustEnv("DATABASE_URL"),
 		ServerURL:      config.MustEnv("SERVER_URL"),
+		AgentSecret:    config.GetEnv("AGENT_SECRET", ""),
 		LLMURL:         config.MustEnv("LLM_URL"),
 		LLMAPIKey:      config.MustEnv("LLM_API_KEY"),
 		LLMModel:       config.GetEnv("LLM_MODEL", "gpt-4"),
 		EmbeddingModel: config.GetEnv("EMBEDDING_MODEL", "text-embedding-3-small"),
+		LLMVision:      os.Getenv("LLM_VISION") == "true",
+		ContextWindow:  config.GetEnvInt("LLM_CONTEXT_WINDOW", defaultContextWindow),
 		ParetoMode:     *paretoMode || os.Getenv("PARETO_MODE") == "true",
 		OTLPEndpoint:   config.GetEnv("OTEL_EXPORTER_OTLP_ENDPOINT", ""),
 		Environment:    config.GetEnv("ENVIRONMENT", "development"),
+		Concurrency:    config.GetEnvInt("AGENT_CONCURRENCY", 4),
 	}
 
 	if cfg.OTLPEndpoint != "" {
@@ -79,28 +96,69 @@ func main() {
 	slog.Info("database connected")
 
 	llm := NewLLMClient(cfg.LLMURL, cfg.LLMAPIKey, cfg.LLMModel, cfg.EmbeddingModel, 4096)
+	llm.vision = cfg.LLMVision
+	llm.contextWindow = cfg.ContextWindow
 	slog.Info("llm client created")
 
-	mcpServers, err := LoadEnabledMCPServers(ctx, db)
+	switch {
+	case *reembedModel != "":
+		if *reembedRate <= 0 {
+			slog.Error("-reembed-rate must be positive")
+			os.Exit(1)
+		}
+		if err := Reembed(ctx, llm, db, *reembedModel, *reembedRate); err != nil {
+			slog.Error("re-embedding failed", "error", err)
+			os.Exit(1)
+		}
+		return
+	case *cutoverModel != "":
+		if err := CutoverEmbeddingModel(ctx, db, *cutoverModel); err != nil {
+			slog.Error("embedding cutover failed", "error", err)
+			os.Exit(1)
+		}
+		slog.Info("embedding model switched", "model", *cutoverModel)
+		return
+	}
+
+	// Embed with the model the stored embeddings were made with, whatever
+	// EMBEDDING_MODEL says; switching models goes through a re-embed.
+	activeModel, err := EnsureActiveEmbeddingModel(ctx, db, cfg.EmbeddingModel)
 	if err != nil {
-		slog.Error("failed to load mcp servers from database", "error", err)
+		slog.Error("failed to load embedding model", "error", err)
+		os.Exit(1)
 	}
+	if activeModel != cfg.EmbeddingModel {
+		slog.Warn("EMBEDDING_MODEL differs from the model of the stored embeddings, which stays in use until a cutover",
+			"configured", cfg.EmbeddingModel, "active", activeModel)
+	}
+	llm.SetEmbeddingModel(activeModel)
+	go followEmbeddingModel(ctx, llm, db)
 
-	var mcp *MCPManager
-	if len(mcpServers) > 0 {
-		mcp, err = NewMCPManager(mcpServers)
+	if *maintainMemories {
+		report, err := RunMemoryMaintenance(ctx, AgentDeps{DB: db, LLM: llm}, *dryRun)
 		if err != nil {
-			slog.Warn("mcp manager failed, continuing without tools", "error", err)
-		} else {
-			defer mcp.Close()
-			slog.Info("mcp manager started", "tool_count", len(mcp.Tools()), "server_count", len(mcpServers))
+			slog.Error("memory maintenance failed", "error", err)
+			os.Exit(1)
 		}
-	} else {
-		slog.Info("no mcp servers configured in database, running without tools")
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(report)
+		return
 	}
 
+	mcpServers, err := LoadEnabledMCPServers(ctx, db)
+	if err != nil {
+		slog.Error("failed to load mcp servers from database", "error", err)
+	}
+
+	// The manager is created even without servers so that servers added
+	// through the API can be started later.
+	mcp := NewMCPManager(mcpServers)
+	defer mcp.Close()
+	slog.Info("mcp manager started", "tool_count", len(mcp.Tools()), "server_count", len(mcpServers))
+
 	prefs := NewPreferencesStore()
-	deps := AgentDeps{DB: db, LLM: llm, MCP: mcp, Prefs: prefs, ParetoMode: cfg.ParetoMode}
+	deps := AgentDeps{DB: db, LLM: llm, MCP: mcp, Prefs: prefs, ParetoMode: cfg.ParetoMode, Generations: NewGenerationRegistry(), Approvals: NewApprovalRegistry()}
 
 	if cfg.ParetoMode {
 		slog.Info("pareto mode enabled")
@@ -108,6 +166,10 @@ func main() {
 
 	go initLangfuseScoreConfigs()
 
+	if interval := config.GetEnvDuration("MEMORY_MAINTENANCE_INTERVAL", 24*time.Hour); interval > 0 {
+		go runMemoryMaintenanceLoop(ctx, deps, interval, config.GetEnvBool("MEMORY_MAINTENANCE_DRY_RUN", false))
+	}
+
 	go func() {
 		for {
 			select {
@@ -115,7 +177,7 @@ func main() {
 				return
 			default:
 			}
-			if err := runAgentLoop(ctx, cfg.ServerURL, deps); err != nil {
+			if err := runAgentLoop(ctx, cfg.ServerURL, cfg.AgentSecret, cfg.Concurrency, deps); err != nil {
 				slog.Error("agent loop error", "error", err)
 			}
 			slog.Info("reconnecting in 5 seconds")
@@ -134,19 +196,50 @@ func main() {
 	cancel()
 }
 
-func runAgentLoop(ctx context.Context, serverURL string, deps AgentDeps) error {
+func runAgentLoop(ctx context.Context, serverURL, agentSecret string, concurrency int, deps AgentDeps) error {
 	slog.Info("connecting to server", "url", serverURL)
-	conn, _, err := websocket.DefaultDialer.DialContext(ctx, serverURL, nil)
+	header := http.Header{}
+	if agentSecret != "" {
+		header.Set("Authorization", "Bearer "+agentSecret)
+	}
+	conn, _, err := websocket.DefaultDialer.DialContext(ctx, serverURL, header)
 	if err != nil {
 		return err
 	}
 	defer conn.Close()
 	slog.Info("connected to server")
 
-	if err := subscribeAsAgent(conn); err != nil {
+	if err := subscribeAsAgent(conn, concurrency); err != nil {
 		return err
 	}
-	slog.Info("registered as agent")
+	slog.Info("registered as agent", "concurrency", concurrency)
+	ws := newWSWriter(conn)
+
+	// The server hands the jobs of a dropped connection to other workers, so
+	// generations started on this one stop with it.
+	connCtx, cancelConn := context.WithCancel(ctx)
+	defer cancelConn()
+	jobs := newActiveJobs()
+	go runJobHeartbeats(connCtx, NewWSNotifier(ws, ""), jobs)
+
+	// Tell the API which MCP tools are available; it forgets them whenever
+	// the agent disconnects.
+	reportMCPTools := func() {
+		NewWSNotifier(ws, "").SendMCPToolsReport(ctx, deps.MCP.Report())
+	}
+	deps.MCP.SetOnChange(reportMCPTools)
+
+	// Config updates broadcast while the agent was disconnected never arrive,
+	// so catch up from the database on every connect.
+	go func() {
+		servers, err := LoadEnabledMCPServers(connCtx, deps.DB)
+		if err != nil {
+			slog.Error("failed to reload mcp servers from database", "error", err)
+		} else {
+			deps.MCP.Apply(servers)
+		}
+		reportMCPTools()
+	}()
 
 	for {
 		select {
@@ -177,6 +270,41 @@ func runAgentLoop(ctx context.Context, serverURL string, deps AgentDeps) error {
 			deps.Prefs.Update(update)
 			slog.Info("updated preferences", "user_id", update.UserID)
 
+		case protocol.TypeMCPConfigUpdate:
+			update, err := protocol.DecodeBody[protocol.MCPConfigUpdate](&envelope)
+			if err != nil {
+				slog.Error("mcp config decode error", "error", err)
+				continue
+			}
+			slog.Info("mcp config update received", "server_count", len(update.Servers))
+			// Starting servers can take a while, so it must not block the read loop.
+			go func() {
+				deps.MCP.Apply(MCPServerConfigsFromProtocol(update.Servers))
+				reportMCPTools()
+			}()
+
+		case protocol.TypeGenerationCancel:
+			cancelReq, err := protocol.DecodeBody[protocol.GenerationCancel](&envelope)
+			if err != nil {
+				slog.Error("cancel decode error", "error", err)
+				continue
+			}
+			if deps.Generations.Cancel(cancelReq.ConversationID, cancelReq.MessageID) {
+				slog.Info("generation cancelled", "conversation_id", cancelReq.ConversationID, "message_id", cancelReq.MessageID)
+			} else {
+				slog.Info("cancel requested for unknown generation", "conversation_id", cancelReq.ConversationID, "message_id", cancelReq.MessageID)
+			}
+
+		case protocol.TypeToolApproval:
+			approval, err := protocol.DecodeBody[protocol.ToolApproval](&envelope)
+			if err != nil {
+				slog.Error("tool approval decode error", "error", err)
+				continue
+			}
+			if !deps.Approvals.Resolve(approval.ConversationID, approval.ToolUseID, approval.Approved, approval.Reason) {
+				slog.Info("approval for unknown tool call", "conversation_id", approval.ConversationID, "tool_use_id", approval.ToolUseID)
+			}
+
 		case protocol.TypeGenRequest:
 			var req ResponseGenerationRequest
 			bodyBytes, _ := msgpack.Marshal(envelope.Body)
@@ -187,49 +315,84 @@ func runAgentLoop(ctx context.Context, serverURL string, deps AgentDeps) error {
 
 			slog.Info("request received", "type", req.RequestType, "conversation_id", req.ConversationID, "message_id", req.MessageID)
 
-			reqCtx := otel.WithSessionID(ctx, req.ConversationID)
-			if envelope.UserID != "" {
-				reqCtx = otel.WithUserID(reqCtx, envelope.UserID)
-			}
+			reqCtx := otel.WithSessionID(connCtx, req.ConversationID)
 			if envelope.HasTraceContext() {
 				reqCtx = otel.ExtractFromTraceContext(reqCtx, otel.TraceContext{
 					TraceID:    envelope.TraceID,
 					SpanID:     envelope.SpanID,
 					TraceFlags: envelope.TraceFlags,
 					SessionID:  envelope.SessionID,
-					UserID:     envelope.UserID,
 				})
 			}
 
 			reqDeps := deps
-			reqDeps.UserID = envelope.UserID
-			reqDeps.Notifier = NewWSNotifier(conn, req.ConversationID)
+			notifier := NewWSNotifier(ws, req.ConversationID)
+			reqDeps.Notifier = notifier
 
 			go func(reqCtx context.Context, req ResponseGenerationRequest, reqDeps AgentDeps) {
-				var err error
-				switch req.RequestType {
-				case "send":
-					err = HandleSend(reqCtx, req, reqDeps)
-				case "regenerate":
-					err = HandleRegenerate(reqCtx, req, reqDeps)
-				case "continue":
-					err = HandleContinue(reqCtx, req, reqDeps)
-				case "edit":
-					err = HandleEdit(reqCtx, req, reqDeps)
-				default:
-					slog.Warn("unknown request type", "type", req.RequestType)
-					return
+				reqCtx, done := reqDeps.Generations.Start(reqCtx, req.ConversationID, req.MessageID)
+				defer done()
+
+				if req.JobID != "" {
+					jobs.Add(req.JobID)
+					notifier.SendJobStatus(reqCtx, req.JobID, protocol.JobRunning, "")
+				}
+
+				reqCtx, reqDeps, err := scopeToOwner(reqCtx, reqDeps, req.ConversationID, func(ctx context.Context, convID string) (string, error) {
+					return GetConversationOwner(ctx, reqDeps.DB, convID)
+				})
+				if err == nil {
+					switch req.RequestType {
+					case "send":
+						err = HandleSend(reqCtx, req, reqDeps)
+					case "regenerate":
+						err = HandleRegenerate(reqCtx, req, reqDeps)
+					case "continue":
+						err = HandleContinue(reqCtx, req, reqDeps)
+					case "edit":
+						err = HandleEdit(reqCtx, req, reqDeps)
+					default:
+						err = fmt.Errorf("unknown request type %q", req.RequestType)
+					}
 				}
 				if err != nil {
 					slog.Error("handler error", "type", req.RequestType, "error", err)
 				}
+
+				if req.JobID != "" {
+					jobs.Remove(req.JobID)
+					if connCtx.Err() != nil {
+						// The server has already taken the job back.
+						return
+					}
+					if err != nil {
+						notifier.SendJobStatus(connCtx, req.JobID, protocol.JobFailed, err.Error())
+					} else {
+						notifier.SendJobStatus(connCtx, req.JobID, protocol.JobDone, "")
+					}
+				}
 			}(reqCtx, req, reqDeps)
 		}
 	}
 }
 
-func subscribeAsAgent(conn *websocket.Conn) error {
-	data, _ := msgpack.Marshal(protocol.Envelope{Type: protocol.TypeSubscribe, Body: map[string]any{"agentMode": true}})
+// scopeToOwner scopes a generation to the conversation's owner, whose
+// memories and notes it may use and whom its traces and queries are for. The
+// envelope's user comes from the client, so it is never trusted for this.
+func scopeToOwner(ctx context.Context, deps AgentDeps, convID string, ownerOf func(context.Context, string) (string, error)) (context.Context, AgentDeps, error) {
+	owner, err := ownerOf(ctx, convID)
+	if err != nil {
+		return ctx, deps, fmt.Errorf("resolve conversation owner: %w", err)
+	}
+	if owner == "" {
+		return ctx, deps, fmt.Errorf("conversation %s has no owner", convID)
+	}
+	deps.UserID = owner
+	return otel.WithUserID(ctx, owner), deps, nil
+}
+
+func subscribeAsAgent(conn *websocket.Conn, concurrency int) error {
+	data, _ := msgpack.Marshal(protocol.Envelope{Type: protocol.TypeSubscribe, Body: map[string]any{"agentMode": true, "concurrency": concurrency}})
 	if err := conn.WriteMessage(websocket.BinaryMessage, data); err != nil {
 		return err
 	}
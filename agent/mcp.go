@@ -3,28 +3,50 @@ package main
 import (
 	"bufio"
 	"context"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
+	"maps"
 	"os"
 	"os/exec"
+	"slices"
 	"strings"
 	"sync"
 
 	"github.com/longregen/alicia/pkg/otel"
+	"github.com/longregen/alicia/shared/protocol"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/trace"
 )
 
+// MCPConn is a connection to a single MCP server, whatever its transport.
+type MCPConn interface {
+	Tools() []Tool
+	Call(ctx context.Context, toolName string, args map[string]any) (any, error)
+	Close() error
+}
+
 // MCPClient is a stdio JSON-RPC client for the Model Context Protocol.
+// Requests are tagged with increasing ids and a reader goroutine hands each
+// response to the request waiting for it, so several calls can be
+// outstanding on the pipe at once.
 type MCPClient struct {
 	cmd    *exec.Cmd
 	stdin  io.WriteCloser
 	stdout *bufio.Reader
 	tools  []Tool
-	nextID int
-	mu     sync.Mutex
+
+	mu       sync.Mutex // guards nextID, pending and writes to stdin
+	nextID   int
+	pending  map[int]chan jsonRPCResponse
+	readErr  error         // why the reader stopped, valid after readDone is closed
+	readDone chan struct{} // closed when stdout can no longer be read
+
+	exited  chan struct{} // closed once the process has exited
+	waitErr error         // result of cmd.Wait, valid after exited is closed
 }
 
 type jsonRPCRequest struct {
@@ -46,6 +68,10 @@ type jsonRPCError struct {
 	Message string `json:"message"`
 }
 
+func (e *jsonRPCError) Error() string {
+	return fmt.Sprintf("rpc error %d: %s", e.Code, e.Message)
+}
+
 // NewMCPClient spawns an MCP server and performs the initialization handshake.
 func NewMCPClient(command string, args []string, env []string) (*MCPClient, error) {
 	cmd := exec.Command(command, args...)
@@ -68,19 +94,30 @@ func NewMCPClient(command string, args []string, env []string) (*MCPClient, erro
 	}
 
 	c := &MCPClient{
-		cmd:    cmd,
-		stdin:  stdin,
-		stdout: bufio.NewReader(stdout),
-		nextID: 1,
-	}
-
-	if err := c.initialize(); err != nil {
-		c.Close()
+		cmd:      cmd,
+		stdin:    stdin,
+		stdout:   bufio.NewReader(stdout),
+		nextID:   1,
+		pending:  make(map[int]chan jsonRPCResponse),
+		readDone: make(chan struct{}),
+		exited:   make(chan struct{}),
+	}
+	go c.readLoop()
+	go func() {
+		c.waitErr = cmd.Wait()
+		close(c.exited)
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), mcpConnectTimeout)
+	defer cancel()
+
+	if err := c.initialize(ctx); err != nil {
+		c.kill()
 		return nil, fmt.Errorf("initialize: %w", err)
 	}
 
-	if err := c.listTools(); err != nil {
-		c.Close()
+	if err := c.listTools(ctx); err != nil {
+		c.kill()
 		return nil, fmt.Errorf("list tools: %w", err)
 	}
 
@@ -98,26 +135,53 @@ func (c *MCPClient) Call(ctx context.Context, toolName string, args map[string]a
 		))
 	defer span.End()
 
-	c.mu.Lock()
-	defer c.mu.Unlock()
-
 	params := map[string]any{
 		"name":      toolName,
 		"arguments": args,
 		"_meta":     otel.InjectMCPMeta(ctx),
 	}
 
-	result, err := c.request("tools/call", params)
+	result, err := c.request(ctx, "tools/call", params)
 	if err != nil {
 		span.RecordError(err)
 		return nil, err
 	}
 
+	return decodeCallResult(span, result)
+}
+
+// Ping checks that the server is still answering requests. An RPC error
+// reply still counts as alive, since not every server implements ping.
+func (c *MCPClient) Ping(ctx context.Context) error {
+	_, err := c.request(ctx, "ping", nil)
+	var rpcErr *jsonRPCError
+	if errors.As(err, &rpcErr) {
+		return nil
+	}
+	return err
+}
+
+// mcpContentBlock is an item of a tools/call result's content.
+type mcpContentBlock struct {
+	Type     string `json:"type"`
+	Text     string `json:"text"`
+	MimeType string `json:"mimeType"`
+	Data     string `json:"data"`
+	URI      string `json:"uri"` // resource_link
+	Resource *struct {
+		URI      string `json:"uri"`
+		MimeType string `json:"mimeType"`
+		Text     string `json:"text"`
+		Blob     string `json:"blob"`
+	} `json:"resource"`
+}
+
+// decodeCallResult unwraps a tools/call result. A single text part is returned
+// as a plain string and results with images or resources as *ToolContent;
+// anything else is returned as the decoded JSON object.
+func decodeCallResult(span trace.Span, result json.RawMessage) (any, error) {
 	var callResult struct {
-		Content []struct {
-			Type string `json:"type"`
-			Text string `json:"text"`
-		} `json:"content"`
+		Content []mcpContentBlock `json:"content"`
 	}
 	if err := json.Unmarshal(result, &callResult); err != nil {
 		span.RecordError(err)
@@ -128,6 +192,13 @@ func (c *MCPClient) Call(ctx context.Context, toolName string, args map[string]a
 		span.SetAttributes(attribute.Int("mcp.result_length", len(callResult.Content[0].Text)))
 		return callResult.Content[0].Text, nil
 	}
+	for _, block := range callResult.Content {
+		if block.Type != "text" {
+			content := toolContentFromBlocks(callResult.Content)
+			span.SetAttributes(attribute.Int("mcp.result_parts", len(content.Parts)))
+			return content, nil
+		}
+	}
 
 	var raw any
 	if err := json.Unmarshal(result, &raw); err != nil {
@@ -137,22 +208,74 @@ func (c *MCPClient) Call(ctx context.Context, toolName string, args map[string]a
 	return raw, nil
 }
 
+// toolContentFromBlocks converts MCP content blocks into content parts. Images,
+// including image resources, keep their bytes; other binary content is only
+// described, since the model can't use it.
+func toolContentFromBlocks(blocks []mcpContentBlock) *ToolContent {
+	content := &ToolContent{}
+	text := func(s string) {
+		content.Parts = append(content.Parts, ContentPart{Type: "text", Text: s})
+	}
+	image := func(mimeType, uri, data string) {
+		decoded, err := base64.StdEncoding.DecodeString(data)
+		if err != nil {
+			text(fmt.Sprintf("[%s image could not be decoded: %v]", mimeType, err))
+			return
+		}
+		content.Parts = append(content.Parts, ContentPart{Type: "image", MimeType: mimeType, URI: uri, Data: decoded})
+	}
+
+	for _, b := range blocks {
+		switch {
+		case b.Type == "text":
+			text(b.Text)
+		case b.Type == "image":
+			image(b.MimeType, "", b.Data)
+		case b.Type == "resource" && b.Resource != nil:
+			r := b.Resource
+			switch {
+			case r.Blob != "" && strings.HasPrefix(r.MimeType, "image/"):
+				image(r.MimeType, r.URI, r.Blob)
+			case r.Blob != "":
+				text(fmt.Sprintf("[resource %s (%s) omitted]", r.URI, r.MimeType))
+			default:
+				text(fmt.Sprintf("Resource %s:\n%s", r.URI, r.Text))
+			}
+		case b.Type == "resource_link":
+			text("Resource: " + b.URI)
+		default:
+			text(fmt.Sprintf("[%s content omitted]", b.Type))
+		}
+	}
+	return content
+}
+
 func (c *MCPClient) Close() error {
 	c.stdin.Close()
-	return c.cmd.Wait()
+	<-c.exited
+	return c.waitErr
 }
 
-func (c *MCPClient) initialize() error {
-	params := map[string]any{
-		"protocolVersion": "2024-11-05",
+// kill stops a process that is no longer responding and waits for it to exit.
+func (c *MCPClient) kill() {
+	c.stdin.Close()
+	c.cmd.Process.Kill()
+	<-c.exited
+}
+
+func initializeParams(protocolVersion string) map[string]any {
+	return map[string]any{
+		"protocolVersion": protocolVersion,
 		"capabilities":    map[string]any{},
 		"clientInfo": map[string]any{
 			"name":    "agent-2",
 			"version": "1.0",
 		},
 	}
+}
 
-	_, err := c.request("initialize", params)
+func (c *MCPClient) initialize(ctx context.Context) error {
+	_, err := c.request(ctx, "initialize", initializeParams("2024-11-05"))
 	if err != nil {
 		return fmt.Errorf("initialize request: %w", err)
 	}
@@ -161,19 +284,27 @@ func (c *MCPClient) initialize() error {
 		JSONRPC: "2.0",
 		Method:  "initialized",
 	}
-	if err := c.send(notification); err != nil {
+	c.mu.Lock()
+	err = c.send(notification)
+	c.mu.Unlock()
+	if err != nil {
 		return fmt.Errorf("initialized notification: %w", err)
 	}
 
 	return nil
 }
 
-func (c *MCPClient) listTools() error {
-	result, err := c.request("tools/list", map[string]any{})
+func (c *MCPClient) listTools(ctx context.Context) error {
+	result, err := c.request(ctx, "tools/list", map[string]any{})
 	if err != nil {
 		return err
 	}
 
+	c.tools, err = parseToolsList(result)
+	return err
+}
+
+func parseToolsList(result json.RawMessage) ([]Tool, error) {
 	var listResult struct {
 		Tools []struct {
 			Name        string         `json:"name"`
@@ -182,40 +313,60 @@ func (c *MCPClient) listTools() error {
 		} `json:"tools"`
 	}
 	if err := json.Unmarshal(result, &listResult); err != nil {
-		return fmt.Errorf("parse tools list: %w", err)
+		return nil, fmt.Errorf("parse tools list: %w", err)
 	}
 
-	c.tools = make([]Tool, len(listResult.Tools))
+	tools := make([]Tool, len(listResult.Tools))
 	for i, t := range listResult.Tools {
-		c.tools[i] = Tool{
+		tools[i] = Tool{
 			Name:        t.Name,
 			Description: t.Description,
 			Schema:      t.InputSchema,
 		}
 	}
-
-	return nil
+	return tools, nil
 }
 
-// request sends a JSON-RPC request and waits for the response. Caller must hold mu.
-func (c *MCPClient) request(method string, params any) (json.RawMessage, error) {
+// request sends a JSON-RPC request and waits for its response, which the
+// reader goroutine routes back by id.
+func (c *MCPClient) request(ctx context.Context, method string, params any) (json.RawMessage, error) {
+	ch := make(chan jsonRPCResponse, 1)
+	c.mu.Lock()
 	id := c.nextID
 	c.nextID++
-
-	req := jsonRPCRequest{
+	c.pending[id] = ch
+	err := c.send(jsonRPCRequest{
 		JSONRPC: "2.0",
 		ID:      id,
 		Method:  method,
 		Params:  params,
-	}
+	})
+	c.mu.Unlock()
 
-	if err := c.send(req); err != nil {
+	defer func() {
+		c.mu.Lock()
+		delete(c.pending, id)
+		c.mu.Unlock()
+	}()
+
+	if err != nil {
 		return nil, err
 	}
 
-	return c.receive(id)
+	select {
+	case resp := <-ch:
+		if resp.Error != nil {
+			return nil, resp.Error
+		}
+		return resp.Result, nil
+	case <-c.readDone:
+		return nil, fmt.Errorf("read: %w", c.readErr)
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
 }
 
+// send writes one message to the server. Caller must hold mu.
 func (c *MCPClient) send(msg any) error {
 	data, err := json.Marshal(msg)
 	if err != nil {
@@ -230,11 +381,15 @@ func (c *MCPClient) send(msg any) error {
 	return nil
 }
 
-func (c *MCPClient) receive(expectedID int) (json.RawMessage, error) {
+// readLoop reads responses until stdout is closed and hands each one to the
+// request waiting for its id.
+func (c *MCPClient) readLoop() {
 	for {
 		line, err := c.stdout.ReadBytes('\n')
 		if err != nil {
-			return nil, fmt.Errorf("read: %w", err)
+			c.readErr = err
+			close(c.readDone)
+			return
 		}
 
 		var resp jsonRPCResponse
@@ -242,59 +397,76 @@ func (c *MCPClient) receive(expectedID int) (json.RawMessage, error) {
 			slog.Warn("mcp: invalid response", "raw", string(line))
 			continue
 		}
-
 		if resp.ID == nil {
 			continue // notification
 		}
-		if *resp.ID != expectedID {
-			slog.Warn("mcp: unexpected response id", "got", *resp.ID, "expected", expectedID)
+
+		c.mu.Lock()
+		ch, ok := c.pending[*resp.ID]
+		delete(c.pending, *resp.ID)
+		c.mu.Unlock()
+		if !ok {
+			// The caller gave up waiting, or the id is bogus.
+			slog.Warn("mcp: unexpected response id", "id", *resp.ID)
 			continue
 		}
-		if resp.Error != nil {
-			return nil, fmt.Errorf("rpc error %d: %s", resp.Error.Code, resp.Error.Message)
-		}
-
-		return resp.Result, nil
+		ch <- resp
 	}
 }
 
-// MCPManager manages multiple MCP clients with namespaced tools.
+// MCPManager manages multiple MCP clients with namespaced tools. The set of
+// servers can be changed at runtime with Apply.
 type MCPManager struct {
-	clients map[string]*MCPClient
+	servers map[string]*mcpServer
+	failed  map[string]error // servers from the last Apply that failed to start
 	tools   []Tool
 	toolMap map[string]string // "server:tool" -> server name
 	mu      sync.RWMutex
+
+	applyMu  sync.Mutex // serializes Apply
+	connect  func(MCPServerConfig) (MCPConn, error)
+	onChange func() // called when a server's status or tools change
+}
+
+// mcpServer is a running server. calls counts in-flight tool calls so a
+// removed server is only closed once they have finished.
+type mcpServer struct {
+	config MCPServerConfig
+	conn   MCPConn
+	calls  sync.WaitGroup
 }
 
-func NewMCPManager(servers []MCPServerConfig) (*MCPManager, error) {
+// NewMCPManager starts the given servers. Servers that fail to start are
+// logged and reported by Report, but don't prevent the others from running.
+func NewMCPManager(servers []MCPServerConfig) *MCPManager {
 	m := &MCPManager{
-		clients: make(map[string]*MCPClient),
+		servers: make(map[string]*mcpServer),
 		toolMap: make(map[string]string),
 	}
+	m.connect = m.connectServer
+	m.Apply(servers)
+	return m
+}
 
-	baseEnv := []string{
-		"PATH=" + os.Getenv("PATH"),
-		"HOME=" + os.Getenv("HOME"),
-	}
-
-	// Per-server env vars to forward from the host environment.
-	serverEnvVars := map[string][]string{
-		"garden":    {"GARDEN_DATABASE_URL"},
-		"web":       {"KAGI_API_KEY"},
-		"assistant": {"AGENT_SECRET", "OTEL_EXPORTER_OTLP_ENDPOINT"},
-	}
-
-	for _, srv := range servers {
-		if srv.TransportType != "stdio" {
-			slog.Warn("mcp: unsupported transport", "server", srv.Name, "type", srv.TransportType)
-			continue
-		}
+// connectServer starts or connects to a server using its transport. Stdio
+// servers are supervised and restarted if their process dies.
+func (m *MCPManager) connectServer(srv MCPServerConfig) (MCPConn, error) {
+	switch srv.TransportType {
+	case "stdio":
 		if srv.Command == "" {
-			slog.Warn("mcp: no command", "server", srv.Name)
-			continue
+			return nil, fmt.Errorf("no command")
 		}
 
-		env := append([]string{}, baseEnv...)
+		env := []string{
+			"PATH=" + os.Getenv("PATH"),
+			"HOME=" + os.Getenv("HOME"),
+		}
+		// Per-server env vars to forward from the host environment.
+		serverEnvVars := map[string][]string{
+			"garden":    {"GARDEN_DATABASE_URL"},
+			"web":       {"KAGI_API_KEY"},
+			"assistant": {"AGENT_SECRET", "OTEL_EXPORTER_OTLP_ENDPOINT"},
+		}
 		for _, key := range serverEnvVars[srv.Name] {
 			if val := os.Getenv(key); val != "" {
 				env = append(env, key+"="+val)
@@ -309,31 +481,164 @@ func NewMCPManager(servers []MCPServerConfig) (*MCPManager, error) {
 			}
 		}
 
-		client, err := NewMCPClient(srv.Command, srv.Args, env)
+		return NewMCPSupervisor(srv.Name, srv.Command, srv.Args, env, m.serverChanged)
+	case "sse", "streamable-http":
+		if srv.URL == "" {
+			return nil, fmt.Errorf("no url")
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), mcpConnectTimeout)
+		defer cancel()
+		if srv.TransportType == "sse" {
+			return NewMCPSSEClient(ctx, srv.URL, srv.Headers)
+		}
+		return NewMCPHTTPClient(ctx, srv.URL, srv.Headers)
+	default:
+		return nil, fmt.Errorf("unsupported transport %q", srv.TransportType)
+	}
+}
+
+// sameConnection reports whether two configs would connect to the same server
+// in the same way, so a running client can be kept.
+func (c MCPServerConfig) sameConnection(o MCPServerConfig) bool {
+	return c.TransportType == o.TransportType &&
+		c.Command == o.Command &&
+		slices.Equal(c.Args, o.Args) &&
+		c.URL == o.URL &&
+		maps.Equal(c.Headers, o.Headers)
+}
+
+// Apply reconciles the running servers with the given set. New and changed
+// servers are started, unchanged ones keep running, and removed or replaced
+// ones are closed once their in-flight calls have finished.
+func (m *MCPManager) Apply(servers []MCPServerConfig) {
+	m.applyMu.Lock()
+	defer m.applyMu.Unlock()
+
+	m.mu.RLock()
+	current := maps.Clone(m.servers)
+	m.mu.RUnlock()
+
+	next := make(map[string]*mcpServer, len(servers))
+	kept := make(map[*mcpServer]MCPServerConfig) // running servers whose limits may have changed
+	failed := make(map[string]error)
+	for _, cfg := range servers {
+		if !cfg.Enabled {
+			continue
+		}
+		if srv, ok := current[cfg.Name]; ok && srv.config.sameConnection(cfg) {
+			next[cfg.Name] = srv
+			kept[srv] = cfg
+			continue
+		}
+
+		conn, err := m.connect(cfg)
 		if err != nil {
-			slog.Error("mcp server failed to start", "server", srv.Name, "error", err)
+			slog.Error("mcp server failed to start", "server", cfg.Name, "error", err)
+			failed[cfg.Name] = err
 			continue
 		}
+		next[cfg.Name] = &mcpServer{config: cfg, conn: conn}
+		slog.Info("mcp server started", "server", cfg.Name, "tool_count", len(conn.Tools()))
+	}
+
+	m.mu.Lock()
+	for srv, cfg := range kept {
+		srv.config = cfg
+	}
+	m.servers = next
+	m.failed = failed
+	m.rebuildTools()
+	m.mu.Unlock()
+
+	for name, srv := range current {
+		if next[name] == srv {
+			continue
+		}
+		go func() {
+			srv.calls.Wait()
+			if err := srv.conn.Close(); err != nil {
+				slog.Error("error closing mcp server", "server", name, "error", err)
+			}
+			slog.Info("mcp server stopped", "server", name)
+		}()
+	}
+}
 
-		m.clients[srv.Name] = client
-		for _, tool := range client.Tools() {
-			prefixedName := srv.Name + ":" + tool.Name
+// rebuildTools recomputes the namespaced tool list. Callers hold m.mu.
+func (m *MCPManager) rebuildTools() {
+	m.tools = nil
+	m.toolMap = make(map[string]string)
+	for _, name := range slices.Sorted(maps.Keys(m.servers)) {
+		for _, tool := range m.servers[name].conn.Tools() {
+			prefixedName := name + ":" + tool.Name
 			m.tools = append(m.tools, Tool{
 				Name:        prefixedName,
-				Description: fmt.Sprintf("[%s] %s", srv.Name, tool.Description),
+				Description: fmt.Sprintf("[%s] %s", name, tool.Description),
 				Schema:      tool.Schema,
 			})
-			m.toolMap[prefixedName] = srv.Name
+			m.toolMap[prefixedName] = name
 		}
-
-		slog.Info("mcp server started", "server", srv.Name, "tool_count", len(client.Tools()))
 	}
+}
+
+// SetOnChange registers fn to be called whenever a running server changes
+// status, for example when a crashed process is restarted.
+func (m *MCPManager) SetOnChange(fn func()) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.onChange = fn
+}
 
-	if len(m.clients) == 0 {
-		return nil, fmt.Errorf("no MCP servers started")
+// serverChanged refreshes the tool list after a server went down or came
+// back, since a restarted process may expose different tools.
+func (m *MCPManager) serverChanged() {
+	m.mu.Lock()
+	m.rebuildTools()
+	fn := m.onChange
+	m.mu.Unlock()
+
+	if fn != nil {
+		fn()
 	}
+}
+
+// Report lists every server from the last Apply with its status and tools,
+// or the error it failed to start with.
+func (m *MCPManager) Report() []protocol.MCPServerTools {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
 
-	return m, nil
+	report := make([]protocol.MCPServerTools, 0, len(m.servers)+len(m.failed))
+	for name, srv := range m.servers {
+		entry := protocol.MCPServerTools{Name: name, Status: mcpStatusUp, Tools: []protocol.MCPTool{}}
+		if sup, ok := srv.conn.(*MCPSupervisor); ok {
+			status, err := sup.Status()
+			entry.Status = status
+			if err != nil {
+				entry.Error = err.Error()
+			}
+		}
+		for _, tool := range srv.conn.Tools() {
+			entry.Tools = append(entry.Tools, protocol.MCPTool{
+				Name:        tool.Name,
+				Description: tool.Description,
+				Schema:      tool.Schema,
+			})
+		}
+		report = append(report, entry)
+	}
+	for name, err := range m.failed {
+		report = append(report, protocol.MCPServerTools{
+			Name:   name,
+			Status: mcpStatusFailed,
+			Tools:  []protocol.MCPTool{},
+			Error:  err.Error(),
+		})
+	}
+	slices.SortFunc(report, func(a, b protocol.MCPServerTools) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+	return report
 }
 
 func (m *MCPManager) Tools() []Tool {
@@ -351,7 +656,10 @@ func (m *MCPManager) Call(ctx context.Context, toolName string, args map[string]
 
 	m.mu.RLock()
 	serverName, ok := m.toolMap[toolName]
-	client := m.clients[serverName]
+	srv := m.servers[serverName]
+	if ok {
+		srv.calls.Add(1)
+	}
 	m.mu.RUnlock()
 
 	if !ok {
@@ -359,24 +667,85 @@ func (m *MCPManager) Call(ctx context.Context, toolName string, args map[string]
 		span.RecordError(err)
 		return nil, err
 	}
+	defer srv.calls.Done()
 
 	span.SetAttributes(attribute.String("mcp.server_name", serverName))
 	actualToolName := strings.TrimPrefix(toolName, serverName+":")
 	span.SetAttributes(attribute.String("mcp.actual_tool_name", actualToolName))
 
-	return client.Call(ctx, actualToolName, args)
+	timeout := m.Limits(toolName).timeout()
+	callCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	result, err := srv.conn.Call(callCtx, actualToolName, args)
+	if err != nil && ctx.Err() == nil && errors.Is(callCtx.Err(), context.DeadlineExceeded) {
+		err = fmt.Errorf("tool %s timed out after %s", toolName, timeout)
+		span.RecordError(err)
+	}
+	return result, err
+}
+
+// Limits returns the limits for a namespaced tool: the server's limits with
+// any per-tool overrides applied.
+func (m *MCPManager) Limits(toolName string) ToolLimits {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	serverName, ok := m.toolMap[toolName]
+	if !ok {
+		return ToolLimits{}
+	}
+	cfg := m.servers[serverName].config
+	return cfg.Limits.merge(cfg.ToolLimits[strings.TrimPrefix(toolName, serverName+":")])
 }
 
 func (m *MCPManager) Close() error {
+	// Supervisors report status changes back to the manager while shutting
+	// down, so they are closed without holding the lock.
 	m.mu.Lock()
-	defer m.mu.Unlock()
+	servers := m.servers
+	m.servers = make(map[string]*mcpServer)
+	m.rebuildTools()
+	m.mu.Unlock()
 
 	var lastErr error
-	for name, client := range m.clients {
-		if err := client.Close(); err != nil {
+	for name, srv := range servers {
+		if err := srv.conn.Close(); err != nil {
 			slog.Error("error closing mcp server", "server", name, "error", err)
 			lastErr = err
 		}
 	}
 	return lastErr
 }
+
+// MCPServerConfigsFromProtocol converts the servers in a config update.
+func MCPServerConfigsFromProtocol(servers []protocol.MCPServerConfig) []MCPServerConfig {
+	configs := make([]MCPServerConfig, 0, len(servers))
+	for _, s := range servers {
+		cfg := MCPServerConfig{
+			Name:          s.Name,
+			TransportType: s.TransportType,
+			Command:       s.Command,
+			Args:          s.Args,
+			URL:           s.URL,
+			Headers:       s.Headers,
+			Limits:        toolLimitsFromProtocol(s.Limits),
+			ToolLimits:    make(map[string]ToolLimits, len(s.ToolLimits)),
+			Enabled:       true,
+		}
+		for tool, limits := range s.ToolLimits {
+			cfg.ToolLimits[tool] = toolLimitsFromProtocol(limits)
+		}
+		configs = append(configs, cfg)
+	}
+	return configs
+}
+
+func toolLimitsFromProtocol(l protocol.MCPToolLimits) ToolLimits {
+	return ToolLimits{
+		TimeoutSeconds: l.TimeoutSeconds,
+		MaxResultBytes: l.MaxResultBytes,
+		ResultPolicy:   l.ResultPolicy,
+		ApprovalPolicy: l.ApprovalPolicy,
+	}
+}
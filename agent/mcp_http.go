@@ -0,0 +1,542 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/longregen/alicia/pkg/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Remote MCP transports. Both speak the same JSON-RPC as the stdio client:
+//
+//   - HTTP+SSE (protocol 2024-11-05) keeps a long-lived event stream open.
+//     The server announces a POST endpoint on it, and responses to the
+//     requests posted there come back on the stream.
+//   - Streamable HTTP (protocol 2025-03-26) POSTs every message to a single
+//     URL. The reply is either a JSON body or a short event stream that ends
+//     with the response.
+
+const (
+	mcpConnectTimeout = 30 * time.Second
+
+	mcpSSEProtocolVersion  = "2024-11-05"
+	mcpHTTPProtocolVersion = "2025-03-26"
+
+	mcpSessionHeader = "Mcp-Session-Id"
+)
+
+// rpcRequester is implemented by the remote transports so the handshake and
+// tool calls can be shared between them.
+type rpcRequester interface {
+	request(ctx context.Context, method string, params any) (json.RawMessage, error)
+	notify(ctx context.Context, method string) error
+}
+
+// rpcMessage is any JSON-RPC message a server can send: a response to one of
+// our requests, a notification, or a request of its own (such as ping).
+type rpcMessage struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      *int            `json:"id,omitempty"`
+	Method  string          `json:"method,omitempty"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *jsonRPCError   `json:"error,omitempty"`
+}
+
+func (m rpcMessage) isResponse() bool { return m.ID != nil && m.Method == "" }
+
+func (m rpcMessage) unwrap() (json.RawMessage, error) {
+	if m.Error != nil {
+		return nil, m.Error
+	}
+	return m.Result, nil
+}
+
+func remoteHandshake(ctx context.Context, c rpcRequester, protocolVersion string) ([]Tool, error) {
+	if _, err := c.request(ctx, "initialize", initializeParams(protocolVersion)); err != nil {
+		return nil, fmt.Errorf("initialize: %w", err)
+	}
+	if err := c.notify(ctx, "notifications/initialized"); err != nil {
+		return nil, fmt.Errorf("initialized notification: %w", err)
+	}
+	result, err := c.request(ctx, "tools/list", map[string]any{})
+	if err != nil {
+		return nil, fmt.Errorf("list tools: %w", err)
+	}
+	return parseToolsList(result)
+}
+
+func remoteCall(ctx context.Context, c rpcRequester, transport, toolName string, args map[string]any) (any, error) {
+	ctx, span := otel.Tracer("alicia-agent").Start(ctx, "mcp.call_tool",
+		trace.WithAttributes(
+			attribute.String("mcp.tool_name", toolName),
+			attribute.String("mcp.transport", transport),
+		))
+	defer span.End()
+
+	params := map[string]any{
+		"name":      toolName,
+		"arguments": args,
+		"_meta":     otel.InjectMCPMeta(ctx),
+	}
+	result, err := c.request(ctx, "tools/call", params)
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+	return decodeCallResult(span, result)
+}
+
+func setHeaders(req *http.Request, headers map[string]string) {
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+}
+
+// httpStatusError reads a short excerpt of an unexpected response body.
+func httpStatusError(resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	return fmt.Errorf("http %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+}
+
+// sseEvent is a single server-sent event.
+type sseEvent struct {
+	Event string
+	Data  string
+}
+
+// readSSE parses a text/event-stream and calls fn for every event until fn
+// returns false or the stream ends.
+func readSSE(r io.Reader, fn func(sseEvent) bool) error {
+	br := bufio.NewReader(r)
+	var ev sseEvent
+	var data []string
+	for {
+		line, err := br.ReadString('\n')
+		if err != nil {
+			// An event without its terminating blank line is incomplete.
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+		line = strings.TrimRight(line, "\r\n")
+
+		switch {
+		case line == "":
+			if len(data) > 0 {
+				ev.Data = strings.Join(data, "\n")
+				if !fn(ev) {
+					return nil
+				}
+			}
+			ev, data = sseEvent{}, nil
+		case strings.HasPrefix(line, ":"):
+			// comment / keep-alive
+		default:
+			field, value, _ := strings.Cut(line, ":")
+			value = strings.TrimPrefix(value, " ")
+			switch field {
+			case "event":
+				ev.Event = value
+			case "data":
+				data = append(data, value)
+			}
+		}
+	}
+}
+
+// --- HTTP+SSE ---
+
+// MCPSSEClient talks to an MCP server over the HTTP+SSE transport.
+type MCPSSEClient struct {
+	http     *http.Client
+	headers  map[string]string
+	endpoint string // where requests are POSTed, announced by the server
+	stream   io.ReadCloser
+	tools    []Tool
+
+	mu      sync.Mutex
+	nextID  int
+	pending map[int]chan rpcMessage
+	err     error         // why the stream ended
+	done    chan struct{} // closed when the stream ends
+}
+
+// NewMCPSSEClient opens the event stream at rawURL, waits for the server to
+// announce its message endpoint and performs the initialization handshake.
+func NewMCPSSEClient(ctx context.Context, rawURL string, headers map[string]string) (*MCPSSEClient, error) {
+	base, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("parse url: %w", err)
+	}
+
+	// The stream outlives ctx, which only bounds the connection setup.
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	setHeaders(req, headers)
+
+	c := &MCPSSEClient{
+		http:    &http.Client{},
+		headers: headers,
+		nextID:  1,
+		pending: make(map[int]chan rpcMessage),
+		done:    make(chan struct{}),
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("open stream: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		return nil, fmt.Errorf("open stream: %w", httpStatusError(resp))
+	}
+	c.stream = resp.Body
+
+	endpoint := make(chan string, 1)
+	go c.readLoop(base, endpoint)
+
+	select {
+	case ep := <-endpoint:
+		c.endpoint = ep
+	case <-c.done:
+		c.stream.Close()
+		return nil, fmt.Errorf("stream closed before endpoint: %w", c.err)
+	case <-ctx.Done():
+		c.Close()
+		return nil, fmt.Errorf("waiting for endpoint: %w", ctx.Err())
+	}
+
+	tools, err := remoteHandshake(ctx, c, mcpSSEProtocolVersion)
+	if err != nil {
+		c.Close()
+		return nil, err
+	}
+	c.tools = tools
+	return c, nil
+}
+
+func (c *MCPSSEClient) readLoop(base *url.URL, endpoint chan<- string) {
+	announced := false
+	err := readSSE(c.stream, func(ev sseEvent) bool {
+		switch ev.Event {
+		case "endpoint":
+			ref, err := url.Parse(strings.TrimSpace(ev.Data))
+			if err != nil {
+				slog.Warn("mcp sse: invalid endpoint", "data", ev.Data)
+				return true
+			}
+			if !announced {
+				announced = true
+				endpoint <- base.ResolveReference(ref).String()
+			}
+		case "", "message":
+			var msg rpcMessage
+			if err := json.Unmarshal([]byte(ev.Data), &msg); err != nil {
+				slog.Warn("mcp sse: invalid message", "raw", ev.Data)
+				return true
+			}
+			c.dispatch(msg)
+		}
+		return true
+	})
+	if err == nil {
+		err = io.EOF
+	}
+
+	c.mu.Lock()
+	c.err = err
+	c.mu.Unlock()
+	close(c.done)
+}
+
+func (c *MCPSSEClient) dispatch(msg rpcMessage) {
+	if msg.isResponse() {
+		c.mu.Lock()
+		ch, ok := c.pending[*msg.ID]
+		delete(c.pending, *msg.ID)
+		c.mu.Unlock()
+		if ok {
+			ch <- msg
+		} else {
+			slog.Warn("mcp sse: unexpected response id", "id", *msg.ID)
+		}
+		return
+	}
+	if msg.ID != nil && msg.Method == "ping" {
+		go func(id int) {
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			if err := c.post(ctx, map[string]any{"jsonrpc": "2.0", "id": id, "result": map[string]any{}}); err != nil {
+				slog.Warn("mcp sse: ping reply failed", "error", err)
+			}
+		}(*msg.ID)
+	}
+}
+
+func (c *MCPSSEClient) post(ctx context.Context, msg any) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("marshal: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.endpoint, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	setHeaders(req, c.headers)
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("post: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return httpStatusError(resp)
+	}
+	io.Copy(io.Discard, resp.Body)
+	return nil
+}
+
+func (c *MCPSSEClient) request(ctx context.Context, method string, params any) (json.RawMessage, error) {
+	ch := make(chan rpcMessage, 1)
+	c.mu.Lock()
+	id := c.nextID
+	c.nextID++
+	c.pending[id] = ch
+	c.mu.Unlock()
+
+	defer func() {
+		c.mu.Lock()
+		delete(c.pending, id)
+		c.mu.Unlock()
+	}()
+
+	if err := c.post(ctx, jsonRPCRequest{JSONRPC: "2.0", ID: id, Method: method, Params: params}); err != nil {
+		return nil, err
+	}
+
+	select {
+	case msg := <-ch:
+		return msg.unwrap()
+	case <-c.done:
+		return nil, fmt.Errorf("stream closed: %w", c.err)
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (c *MCPSSEClient) notify(ctx context.Context, method string) error {
+	return c.post(ctx, jsonRPCRequest{JSONRPC: "2.0", Method: method})
+}
+
+func (c *MCPSSEClient) Tools() []Tool {
+	return c.tools
+}
+
+func (c *MCPSSEClient) Call(ctx context.Context, toolName string, args map[string]any) (any, error) {
+	return remoteCall(ctx, c, "sse", toolName, args)
+}
+
+func (c *MCPSSEClient) Close() error {
+	err := c.stream.Close()
+	<-c.done
+	return err
+}
+
+// --- Streamable HTTP ---
+
+// MCPHTTPClient talks to an MCP server over the Streamable HTTP transport.
+type MCPHTTPClient struct {
+	http    *http.Client
+	url     string
+	headers map[string]string
+	tools   []Tool
+
+	mu        sync.Mutex
+	nextID    int
+	sessionID string
+}
+
+// NewMCPHTTPClient performs the initialization handshake against the MCP
+// endpoint at rawURL.
+func NewMCPHTTPClient(ctx context.Context, rawURL string, headers map[string]string) (*MCPHTTPClient, error) {
+	if _, err := url.Parse(rawURL); err != nil {
+		return nil, fmt.Errorf("parse url: %w", err)
+	}
+
+	c := &MCPHTTPClient{
+		http:    &http.Client{},
+		url:     rawURL,
+		headers: headers,
+		nextID:  1,
+	}
+
+	tools, err := remoteHandshake(ctx, c, mcpHTTPProtocolVersion)
+	if err != nil {
+		c.Close()
+		return nil, err
+	}
+	c.tools = tools
+	return c, nil
+}
+
+func (c *MCPHTTPClient) newRequest(ctx context.Context, method string, body []byte) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, c.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json, text/event-stream")
+	setHeaders(req, c.headers)
+
+	c.mu.Lock()
+	if c.sessionID != "" {
+		req.Header.Set(mcpSessionHeader, c.sessionID)
+	}
+	c.mu.Unlock()
+	return req, nil
+}
+
+// send POSTs a message and returns the response, recording the session ID
+// the server assigns during initialization.
+func (c *MCPHTTPClient) send(ctx context.Context, msg any) (*http.Response, error) {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return nil, fmt.Errorf("marshal: %w", err)
+	}
+	req, err := c.newRequest(ctx, http.MethodPost, data)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("post: %w", err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		if resp.StatusCode == http.StatusNotFound && req.Header.Get(mcpSessionHeader) != "" {
+			return nil, fmt.Errorf("session expired: %w", httpStatusError(resp))
+		}
+		return nil, httpStatusError(resp)
+	}
+
+	if sid := resp.Header.Get(mcpSessionHeader); sid != "" {
+		c.mu.Lock()
+		c.sessionID = sid
+		c.mu.Unlock()
+	}
+	return resp, nil
+}
+
+func (c *MCPHTTPClient) request(ctx context.Context, method string, params any) (json.RawMessage, error) {
+	c.mu.Lock()
+	id := c.nextID
+	c.nextID++
+	c.mu.Unlock()
+
+	resp, err := c.send(ctx, jsonRPCRequest{JSONRPC: "2.0", ID: id, Method: method, Params: params})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	switch mediaType {
+	case "application/json":
+		var msg rpcMessage
+		if err := json.NewDecoder(resp.Body).Decode(&msg); err != nil {
+			return nil, fmt.Errorf("decode response: %w", err)
+		}
+		if msg.ID == nil || *msg.ID != id {
+			return nil, fmt.Errorf("unexpected response id for request %d", id)
+		}
+		return msg.unwrap()
+
+	case "text/event-stream":
+		var result *rpcMessage
+		err := readSSE(resp.Body, func(ev sseEvent) bool {
+			var msg rpcMessage
+			if err := json.Unmarshal([]byte(ev.Data), &msg); err != nil {
+				slog.Warn("mcp http: invalid message", "raw", ev.Data)
+				return true
+			}
+			if msg.isResponse() && *msg.ID == id {
+				result = &msg
+				return false
+			}
+			return true // notifications and progress updates
+		})
+		if result != nil {
+			return result.unwrap()
+		}
+		if err == nil {
+			err = io.ErrUnexpectedEOF
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, fmt.Errorf("stream ended without response: %w", err)
+
+	default:
+		return nil, fmt.Errorf("unexpected content type %q", resp.Header.Get("Content-Type"))
+	}
+}
+
+func (c *MCPHTTPClient) notify(ctx context.Context, method string) error {
+	resp, err := c.send(ctx, jsonRPCRequest{JSONRPC: "2.0", Method: method})
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func (c *MCPHTTPClient) Tools() []Tool {
+	return c.tools
+}
+
+func (c *MCPHTTPClient) Call(ctx context.Context, toolName string, args map[string]any) (any, error) {
+	return remoteCall(ctx, c, "streamable-http", toolName, args)
+}
+
+// Close ends the session on the server, if it issued one.
+func (c *MCPHTTPClient) Close() error {
+	c.mu.Lock()
+	sid := c.sessionID
+	c.mu.Unlock()
+	if sid == "" {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	req, err := c.newRequest(ctx, http.MethodDelete, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
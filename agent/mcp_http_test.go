@@ -0,0 +1,262 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const testMCPToken = "Bearer secret"
+
+type testRPCRequest struct {
+	ID     *int            `json:"id"`
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params"`
+}
+
+// handleTestRPC implements a tiny MCP server with a single "echo" tool.
+func handleTestRPC(req testRPCRequest) map[string]any {
+	resp := map[string]any{"jsonrpc": "2.0", "id": *req.ID}
+	switch req.Method {
+	case "initialize":
+		resp["result"] = map[string]any{
+			"protocolVersion": "2025-03-26",
+			"capabilities":    map[string]any{"tools": map[string]any{}},
+			"serverInfo":      map[string]any{"name": "test", "version": "1.0"},
+		}
+	case "tools/list":
+		resp["result"] = map[string]any{"tools": []map[string]any{{
+			"name":        "echo",
+			"description": "Echo text back",
+			"inputSchema": map[string]any{"type": "object"},
+		}}}
+	case "tools/call":
+		var params struct {
+			Arguments struct {
+				Text string `json:"text"`
+			} `json:"arguments"`
+		}
+		json.Unmarshal(req.Params, &params)
+		resp["result"] = map[string]any{"content": []map[string]any{{"type": "text", "text": params.Arguments.Text}}}
+	default:
+		resp["error"] = map[string]any{"code": -32601, "message": "method not found"}
+	}
+	return resp
+}
+
+func newStreamableHTTPServer(t *testing.T) (*httptest.Server, *bool) {
+	var mu sync.Mutex
+	deleted := false
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != testMCPToken {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if r.Method == http.MethodDelete {
+			mu.Lock()
+			deleted = r.Header.Get(mcpSessionHeader) == "sess-1"
+			mu.Unlock()
+			return
+		}
+
+		var req testRPCRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if req.Method != "initialize" && r.Header.Get(mcpSessionHeader) != "sess-1" {
+			http.Error(w, "unknown session", http.StatusNotFound)
+			return
+		}
+		if req.ID == nil {
+			w.WriteHeader(http.StatusAccepted)
+			return
+		}
+		if req.Method == "initialize" {
+			w.Header().Set(mcpSessionHeader, "sess-1")
+		}
+
+		resp, _ := json.Marshal(handleTestRPC(req))
+		if req.Method != "tools/call" {
+			w.Header().Set("Content-Type", "application/json")
+			w.Write(resp)
+			return
+		}
+		// Tool calls answer over an event stream, preceded by a notification.
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "event: message\ndata: {\"jsonrpc\":\"2.0\",\"method\":\"notifications/progress\"}\n\n")
+		fmt.Fprintf(w, "event: message\ndata: %s\n\n", resp)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &deleted
+}
+
+func newSSEServer(t *testing.T) *httptest.Server {
+	outbox := make(chan []byte, 16)
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /sse", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != testMCPToken {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, ": connected\n\nevent: endpoint\ndata: /messages?sessionId=1\n\n")
+		w.(http.Flusher).Flush()
+		for {
+			select {
+			case msg := <-outbox:
+				fmt.Fprintf(w, "event: message\ndata: %s\n\n", msg)
+				w.(http.Flusher).Flush()
+			case <-r.Context().Done():
+				return
+			}
+		}
+	})
+	mux.HandleFunc("POST /messages", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("sessionId") != "1" || r.Header.Get("Authorization") != testMCPToken {
+			http.Error(w, "bad session", http.StatusBadRequest)
+			return
+		}
+		var req testRPCRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if req.ID != nil {
+			resp, _ := json.Marshal(handleTestRPC(req))
+			outbox <- resp
+		}
+		w.WriteHeader(http.StatusAccepted)
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func testCtx(t *testing.T) context.Context {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	t.Cleanup(cancel)
+	return ctx
+}
+
+func TestMCPHTTPClient(t *testing.T) {
+	srv, deleted := newStreamableHTTPServer(t)
+	ctx := testCtx(t)
+
+	c, err := NewMCPHTTPClient(ctx, srv.URL, map[string]string{"Authorization": testMCPToken})
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	if tools := c.Tools(); len(tools) != 1 || tools[0].Name != "echo" {
+		t.Fatalf("unexpected tools: %+v", tools)
+	}
+
+	got, err := c.Call(ctx, "echo", map[string]any{"text": "hello"})
+	if err != nil {
+		t.Fatalf("call: %v", err)
+	}
+	if got != "hello" {
+		t.Errorf("call result = %v, want hello", got)
+	}
+
+	if err := c.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	if !*deleted {
+		t.Error("session was not terminated on close")
+	}
+}
+
+func TestMCPHTTPClientRequiresHeaders(t *testing.T) {
+	srv, _ := newStreamableHTTPServer(t)
+
+	_, err := NewMCPHTTPClient(testCtx(t), srv.URL, nil)
+	if err == nil || !strings.Contains(err.Error(), "401") {
+		t.Fatalf("expected 401 error, got %v", err)
+	}
+}
+
+func TestMCPSSEClient(t *testing.T) {
+	srv := newSSEServer(t)
+	ctx := testCtx(t)
+
+	c, err := NewMCPSSEClient(ctx, srv.URL+"/sse", map[string]string{"Authorization": testMCPToken})
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	defer c.Close()
+
+	if tools := c.Tools(); len(tools) != 1 || tools[0].Name != "echo" {
+		t.Fatalf("unexpected tools: %+v", tools)
+	}
+
+	var wg sync.WaitGroup
+	for i := range 4 {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			text := fmt.Sprintf("msg-%d", i)
+			got, err := c.Call(ctx, "echo", map[string]any{"text": text})
+			if err != nil {
+				t.Errorf("call %d: %v", i, err)
+				return
+			}
+			if got != text {
+				t.Errorf("call %d result = %v, want %s", i, got, text)
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestMCPManagerRemoteServer(t *testing.T) {
+	srv, _ := newStreamableHTTPServer(t)
+
+	m := NewMCPManager([]MCPServerConfig{{
+		Name:          "remote",
+		TransportType: "streamable-http",
+		URL:           srv.URL,
+		Headers:       map[string]string{"Authorization": testMCPToken},
+		Enabled:       true,
+	}})
+	defer m.Close()
+
+	if tools := m.Tools(); len(tools) != 1 || tools[0].Name != "remote:echo" {
+		t.Fatalf("unexpected tools: %+v", tools)
+	}
+	got, err := m.Call(testCtx(t), "remote:echo", map[string]any{"text": "via manager"})
+	if err != nil {
+		t.Fatalf("call: %v", err)
+	}
+	if got != "via manager" {
+		t.Errorf("call result = %v", got)
+	}
+}
+
+func TestReadSSE(t *testing.T) {
+	stream := ": keep-alive\n\nevent: endpoint\ndata: /a\n\ndata: line1\r\ndata: line2\n\nevent: message\ndata: incomplete"
+
+	var events []sseEvent
+	if err := readSSE(strings.NewReader(stream), func(ev sseEvent) bool {
+		events = append(events, ev)
+		return true
+	}); err != nil {
+		t.Fatalf("readSSE: %v", err)
+	}
+
+	want := []sseEvent{{Event: "endpoint", Data: "/a"}, {Data: "line1\nline2"}}
+	if len(events) != len(want) {
+		t.Fatalf("got %d events, want %d: %+v", len(events), len(want), events)
+	}
+	for i := range want {
+		if events[i] != want[i] {
+			t.Errorf("event %d = %+v, want %+v", i, events[i], want[i])
+		}
+	}
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/longregen/alicia/shared/backoff"
+)
+
+// Statuses reported for each MCP server.
+const (
+	mcpStatusUp         = "up"
+	mcpStatusRestarting = "restarting"
+	mcpStatusFailed     = "failed"
+)
+
+const (
+	mcpPingInterval = 30 * time.Second
+	mcpPingTimeout  = 10 * time.Second
+)
+
+// MCPSupervisor keeps a stdio MCP server running. It restarts the process
+// with backoff when it exits or stops answering pings, and gives up with
+// status "failed" once the backoff strategy is exhausted. Callers hold the
+// supervisor rather than the client, so the handle survives restarts.
+type MCPSupervisor struct {
+	name     string
+	start    func() (*MCPClient, error)
+	onChange func() // called after every status change, without locks held
+
+	strategy     backoff.Strategy
+	pingInterval time.Duration
+
+	mu      sync.RWMutex
+	client  *MCPClient
+	status  string
+	lastErr error
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// NewMCPSupervisor starts the server and begins supervising it. An error is
+// returned only if the first start fails.
+func NewMCPSupervisor(name, command string, args, env []string, onChange func()) (*MCPSupervisor, error) {
+	s := newMCPSupervisor(name, func() (*MCPClient, error) {
+		return NewMCPClient(command, args, env)
+	}, onChange)
+	if err := s.run(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func newMCPSupervisor(name string, start func() (*MCPClient, error), onChange func()) *MCPSupervisor {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &MCPSupervisor{
+		name:         name,
+		start:        start,
+		onChange:     onChange,
+		strategy:     backoff.Standard,
+		pingInterval: mcpPingInterval,
+		ctx:          ctx,
+		cancel:       cancel,
+		done:         make(chan struct{}),
+	}
+}
+
+// run performs the first start and launches the supervision loop.
+func (s *MCPSupervisor) run() error {
+	client, err := s.start()
+	if err != nil {
+		s.cancel()
+		return err
+	}
+	s.client = client
+	s.status = mcpStatusUp
+	go s.supervise()
+	return nil
+}
+
+func (s *MCPSupervisor) supervise() {
+	defer close(s.done)
+	for {
+		s.mu.RLock()
+		client := s.client
+		s.mu.RUnlock()
+
+		err := s.watch(client)
+		if s.ctx.Err() != nil {
+			return
+		}
+		slog.Warn("mcp server down, restarting", "server", s.name, "error", err)
+		client.kill()
+		s.setStatus(mcpStatusRestarting, nil, err)
+
+		var next *MCPClient
+		err = backoff.RetryWithCallback(s.ctx, s.strategy, func(ctx context.Context, attempt int) error {
+			c, err := s.start()
+			if err != nil {
+				return err
+			}
+			next = c
+			return nil
+		}, func(attempt int, err error, delay time.Duration) {
+			slog.Warn("mcp server restart failed", "server", s.name, "attempt", attempt, "retry_in", delay, "error", err)
+		})
+		if s.ctx.Err() != nil {
+			if next != nil {
+				next.Close()
+			}
+			return
+		}
+		if err != nil {
+			slog.Error("mcp server failed permanently", "server", s.name, "error", err)
+			s.setStatus(mcpStatusFailed, nil, err)
+			return
+		}
+		slog.Info("mcp server restarted", "server", s.name, "tool_count", len(next.Tools()))
+		s.setStatus(mcpStatusUp, next, nil)
+	}
+}
+
+// watch blocks until the process exits, a ping fails, or the supervisor is
+// closed, and returns why the server went down.
+func (s *MCPSupervisor) watch(c *MCPClient) error {
+	ticker := time.NewTicker(s.pingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.ctx.Done():
+			return nil
+		case <-c.exited:
+			if c.waitErr != nil {
+				return fmt.Errorf("process exited: %w", c.waitErr)
+			}
+			return errors.New("process exited")
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(s.ctx, mcpPingTimeout)
+			err := c.Ping(ctx)
+			cancel()
+			if err != nil && s.ctx.Err() == nil {
+				return fmt.Errorf("ping: %w", err)
+			}
+		}
+	}
+}
+
+// setStatus records a status change. A non-nil client replaces the current
+// one; a non-nil err becomes the last error, which is kept after recovery.
+func (s *MCPSupervisor) setStatus(status string, client *MCPClient, err error) {
+	s.mu.Lock()
+	s.status = status
+	if client != nil {
+		s.client = client
+	}
+	if err != nil {
+		s.lastErr = err
+	}
+	s.mu.Unlock()
+
+	if s.onChange != nil {
+		s.onChange()
+	}
+}
+
+// Status returns the server's current status and the last error it went
+// down with, if any.
+func (s *MCPSupervisor) Status() (string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.status, s.lastErr
+}
+
+// Tools returns the tools of the running process. A server that has failed
+// permanently has none, so they are no longer offered to the model.
+func (s *MCPSupervisor) Tools() []Tool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.status == mcpStatusFailed {
+		return nil
+	}
+	return s.client.Tools()
+}
+
+func (s *MCPSupervisor) Call(ctx context.Context, toolName string, args map[string]any) (any, error) {
+	s.mu.RLock()
+	client, status, lastErr := s.client, s.status, s.lastErr
+	s.mu.RUnlock()
+
+	if status != mcpStatusUp {
+		return nil, fmt.Errorf("mcp server %s is %s: %w", s.name, status, lastErr)
+	}
+	return client.Call(ctx, toolName, args)
+}
+
+func (s *MCPSupervisor) Close() error {
+	s.cancel()
+	<-s.done
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.status != mcpStatusUp {
+		return nil // the process has already been killed
+	}
+	return s.client.Close()
+}
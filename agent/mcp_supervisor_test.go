@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/longregen/alicia/shared/backoff"
+)
+
+// TestHelperMCPServer is not a real test: it runs as a stdio MCP server when
+// re-executed by the MCP client tests. Calling its "crash" tool makes the
+// process exit, and echo calls with a delay_ms argument answer after that
+// delay, out of order with other requests.
+func TestHelperMCPServer(t *testing.T) {
+	if os.Getenv("ALICIA_MCP_HELPER") != "1" {
+		t.Skip("helper process")
+	}
+
+	var mu sync.Mutex
+	reply := func(resp map[string]any) {
+		data, _ := json.Marshal(resp)
+		mu.Lock()
+		fmt.Println(string(data))
+		mu.Unlock()
+	}
+
+	scanner := bufio.NewScanner(os.Stdin)
+	for scanner.Scan() {
+		var req testRPCRequest
+		if err := json.Unmarshal(scanner.Bytes(), &req); err != nil || req.ID == nil {
+			continue
+		}
+		if req.Method == "tools/call" && strings.Contains(string(req.Params), `"crash"`) {
+			os.Exit(3)
+		}
+		resp := handleTestRPC(req)
+		if req.Method == "ping" {
+			delete(resp, "error")
+			resp["result"] = map[string]any{}
+		}
+
+		var params struct {
+			Arguments struct {
+				DelayMs int `json:"delay_ms"`
+			} `json:"arguments"`
+		}
+		json.Unmarshal(req.Params, &params)
+		go func() {
+			time.Sleep(time.Duration(params.Arguments.DelayMs) * time.Millisecond)
+			reply(resp)
+		}()
+	}
+	os.Exit(0)
+}
+
+func startHelperMCPServer() (*MCPClient, error) {
+	return NewMCPClient(os.Args[0], []string{"-test.run=^TestHelperMCPServer$"}, []string{"ALICIA_MCP_HELPER=1"})
+}
+
+func newTestSupervisor(t *testing.T, start func() (*MCPClient, error)) (*MCPSupervisor, <-chan string) {
+	changes := make(chan string, 16)
+	var s *MCPSupervisor
+	s = newMCPSupervisor("helper", start, func() {
+		status, _ := s.Status()
+		changes <- status
+	})
+	s.strategy = backoff.Strategy{Delays: []time.Duration{10 * time.Millisecond, 10 * time.Millisecond}}
+	s.pingInterval = 50 * time.Millisecond
+	if err := s.run(); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s, changes
+}
+
+func waitForStatus(t *testing.T, changes <-chan string, want string) {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case got := <-changes:
+			if got == want {
+				return
+			}
+		case <-timeout:
+			t.Fatalf("timed out waiting for status %q", want)
+		}
+	}
+}
+
+func TestMCPSupervisorRestartsCrashedServer(t *testing.T) {
+	s, changes := newTestSupervisor(t, startHelperMCPServer)
+	ctx := testCtx(t)
+
+	if _, err := s.Call(ctx, "crash", nil); err == nil {
+		t.Fatal("expected crash call to fail")
+	}
+	waitForStatus(t, changes, mcpStatusRestarting)
+	waitForStatus(t, changes, mcpStatusUp)
+
+	got, err := s.Call(ctx, "echo", map[string]any{"text": "back"})
+	if err != nil {
+		t.Fatalf("call after restart: %v", err)
+	}
+	if got != "back" {
+		t.Errorf("call result = %v, want back", got)
+	}
+	if _, lastErr := s.Status(); lastErr == nil || !strings.Contains(lastErr.Error(), "exited") {
+		t.Errorf("last error = %v, want process exit", lastErr)
+	}
+}
+
+func TestMCPSupervisorGivesUp(t *testing.T) {
+	starts := 0
+	s, changes := newTestSupervisor(t, func() (*MCPClient, error) {
+		starts++
+		if starts > 1 {
+			return nil, errors.New("binary missing")
+		}
+		return startHelperMCPServer()
+	})
+
+	s.Call(testCtx(t), "crash", nil)
+	waitForStatus(t, changes, mcpStatusFailed)
+
+	if tools := s.Tools(); len(tools) != 0 {
+		t.Errorf("failed server still exposes tools: %+v", tools)
+	}
+	_, err := s.Call(testCtx(t), "echo", nil)
+	if err == nil || !strings.Contains(err.Error(), "binary missing") {
+		t.Errorf("call on failed server = %v", err)
+	}
+}
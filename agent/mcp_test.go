@@ -0,0 +1,209 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeMCPConn is an MCPConn whose calls signal entered and then block until
+// release is closed or their context is done.
+type fakeMCPConn struct {
+	tools   []Tool
+	entered chan struct{}
+	release chan struct{}
+	mu      sync.Mutex
+	closed  bool
+}
+
+func (c *fakeMCPConn) Tools() []Tool { return c.tools }
+
+func (c *fakeMCPConn) Call(ctx context.Context, toolName string, args map[string]any) (any, error) {
+	c.entered <- struct{}{}
+	select {
+	case <-c.release:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return nil, errors.New("closed")
+	}
+	return toolName, nil
+}
+
+func (c *fakeMCPConn) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closed = true
+	return nil
+}
+
+func (c *fakeMCPConn) isClosed() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.closed
+}
+
+func newFakeMCPManager(conns map[string]*fakeMCPConn, starts map[string]int) *MCPManager {
+	m := &MCPManager{servers: make(map[string]*mcpServer), toolMap: make(map[string]string)}
+	m.connect = func(cfg MCPServerConfig) (MCPConn, error) {
+		if cfg.URL == "" {
+			return nil, errors.New("no url")
+		}
+		starts[cfg.Name]++
+		c := &fakeMCPConn{tools: []Tool{{Name: "ping"}}, entered: make(chan struct{}, 1), release: make(chan struct{})}
+		conns[cfg.Name] = c
+		return c, nil
+	}
+	return m
+}
+
+func TestMCPManagerApply(t *testing.T) {
+	conns := make(map[string]*fakeMCPConn)
+	starts := make(map[string]int)
+	m := newFakeMCPManager(conns, starts)
+
+	a := MCPServerConfig{Name: "a", TransportType: "sse", URL: "http://a", Enabled: true}
+	b := MCPServerConfig{Name: "b", TransportType: "sse", URL: "http://b", Enabled: true}
+	m.Apply([]MCPServerConfig{a})
+
+	b2 := b
+	b2.Headers = map[string]string{"Authorization": "x"}
+	broken := MCPServerConfig{Name: "broken", TransportType: "sse", Enabled: true}
+	m.Apply([]MCPServerConfig{a, b})
+	m.Apply([]MCPServerConfig{a, b2, broken})
+
+	if starts["a"] != 1 {
+		t.Errorf("unchanged server a started %d times, want 1", starts["a"])
+	}
+	if starts["b"] != 2 {
+		t.Errorf("changed server b started %d times, want 2", starts["b"])
+	}
+
+	var names []string
+	for _, tool := range m.Tools() {
+		names = append(names, tool.Name)
+	}
+	if len(names) != 2 || names[0] != "a:ping" || names[1] != "b:ping" {
+		t.Errorf("tools = %v", names)
+	}
+
+	report := m.Report()
+	if len(report) != 3 || report[1].Name != "b" || report[2].Name != "broken" || report[2].Error == "" {
+		t.Fatalf("unexpected report: %+v", report)
+	}
+}
+
+func TestMCPManagerApplyDrainsInFlightCalls(t *testing.T) {
+	conns := make(map[string]*fakeMCPConn)
+	m := newFakeMCPManager(conns, make(map[string]int))
+	m.Apply([]MCPServerConfig{{Name: "a", TransportType: "sse", URL: "http://a", Enabled: true}})
+	conn := conns["a"]
+
+	type result struct {
+		v   any
+		err error
+	}
+	done := make(chan result, 1)
+	go func() {
+		v, err := m.Call(context.Background(), "a:ping", nil)
+		done <- result{v, err}
+	}()
+	<-conn.entered
+
+	m.Apply(nil)
+	if _, err := m.Call(context.Background(), "a:ping", nil); err == nil {
+		t.Error("expected removed tool to be unknown")
+	}
+	time.Sleep(10 * time.Millisecond)
+	if conn.isClosed() {
+		t.Fatal("server closed while a call was in flight")
+	}
+
+	close(conn.release)
+	res := <-done
+	if res.err != nil || res.v != "ping" {
+		t.Fatalf("in-flight call = %v, %v", res.v, res.err)
+	}
+	deadline := time.Now().Add(time.Second)
+	for !conn.isClosed() {
+		if time.Now().After(deadline) {
+			t.Fatal("server was not closed after its calls finished")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestMCPClientConcurrentCalls(t *testing.T) {
+	c, err := startHelperMCPServer()
+	if err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	defer c.Close()
+	ctx := testCtx(t)
+
+	// Later calls answer first, so responses arrive out of order.
+	delays := []int{300, 200, 100}
+	start := time.Now()
+	var wg sync.WaitGroup
+	for i, delay := range delays {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			text := fmt.Sprintf("call-%d", i)
+			got, err := c.Call(ctx, "echo", map[string]any{"text": text, "delay_ms": delay})
+			if err != nil {
+				t.Errorf("call %d: %v", i, err)
+				return
+			}
+			if got != text {
+				t.Errorf("call %d result = %v, want %s", i, got, text)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if elapsed := time.Since(start); elapsed >= 550*time.Millisecond {
+		t.Errorf("calls took %v, expected them to overlap", elapsed)
+	}
+}
+
+func TestRunToolCallsKeepsOrder(t *testing.T) {
+	calls := make([]LLMToolCall, 10)
+	for i := range calls {
+		calls[i] = LLMToolCall{ID: fmt.Sprint(i)}
+	}
+
+	var mu sync.Mutex
+	running, peak := 0, 0
+	results := runToolCalls(calls, func(tc LLMToolCall) string {
+		mu.Lock()
+		running++
+		peak = max(peak, running)
+		mu.Unlock()
+
+		time.Sleep(10 * time.Millisecond)
+
+		mu.Lock()
+		running--
+		mu.Unlock()
+		return tc.ID
+	})
+
+	for i, id := range results {
+		if id != fmt.Sprint(i) {
+			t.Fatalf("results out of order: %v", results)
+		}
+	}
+	if peak > maxParallelToolCalls {
+		t.Errorf("%d calls ran at once, cap is %d", peak, maxParallelToolCalls)
+	}
+	if peak < 2 {
+		t.Errorf("calls did not run concurrently")
+	}
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"log/slog"
 	"os"
 	"strconv"
@@ -57,7 +58,7 @@ func ExtractAndSaveMemories(ctx context.Context, convID, msgID string, deps Agen
 	ctx, cancel := context.WithTimeout(ctx, getMemoryExtractionTimeout())
 	defer cancel()
 
-	messages, err := LoadConversationFull(ctx, deps.DB, convID)
+	messages, err := LoadConversationChain(ctx, deps.DB, msgID)
 	if err != nil {
 		slog.ErrorContext(ctx, "memory extraction: failed to load conversation", "conv_id", convID, "error", err)
 		return
@@ -92,6 +93,7 @@ func ExtractAndSaveMemories(ctx context.Context, convID, msgID string, deps Agen
 		// Build generation record — persisted via defer at end of each candidate
 		gen := MemoryGeneration{
 			ID:                       NewMemoryGenerationID(),
+			UserID:                   deps.UserID,
 			ConversationID:           convID,
 			MessageID:                msgID,
 			MemoryContent:            candidate,
@@ -122,17 +124,17 @@ func ExtractAndSaveMemories(ctx context.Context, convID, msgID string, deps Agen
 				}
 			}()
 
-			embedding, err := deps.LLM.Embed(ctx, candidate)
+			embedding, err := deps.LLM.EmbedDocument(ctx, candidate)
 			if err != nil {
 				slog.ErrorContext(ctx, "memory embedding failed", "error", err)
 				return
 			}
-			if len(embedding) == 0 {
+			if len(embedding.Vector) == 0 {
 				slog.WarnContext(ctx, "memory embedding returned empty vector, skipping search")
 				return
 			}
 
-			existing, err := SearchMemories(ctx, deps.DB, embedding, memorySimilarityThreshold, memorySimilarityTopK)
+			existing, err := SearchMemories(ctx, deps.DB, deps.UserID, embedding.Vector, memorySimilarityThreshold, memorySimilarityTopK)
 			if err != nil {
 				slog.ErrorContext(ctx, "memory search failed", "error", err)
 				return
@@ -140,26 +142,26 @@ func ExtractAndSaveMemories(ctx context.Context, convID, msgID string, deps Agen
 			slog.InfoContext(ctx, "memory similarity search", "preview", preview, "similar_count", len(existing))
 
 			decision, promptName, promptVersion := decideMemory(ctx, deps.LLM, candidate, evalResult, existing)
-			gen.RerankDecision = decision
+			gen.RerankDecision = decision.Action
 			gen.RerankPromptName = promptName
 			gen.RerankPromptVersion = promptVersion
-			gen.Accepted = decision == "KEEP"
+			gen.TargetMemoryIDs = decision.Targets
+			gen.Accepted = decision.Action != memoryDrop
 
 			go sendMemoryScoresToLangfuse(evalResult, gen.Accepted, convID, msgID, deps.UserID)
 
-			if decision != "KEEP" {
-				slog.InfoContext(ctx, "memory discarded", "preview", preview, "decision", decision)
+			if decision.Action == memoryDrop {
+				slog.InfoContext(ctx, "memory discarded", "preview", preview, "decision", decision.Action)
 				return
 			}
 
-			importance := float32(evalResult.Importance.Rating) / 5.0
-			memID := NewMemoryID()
-			if err := CreateMemory(ctx, deps.DB, memID, candidate, embedding, importance); err != nil {
-				slog.ErrorContext(ctx, "memory creation failed", "error", err)
-			} else {
-				slog.InfoContext(ctx, "memory created", "preview", preview)
-				gen.MemoryID = &memID
+			memID, err := applyMemoryDecision(ctx, deps, decision, gen.ID, candidate, msgID, embedding, evalResult)
+			if err != nil {
+				slog.ErrorContext(ctx, "memory decision failed", "decision", decision.Action, "targets", decision.Targets, "error", err)
+				return
 			}
+			slog.InfoContext(ctx, "memory saved", "preview", preview, "decision", decision.Action, "memory_id", memID)
+			gen.MemoryID = &memID
 		}()
 	}
 }
@@ -184,6 +186,15 @@ var memoryExtractResponseFormat = &openai.ChatCompletionResponseFormat{
 	},
 }
 
+var memoryDecideResponseFormat = &openai.ChatCompletionResponseFormat{
+	Type: openai.ChatCompletionResponseFormatTypeJSONSchema,
+	JSONSchema: &openai.ChatCompletionResponseFormatJSONSchema{
+		Name:   "memory_decision",
+		Strict: true,
+		Schema: json.RawMessage(`{"type":"object","properties":{"decision":{"type":"string","enum":["KEEP","DROP","UPDATE","MERGE","SUPERSEDE"]},"targets":{"type":"array","items":{"type":"integer"}},"content":{"type":"string"}},"required":["decision","targets","content"],"additionalProperties":false}`),
+	},
+}
+
 var evalDimensionResponseFormat = &openai.ChatCompletionResponseFormat{
 	Type: openai.ChatCompletionResponseFormatTypeJSONSchema,
 	JSONSchema: &openai.ChatCompletionResponseFormatJSONSchema{
@@ -286,7 +297,108 @@ func evalDimension(ctx context.Context, llm *LLMClient, promptName, fallback, co
 	return result
 }
 
-func decideMemory(ctx context.Context, llm *LLMClient, newMemory string, eval MemoryEvalResult, existing []Memory) (decision, promptName string, promptVersion int) {
+// Memory decisions. KEEP stores the candidate as a new memory and DROP
+// discards it; the others act on the similar memories it was compared with.
+const (
+	memoryKeep      = "KEEP"
+	memoryDrop      = "DROP"
+	memoryUpdate    = "UPDATE"    // rewrite one existing memory
+	memoryMerge     = "MERGE"     // fold existing memories and the candidate into the first of them
+	memorySupersede = "SUPERSEDE" // store the candidate and archive the memories it replaces
+)
+
+// MemoryDecision is what to do with an extracted memory candidate.
+type MemoryDecision struct {
+	Action  string
+	Targets []string // IDs of the existing memories acted on
+	Content string   // the memory text to store
+}
+
+// applyMemoryDecision carries out a KEEP, UPDATE, MERGE or SUPERSEDE decision
+// and returns the ID of the memory that now holds the fact.
+func applyMemoryDecision(ctx context.Context, deps AgentDeps, d MemoryDecision, generationID, candidate, msgID string, embedding Embedding, eval MemoryEvalResult) (string, error) {
+	if d.Content != candidate {
+		var err error
+		if embedding, err = deps.LLM.EmbedDocument(ctx, d.Content); err != nil {
+			return "", fmt.Errorf("embed revised memory: %w", err)
+		}
+	}
+
+	switch d.Action {
+	case memoryUpdate:
+		return d.Targets[0], ReviseMemory(ctx, deps.DB, d.Targets[0], deps.UserID, d.Content, embedding, "update", generationID)
+	case memoryMerge:
+		return d.Targets[0], MergeMemories(ctx, deps.DB, d.Targets[0], d.Targets[1:], deps.UserID, d.Content, embedding, generationID)
+	}
+
+	memID := NewMemoryID()
+	importance := float32(eval.Importance.Rating) / 5.0
+	ratings := MemoryRatings{
+		Importance: eval.Importance.Rating,
+		Historical: eval.Historical.Rating,
+		Personal:   eval.Personal.Rating,
+		Factual:    eval.Factual.Rating,
+	}
+	if err := CreateMemory(ctx, deps.DB, memID, deps.UserID, d.Content, msgID, embedding, importance, ratings); err != nil {
+		return "", err
+	}
+	if d.Action == memorySupersede {
+		if err := SupersedeMemories(ctx, deps.DB, deps.UserID, d.Targets, memID); err != nil {
+			return memID, fmt.Errorf("archive superseded memories: %w", err)
+		}
+	}
+	return memID, nil
+}
+
+// parseMemoryDecision reads the decide step's answer. Targets are 1-based
+// positions in existing. A decision that lacks what it needs, such as an
+// UPDATE without a target, falls back to KEEP so the fact isn't lost. Plain
+// KEEP/DROP answers from older prompt versions are still understood.
+func parseMemoryDecision(text, candidate string, existing []Memory) MemoryDecision {
+	text = strings.TrimSpace(text)
+	var parsed struct {
+		Decision string `json:"decision"`
+		Targets  []int  `json:"targets"`
+		Content  string `json:"content"`
+	}
+	if err := json.Unmarshal([]byte(text), &parsed); err != nil {
+		if strings.HasPrefix(strings.ToUpper(text), memoryDrop) {
+			return MemoryDecision{Action: memoryDrop}
+		}
+		return MemoryDecision{Action: memoryKeep, Content: candidate}
+	}
+
+	d := MemoryDecision{Action: strings.ToUpper(strings.TrimSpace(parsed.Decision)), Content: strings.TrimSpace(parsed.Content)}
+	seen := make(map[string]bool)
+	for _, n := range parsed.Targets {
+		if n >= 1 && n <= len(existing) && !seen[existing[n-1].ID] {
+			seen[existing[n-1].ID] = true
+			d.Targets = append(d.Targets, existing[n-1].ID)
+		}
+	}
+
+	switch d.Action {
+	case memoryDrop:
+		return MemoryDecision{Action: memoryDrop}
+	case memoryUpdate, memoryMerge:
+		if len(d.Targets) > 0 && d.Content != "" {
+			if d.Action == memoryUpdate {
+				d.Targets = d.Targets[:1]
+			}
+			return d
+		}
+	case memorySupersede:
+		if len(d.Targets) > 0 {
+			if d.Content == "" {
+				d.Content = candidate
+			}
+			return d
+		}
+	}
+	return MemoryDecision{Action: memoryKeep, Content: candidate}
+}
+
+func decideMemory(ctx context.Context, llm *LLMClient, newMemory string, eval MemoryEvalResult, existing []Memory) (decision MemoryDecision, promptName string, promptVersion int) {
 	var existingStr string
 	if len(existing) == 0 {
 		existingStr = "(none)"
@@ -309,9 +421,10 @@ func decideMemory(ctx context.Context, llm *LLMClient, newMemory string, eval Me
 
 	promptName = prompt.Name
 	promptVersion = prompt.Version
-	decision = "KEEP"
+	decision = MemoryDecision{Action: memoryKeep, Content: newMemory}
 
 	resp, err := MakeLLMCall(ctx, llm, []LLMMessage{{Role: "user", Content: prompt.Text}}, nil, LLMCallOptions{
+		ResponseFormat: memoryDecideResponseFormat,
 		GenerationName: "memory.decide",
 		Prompt:         prompt,
 		TraceName:      "agent:memory",
@@ -322,11 +435,8 @@ func decideMemory(ctx context.Context, llm *LLMClient, newMemory string, eval Me
 		return
 	}
 
-	d := strings.ToUpper(strings.TrimSpace(resp.Content))
-	slog.InfoContext(ctx, "memory decide result", "decision", d, "existing_count", len(existing))
-	if strings.HasPrefix(d, "DROP") {
-		decision = "DROP"
-	}
+	decision = parseMemoryDecision(resp.Content, newMemory, existing)
+	slog.InfoContext(ctx, "memory decide result", "decision", decision.Action, "targets", len(decision.Targets), "existing_count", len(existing))
 	return
 }
 
@@ -448,7 +558,11 @@ Evaluation scores (1-5):
 Existing similar memories:
 {{existing_memories}}
 
-Respond KEEP if this memory is worth storing (high quality and not redundant).
-Respond DROP if low quality, redundant, or already covered.
+Choose one decision:
+- KEEP: the memory is worth storing and is not covered by an existing one.
+- DROP: the memory is low quality, redundant or already covered.
+- UPDATE: the memory refines or corrects one existing memory. Give its number in targets and the rewritten memory in content.
+- MERGE: the memory and several existing memories say overlapping things. Give their numbers in targets and one combined memory in content.
+- SUPERSEDE: the memory replaces existing memories that are no longer true (for example, the user moved to another city). Give their numbers in targets; they will be archived.
 
-No explanation needed.`
+Respond in JSON: {"decision": "...", "targets": [numbers of existing memories], "content": "memory text, or empty"}`
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseMemoryDecision(t *testing.T) {
+	existing := []Memory{{ID: "mem_lisbon"}, {ID: "mem_job"}, {ID: "mem_city"}}
+	candidate := "User moved to Berlin"
+
+	tests := []struct {
+		name string
+		text string
+		want MemoryDecision
+	}{
+		{"keep", `{"decision":"KEEP","targets":[],"content":""}`, MemoryDecision{Action: memoryKeep, Content: candidate}},
+		{"drop", `{"decision":"drop","targets":[1],"content":"x"}`, MemoryDecision{Action: memoryDrop}},
+		{"plain drop", "DROP - already known", MemoryDecision{Action: memoryDrop}},
+		{"plain keep", "KEEP", MemoryDecision{Action: memoryKeep, Content: candidate}},
+		{
+			"update keeps one target",
+			`{"decision":"UPDATE","targets":[1,3],"content":"User lives in Berlin"}`,
+			MemoryDecision{Action: memoryUpdate, Targets: []string{"mem_lisbon"}, Content: "User lives in Berlin"},
+		},
+		{
+			"merge ignores bad and repeated targets",
+			`{"decision":"MERGE","targets":[3,9,1,3],"content":"User lives in Berlin, formerly Lisbon"}`,
+			MemoryDecision{Action: memoryMerge, Targets: []string{"mem_city", "mem_lisbon"}, Content: "User lives in Berlin, formerly Lisbon"},
+		},
+		{
+			"supersede stores the candidate",
+			`{"decision":"SUPERSEDE","targets":[1],"content":""}`,
+			MemoryDecision{Action: memorySupersede, Targets: []string{"mem_lisbon"}, Content: candidate},
+		},
+		{"update without content", `{"decision":"UPDATE","targets":[1],"content":""}`, MemoryDecision{Action: memoryKeep, Content: candidate}},
+		{"supersede without targets", `{"decision":"SUPERSEDE","targets":[7],"content":""}`, MemoryDecision{Action: memoryKeep, Content: candidate}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseMemoryDecision(tt.text, candidate, existing); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
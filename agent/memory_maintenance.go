@@ -0,0 +1,351 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// Never-used memories are left alone for memoryDecayGrace after they are
+	// created, then lose half their importance every memoryUnusedHalfLife.
+	memoryDecayGrace     = 30 * 24 * time.Hour
+	memoryUnusedHalfLife = 180 * 24 * time.Hour
+
+	// Memories users rated irrelevant at least memoryDownratedMinVotes times,
+	// and more often than relevant, lose half their importance every
+	// memoryDownratedHalfLife from the latest such rating.
+	memoryDownratedMinVotes = 2
+	memoryDownratedHalfLife = 30 * 24 * time.Hour
+
+	// memoryArchiveFloor is the importance below which an unpinned memory is
+	// archived.
+	memoryArchiveFloor = 0.1
+
+	// Memories at least memoryDuplicateSimilarity similar are clustered as
+	// near-duplicates; each memory is compared with its
+	// memoryDuplicateNeighbours nearest neighbours.
+	memoryDuplicateSimilarity = 0.92
+	memoryDuplicateNeighbours = 5
+
+	// memoryMaxMergesPerRun bounds the LLM calls a run makes to consolidate
+	// clusters; the rest are merged by later runs.
+	memoryMaxMergesPerRun = 50
+
+	memoryMaintenanceTimeout = 30 * time.Minute
+)
+
+const (
+	decayReasonUnused    = "unused"
+	decayReasonDownrated = "downrated"
+)
+
+// MaintenanceReport records what a run of the memory maintenance job changed
+// or, for a dry run, would have changed.
+type MaintenanceReport struct {
+	ID         string          `json:"id"`
+	DryRun     bool            `json:"dry_run"`
+	StartedAt  time.Time       `json:"started_at"`
+	FinishedAt time.Time       `json:"finished_at"`
+	Decayed    []MemoryDecay   `json:"decayed"`
+	Archived   []MemoryArchive `json:"archived"`
+	Clusters   []MemoryCluster `json:"clusters"`
+}
+
+// MemoryDecay is a memory whose importance was lowered.
+type MemoryDecay struct {
+	MemoryID string  `json:"memory_id"`
+	UserID   string  `json:"user_id"`
+	Reason   string  `json:"reason"`
+	Before   float32 `json:"before"`
+	After    float32 `json:"after"`
+}
+
+// MemoryArchive is a memory archived for falling below the importance floor.
+type MemoryArchive struct {
+	MemoryID   string  `json:"memory_id"`
+	UserID     string  `json:"user_id"`
+	Importance float32 `json:"importance"`
+}
+
+// MemoryCluster is a group of a user's near-duplicate memories. When it is
+// consolidated the others are merged into KeepID.
+type MemoryCluster struct {
+	UserID        string   `json:"user_id"`
+	MemoryIDs     []string `json:"memory_ids"`
+	MinSimilarity float32  `json:"min_similarity"`
+	KeepID        string   `json:"keep_id,omitempty"`
+	MergedContent string   `json:"merged_content,omitempty"`
+	Skipped       string   `json:"skipped,omitempty"`
+}
+
+// planMemoryDecay works out how much each memory decays by now and which
+// memories end up below the archive floor.
+func planMemoryDecay(usage []MemoryUsage, now time.Time) ([]MemoryDecay, []MemoryArchive) {
+	var decayed []MemoryDecay
+	var archived []MemoryArchive
+	for _, u := range usage {
+		importance := u.Importance
+		if reason, since, halfLife := memoryDecayRule(u); reason != "" {
+			if u.DecayedAt != nil && u.DecayedAt.After(since) {
+				since = *u.DecayedAt
+			}
+			if elapsed := now.Sub(since); elapsed > 0 {
+				after := importance * float32(math.Pow(0.5, float64(elapsed)/float64(halfLife)))
+				if after < importance {
+					decayed = append(decayed, MemoryDecay{MemoryID: u.ID, UserID: u.UserID, Reason: reason, Before: importance, After: after})
+					importance = after
+				}
+			}
+		}
+		if importance < memoryArchiveFloor {
+			archived = append(archived, MemoryArchive{MemoryID: u.ID, UserID: u.UserID, Importance: importance})
+		}
+	}
+	return decayed, archived
+}
+
+// memoryDecayRule says whether a memory decays, from when and how fast.
+// Being rated irrelevant takes precedence over never being used.
+func memoryDecayRule(u MemoryUsage) (reason string, since time.Time, halfLife time.Duration) {
+	if u.Downvotes >= memoryDownratedMinVotes && u.Downvotes > u.Upvotes && u.LastDownvoteAt != nil {
+		return decayReasonDownrated, *u.LastDownvoteAt, memoryDownratedHalfLife
+	}
+	if u.Uses == 0 {
+		return decayReasonUnused, u.CreatedAt.Add(memoryDecayGrace), memoryUnusedHalfLife
+	}
+	return "", time.Time{}, 0
+}
+
+// clusterMemories groups memories linked by similar pairs into clusters,
+// leaving out the excluded memories. Clusters are ordered by user and then
+// by their first memory id, and their ids are sorted.
+func clusterMemories(pairs []MemoryPair, exclude map[string]bool) []MemoryCluster {
+	parent := map[string]string{}
+	var find func(string) string
+	find = func(id string) string {
+		if p, ok := parent[id]; ok && p != id {
+			root := find(p)
+			parent[id] = root
+			return root
+		}
+		parent[id] = id
+		return id
+	}
+
+	users := map[string]string{}
+	for _, p := range pairs {
+		if exclude[p.A] || exclude[p.B] {
+			continue
+		}
+		users[p.A], users[p.B] = p.UserID, p.UserID
+		if a, b := find(p.A), find(p.B); a != b {
+			parent[b] = a
+		}
+	}
+
+	groups := map[string][]string{}
+	for id := range users {
+		root := find(id)
+		groups[root] = append(groups[root], id)
+	}
+	minSimilarity := map[string]float32{}
+	for _, p := range pairs {
+		if exclude[p.A] || exclude[p.B] {
+			continue
+		}
+		root := find(p.A)
+		if s, ok := minSimilarity[root]; !ok || p.Similarity < s {
+			minSimilarity[root] = p.Similarity
+		}
+	}
+
+	clusters := make([]MemoryCluster, 0, len(groups))
+	for root, ids := range groups {
+		sort.Strings(ids)
+		clusters = append(clusters, MemoryCluster{UserID: users[root], MemoryIDs: ids, MinSimilarity: minSimilarity[root]})
+	}
+	sort.Slice(clusters, func(i, j int) bool {
+		if clusters[i].UserID != clusters[j].UserID {
+			return clusters[i].UserID < clusters[j].UserID
+		}
+		return clusters[i].MemoryIDs[0] < clusters[j].MemoryIDs[0]
+	})
+	return clusters
+}
+
+// consolidationKeep picks the memory of a cluster the others are merged
+// into: the pinned one, or else the most important, oldest first. It
+// returns false if several are pinned, since merging would unpin some.
+func consolidationKeep(memories []Memory) (Memory, bool) {
+	var keep Memory
+	pinned := 0
+	for i, m := range memories {
+		switch {
+		case m.Pinned:
+			pinned++
+			keep = m
+		case pinned > 0:
+		case i == 0 || m.Importance > keep.Importance:
+			keep = m
+		}
+	}
+	return keep, pinned <= 1
+}
+
+// RunMemoryMaintenance decays the importance of memories that are never used
+// or that users keep rating irrelevant, archives those that fall below the
+// floor and consolidates clusters of near-duplicates into one memory. In a
+// dry run nothing is changed and the report says what would have been.
+func RunMemoryMaintenance(ctx context.Context, deps AgentDeps, dryRun bool) (*MaintenanceReport, error) {
+	report := &MaintenanceReport{ID: NewMaintenanceRunID(), DryRun: dryRun, StartedAt: time.Now()}
+
+	usage, err := LoadMemoryUsage(ctx, deps.DB)
+	if err != nil {
+		return nil, fmt.Errorf("load memory usage: %w", err)
+	}
+	report.Decayed, report.Archived = planMemoryDecay(usage, report.StartedAt)
+	if !dryRun {
+		if err := ApplyMemoryDecay(ctx, deps.DB, report.Decayed, report.Archived); err != nil {
+			return nil, fmt.Errorf("apply memory decay: %w", err)
+		}
+	}
+
+	pairs, err := LoadSimilarMemoryPairs(ctx, deps.DB, memoryDuplicateSimilarity, memoryDuplicateNeighbours)
+	if err != nil {
+		return nil, fmt.Errorf("load similar memories: %w", err)
+	}
+	archived := make(map[string]bool, len(report.Archived))
+	for _, a := range report.Archived {
+		archived[a.MemoryID] = true
+	}
+	report.Clusters = clusterMemories(pairs, archived)
+	if !dryRun {
+		merges := 0
+		for i := range report.Clusters {
+			c := &report.Clusters[i]
+			if merges >= memoryMaxMergesPerRun {
+				c.Skipped = "merge limit reached"
+				continue
+			}
+			merges++
+			consolidateCluster(ctx, deps, c)
+		}
+	}
+
+	report.FinishedAt = time.Now()
+	if err := CreateMaintenanceRun(ctx, deps.DB, report); err != nil {
+		slog.ErrorContext(ctx, "memory maintenance: failed to save report", "run_id", report.ID, "error", err)
+	}
+	slog.InfoContext(ctx, "memory maintenance finished", "run_id", report.ID, "dry_run", dryRun,
+		"decayed", len(report.Decayed), "archived", len(report.Archived), "clusters", len(report.Clusters),
+		"duration", report.FinishedAt.Sub(report.StartedAt))
+	return report, nil
+}
+
+// consolidateCluster has the model write one memory from the memories of c
+// and merges them into it. Failures are recorded in c.Skipped.
+func consolidateCluster(ctx context.Context, deps AgentDeps, c *MemoryCluster) {
+	memories, err := LoadMemoriesByID(ctx, deps.DB, c.UserID, c.MemoryIDs)
+	if err != nil {
+		c.Skipped = "load failed: " + err.Error()
+		return
+	}
+	if len(memories) < 2 {
+		c.Skipped = "already consolidated"
+		return
+	}
+	keep, ok := consolidationKeep(memories)
+	if !ok {
+		c.Skipped = "several memories are pinned"
+		return
+	}
+	c.KeepID = keep.ID
+
+	var list strings.Builder
+	for _, m := range memories {
+		fmt.Fprintf(&list, "- %s\n", m.Content)
+	}
+	prompt := RetrievePromptTemplate("alicia/agent/memory-consolidate", fallbackMemoryConsolidate, map[string]string{
+		"memories": list.String(),
+	})
+	resp, err := MakeLLMCall(ctx, deps.LLM, []LLMMessage{{Role: "user", Content: prompt.Text}}, nil, LLMCallOptions{
+		GenerationName: "agent.consolidate_memories",
+		Prompt:         prompt,
+		UserID:         c.UserID,
+		TraceName:      "agent:memory_consolidation",
+	})
+	if err != nil {
+		c.Skipped = "llm call failed: " + err.Error()
+		return
+	}
+	content := strings.TrimSpace(resp.Content)
+	if content == "" {
+		c.Skipped = "empty merged memory"
+		return
+	}
+	embedding, err := deps.LLM.EmbedDocument(ctx, content)
+	if err != nil {
+		c.Skipped = "embedding failed: " + err.Error()
+		return
+	}
+
+	var merged []string
+	for _, m := range memories {
+		if m.ID != keep.ID {
+			merged = append(merged, m.ID)
+		}
+	}
+	if err := MergeMemories(ctx, deps.DB, keep.ID, merged, c.UserID, content, embedding, ""); err != nil {
+		c.Skipped = "merge failed: " + err.Error()
+		return
+	}
+	c.MergedContent = content
+}
+
+// runMemoryMaintenanceLoop runs the maintenance job every interval, counted
+// from the end of the last run, so restarts don't delay or repeat it.
+func runMemoryMaintenanceLoop(ctx context.Context, deps AgentDeps, interval time.Duration, dryRun bool) {
+	for {
+		wait := interval
+		last, err := LastMaintenanceRun(ctx, deps.DB, dryRun)
+		if err != nil {
+			slog.ErrorContext(ctx, "memory maintenance: failed to load last run", "error", err)
+		} else if last != nil {
+			wait = time.Until(last.Add(interval))
+		} else {
+			wait = 0
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+
+		runCtx, cancel := context.WithTimeout(ctx, memoryMaintenanceTimeout)
+		if _, err := RunMemoryMaintenance(runCtx, deps, dryRun); err != nil {
+			slog.ErrorContext(ctx, "memory maintenance failed", "error", err)
+			// Try again after a full interval rather than immediately.
+			select {
+			case <-ctx.Done():
+				cancel()
+				return
+			case <-time.After(interval):
+			}
+		}
+		cancel()
+	}
+}
+
+const fallbackMemoryConsolidate = `These memories about the user say overlapping or near-identical things:
+
+{{memories}}
+
+Write ONE memory that replaces all of them. Keep every distinct fact, name, date and number; where they conflict, prefer the more specific statement. Write it in the same style as the memories, as a single self-contained statement.
+
+Respond with ONLY the memory.`
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestPlanMemoryDecay(t *testing.T) {
+	now := time.Now()
+	day := 24 * time.Hour
+	ago := func(d time.Duration) *time.Time { at := now.Add(-d); return &at }
+
+	usage := []MemoryUsage{
+		// Unused for a half-life past the grace period.
+		{ID: "unused", Importance: 0.8, CreatedAt: now.Add(-memoryDecayGrace - memoryUnusedHalfLife)},
+		// Decayed a half-life ago: only the decay since then applies.
+		{ID: "decayed", Importance: 0.4, CreatedAt: now.Add(-1000 * day), DecayedAt: ago(memoryUnusedHalfLife)},
+		{ID: "new", Importance: 0.8, CreatedAt: now.Add(-day)},
+		{ID: "used", Importance: 0.8, CreatedAt: now.Add(-1000 * day), Uses: 3, LastUsedAt: ago(500 * day)},
+		// Rated irrelevant twice, the last time a half-life ago.
+		{ID: "downrated", Importance: 0.6, CreatedAt: now.Add(-100 * day), Uses: 2, Downvotes: 2, LastDownvoteAt: ago(memoryDownratedHalfLife)},
+		{ID: "disputed", Importance: 0.6, CreatedAt: now.Add(-100 * day), Uses: 4, Upvotes: 2, Downvotes: 2, LastDownvoteAt: ago(90 * day)},
+		{ID: "faded", Importance: 0.15, CreatedAt: now.Add(-memoryDecayGrace - memoryUnusedHalfLife)},
+		{ID: "low", Importance: 0.05, CreatedAt: now.Add(-day)},
+	}
+
+	decayed, archived := planMemoryDecay(usage, now)
+
+	want := map[string]struct {
+		reason string
+		after  float32
+	}{
+		"unused":    {decayReasonUnused, 0.4},
+		"decayed":   {decayReasonUnused, 0.2},
+		"downrated": {decayReasonDownrated, 0.3},
+		"faded":     {decayReasonUnused, 0.075},
+	}
+	if len(decayed) != len(want) {
+		t.Fatalf("decayed %d memories, want %d: %+v", len(decayed), len(want), decayed)
+	}
+	for _, d := range decayed {
+		w, ok := want[d.MemoryID]
+		if !ok {
+			t.Errorf("unexpected decay %+v", d)
+			continue
+		}
+		if d.Reason != w.reason || d.After < w.after-0.001 || d.After > w.after+0.001 {
+			t.Errorf("decay of %s = %s to %v, want %s to %v", d.MemoryID, d.Reason, d.After, w.reason, w.after)
+		}
+	}
+
+	var ids []string
+	for _, a := range archived {
+		ids = append(ids, a.MemoryID)
+	}
+	if !reflect.DeepEqual(ids, []string{"faded", "low"}) {
+		t.Errorf("archived %v, want [faded low]", ids)
+	}
+}
+
+func TestClusterMemories(t *testing.T) {
+	pairs := []MemoryPair{
+		{UserID: "u1", A: "m1", B: "m2", Similarity: 0.95},
+		{UserID: "u1", A: "m2", B: "m1", Similarity: 0.95},
+		{UserID: "u1", A: "m3", B: "m2", Similarity: 0.93},
+		{UserID: "u1", A: "m4", B: "m5", Similarity: 0.99},
+		{UserID: "u2", A: "m7", B: "m6", Similarity: 0.97},
+		{UserID: "u2", A: "m8", B: "m9", Similarity: 0.97},
+	}
+
+	got := clusterMemories(pairs, map[string]bool{"m9": true})
+	want := []MemoryCluster{
+		{UserID: "u1", MemoryIDs: []string{"m1", "m2", "m3"}, MinSimilarity: 0.93},
+		{UserID: "u1", MemoryIDs: []string{"m4", "m5"}, MinSimilarity: 0.99},
+		{UserID: "u2", MemoryIDs: []string{"m6", "m7"}, MinSimilarity: 0.97},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v\nwant %+v", got, want)
+	}
+}
+
+func TestConsolidationKeep(t *testing.T) {
+	now := time.Now()
+	memories := []Memory{
+		{ID: "old", Importance: 0.6, CreatedAt: now.Add(-time.Hour)},
+		{ID: "important", Importance: 0.8, CreatedAt: now},
+		{ID: "tie", Importance: 0.8, CreatedAt: now},
+	}
+	if keep, ok := consolidationKeep(memories); !ok || keep.ID != "important" {
+		t.Errorf("keep = %s, %v; want important", keep.ID, ok)
+	}
+
+	memories = append(memories, Memory{ID: "pinned", Importance: 0.2, Pinned: true})
+	if keep, ok := consolidationKeep(memories); !ok || keep.ID != "pinned" {
+		t.Errorf("keep = %s, %v; want pinned", keep.ID, ok)
+	}
+
+	memories = append(memories, Memory{ID: "pinned2", Pinned: true})
+	if _, ok := consolidationKeep(memories); ok {
+		t.Error("merging two pinned memories was allowed")
+	}
+}
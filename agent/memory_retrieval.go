@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/longregen/alicia/shared/search"
+)
+
+const (
+	// memoryMinSimilarity is the floor below which an unpinned memory is
+	// never offered by similarity, however important or recent it is. Keyword
+	// matches don't need to reach it.
+	memoryMinSimilarity = 0.5
+
+	// memoryCandidateFactor sets how many candidates are fetched per memory
+	// returned, so that ranking has something to choose from.
+	memoryCandidateFactor = 4
+
+	// noteCandidateFactor does the same for notes.
+	noteCandidateFactor = 3
+
+	// Weights of the blended ranking score. Relevance is the fused hybrid
+	// search rank and importance is stored as 0-1.
+	memoryWeightRelevance  = 0.6
+	memoryWeightImportance = 0.25
+	memoryWeightRecency    = 0.15
+
+	// memoryRecencyHalfLife is the age at which a memory's recency counts half.
+	memoryRecencyHalfLife = 90 * 24 * time.Hour
+)
+
+// RetrieveMemories returns the memories to give the model for a request:
+// every pinned memory, then the best unpinned memories by blended score that
+// pass the user's dimension thresholds, up to MemoryRetrievalCount of them.
+// Candidates are found by hybrid search on the request text and its
+// embedding, which may be nil.
+func RetrieveMemories(ctx context.Context, deps AgentDeps, text string, embedding []float32) ([]Memory, error) {
+	prefs := deps.Prefs.Get(deps.UserID)
+	candidates, err := LoadMemoryCandidates(ctx, deps.DB, deps.UserID, embedding, MemoryQuery{
+		Text:          text,
+		MinSimilarity: memoryMinSimilarity,
+		MinImportance: prefs.MemoryMinImportance,
+		MinHistorical: prefs.MemoryMinHistorical,
+		MinPersonal:   prefs.MemoryMinPersonal,
+		MinFactual:    prefs.MemoryMinFactual,
+		Limit:         prefs.MemoryRetrievalCount * memoryCandidateFactor,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return rankMemories(candidates, prefs.MemoryRetrievalCount, prefs.SearchWeights(), time.Now()), nil
+}
+
+// memoryScore blends how relevant, important and recent a memory is.
+func memoryScore(m Memory, weights search.Weights, now time.Time) float64 {
+	recency := 1.0
+	if age := now.Sub(m.CreatedAt); age > 0 {
+		recency = math.Pow(0.5, float64(age)/float64(memoryRecencyHalfLife))
+	}
+	return memoryWeightRelevance*weights.Relevance(m.VectorRank, m.KeywordRank) +
+		memoryWeightImportance*float64(m.Importance) +
+		memoryWeightRecency*recency
+}
+
+// rankMemories orders candidates by score and keeps the pinned ones plus the
+// limit best unpinned ones. Pinned memories come first. Unpinned memories
+// found only by a ranking whose weight is zero are dropped.
+func rankMemories(candidates []Memory, limit int, weights search.Weights, now time.Time) []Memory {
+	ranked := make([]Memory, 0, len(candidates))
+	for _, m := range candidates {
+		if m.Pinned || weights.Score(m.VectorRank, m.KeywordRank) > 0 {
+			ranked = append(ranked, m)
+		}
+	}
+	sort.SliceStable(ranked, func(i, j int) bool {
+		if ranked[i].Pinned != ranked[j].Pinned {
+			return ranked[i].Pinned
+		}
+		return memoryScore(ranked[i], weights, now) > memoryScore(ranked[j], weights, now)
+	})
+
+	out := ranked[:0]
+	unpinned := 0
+	for _, m := range ranked {
+		if !m.Pinned {
+			if unpinned >= limit {
+				continue
+			}
+			unpinned++
+		}
+		out = append(out, m)
+	}
+	return out
+}
+
+// rankNotes orders notes by their fused hybrid search score and keeps the
+// limit best. Notes found only by a ranking whose weight is zero are
+// dropped.
+func rankNotes(notes []Note, limit int, weights search.Weights) []Note {
+	ranked := make([]Note, 0, len(notes))
+	for _, n := range notes {
+		if weights.Score(n.VectorRank, n.KeywordRank) > 0 {
+			ranked = append(ranked, n)
+		}
+	}
+	sort.SliceStable(ranked, func(i, j int) bool {
+		return weights.Score(ranked[i].VectorRank, ranked[i].KeywordRank) >
+			weights.Score(ranked[j].VectorRank, ranked[j].KeywordRank)
+	})
+	if len(ranked) > limit {
+		ranked = ranked[:limit]
+	}
+	return ranked
+}
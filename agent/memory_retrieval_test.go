@@ -0,0 +1,61 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/longregen/alicia/shared/search"
+)
+
+func TestRankMemories(t *testing.T) {
+	now := time.Now()
+	candidates := []Memory{
+		{ID: "similar", VectorRank: 1, KeywordRank: 1, Importance: 0.2, CreatedAt: now.Add(-365 * 24 * time.Hour)},
+		{ID: "important", VectorRank: 2, KeywordRank: 3, Importance: 1.0, CreatedAt: now.Add(-24 * time.Hour)},
+		{ID: "weak", VectorRank: 3, Importance: 0.2, CreatedAt: now.Add(-365 * 24 * time.Hour)},
+		{ID: "pinned", Importance: 0.4, Pinned: true, CreatedAt: now.Add(-700 * 24 * time.Hour)},
+	}
+	weights := search.Weights{Vector: 1, Keyword: 1}
+
+	got := rankMemories(candidates, 2, weights, now)
+	want := []string{"pinned", "important", "similar"}
+	if len(got) != len(want) {
+		t.Fatalf("got %d memories, want %d: %+v", len(got), len(want), got)
+	}
+	for i, id := range want {
+		if got[i].ID != id {
+			t.Errorf("memory %d = %s, want %s", i, got[i].ID, id)
+		}
+	}
+
+	// Pinned memories don't count against the limit.
+	if got := rankMemories(candidates, 0, weights, now); len(got) != 1 || got[0].ID != "pinned" {
+		t.Errorf("with limit 0 got %+v", got)
+	}
+
+	// With keyword matching switched off, "weak" is the only other vector hit.
+	got = rankMemories(append(candidates, Memory{ID: "keyword", KeywordRank: 2, Importance: 1.0, CreatedAt: now}), 5, search.Weights{Vector: 1}, now)
+	if len(got) != 4 || got[3].ID != "weak" {
+		t.Errorf("with vector only got %+v", got)
+	}
+}
+
+func TestRankNotes(t *testing.T) {
+	notes := []Note{
+		{ID: "vector", VectorRank: 1},
+		{ID: "both", VectorRank: 2, KeywordRank: 2},
+		{ID: "keyword", KeywordRank: 1},
+		{ID: "tail", VectorRank: 3},
+	}
+
+	got := rankNotes(notes, 3, search.Weights{Vector: 1, Keyword: 1})
+	if len(got) != 3 || got[0].ID != "both" || got[1].ID != "vector" || got[2].ID != "keyword" {
+		t.Errorf("got %+v", got)
+	}
+
+	// With similarity switched off only keyword matches are left.
+	got = rankNotes(notes, 3, search.Weights{Keyword: 1})
+	if len(got) != 2 || got[0].ID != "keyword" || got[1].ID != "both" {
+		t.Errorf("keyword-weighted got %+v", got)
+	}
+}
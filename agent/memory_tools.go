@@ -0,0 +1,409 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+// Built-in tools let the model remember, look up, revise and forget the
+// user's memories and notes while it answers, instead of waiting for
+// extraction after the response. They are offered alongside the MCP tools
+// and run in the agent itself.
+const (
+	toolMemoryCreate = "memory_create"
+	toolMemorySearch = "memory_search"
+	toolMemoryUpdate = "memory_update"
+	toolMemoryDelete = "memory_delete"
+	toolNoteCreate   = "note_create"
+	toolNoteSearch   = "note_search"
+	toolNoteUpdate   = "note_update"
+	toolNoteDelete   = "note_delete"
+)
+
+const (
+	// memoryToolDuplicateSimilarity is how similar a new memory must be to
+	// an existing one for memory_create to revise that one instead.
+	memoryToolDuplicateSimilarity = 0.92
+
+	// memoryToolImportance is the importance of memories the user asked to
+	// have remembered.
+	memoryToolImportance = 0.8
+
+	// memoryToolSearchLimit is how many results the search tools return by
+	// default, and memoryToolSearchMax the most they return.
+	memoryToolSearchLimit = 5
+	memoryToolSearchMax   = 20
+)
+
+// Decisions recorded on the generations of tool changes, alongside
+// memoryUpdate.
+const (
+	memoryToolAdd    = "ADD"
+	memoryToolDelete = "DELETE"
+)
+
+// Actions reported with a MemoryTrace for changes made by the tools.
+const (
+	memoryActionCreated = "created"
+	memoryActionUpdated = "updated"
+	memoryActionDeleted = "deleted"
+)
+
+// memoryToolTurn is the request a built-in tool call is made for.
+type memoryToolTurn struct {
+	convID      string
+	msgID       string // the assistant message being generated
+	sourceMsgID string // the message changes are attributed to
+}
+
+func stringProp(description string) map[string]any {
+	return map[string]any{"type": "string", "description": description}
+}
+
+func objectSchema(required []string, props map[string]any) map[string]any {
+	return map[string]any{"type": "object", "properties": props, "required": required}
+}
+
+// MemoryTools returns the definitions of the built-in memory and note tools.
+func MemoryTools() []Tool {
+	limit := map[string]any{"type": "integer", "description": fmt.Sprintf("Maximum results (default %d)", memoryToolSearchLimit)}
+	return []Tool{
+		{
+			Name:        toolMemoryCreate,
+			Description: "Remember a fact about the user for future conversations. Use when the user asks you to remember something. Write the fact as a short standalone sentence.",
+			Schema: objectSchema([]string{"content"}, map[string]any{
+				"content": stringProp("The fact to remember"),
+			}),
+		},
+		{
+			Name:        toolMemorySearch,
+			Description: "Search the user's memories. Returns each memory's id, for memory_update and memory_delete.",
+			Schema: objectSchema([]string{"query"}, map[string]any{
+				"query": stringProp("What to look for"),
+				"limit": limit,
+			}),
+		},
+		{
+			Name:        toolMemoryUpdate,
+			Description: "Correct or replace a memory. Find its id with memory_search first.",
+			Schema: objectSchema([]string{"id", "content"}, map[string]any{
+				"id":      stringProp("The memory's id"),
+				"content": stringProp("The memory's new text"),
+			}),
+		},
+		{
+			Name:        toolMemoryDelete,
+			Description: "Forget a memory. Use when the user asks you to forget something or says it is no longer true. Find its id with memory_search first.",
+			Schema: objectSchema([]string{"id"}, map[string]any{
+				"id":     stringProp("The memory's id"),
+				"reason": stringProp("Why it is forgotten"),
+			}),
+		},
+		{
+			Name:        toolNoteCreate,
+			Description: "Save a note for the user, such as a list, a plan or a longer piece of text they want to keep.",
+			Schema: objectSchema([]string{"title", "content"}, map[string]any{
+				"title":   stringProp("The note's title"),
+				"content": stringProp("The note's text"),
+			}),
+		},
+		{
+			Name:        toolNoteSearch,
+			Description: "Search the user's notes. Returns each note's id, for note_update and note_delete.",
+			Schema: objectSchema([]string{"query"}, map[string]any{
+				"query": stringProp("What to look for"),
+				"limit": limit,
+			}),
+		},
+		{
+			Name:        toolNoteUpdate,
+			Description: "Change a note's title or text. Find its id with note_search first.",
+			Schema: objectSchema([]string{"id"}, map[string]any{
+				"id":      stringProp("The note's id"),
+				"title":   stringProp("The new title, if it changes"),
+				"content": stringProp("The new text, if it changes"),
+			}),
+		},
+		{
+			Name:        toolNoteDelete,
+			Description: "Delete a note. Find its id with note_search first.",
+			Schema: objectSchema([]string{"id"}, map[string]any{
+				"id": stringProp("The note's id"),
+			}),
+		},
+	}
+}
+
+// isMemoryTool reports whether name is one of the built-in memory and note
+// tools.
+func isMemoryTool(name string) bool {
+	switch name {
+	case toolMemoryCreate, toolMemorySearch, toolMemoryUpdate, toolMemoryDelete,
+		toolNoteCreate, toolNoteSearch, toolNoteUpdate, toolNoteDelete:
+		return true
+	}
+	return false
+}
+
+// callMemoryTool runs a built-in memory or note tool call for the user.
+// Memory changes are recorded as generations with source "tool" and reported
+// to the client as memory traces on the assistant message.
+func callMemoryTool(ctx context.Context, deps AgentDeps, turn memoryToolTurn, tc LLMToolCall) (any, error) {
+	if deps.UserID == "" {
+		return nil, fmt.Errorf("%s: no user for this conversation", tc.Name)
+	}
+	args := tc.Arguments
+	switch tc.Name {
+	case toolMemoryCreate:
+		content, err := requiredArg(args, "content")
+		if err != nil {
+			return nil, err
+		}
+		return createMemoryFromTool(ctx, deps, turn, content)
+	case toolMemorySearch:
+		query, err := requiredArg(args, "query")
+		if err != nil {
+			return nil, err
+		}
+		return searchMemoriesFromTool(ctx, deps, turn, query, limitArg(args))
+	case toolMemoryUpdate:
+		id, err := requiredArg(args, "id")
+		if err != nil {
+			return nil, err
+		}
+		content, err := requiredArg(args, "content")
+		if err != nil {
+			return nil, err
+		}
+		return updateMemoryFromTool(ctx, deps, turn, id, content)
+	case toolMemoryDelete:
+		id, err := requiredArg(args, "id")
+		if err != nil {
+			return nil, err
+		}
+		return deleteMemoryFromTool(ctx, deps, turn, id, stringArg(args, "reason"))
+	case toolNoteCreate:
+		title, err := requiredArg(args, "title")
+		if err != nil {
+			return nil, err
+		}
+		content, err := requiredArg(args, "content")
+		if err != nil {
+			return nil, err
+		}
+		embedding := embedForTool(ctx, deps, title+"\n"+content)
+		noteID := NewNoteID()
+		if err := CreateNote(ctx, deps.DB, noteID, deps.UserID, title, content, turn.sourceMsgID, embedding); err != nil {
+			return nil, fmt.Errorf("create note: %w", err)
+		}
+		return map[string]any{"id": noteID, "status": memoryActionCreated}, nil
+	case toolNoteSearch:
+		query, err := requiredArg(args, "query")
+		if err != nil {
+			return nil, err
+		}
+		prefs := deps.Prefs.Get(deps.UserID)
+		embedding, err := deps.LLM.Embed(ctx, query)
+		if err != nil {
+			embedding = nil
+		}
+		notes, err := SearchNotes(ctx, deps.DB, deps.UserID, query, embedding, prefs.NotesSimilarityThreshold, limitArg(args), prefs.SearchWeights())
+		if err != nil {
+			return nil, fmt.Errorf("search notes: %w", err)
+		}
+		results := make([]map[string]any, 0, len(notes))
+		for _, n := range notes {
+			results = append(results, map[string]any{"id": n.ID, "title": n.Title, "content": n.Content})
+		}
+		return map[string]any{"notes": results}, nil
+	case toolNoteUpdate:
+		id, err := requiredArg(args, "id")
+		if err != nil {
+			return nil, err
+		}
+		note, err := LoadNote(ctx, deps.DB, id, deps.UserID)
+		if err != nil {
+			return nil, err
+		}
+		title, content := stringArg(args, "title"), stringArg(args, "content")
+		if title == "" && content == "" {
+			return nil, fmt.Errorf("%s: title or content is required", tc.Name)
+		}
+		if title != "" {
+			note.Title = title
+		}
+		if content != "" {
+			note.Content = content
+		}
+		embedding := embedForTool(ctx, deps, note.Title+"\n"+note.Content)
+		if err := UpdateNote(ctx, deps.DB, id, deps.UserID, note.Title, note.Content, turn.sourceMsgID, embedding); err != nil {
+			return nil, fmt.Errorf("update note: %w", err)
+		}
+		return map[string]any{"id": id, "status": memoryActionUpdated}, nil
+	case toolNoteDelete:
+		id, err := requiredArg(args, "id")
+		if err != nil {
+			return nil, err
+		}
+		if err := DeleteNote(ctx, deps.DB, id, deps.UserID, turn.sourceMsgID); err != nil {
+			return nil, err
+		}
+		return map[string]any{"id": id, "status": memoryActionDeleted}, nil
+	}
+	return nil, fmt.Errorf("unknown tool %s", tc.Name)
+}
+
+// createMemoryFromTool remembers content, revising a near-identical memory
+// rather than adding a duplicate of it.
+func createMemoryFromTool(ctx context.Context, deps AgentDeps, turn memoryToolTurn, content string) (any, error) {
+	embedding := embedForTool(ctx, deps, content)
+	if len(embedding.Vector) > 0 {
+		similar, err := SearchMemories(ctx, deps.DB, deps.UserID, embedding.Vector, memoryToolDuplicateSimilarity, 1)
+		if err != nil {
+			return nil, fmt.Errorf("search memories: %w", err)
+		}
+		if len(similar) > 0 {
+			return reviseMemoryFromTool(ctx, deps, turn, similar[0].ID, content, embedding)
+		}
+	}
+
+	memID := NewMemoryID()
+	gen := toolMemoryGeneration(deps, turn, memoryToolAdd, content, memID)
+	if err := CreateMemory(ctx, deps.DB, memID, deps.UserID, content, turn.sourceMsgID, embedding, memoryToolImportance, MemoryRatings{}); err != nil {
+		return nil, fmt.Errorf("create memory: %w", err)
+	}
+	recordToolGeneration(ctx, deps, gen)
+	deps.Notifier.SendMemoryChange(ctx, turn.msgID, memID, content, memoryActionCreated)
+	return map[string]any{"id": memID, "status": memoryActionCreated}, nil
+}
+
+func updateMemoryFromTool(ctx context.Context, deps AgentDeps, turn memoryToolTurn, id, content string) (any, error) {
+	return reviseMemoryFromTool(ctx, deps, turn, id, content, embedForTool(ctx, deps, content))
+}
+
+func reviseMemoryFromTool(ctx context.Context, deps AgentDeps, turn memoryToolTurn, id, content string, embedding Embedding) (any, error) {
+	gen := toolMemoryGeneration(deps, turn, memoryUpdate, content, id)
+	if err := ReviseMemory(ctx, deps.DB, id, deps.UserID, content, embedding, "tool", gen.ID); err != nil {
+		return nil, err
+	}
+	recordToolGeneration(ctx, deps, gen)
+	deps.Notifier.SendMemoryChange(ctx, turn.msgID, id, content, memoryActionUpdated)
+	return map[string]any{"id": id, "status": memoryActionUpdated}, nil
+}
+
+func deleteMemoryFromTool(ctx context.Context, deps AgentDeps, turn memoryToolTurn, id, reason string) (any, error) {
+	memories, err := LoadMemoriesByID(ctx, deps.DB, deps.UserID, []string{id})
+	if err != nil {
+		return nil, fmt.Errorf("load memory: %w", err)
+	}
+	if len(memories) == 0 {
+		return nil, fmt.Errorf("memory %s not found", id)
+	}
+	if reason == "" {
+		reason = "forgotten at the user's request"
+	}
+	if err := DeleteMemory(ctx, deps.DB, id, deps.UserID, reason); err != nil {
+		return nil, err
+	}
+	recordToolGeneration(ctx, deps, toolMemoryGeneration(deps, turn, memoryToolDelete, memories[0].Content, id))
+	deps.Notifier.SendMemoryChange(ctx, turn.msgID, id, memories[0].Content, memoryActionDeleted)
+	return map[string]any{"id": id, "status": memoryActionDeleted}, nil
+}
+
+// searchMemoriesFromTool finds memories like RetrieveMemories does, but
+// without the user's rating thresholds, and records their use.
+func searchMemoriesFromTool(ctx context.Context, deps AgentDeps, turn memoryToolTurn, query string, limit int) (any, error) {
+	embedding, err := deps.LLM.Embed(ctx, query)
+	if err != nil {
+		embedding = nil
+	}
+	candidates, err := LoadMemoryCandidates(ctx, deps.DB, deps.UserID, embedding, MemoryQuery{
+		Text:          query,
+		MinSimilarity: memoryMinSimilarity,
+		Limit:         limit * memoryCandidateFactor,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("search memories: %w", err)
+	}
+	// Pinned memories are always candidates; only those that match count here.
+	matched := candidates[:0]
+	for _, m := range candidates {
+		if m.VectorRank > 0 || m.KeywordRank > 0 {
+			m.Pinned = false
+			matched = append(matched, m)
+		}
+	}
+	memories := rankMemories(matched, limit, deps.Prefs.Get(deps.UserID).SearchWeights(), time.Now())
+
+	results := make([]map[string]any, 0, len(memories))
+	for _, m := range memories {
+		if err := RecordMemoryUse(ctx, deps.DB, NewMemoryUseID(), deps.UserID, m.ID, turn.msgID, turn.convID, m.Similarity); err != nil {
+			return nil, fmt.Errorf("record memory use: %w", err)
+		}
+		deps.Notifier.SendMemoryTrace(ctx, turn.msgID, m.ID, m.Content, m.Similarity)
+		results = append(results, map[string]any{"id": m.ID, "content": m.Content})
+	}
+	return map[string]any{"memories": results}, nil
+}
+
+// toolMemoryGeneration describes a change the tools made to memory, for the
+// memory's provenance.
+func toolMemoryGeneration(deps AgentDeps, turn memoryToolTurn, decision, content, memID string) MemoryGeneration {
+	gen := MemoryGeneration{
+		ID:             NewMemoryGenerationID(),
+		UserID:         deps.UserID,
+		ConversationID: turn.convID,
+		MessageID:      turn.sourceMsgID,
+		MemoryContent:  content,
+		RerankDecision: decision,
+		Accepted:       true,
+		MemoryID:       &memID,
+		Source:         "tool",
+	}
+	if decision != memoryToolAdd {
+		gen.TargetMemoryIDs = []string{memID}
+	}
+	return gen
+}
+
+func recordToolGeneration(ctx context.Context, deps AgentDeps, gen MemoryGeneration) {
+	if err := CreateMemoryGeneration(ctx, deps.DB, gen); err != nil {
+		slog.ErrorContext(ctx, "memory generation record failed", "generation_id", gen.ID, "error", err)
+	}
+}
+
+// embedForTool embeds text for storage. Without an embedding the memory or
+// note is still found by keyword, and re-embedding fills it in later.
+func embedForTool(ctx context.Context, deps AgentDeps, text string) Embedding {
+	embedding, err := deps.LLM.EmbedDocument(ctx, text)
+	if err != nil {
+		slog.WarnContext(ctx, "memory tool embedding failed", "error", err)
+		return Embedding{}
+	}
+	return embedding
+}
+
+func requiredArg(args map[string]any, name string) (string, error) {
+	v := stringArg(args, name)
+	if v == "" {
+		return "", fmt.Errorf("%s is required", name)
+	}
+	return v, nil
+}
+
+func stringArg(args map[string]any, name string) string {
+	s, _ := args[name].(string)
+	return strings.TrimSpace(s)
+}
+
+// limitArg reads the search tools' limit, which JSON decodes as a float64.
+func limitArg(args map[string]any) int {
+	n, ok := args["limit"].(float64)
+	if !ok || n < 1 {
+		return memoryToolSearchLimit
+	}
+	return min(int(n), memoryToolSearchMax)
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/longregen/alicia/pkg/otel"
+)
+
+func TestMemoryTools(t *testing.T) {
+	for _, tool := range MemoryTools() {
+		if !isMemoryTool(tool.Name) {
+			t.Errorf("%s is not recognised as a memory tool", tool.Name)
+		}
+		props := tool.Schema["properties"].(map[string]any)
+		for _, name := range tool.Schema["required"].([]string) {
+			if _, ok := props[name]; !ok {
+				t.Errorf("%s requires undeclared argument %s", tool.Name, name)
+			}
+		}
+	}
+	if isMemoryTool("garden:execute_sql") || isMemoryTool(FinalAnswerToolName) {
+		t.Error("other tools are recognised as memory tools")
+	}
+}
+
+func TestCallMemoryToolArguments(t *testing.T) {
+	deps := AgentDeps{UserID: "user_1"}
+	turn := memoryToolTurn{convID: "conv_1", msgID: "msg_2", sourceMsgID: "msg_1"}
+	tests := []struct {
+		name string
+		args map[string]any
+		want string
+	}{
+		{toolMemoryCreate, map[string]any{"content": "  "}, "content is required"},
+		{toolMemoryUpdate, map[string]any{"content": "Flight is on Tuesday"}, "id is required"},
+		{toolMemoryDelete, map[string]any{}, "id is required"},
+		{toolNoteCreate, map[string]any{"title": "Packing"}, "content is required"},
+		{toolNoteSearch, map[string]any{"query": 3}, "query is required"},
+		{"note_archive", map[string]any{}, "unknown tool"},
+	}
+	for _, tt := range tests {
+		_, err := callMemoryTool(testCtx(t), deps, turn, LLMToolCall{ID: "tu_1", Name: tt.name, Arguments: tt.args})
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s(%v) = %v, want %q", tt.name, tt.args, err, tt.want)
+		}
+	}
+
+	deps.UserID = ""
+	if _, err := callMemoryTool(testCtx(t), deps, turn, LLMToolCall{Name: toolMemoryCreate, Arguments: map[string]any{"content": "x"}}); err == nil {
+		t.Error("memory tool ran without a user")
+	}
+}
+
+func TestLimitArg(t *testing.T) {
+	tests := []struct {
+		args map[string]any
+		want int
+	}{
+		{map[string]any{}, memoryToolSearchLimit},
+		{map[string]any{"limit": float64(3)}, 3},
+		{map[string]any{"limit": float64(0)}, memoryToolSearchLimit},
+		{map[string]any{"limit": "7"}, memoryToolSearchLimit},
+		{map[string]any{"limit": float64(500)}, memoryToolSearchMax},
+	}
+	for _, tt := range tests {
+		if got := limitArg(tt.args); got != tt.want {
+			t.Errorf("limitArg(%v) = %d, want %d", tt.args, got, tt.want)
+		}
+	}
+}
+
+// A generation request naming another user in its envelope still runs, and
+// uses memories, as the conversation's owner.
+func TestScopeToOwner(t *testing.T) {
+	ctx := otel.WithUserID(testCtx(t), "usr_foreign")
+	deps := AgentDeps{UserID: "usr_foreign"}
+	ownerOf := func(_ context.Context, convID string) (string, error) {
+		if convID != "conv_1" {
+			return "", errors.New("no rows")
+		}
+		return "usr_owner", nil
+	}
+
+	ctx, scoped, err := scopeToOwner(ctx, deps, "conv_1", ownerOf)
+	if err != nil {
+		t.Fatalf("scopeToOwner: %v", err)
+	}
+	if scoped.UserID != "usr_owner" || otel.UserIDFromContext(ctx) != "usr_owner" {
+		t.Errorf("scoped to deps user %q, context user %q; want usr_owner", scoped.UserID, otel.UserIDFromContext(ctx))
+	}
+
+	// Without an owner the request doesn't run at all.
+	if _, _, err := scopeToOwner(ctx, deps, "conv_missing", ownerOf); err == nil {
+		t.Error("scoped a conversation that has no owner")
+	}
+	noOwner := func(context.Context, string) (string, error) { return "", nil }
+	if _, _, err := scopeToOwner(ctx, deps, "conv_1", noOwner); err == nil {
+		t.Error("scoped to an empty owner")
+	}
+}
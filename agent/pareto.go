@@ -184,6 +184,7 @@ func createSeedCandidates(count int) []*PathCandidate {
 func runParetoExploration(ctx context.Context, convID, msgID, previousID, userQuery string, cfg GenerateConfig, paretoCfg ParetoConfig, deps AgentDeps) error {
 	deps.Notifier.SetMessageID(msgID)
 	deps.Notifier.SetPreviousID(previousID)
+	deps.Generations.Track(ctx, msgID)
 	deps.Notifier.SendStartAnswer(ctx, msgID)
 	deps.Notifier.SendThinking(ctx, msgID, "Thinking...")
 
@@ -205,7 +206,7 @@ func runParetoExploration(ctx context.Context, convID, msgID, previousID, userQu
 	// --- Setup: load history, memories, tools ---
 	setupCtx, setupSpan := otel.Tracer("alicia-agent").Start(ctx, "pareto.setup")
 
-	messages, err := LoadConversationFull(setupCtx, deps.DB, convID)
+	messages, summary, err := loadBranch(setupCtx, deps, convID, previousID)
 	if err != nil {
 		setupSpan.RecordError(err)
 		setupSpan.End()
@@ -214,20 +215,18 @@ func runParetoExploration(ctx context.Context, convID, msgID, previousID, userQu
 		return fmt.Errorf("load conversation: %w", err)
 	}
 
-	var memories []Memory
 	embedding, err := deps.LLM.Embed(setupCtx, userQuery)
 	if err != nil {
 		slog.ErrorContext(setupCtx, "failed to generate embedding for memory search", "error", err)
-	} else if len(embedding) > 0 {
-		userPrefs := deps.Prefs.Get(deps.UserID)
-		memories, err = SearchMemories(setupCtx, deps.DB, embedding, 0.7, userPrefs.MemoryRetrievalCount)
-		if err != nil {
-			slog.ErrorContext(setupCtx, "failed to search memories", "error", err)
-		} else {
-			for _, m := range memories {
-				RecordMemoryUse(setupCtx, deps.DB, NewMemoryUseID(), m.ID, msgID, convID, m.Similarity)
-				deps.Notifier.SendMemoryTrace(setupCtx, msgID, m.ID, m.Content, m.Similarity)
-			}
+		embedding = nil
+	}
+	memories, err := RetrieveMemories(setupCtx, deps, userQuery, embedding)
+	if err != nil {
+		slog.ErrorContext(setupCtx, "failed to search memories", "error", err)
+	} else {
+		for _, m := range memories {
+			RecordMemoryUse(setupCtx, deps.DB, NewMemoryUseID(), deps.UserID, m.ID, msgID, convID, m.Similarity)
+			deps.Notifier.SendMemoryTrace(setupCtx, msgID, m.ID, m.Content, m.Similarity)
 		}
 	}
 
@@ -250,7 +249,20 @@ func runParetoExploration(ctx context.Context, convID, msgID, previousID, userQu
 	seeds := createSeedCandidates(paretoCfg.BranchesPerGen)
 	weights := DefaultPathScoreWeights()
 
+	// On cancellation the best answer found so far, if any, is kept.
+	finishParetoCancelled := func() error {
+		var content, reasoning string
+		if best := archive.GetBestByWeightedSum(weights); best != nil && best.Trace != nil {
+			content = strings.TrimSpace(best.Trace.FinalAnswer)
+			reasoning = strings.Join(best.Trace.ReasoningSteps, "\n\n")
+		}
+		return finishCancelled(ctx, deps, msgID, content, reasoning)
+	}
+
 	for gen := 0; gen < paretoCfg.MaxGenerations; gen++ {
+		if isCancelled(ctx) {
+			return finishParetoCancelled()
+		}
 		genCtx, genSpan := otel.Tracer("alicia-agent").Start(ctx, "pareto.generation",
 			trace.WithAttributes(
 				attribute.Int("generation", gen+1),
@@ -320,7 +332,7 @@ func runParetoExploration(ctx context.Context, convID, msgID, previousID, userQu
 					})
 				}
 
-				execTrace, err := executeCandidateWithStrategy(execCtx, c, messages, memories, tools, userQuery, convID, cfg, deps, tracker, candidateSpanID)
+				execTrace, err := executeCandidateWithStrategy(execCtx, c, messages, summary, memories, tools, userQuery, convID, cfg, deps, tracker, candidateSpanID)
 				if err != nil {
 					execSpan.RecordError(err)
 					execSpan.End()
@@ -438,6 +450,11 @@ func runParetoExploration(ctx context.Context, convID, msgID, previousID, userQu
 		}
 		stopProgress()
 
+		if isCancelled(ctx) {
+			genSpan.End()
+			return finishParetoCancelled()
+		}
+
 		if archive.Size() == 0 {
 			genSpan.End()
 			slog.ErrorContext(genCtx, "all candidates failed in generation", "generation", gen)
@@ -626,11 +643,12 @@ func runParetoExploration(ctx context.Context, convID, msgID, previousID, userQu
 
 	// Extract and save memories asynchronously (detached context to survive client disconnect)
 	go ExtractAndSaveMemories(context.Background(), convID, msgID, deps)
+	go SummarizeConversation(context.Background(), convID, msgID, deps)
 
 	return nil
 }
 
-func executeCandidateWithStrategy(ctx context.Context, candidate *PathCandidate, history []Message, memories []Memory, tools []Tool, userQuery, convID string, cfg GenerateConfig, deps AgentDeps, tracker *toolTracker, parentSpanID string) (*ExecutionTrace, error) {
+func executeCandidateWithStrategy(ctx context.Context, candidate *PathCandidate, history []Message, summary *ConversationSummary, memories []Memory, tools []Tool, userQuery, convID string, cfg GenerateConfig, deps AgentDeps, tracker *toolTracker, parentSpanID string) (*ExecutionTrace, error) {
 	startTime := time.Now()
 
 	execTrace := &ExecutionTrace{
@@ -639,7 +657,8 @@ func executeCandidateWithStrategy(ctx context.Context, candidate *PathCandidate,
 	}
 
 	// Build messages with strategy injected
-	llmMsgs, systemPrompt := buildMessagesWithStrategy(history, memories, tools, candidate.StrategyPrompt, candidate.AccumulatedLessons)
+	llmMsgs, systemPrompt := buildMessagesWithStrategy(history, summary, memories, tools, candidate.StrategyPrompt, candidate.AccumulatedLessons)
+	llmMsgs = fitContext(llmMsgs, tools, deps.LLM.ContextWindow(), deps.LLM.maxTokens)
 
 	traceID := trace.SpanFromContext(ctx).SpanContext().TraceID().String()
 	totalTokens := 0
@@ -744,47 +763,68 @@ func executeCandidateWithStrategy(ctx context.Context, candidate *PathCandidate,
 
 		llmMsgs = append(llmMsgs, LLMMessage{Role: "assistant", Content: resp.Content, ToolCalls: resp.ToolCalls})
 
-		var iterToolCalls []ToolCallRecord
-		for _, tc := range resp.ToolCalls {
-			// Skip final_answer - it's not a real tool to execute
-			if IsFinalAnswerCall(tc) {
-				continue
-			}
-			mcpName := tc.Name
-			if strings.HasPrefix(mcpName, "mcp_garden_") {
-				mcpName = strings.TrimPrefix(mcpName, "mcp_garden_")
-			}
+		calls := executableToolCalls(resp.ToolCalls)
+		if len(calls) > 0 && deps.MCP == nil {
+			return nil, fmt.Errorf("MCP not available for tool call: %s", calls[0].Name)
+		}
 
+		type toolResult struct {
+			result any
+			text   string
+			err    error
+		}
+		results := runToolCalls(calls, func(tc LLMToolCall) toolResult {
+			mcpName := mcpToolName(tc.Name)
 			if tracker != nil {
 				tracker.Record(mcpName, tc.Arguments)
 			}
-
-			if deps.MCP == nil {
-				return nil, fmt.Errorf("MCP not available for tool call: %s", tc.Name)
+			// Candidates explore in parallel and their tool calls aren't shown
+			// to the user, so calls that need approval are refused here.
+			limits := deps.MCP.Limits(mcpName)
+			switch limits.ApprovalPolicy {
+			case approvalNever:
+				return toolResult{err: fmt.Errorf("tool %s is disabled", tc.Name)}
+			case approvalAsk:
+				return toolResult{err: fmt.Errorf("tool %s needs the user's approval, which is not available while exploring answers", tc.Name)}
 			}
+			result, err := deps.MCP.Call(ctx, mcpName, tc.Arguments)
+			if err != nil {
+				return toolResult{err: err}
+			}
+			text := fitToolResult(ctx, deps, convID, mcpName, limits, toolResultText(result))
+			return toolResult{result: result, text: text}
+		})
 
-			result, execErr := deps.MCP.Call(ctx, mcpName, tc.Arguments)
-
+		var iterToolCalls []ToolCallRecord
+		for j, tc := range calls {
+			res := results[j]
 			record := ToolCallRecord{
 				ToolName:  tc.Name,
 				Arguments: tc.Arguments,
 			}
 
 			var toolMsg LLMMessage
-			if execErr != nil {
+			if res.err != nil {
 				record.Success = false
-				record.Error = execErr.Error()
-				toolMsg = LLMMessage{Role: "tool", Content: "Error: " + execErr.Error(), ToolCallID: tc.ID}
+				record.Error = res.err.Error()
+				toolMsg = LLMMessage{Role: "tool", Content: "Error: " + res.err.Error(), ToolCallID: tc.ID}
 			} else {
 				record.Success = true
-				record.Result = result
-				toolMsg = LLMMessage{Role: "tool", Content: fmt.Sprintf("%v", result), ToolCallID: tc.ID}
+				record.Result = res.result
+				toolMsg = LLMMessage{Role: "tool", Content: res.text, ToolCallID: tc.ID}
 			}
 
 			iterToolCalls = append(iterToolCalls, record)
 			execTrace.ToolCalls = append(execTrace.ToolCalls, record)
 			llmMsgs = append(llmMsgs, toolMsg)
 		}
+		if deps.LLM.SupportsVision() {
+			for j, tc := range calls {
+				if imgMsg, ok := toolImagesMessage(tc.Name, results[j].result); ok {
+					llmMsgs = append(llmMsgs, imgMsg)
+				}
+			}
+		}
 		sendIterGeneration(iterToolCalls)
 
 		if i == cfg.MaxToolIterations-1 {
@@ -1010,7 +1050,7 @@ func startProgressTicker(ctx context.Context, notifier Notifier, msgID string, i
 	}
 }
 
-func buildMessagesWithStrategy(history []Message, memories []Memory, tools []Tool, strategy string, lessons []string) ([]LLMMessage, PromptResult) {
+func buildMessagesWithStrategy(history []Message, summary *ConversationSummary, memories []Memory, tools []Tool, strategy string, lessons []string) ([]LLMMessage, PromptResult) {
 	var msgs []LLMMessage
 
 	instructions := "## Approach Strategy\n" + strategy
@@ -1024,6 +1064,10 @@ func buildMessagesWithStrategy(history []Message, memories []Memory, tools []Too
 	systemPrompt := getSystemPrompt(memories, nil, tools, instructions)
 
 	msgs = append(msgs, LLMMessage{Role: "system", Content: systemPrompt.Text})
+	if summary != nil {
+		msgs = append(msgs, summaryMessage(summary))
+		history = historyAfterSummary(history, summary)
+	}
 
 	for _, m := range history {
 		if m.Role == "system" {
@@ -7,6 +7,7 @@ import (
 	"github.com/longregen/alicia/shared/preferences"
 	"github.com/longregen/alicia/shared/protocol"
 	"github.com/longregen/alicia/shared/ptr"
+	"github.com/longregen/alicia/shared/search"
 )
 
 // defaultTemperature returns the default temperature from env var or shared default.
@@ -30,6 +31,8 @@ type UserPreferences struct {
 	ParetoEnableCrossover    bool
 	NotesSimilarityThreshold float32
 	NotesMaxCount            int
+	SearchVectorWeight       float32
+	SearchKeywordWeight      float32
 }
 
 func DefaultPreferences() UserPreferences {
@@ -50,9 +53,17 @@ func DefaultPreferences() UserPreferences {
 		ParetoEnableCrossover:    d.ParetoEnableCrossover,
 		NotesSimilarityThreshold: d.NotesSimilarityThreshold,
 		NotesMaxCount:            d.NotesMaxCount,
+		SearchVectorWeight:       d.SearchVectorWeight,
+		SearchKeywordWeight:      d.SearchKeywordWeight,
 	}
 }
 
+// SearchWeights are the weights hybrid search fuses the vector and keyword
+// rankings with.
+func (p UserPreferences) SearchWeights() search.Weights {
+	return search.Weights{Vector: float64(p.SearchVectorWeight), Keyword: float64(p.SearchKeywordWeight)}
+}
+
 type PreferencesStore struct {
 	mu    sync.RWMutex
 	prefs map[string]UserPreferences
@@ -93,6 +104,8 @@ func (s *PreferencesStore) Update(update protocol.PreferencesUpdate) {
 		ParetoEnableCrossover:    update.ParetoEnableCrossover,
 		NotesSimilarityThreshold: update.NotesSimilarityThreshold,
 		NotesMaxCount:            update.NotesMaxCount,
+		SearchVectorWeight:       update.SearchVectorWeight,
+		SearchKeywordWeight:      update.SearchKeywordWeight,
 	}
 
 	defaults := DefaultPreferences()
@@ -123,6 +136,11 @@ func (s *PreferencesStore) Update(update protocol.PreferencesUpdate) {
 	if p.NotesMaxCount == 0 {
 		p.NotesMaxCount = defaults.NotesMaxCount
 	}
+	// Either weight may be zero, but not both.
+	if p.SearchVectorWeight == 0 && p.SearchKeywordWeight == 0 {
+		p.SearchVectorWeight = defaults.SearchVectorWeight
+		p.SearchKeywordWeight = defaults.SearchKeywordWeight
+	}
 
 	s.prefs[update.UserID] = p
 }
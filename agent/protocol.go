@@ -12,16 +12,33 @@ import (
 	"github.com/vmihailenco/msgpack/v5"
 )
 
+// wsWriter serializes writes to a WebSocket connection, which allows only one
+// writer at a time. All notifiers on a connection share its writer.
+type wsWriter struct {
+	mu   sync.Mutex
+	conn *websocket.Conn
+}
+
+func newWSWriter(conn *websocket.Conn) *wsWriter {
+	return &wsWriter{conn: conn}
+}
+
+func (w *wsWriter) WriteMessage(messageType int, data []byte) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.conn.WriteMessage(messageType, data)
+}
+
 // WSNotifier sends protocol messages over WebSocket.
 type WSNotifier struct {
-	conn           *websocket.Conn
+	conn           *wsWriter
 	conversationID string
 	messageID      string
 	previousID     string
 	mu             sync.Mutex
 }
 
-func NewWSNotifier(conn *websocket.Conn, conversationID string) *WSNotifier {
+func NewWSNotifier(conn *wsWriter, conversationID string) *WSNotifier {
 	return &WSNotifier{conn: conn, conversationID: conversationID}
 }
 
@@ -38,9 +55,6 @@ func (n *WSNotifier) SetPreviousID(id string) {
 }
 
 func (n *WSNotifier) send(ctx context.Context, msgType protocol.MessageType, body any) {
-	n.mu.Lock()
-	defer n.mu.Unlock()
-
 	env := protocol.Envelope{
 		ConversationID: n.conversationID,
 		Type:           msgType,
@@ -102,7 +116,23 @@ func (n *WSNotifier) SendToolStart(ctx context.Context, id, name string, args ma
 		ConversationID: n.conversationID,
 		ToolName:       name,
 		Arguments:      args,
-		Execution:      "server",
+		Execution:      protocol.ToolExecutionServer,
+	})
+}
+
+// SendToolApprovalRequest announces a tool call that waits for the user to
+// approve or deny it.
+func (n *WSNotifier) SendToolApprovalRequest(ctx context.Context, id, name string, args map[string]any) {
+	n.mu.Lock()
+	msgID := n.messageID
+	n.mu.Unlock()
+	n.send(ctx, protocol.TypeToolUseRequest, protocol.ToolUseRequest{
+		ID:             id,
+		MessageID:      msgID,
+		ConversationID: n.conversationID,
+		ToolName:       name,
+		Arguments:      args,
+		Execution:      protocol.ToolExecutionAwaitingApproval,
 	})
 }
 
@@ -121,6 +151,30 @@ func (n *WSNotifier) SendToolComplete(ctx context.Context, id string, success bo
 	})
 }
 
+func (n *WSNotifier) SendDelta(ctx context.Context, messageID string, seq int, delta string) {
+	n.send(ctx, protocol.TypeAssistantDelta, protocol.AssistantDelta{
+		MessageID:      messageID,
+		ConversationID: n.conversationID,
+		Sequence:       seq,
+		Delta:          delta,
+	})
+}
+
+func (n *WSNotifier) SendSentence(ctx context.Context, messageID string, seq int, text string, final bool) {
+	n.mu.Lock()
+	prevID := n.previousID
+	n.mu.Unlock()
+	n.send(ctx, protocol.TypeAssistantSentence, protocol.AssistantSentence{
+		ID:             NewSentenceID(),
+		MessageID:      messageID,
+		PreviousID:     prevID,
+		ConversationID: n.conversationID,
+		Sequence:       seq,
+		Text:           text,
+		IsFinal:        final,
+	})
+}
+
 func (n *WSNotifier) SendComplete(ctx context.Context, messageID, content string) {
 	n.mu.Lock()
 	prevID := n.previousID
@@ -134,6 +188,20 @@ func (n *WSNotifier) SendComplete(ctx context.Context, messageID, content string
 	})
 }
 
+func (n *WSNotifier) SendCancelled(ctx context.Context, messageID, content string) {
+	n.mu.Lock()
+	prevID := n.previousID
+	n.mu.Unlock()
+	n.send(ctx, protocol.TypeAssistantMsg, protocol.AssistantMessage{
+		ID:             messageID,
+		PreviousID:     prevID,
+		ConversationID: n.conversationID,
+		Content:        content,
+		Status:         "cancelled",
+		Timestamp:      time.Now().UnixMilli(),
+	})
+}
+
 func (n *WSNotifier) SendError(ctx context.Context, messageID string, err error) {
 	n.send(ctx, protocol.TypeError, protocol.Error{
 		Code:           "agent_error",
@@ -160,3 +228,27 @@ func (n *WSNotifier) SendMemoryTrace(ctx context.Context, messageID, memoryID, c
 		Relevance:      relevance,
 	})
 }
+
+func (n *WSNotifier) SendMemoryChange(ctx context.Context, messageID, memoryID, content, action string) {
+	n.send(ctx, protocol.TypeMemoryTrace, protocol.MemoryTrace{
+		ID:             NewMemoryTraceID(),
+		MemoryID:       memoryID,
+		MessageID:      messageID,
+		ConversationID: n.conversationID,
+		Content:        content,
+		Relevance:      1,
+		Action:         action,
+	})
+}
+
+func (n *WSNotifier) SendMCPToolsReport(ctx context.Context, servers []protocol.MCPServerTools) {
+	n.send(ctx, protocol.TypeMCPToolsReport, protocol.MCPToolsReport{Servers: servers})
+}
+
+func (n *WSNotifier) SendJobStatus(ctx context.Context, jobID, status, errMsg string) {
+	n.send(ctx, protocol.TypeJobStatus, protocol.JobStatus{JobID: jobID, Status: status, Error: errMsg})
+}
+
+func (n *WSNotifier) SendJobHeartbeat(ctx context.Context, jobIDs []string) {
+	n.send(ctx, protocol.TypeJobHeartbeat, protocol.JobHeartbeat{JobIDs: jobIDs})
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestWSNotifiersShareWriter(t *testing.T) {
+	const notifiers, perNotifier = 4, 50
+
+	received := make(chan int, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		n := 0
+		for n < notifiers*perNotifier {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				break
+			}
+			n++
+		}
+		received <- n
+	}))
+	defer srv.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+
+	// Notifiers for different conversations write to the same connection at
+	// once, as heartbeats and concurrent generations do.
+	ws := newWSWriter(conn)
+	var wg sync.WaitGroup
+	for i := 0; i < notifiers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			n := NewWSNotifier(ws, "conv")
+			for j := 0; j < perNotifier; j++ {
+				n.SendDelta(context.Background(), "msg", j, "token")
+			}
+		}()
+	}
+	wg.Wait()
+
+	if n := <-received; n != notifiers*perNotifier {
+		t.Errorf("server got %d messages, want %d", n, notifiers*perNotifier)
+	}
+}
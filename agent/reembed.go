@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/longregen/alicia/shared/backoff"
+)
+
+const (
+	reembedBatchSize = 100
+
+	// maxEmbeddingChars bounds the text of a note that is embedded, as the
+	// API does when it embeds notes.
+	maxEmbeddingChars = 32000
+
+	// embeddingModelRefresh is how often the agent checks which embedding
+	// model is active, to follow a cutover.
+	embeddingModelRefresh = time.Minute
+)
+
+// Reembed embeds every memory and note with model, rate requests per second
+// at most. If model is the active model the live embeddings made with any
+// other model, or missing, are replaced; otherwise the embeddings are staged
+// for CutoverEmbeddingModel. Progress is kept in the rows themselves, so an
+// interrupted run picks up where it stopped.
+func Reembed(ctx context.Context, llm *LLMClient, pool *pgxpool.Pool, model string, rate float64) error {
+	active, _, err := ActiveEmbeddingModel(ctx, pool)
+	if err != nil {
+		return fmt.Errorf("load active embedding model: %w", err)
+	}
+	staging := model != active
+
+	tick := time.NewTicker(time.Duration(float64(time.Second) / rate))
+	defer tick.Stop()
+
+	registered := false
+	for _, t := range []embeddedTable{memoriesTable, notesTable} {
+		total, err := CountPendingEmbeddings(ctx, pool, t, model, staging)
+		if err != nil {
+			return fmt.Errorf("count %s: %w", t.name, err)
+		}
+		slog.InfoContext(ctx, "re-embedding", "table", t.name, "model", model, "staging", staging, "pending", total)
+
+		done, skipped, afterID := 0, 0, ""
+		for {
+			batch, err := LoadPendingEmbeddings(ctx, pool, t, model, staging, afterID, reembedBatchSize)
+			if err != nil {
+				return fmt.Errorf("load %s: %w", t.name, err)
+			}
+			if len(batch) == 0 {
+				break
+			}
+			for _, p := range batch {
+				afterID = p.ID
+				select {
+				case <-ctx.Done():
+					return ctx.Err()
+				case <-tick.C:
+				}
+
+				var e Embedding
+				err := backoff.Retry(ctx, backoff.Quick, func(ctx context.Context, attempt int) error {
+					var err error
+					e, err = llm.EmbedWith(ctx, model, validUTF8Prefix(p.Text, maxEmbeddingChars))
+					return err
+				})
+				if err != nil {
+					return fmt.Errorf("embed %s %s: %w", t.name, p.ID, err)
+				}
+				if len(e.Vector) == 0 {
+					skipped++
+					continue
+				}
+				if !registered {
+					if err := RegisterEmbeddingModel(ctx, pool, model, len(e.Vector)); err != nil {
+						return err
+					}
+					registered = true
+				}
+
+				stored, err := StoreEmbedding(ctx, pool, t, p.ID, p.Text, e, staging)
+				if err != nil {
+					return fmt.Errorf("store %s %s: %w", t.name, p.ID, err)
+				}
+				if !stored {
+					// Edited meanwhile; the next run embeds the new text.
+					skipped++
+					continue
+				}
+				done++
+			}
+			slog.InfoContext(ctx, "re-embedding progress", "table", t.name, "done", done, "skipped", skipped, "pending", total-done-skipped)
+		}
+	}
+
+	if staging {
+		slog.InfoContext(ctx, "re-embedding finished; switch search over with -embedding-cutover", "model", model)
+	} else {
+		slog.InfoContext(ctx, "re-embedding finished", "model", model)
+	}
+	return nil
+}
+
+// followEmbeddingModel keeps llm embedding with the active model, so that
+// queries switch over when a cutover happens while the agent runs.
+func followEmbeddingModel(ctx context.Context, llm *LLMClient, pool *pgxpool.Pool) {
+	ticker := time.NewTicker(embeddingModelRefresh)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		active, _, err := ActiveEmbeddingModel(ctx, pool)
+		if err != nil {
+			slog.ErrorContext(ctx, "failed to load active embedding model", "error", err)
+			continue
+		}
+		if active != "" && active != llm.EmbeddingModel() {
+			slog.InfoContext(ctx, "embedding model switched", "from", llm.EmbeddingModel(), "to", active)
+			llm.SetEmbeddingModel(active)
+		}
+	}
+}
@@ -0,0 +1,262 @@
+package main
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// answerStreamer turns raw model output into AssistantDelta and
+// AssistantSentence notifications for a single assistant message. Text comes
+// either from plain content deltas or from the "content" argument of an
+// answer_user tool call, which is decoded incrementally from the partial JSON.
+type answerStreamer struct {
+	ctx      context.Context
+	notifier Notifier
+	msgID    string
+
+	mu          sync.Mutex
+	deltaSeq    int
+	sentenceSeq int
+	segmenter   sentenceSegmenter
+	answers     map[int]*jsonStringExtractor // tool call index -> answer_user extractor
+	text        strings.Builder
+	streamed    bool
+}
+
+func newAnswerStreamer(ctx context.Context, notifier Notifier, msgID string) *answerStreamer {
+	return &answerStreamer{
+		ctx:      ctx,
+		notifier: notifier,
+		msgID:    msgID,
+		answers:  make(map[int]*jsonStringExtractor),
+	}
+}
+
+// Handler returns a StreamHandler that feeds this streamer. A fresh handler
+// should be requested for every LLM call since tool call indexes restart.
+func (s *answerStreamer) Handler() *StreamHandler {
+	s.mu.Lock()
+	s.answers = make(map[int]*jsonStringExtractor)
+	s.mu.Unlock()
+	return &StreamHandler{
+		OnContent:  s.write,
+		OnToolCall: s.toolCall,
+	}
+}
+
+func (s *answerStreamer) toolCall(index int, name, argsDelta string) {
+	if name != FinalAnswerToolName {
+		return
+	}
+	s.mu.Lock()
+	ext, ok := s.answers[index]
+	if !ok {
+		ext = &jsonStringExtractor{key: "content"}
+		s.answers[index] = ext
+	}
+	s.mu.Unlock()
+	if text := ext.Feed(argsDelta); text != "" {
+		s.write(text)
+	}
+}
+
+func (s *answerStreamer) write(delta string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.streamed = true
+	s.text.WriteString(delta)
+	s.notifier.SendDelta(s.ctx, s.msgID, s.deltaSeq, delta)
+	s.deltaSeq++
+	for _, sentence := range s.segmenter.Push(delta) {
+		s.notifier.SendSentence(s.ctx, s.msgID, s.sentenceSeq, sentence, false)
+		s.sentenceSeq++
+	}
+}
+
+// Streamed reports whether any text has been forwarded to clients.
+func (s *answerStreamer) Streamed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.streamed
+}
+
+// Text returns everything streamed so far.
+func (s *answerStreamer) Text() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.text.String()
+}
+
+// Finish flushes any buffered partial sentence and marks the stream final.
+func (s *answerStreamer) Finish() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.streamed {
+		return
+	}
+	s.notifier.SendSentence(s.ctx, s.msgID, s.sentenceSeq, strings.TrimSpace(s.segmenter.Flush()), true)
+	s.sentenceSeq++
+}
+
+// sentenceSegmenter accumulates streamed text and splits off complete
+// sentences. A sentence ends at '.', '!', '?' or '…' followed by whitespace,
+// or at a blank line.
+type sentenceSegmenter struct {
+	buf strings.Builder
+}
+
+// minSentenceLen avoids emitting fragments like "e.g." or "1." as sentences.
+const minSentenceLen = 12
+
+func (s *sentenceSegmenter) Push(text string) []string {
+	s.buf.WriteString(text)
+	pending := s.buf.String()
+
+	var out []string
+	start := 0
+	for i := 0; i < len(pending); {
+		r, size := utf8.DecodeRuneInString(pending[i:])
+		next := i + size
+		if next >= len(pending) {
+			break
+		}
+		nextRune, _ := utf8.DecodeRuneInString(pending[next:])
+
+		boundary := false
+		switch {
+		case r == '\n' && nextRune == '\n':
+			boundary = true
+		case strings.ContainsRune(".!?…", r) && unicode.IsSpace(nextRune):
+			boundary = next-start >= minSentenceLen
+		}
+		if boundary {
+			if sentence := strings.TrimSpace(pending[start:next]); sentence != "" {
+				out = append(out, sentence)
+			}
+			start = next
+		}
+		i = next
+	}
+
+	if start > 0 {
+		rest := pending[start:]
+		s.buf.Reset()
+		s.buf.WriteString(rest)
+	}
+	return out
+}
+
+// Flush returns whatever text is still buffered.
+func (s *sentenceSegmenter) Flush() string {
+	rest := s.buf.String()
+	s.buf.Reset()
+	return rest
+}
+
+// jsonStringExtractor incrementally decodes the string value of a top-level
+// key from a JSON object that arrives in fragments, such as streamed tool call
+// arguments. Feed returns the newly decoded portion of the value.
+type jsonStringExtractor struct {
+	key   string
+	raw   strings.Builder
+	pos   int // offset in raw up to which input has been consumed
+	state int // 0 = searching for key, 1 = inside value, 2 = done
+}
+
+func (e *jsonStringExtractor) Feed(fragment string) string {
+	e.raw.WriteString(fragment)
+	data := e.raw.String()
+
+	if e.state == 0 {
+		needle := strconv.Quote(e.key)
+		idx := strings.Index(data, needle)
+		if idx < 0 {
+			return ""
+		}
+		i := idx + len(needle)
+		for i < len(data) && (data[i] == ' ' || data[i] == ':' || data[i] == '\n' || data[i] == '\t') {
+			i++
+		}
+		if i >= len(data) {
+			return ""
+		}
+		if data[i] != '"' {
+			e.state = 2
+			return ""
+		}
+		e.pos = i + 1
+		e.state = 1
+	}
+	if e.state != 1 {
+		return ""
+	}
+
+	var out strings.Builder
+	i := e.pos
+	for i < len(data) {
+		c := data[i]
+		if c == '"' {
+			e.state = 2
+			i++
+			break
+		}
+		if c != '\\' {
+			out.WriteByte(c)
+			i++
+			continue
+		}
+		if i+1 >= len(data) {
+			break // incomplete escape, wait for more input
+		}
+		switch data[i+1] {
+		case 'n':
+			out.WriteByte('\n')
+		case 't':
+			out.WriteByte('\t')
+		case 'r':
+			out.WriteByte('\r')
+		case 'b':
+			out.WriteByte('\b')
+		case 'f':
+			out.WriteByte('\f')
+		case 'u':
+			if i+6 > len(data) {
+				e.pos = i
+				return out.String()
+			}
+			r := parseHex4(data[i+2 : i+6])
+			if utf16.IsSurrogate(r) {
+				if i+12 > len(data) {
+					e.pos = i
+					return out.String()
+				}
+				if data[i+6:i+8] == `\u` {
+					r = utf16.DecodeRune(r, parseHex4(data[i+8:i+12]))
+					i += 6
+				}
+			}
+			out.WriteRune(r)
+			i += 6
+			continue
+		default:
+			out.WriteByte(data[i+1])
+		}
+		i += 2
+	}
+	e.pos = i
+	return out.String()
+}
+
+func parseHex4(s string) rune {
+	n, err := strconv.ParseUint(s, 16, 32)
+	if err != nil {
+		return utf8.RuneError
+	}
+	return rune(n)
+}
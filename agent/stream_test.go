@@ -0,0 +1,34 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSentenceSegmenter(t *testing.T) {
+	var seg sentenceSegmenter
+	var got []string
+	for _, chunk := range []string{"Hello there, fr", "iend. How are", " you today? I'm fine", ", thanks.\n\nNext"} {
+		got = append(got, seg.Push(chunk)...)
+	}
+	want := []string{"Hello there, friend.", "How are you today?", "I'm fine, thanks."}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("sentences = %q, want %q", got, want)
+	}
+	if rest := strings.TrimSpace(seg.Flush()); rest != "Next" {
+		t.Fatalf("flush = %q, want %q", rest, "Next")
+	}
+}
+
+func TestJSONStringExtractor(t *testing.T) {
+	ext := &jsonStringExtractor{key: "content"}
+	var out strings.Builder
+	for _, frag := range []string{`{"con`, `tent": "Line one\`, `nLine \"two\" é`, `\ud83d`, `\ude00 done"`, `, "x": 1}`} {
+		out.WriteString(ext.Feed(frag))
+	}
+	want := "Line one\nLine \"two\" é😀 done"
+	if out.String() != want {
+		t.Fatalf("extracted = %q, want %q", out.String(), want)
+	}
+}
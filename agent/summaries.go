@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/longregen/alicia/pkg/langfuse"
+)
+
+const (
+	// summaryKeepRecentMessages is how many of the latest messages always
+	// stay verbatim; only older messages are folded into the summary.
+	summaryKeepRecentMessages = 12
+
+	// summaryMinNewMessages is how many unsummarised messages must have
+	// accumulated past the recent window before a new summary is written.
+	summaryMinNewMessages = 16
+
+	summaryMaxInputLength = 24000
+	summaryTimeout        = 60 * time.Second
+)
+
+// loadBranch loads the branch ending at tipID together with its summary.
+// Summaries cut on other branches are invalidated first: after a regenerate
+// or an edit before the cut they describe messages this branch doesn't have,
+// and SummarizeConversation rebuilds one for the new branch.
+func loadBranch(ctx context.Context, deps AgentDeps, convID, tipID string) ([]Message, *ConversationSummary, error) {
+	if n, err := InvalidateSummariesOffBranch(ctx, deps.DB, convID, tipID); err != nil {
+		slog.ErrorContext(ctx, "failed to invalidate conversation summaries", "conversation_id", convID, "error", err)
+	} else if n > 0 {
+		slog.InfoContext(ctx, "invalidated conversation summaries", "conversation_id", convID, "count", n)
+	}
+
+	messages, err := LoadConversationChain(ctx, deps.DB, tipID)
+	if err != nil {
+		return nil, nil, err
+	}
+	summary, err := LoadBranchSummary(ctx, deps.DB, messages)
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to load conversation summary", "conversation_id", convID, "error", err)
+		return messages, nil, nil
+	}
+	return messages, summary, nil
+}
+
+// historyAfterSummary returns the messages of history that come after the
+// summary's cut point. If the cut point isn't on the branch the whole
+// history is returned.
+func historyAfterSummary(history []Message, summary *ConversationSummary) []Message {
+	if summary == nil {
+		return history
+	}
+	for i, m := range history {
+		if m.ID == summary.MessageID {
+			return history[i+1:]
+		}
+	}
+	return history
+}
+
+func summaryMessage(summary *ConversationSummary) LLMMessage {
+	return LLMMessage{Role: "system", Content: "Summary of the earlier part of this conversation:\n\n" + summary.Content}
+}
+
+// summaryCut returns the index of the first message that stays verbatim when
+// history is summarised, or 0 when there is not yet enough to summarise.
+// start is the index of the first message not covered by the current
+// summary. The cut always lands on a user message so that the recent window
+// starts with a whole turn.
+func summaryCut(history []Message, start int) int {
+	for end := len(history) - summaryKeepRecentMessages; end-start >= summaryMinNewMessages; end-- {
+		if history[end].Role == "user" {
+			return end
+		}
+	}
+	return 0
+}
+
+// SummarizeConversation folds the older part of the branch ending at tipID
+// into a new rolling summary once enough messages have accumulated past the
+// current one. It runs after a response, off the request path.
+func SummarizeConversation(ctx context.Context, convID, tipID string, deps AgentDeps) {
+	if os.Getenv("CONVERSATION_SUMMARY_ENABLED") == "false" {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, summaryTimeout)
+	defer cancel()
+
+	messages, summary, err := loadBranch(ctx, deps, convID, tipID)
+	if err != nil {
+		slog.ErrorContext(ctx, "summary: failed to load conversation", "conversation_id", convID, "error", err)
+		return
+	}
+
+	start := len(messages) - len(historyAfterSummary(messages, summary))
+	end := summaryCut(messages, start)
+	if end == 0 {
+		return
+	}
+
+	previous := "(none)"
+	if summary != nil {
+		previous = summary.Content
+	}
+	prompt := RetrievePromptTemplate("alicia/agent/conversation-summary", fallbackConversationSummary, map[string]string{
+		"previous_summary": previous,
+		"conversation":     langfuse.TruncateString(buildConversationText(messages[start:end]), summaryMaxInputLength, "..."),
+	})
+
+	resp, err := MakeLLMCall(ctx, deps.LLM, []LLMMessage{{Role: "user", Content: prompt.Text}}, nil, LLMCallOptions{
+		GenerationName: "agent.summarize_conversation",
+		Prompt:         prompt,
+		ConvID:         convID,
+		UserID:         deps.UserID,
+		TraceName:      "agent:conversation_summary",
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "summary: llm call failed", "conversation_id", convID, "error", err)
+		return
+	}
+	content := strings.TrimSpace(resp.Content)
+	if content == "" {
+		slog.WarnContext(ctx, "summary: empty summary", "conversation_id", convID)
+		return
+	}
+
+	s := ConversationSummary{
+		ID:             NewSummaryID(),
+		ConversationID: convID,
+		MessageID:      messages[end-1].ID,
+		Content:        content,
+		MessageCount:   end,
+		PromptName:     prompt.Name,
+		PromptVersion:  prompt.Version,
+	}
+	if err := CreateConversationSummary(ctx, deps.DB, s); err != nil {
+		slog.ErrorContext(ctx, "summary: failed to save", "conversation_id", convID, "error", err)
+		return
+	}
+	slog.InfoContext(ctx, "conversation summarised", "conversation_id", convID, "summary_id", s.ID,
+		"messages", fmt.Sprintf("%d-%d", start, end))
+}
+
+const fallbackConversationSummary = `You maintain a running summary of a long conversation between a user and an assistant, so the assistant can continue it without the full transcript.
+
+Previous summary:
+{{previous_summary}}
+
+Messages since the previous summary:
+{{conversation}}
+
+Write an updated summary that merges the previous summary with the new messages. Keep names, decisions, open questions, commitments, preferences the user stated, and facts the assistant will need later. Drop small talk and anything that has been superseded. Write in the third person, in plain prose or short bullet points, in at most 400 words.
+
+Respond with ONLY the summary.`
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func testBranch(n int) []Message {
+	msgs := make([]Message, n)
+	for i := range msgs {
+		role := "user"
+		if i%2 == 1 {
+			role = "assistant"
+		}
+		msgs[i] = Message{ID: fmt.Sprintf("msg_%d", i), Role: role, Content: fmt.Sprintf("message %d", i)}
+	}
+	return msgs
+}
+
+func TestSummaryCut(t *testing.T) {
+	if cut := summaryCut(testBranch(20), 0); cut != 0 {
+		t.Errorf("short branch cut at %d", cut)
+	}
+
+	history := testBranch(40)
+	cut := summaryCut(history, 0)
+	if cut == 0 || history[cut].Role != "user" || len(history)-cut < summaryKeepRecentMessages {
+		t.Fatalf("cut at %d", cut)
+	}
+	if again := summaryCut(history, cut); again != 0 {
+		t.Errorf("summarised again at %d right after a cut at %d", again, cut)
+	}
+}
+
+func TestBuildLLMMessagesWithSummary(t *testing.T) {
+	history := testBranch(10)
+	summary := &ConversationSummary{MessageID: "msg_5", Content: "They talked about gardens."}
+
+	msgs, _ := buildLLMMessages(history, summary, nil, nil, nil)
+	if msgs[1].Role != "system" || !strings.Contains(msgs[1].Content, "gardens") {
+		t.Fatalf("summary not sent: %+v", msgs[1])
+	}
+	if len(msgs) != 2+4 || msgs[2].Content != "message 6" {
+		t.Errorf("expected the summary followed by messages 6-9, got %+v", msgs[2:])
+	}
+
+	// A summary cut on another branch is ignored.
+	stale := &ConversationSummary{MessageID: "msg_other", Content: "stale"}
+	if got := historyAfterSummary(history, stale); len(got) != len(history) {
+		t.Errorf("stale summary trimmed history to %d messages", len(got))
+	}
+
+	// Trimming for the context window keeps the summary.
+	fitted := fitContext(msgs, nil, messageTokens(msgs[0])+messageTokens(msgs[1])+30, 20)
+	if fitted[1].Content != msgs[1].Content || !strings.Contains(fitted[2].Content, "left out") {
+		t.Errorf("summary not kept when trimming: %+v", fitted)
+	}
+}
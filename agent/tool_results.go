@@ -0,0 +1,206 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	defaultToolTimeout    = 2 * time.Minute
+	defaultMaxResultBytes = 16000
+
+	// Results over the size limit are truncated unless the policy is
+	// resultPolicySummarize.
+	resultPolicySummarize = "summarize"
+
+	// maxSummaryInputBytes bounds how much of a huge result is sent to the
+	// model for summarisation.
+	maxSummaryInputBytes = 200000
+)
+
+// ToolLimits bounds a tool call and the result handed back to the model, and
+// says whether the call needs the user's approval. They are configured per
+// server, with per-tool overrides; zero values fall back to the defaults.
+type ToolLimits struct {
+	TimeoutSeconds int    `json:"timeout_seconds,omitempty"`
+	MaxResultBytes int    `json:"max_result_bytes,omitempty"`
+	ResultPolicy   string `json:"result_policy,omitempty"`
+	ApprovalPolicy string `json:"approval_policy,omitempty"`
+}
+
+// merge returns l with the non-zero fields of override applied.
+func (l ToolLimits) merge(override ToolLimits) ToolLimits {
+	if override.TimeoutSeconds > 0 {
+		l.TimeoutSeconds = override.TimeoutSeconds
+	}
+	if override.MaxResultBytes > 0 {
+		l.MaxResultBytes = override.MaxResultBytes
+	}
+	if override.ResultPolicy != "" {
+		l.ResultPolicy = override.ResultPolicy
+	}
+	if override.ApprovalPolicy != "" {
+		l.ApprovalPolicy = override.ApprovalPolicy
+	}
+	return l
+}
+
+func (l ToolLimits) timeout() time.Duration {
+	if l.TimeoutSeconds > 0 {
+		return time.Duration(l.TimeoutSeconds) * time.Second
+	}
+	return defaultToolTimeout
+}
+
+func (l ToolLimits) maxResultBytes() int {
+	if l.MaxResultBytes > 0 {
+		return l.MaxResultBytes
+	}
+	return defaultMaxResultBytes
+}
+
+// toolResultText renders a tool result for the model. Strings are used as is,
+// multimodal results become their text fallback and anything else is encoded
+// as JSON.
+func toolResultText(result any) string {
+	switch r := result.(type) {
+	case string:
+		return r
+	case *ToolContent:
+		return r.Text()
+	}
+	data, err := json.Marshal(result)
+	if err != nil {
+		return fmt.Sprintf("%v", result)
+	}
+	return string(data)
+}
+
+// Text is the fallback for models that can't see images: the text parts, with
+// a placeholder describing each image.
+func (c *ToolContent) Text() string {
+	var sb strings.Builder
+	for i, p := range c.Parts {
+		if i > 0 {
+			sb.WriteString("\n")
+		}
+		switch p.Type {
+		case "image":
+			fmt.Fprintf(&sb, "[image: %s, %d bytes", p.MimeType, len(p.Data))
+			if p.URI != "" {
+				sb.WriteString(", " + p.URI)
+			}
+			sb.WriteString("]")
+		default:
+			sb.WriteString(p.Text)
+		}
+	}
+	return sb.String()
+}
+
+// toolImagesMessage returns a user message carrying the images of a tool
+// result, for models that accept images. Tool messages can only hold text,
+// so the images follow the tool results as a separate message.
+func toolImagesMessage(toolName string, result any) (LLMMessage, bool) {
+	content, ok := result.(*ToolContent)
+	if !ok {
+		return LLMMessage{}, false
+	}
+	intro := "Images returned by the tool " + toolName + ":"
+	parts := []ContentPart{{Type: "text", Text: intro}}
+	for _, p := range content.Parts {
+		if p.Type == "image" && len(p.Data) > 0 {
+			parts = append(parts, p)
+		}
+	}
+	if len(parts) == 1 {
+		return LLMMessage{}, false
+	}
+	return LLMMessage{Role: "user", Content: intro + "\n" + content.Text(), Parts: parts}, true
+}
+
+// fitToolResult shrinks a result that exceeds the tool's size limit before it
+// goes back to the model, either by truncating it or by asking the model for
+// a summary. The raw result is stored separately, so nothing is lost.
+func fitToolResult(ctx context.Context, deps AgentDeps, convID, toolName string, limits ToolLimits, text string) string {
+	limit := limits.maxResultBytes()
+	if len(text) <= limit {
+		return text
+	}
+
+	if limits.ResultPolicy == resultPolicySummarize && deps.LLM != nil {
+		summary, err := summarizeToolResult(ctx, deps, convID, toolName, text, limit)
+		if err == nil {
+			return summary
+		}
+		slog.WarnContext(ctx, "tool result summary failed, truncating", "tool", toolName, "error", err)
+	}
+	return truncateToolResult(text, limit)
+}
+
+// truncateToolResult keeps the start and end of text within limit bytes and
+// marks what was cut. Most tools put the important part first, so the head
+// gets the larger share.
+func truncateToolResult(text string, limit int) string {
+	if len(text) <= limit {
+		return text
+	}
+	marker := "\n\n[... " + strconv.Itoa(len(text)) + " bytes total, truncated ...]\n\n"
+	budget := limit - len(marker)
+	if budget <= 0 {
+		return validUTF8Prefix(text, limit)
+	}
+	head := validUTF8Prefix(text, budget*3/4)
+	tail := validUTF8Suffix(text, budget-len(head))
+	return head + marker + tail
+}
+
+func validUTF8Prefix(s string, n int) string {
+	if n >= len(s) {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
+
+func validUTF8Suffix(s string, n int) string {
+	if n >= len(s) {
+		return s
+	}
+	start := len(s) - n
+	for start < len(s) && !utf8.RuneStart(s[start]) {
+		start++
+	}
+	return s[start:]
+}
+
+func summarizeToolResult(ctx context.Context, deps AgentDeps, convID, toolName, text string, limit int) (string, error) {
+	fallback := "The output of the tool \"{{tool}}\" is too long to use directly. Summarise it in at most {{max_chars}} characters. Keep every fact, identifier, number and URL that could matter for answering the user, and say if the output reports an error.\n\nTool output:\n{{result}}\n\nRespond with ONLY the summary."
+	prompt := RetrievePromptTemplate("alicia/agent/tool-result-summary", fallback, map[string]string{
+		"tool":      toolName,
+		"max_chars": strconv.Itoa(limit),
+		"result":    validUTF8Prefix(text, maxSummaryInputBytes),
+	})
+
+	resp, err := MakeLLMCall(ctx, deps.LLM, []LLMMessage{{Role: "user", Content: prompt.Text}}, nil, LLMCallOptions{
+		GenerationName: "agent.summarize_tool_result",
+		Prompt:         prompt,
+		ConvID:         convID,
+		UserID:         deps.UserID,
+		TraceName:      "agent:tool_result_summary",
+		NoRetry:        true,
+	})
+	if err != nil {
+		return "", err
+	}
+	summary := "[Summary of a " + strconv.Itoa(len(text)) + " byte result]\n" + resp.Content
+	return truncateToolResult(summary, limit), nil
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+func TestTruncateToolResult(t *testing.T) {
+	text := strings.Repeat("é", 5000) // two bytes per rune
+	got := truncateToolResult(text, 1001)
+
+	if len(got) > 1001 {
+		t.Errorf("truncated result is %d bytes, limit 1001", len(got))
+	}
+	if !utf8.ValidString(got) {
+		t.Error("truncation split a multi-byte rune")
+	}
+	if !strings.Contains(got, "10000 bytes total, truncated") {
+		t.Errorf("missing truncation marker: %q", got)
+	}
+	if !strings.HasPrefix(got, "éé") || !strings.HasSuffix(got, "éé") {
+		t.Error("expected both the head and the tail to be kept")
+	}
+
+	if short := truncateToolResult("ok", 10); short != "ok" {
+		t.Errorf("short result changed: %q", short)
+	}
+}
+
+func TestToolLimitsMerge(t *testing.T) {
+	server := ToolLimits{TimeoutSeconds: 30, MaxResultBytes: 4000, ResultPolicy: resultPolicySummarize}
+	got := server.merge(ToolLimits{TimeoutSeconds: 300})
+
+	if got.timeout() != 5*time.Minute || got.maxResultBytes() != 4000 || got.ResultPolicy != resultPolicySummarize {
+		t.Errorf("merged limits = %+v", got)
+	}
+	if d := (ToolLimits{}); d.timeout() != defaultToolTimeout || d.maxResultBytes() != defaultMaxResultBytes {
+		t.Errorf("zero limits should use the defaults")
+	}
+}
+
+func TestMCPManagerCallTimeout(t *testing.T) {
+	conns := make(map[string]*fakeMCPConn)
+	m := newFakeMCPManager(conns, make(map[string]int))
+	m.Apply([]MCPServerConfig{{
+		Name: "a", TransportType: "sse", URL: "http://a", Enabled: true,
+		Limits:     ToolLimits{TimeoutSeconds: 60},
+		ToolLimits: map[string]ToolLimits{"ping": {TimeoutSeconds: 1}},
+	}})
+
+	if got := m.Limits("a:ping").TimeoutSeconds; got != 1 {
+		t.Fatalf("tool override not applied, timeout = %d", got)
+	}
+	_, err := m.Call(context.Background(), "a:ping", nil)
+	if err == nil || !strings.Contains(err.Error(), "timed out after 1s") {
+		t.Errorf("call error = %v, want timeout", err)
+	}
+}
+
+func TestDecodeCallResultImages(t *testing.T) {
+	png := []byte{0x89, 'P', 'N', 'G'}
+	raw := fmt.Sprintf(`{"content": [
+		{"type": "text", "text": "captured"},
+		{"type": "image", "mimeType": "image/png", "data": %q},
+		{"type": "resource", "resource": {"uri": "file:///notes.txt", "mimeType": "text/plain", "text": "hello"}}
+	]}`, base64.StdEncoding.EncodeToString(png))
+
+	_, span := noop.NewTracerProvider().Tracer("test").Start(context.Background(), "test")
+	result, err := decodeCallResult(span, json.RawMessage(raw))
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	content, ok := result.(*ToolContent)
+	if !ok || len(content.Parts) != 3 {
+		t.Fatalf("result = %#v, want tool content with 3 parts", result)
+	}
+	if img := content.Parts[1]; img.Type != "image" || string(img.Data) != string(png) {
+		t.Errorf("image part = %+v", img)
+	}
+
+	// The text fallback and the stored JSON never carry the image bytes.
+	text := toolResultText(content)
+	if !strings.Contains(text, "captured") || !strings.Contains(text, "[image: image/png, 4 bytes]") || !strings.Contains(text, "hello") {
+		t.Errorf("text fallback = %q", text)
+	}
+	content.Parts[1].AttachmentID = "tuatt_1"
+	stored, _ := json.Marshal(content)
+	if strings.Contains(string(stored), base64.StdEncoding.EncodeToString(png)) || !strings.Contains(string(stored), "tuatt_1") {
+		t.Errorf("stored result = %s", stored)
+	}
+
+	msg, ok := toolImagesMessage("screenshot", content)
+	if !ok || len(msg.Parts) != 2 {
+		t.Fatalf("image message = %+v", msg)
+	}
+	vision := &LLMClient{vision: true}
+	req := vision.buildChatRequest([]LLMMessage{msg}, nil, ChatOptions{})
+	parts := req.Messages[0].MultiContent
+	if len(parts) != 2 || parts[1].ImageURL == nil || !strings.HasPrefix(parts[1].ImageURL.URL, "data:image/png;base64,") {
+		t.Errorf("openai parts = %+v", parts)
+	}
+	if req := (&LLMClient{}).buildChatRequest([]LLMMessage{msg}, nil, ChatOptions{}); req.Messages[0].MultiContent != nil {
+		t.Error("image parts sent to a model without vision")
+	}
+}
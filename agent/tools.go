@@ -3,7 +3,9 @@ package main
 import (
 	"context"
 	"log/slog"
+	"strings"
 
+	"golang.org/x/sync/errgroup"
 )
 
 const maxTokenRetries = 3
@@ -76,3 +78,40 @@ func ExtractFinalAnswer(tc LLMToolCall) string {
 	}
 	return ""
 }
+
+// maxParallelToolCalls caps how many tool calls from a single model response
+// run at the same time.
+const maxParallelToolCalls = 4
+
+// executableToolCalls returns the calls that should be run, dropping
+// final_answer, which is not a real tool.
+func executableToolCalls(calls []LLMToolCall) []LLMToolCall {
+	out := make([]LLMToolCall, 0, len(calls))
+	for _, tc := range calls {
+		if !IsFinalAnswerCall(tc) {
+			out = append(out, tc)
+		}
+	}
+	return out
+}
+
+// mcpToolName maps the name the model used to the MCP manager's tool name.
+func mcpToolName(name string) string {
+	return strings.TrimPrefix(name, "mcp_garden_")
+}
+
+// runToolCalls runs fn for every call, at most maxParallelToolCalls at once,
+// and returns the results in the order of calls.
+func runToolCalls[T any](calls []LLMToolCall, fn func(tc LLMToolCall) T) []T {
+	results := make([]T, len(calls))
+	var g errgroup.Group
+	g.SetLimit(maxParallelToolCalls)
+	for i, tc := range calls {
+		g.Go(func() error {
+			results[i] = fn(tc)
+			return nil
+		})
+	}
+	g.Wait()
+	return results
+}
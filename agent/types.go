@@ -1,6 +1,9 @@
 package main
 
-import "context"
+import (
+	"context"
+	"time"
+)
 
 type Message struct {
 	ID             string
@@ -10,15 +13,20 @@ type Message struct {
 	Role           string
 	Content        string
 	Reasoning      string
-	Status         string // pending, streaming, completed, error
+	Status         string // pending, streaming, completed, error, cancelled
 	ToolUses       []ToolUse
 	Memories       []Memory // memories retrieved for this message
 }
 
 type Memory struct {
-	ID         string
-	Content    string
-	Similarity float32 // computed during search
+	ID          string
+	Content     string
+	Similarity  float32 // computed during search
+	Importance  float32
+	Pinned      bool
+	CreatedAt   time.Time
+	VectorRank  int // 1-based rank by similarity during search, 0 if not ranked
+	KeywordRank int // 1-based rank by keyword match during search, 0 if not ranked
 }
 
 type Tool struct {
@@ -38,12 +46,32 @@ type ToolUse struct {
 }
 
 type LLMMessage struct {
-	Role       string
-	Content    string
+	Role    string
+	Content string
+	// Parts replace Content for models that accept images; Content remains
+	// the text fallback for those that don't.
+	Parts      []ContentPart
 	ToolCalls  []LLMToolCall
 	ToolCallID string
 }
 
+// ContentPart is one part of a multimodal message or tool result. Image bytes
+// are never serialized: tool results reference them by attachment ID once
+// they have been stored.
+type ContentPart struct {
+	Type         string `json:"type" msgpack:"type"` // "text" or "image"
+	Text         string `json:"text,omitempty" msgpack:"text,omitempty"`
+	MimeType     string `json:"mimeType,omitempty" msgpack:"mimeType,omitempty"`
+	URI          string `json:"uri,omitempty" msgpack:"uri,omitempty"`
+	AttachmentID string `json:"attachmentId,omitempty" msgpack:"attachmentId,omitempty"`
+	Data         []byte `json:"-" msgpack:"-"`
+}
+
+// ToolContent is a tool result with parts other than text, such as images.
+type ToolContent struct {
+	Parts []ContentPart `json:"content" msgpack:"content"`
+}
+
 type LLMToolCall struct {
 	ID        string
 	Name      string
@@ -62,20 +90,23 @@ type LLMResponse struct {
 }
 
 type ResponseGenerationRequest struct {
-	ID             string  `msgpack:"id"`
-	MessageID      string  `msgpack:"messageId"`
-	ConversationID string  `msgpack:"conversationId"`
-	RequestType    string  `msgpack:"requestType"`
-	NewContent     string  `msgpack:"newContent,omitempty"`
-	EnableTools    bool    `msgpack:"enableTools"`
-	UsePareto      bool    `msgpack:"usePareto"`
-	PreviousID     string  `msgpack:"previousId,omitempty"`
-	Timestamp      float64 `msgpack:"timestamp,omitempty"` // float64 for JS compatibility
+	ID              string  `msgpack:"id"`
+	MessageID       string  `msgpack:"messageId"`
+	ConversationID  string  `msgpack:"conversationId"`
+	RequestType     string  `msgpack:"requestType"`
+	NewContent      string  `msgpack:"newContent,omitempty"`
+	EnableTools     bool    `msgpack:"enableTools"`
+	EnableStreaming bool    `msgpack:"enableStreaming"`
+	UsePareto       bool    `msgpack:"usePareto"`
+	PreviousID      string  `msgpack:"previousId,omitempty"`
+	Timestamp       float64 `msgpack:"timestamp,omitempty"` // float64 for JS compatibility
+	JobID           string  `msgpack:"jobId,omitempty"`
 }
 
 type GenerateConfig struct {
 	MaxToolIterations int
 	EnableTools       bool
+	EnableStreaming   bool
 	ParetoMode        bool
 }
 
@@ -86,9 +117,16 @@ type Notifier interface {
 	SendThinking(ctx context.Context, messageID, text string)
 	SendThinkingWithProgress(ctx context.Context, messageID, text string, progress float32)
 	SendToolStart(ctx context.Context, id, name string, args map[string]any)
+	SendToolApprovalRequest(ctx context.Context, id, name string, args map[string]any)
 	SendToolComplete(ctx context.Context, id string, success bool, result any, errMsg string)
+	SendDelta(ctx context.Context, messageID string, seq int, delta string)
+	SendSentence(ctx context.Context, messageID string, seq int, text string, final bool)
 	SendComplete(ctx context.Context, messageID, content string)
+	SendCancelled(ctx context.Context, messageID, content string)
 	SendError(ctx context.Context, messageID string, err error)
 	SendTitleUpdate(ctx context.Context, title string)
 	SendMemoryTrace(ctx context.Context, messageID, memoryID, content string, relevance float32)
+	// SendMemoryChange tells the client the agent created, updated or
+	// deleted a memory while generating messageID.
+	SendMemoryChange(ctx context.Context, messageID, memoryID, content, action string)
 }
@@ -58,6 +58,16 @@ class AliciaApplication : Application() {
             }
         }
 
+        // Device API key issued by the server (POST /api/v1/auth/api-keys)
+        val apiKeyFile = File(filesDir, "api_key.txt")
+        if (apiKeyFile.exists()) {
+            val key = apiKeyFile.readText().trim()
+            if (key.isNotEmpty()) {
+                ApiClient.apiKey = key
+                Log.i(TAG, "Using device API key")
+            }
+        }
+
         AliciaTelemetry.initialize(this)
         registerActivityLifecycleCallbacks(ActivityLifecycleTracer())
 
@@ -17,6 +17,10 @@ object ApiClient {
     val BASE_URL: String
         get() = baseUrlOverride ?: DEFAULT_BASE_URL
 
+    // Device API key; when set, requests act as its user instead of X-User-ID.
+    @Volatile
+    var apiKey: String? = null
+
     private const val MAX_RETRIES = 3
     private val RETRYABLE_CODES = setOf(429, 500, 502, 503)
 
@@ -43,8 +47,19 @@ object ApiClient {
         response ?: throw lastException ?: IOException("Retry failed")
     }
 
+    private val authInterceptor = okhttp3.Interceptor { chain ->
+        val request = chain.request()
+        val key = apiKey
+        if (key.isNullOrEmpty() || request.header("Authorization") != null) {
+            chain.proceed(request)
+        } else {
+            chain.proceed(request.newBuilder().header("Authorization", "Bearer $key").build())
+        }
+    }
+
     val httpClient: OkHttpClient by lazy {
         OkHttpClient.Builder()
+            .addInterceptor(authInterceptor)
             .addInterceptor(retryInterceptor)
             .connectTimeout(30, TimeUnit.SECONDS)
             .readTimeout(60, TimeUnit.SECONDS)
@@ -1,6 +1,8 @@
 package config
 
 import (
+	"time"
+
 	iconfig "github.com/longregen/alicia/shared/config"
 )
 
@@ -11,6 +13,17 @@ type Config struct {
 	Headscale HeadscaleConfig
 	Langfuse  LangfuseConfig
 	Otel      OtelConfig
+	Auth      AuthConfig
+}
+
+type AuthConfig struct {
+	Secret          string
+	SessionTTL      time.Duration
+	AllowSignup     bool
+	FirstUserID     string
+	WebAuthnRPID    string
+	WebAuthnRPName  string
+	WebAuthnOrigins []string
 }
 
 type OtelConfig struct {
@@ -79,6 +92,15 @@ func Load() *Config {
 			Endpoint:    iconfig.GetEnvWithFallback("ALICIA_OTEL_ENDPOINT", "OTEL_EXPORTER_OTLP_ENDPOINT", ""),
 			Environment: iconfig.GetEnvWithFallback("ALICIA_ENVIRONMENT", "ENVIRONMENT", "development"),
 		},
+		Auth: AuthConfig{
+			Secret:          iconfig.GetEnvWithFallback("ALICIA_AUTH_SECRET", "AUTH_SECRET", ""),
+			SessionTTL:      iconfig.GetEnvDuration("ALICIA_SESSION_TTL", 30*24*time.Hour),
+			AllowSignup:     iconfig.GetEnvBoolWithFallback("ALICIA_ALLOW_SIGNUP", "ALLOW_SIGNUP", false),
+			FirstUserID:     iconfig.GetEnvWithFallback("ALICIA_AUTH_FIRST_USER_ID", "AUTH_FIRST_USER_ID", ""),
+			WebAuthnRPID:    iconfig.GetEnvWithFallback("ALICIA_WEBAUTHN_RP_ID", "WEBAUTHN_RP_ID", ""),
+			WebAuthnRPName:  iconfig.GetEnvWithFallback("ALICIA_WEBAUTHN_RP_NAME", "WEBAUTHN_RP_NAME", "Alicia"),
+			WebAuthnOrigins: iconfig.GetEnvSliceWithFallback("ALICIA_WEBAUTHN_ORIGINS", "WEBAUTHN_ORIGINS", nil),
+		},
 	}
 }
 
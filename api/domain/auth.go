@@ -0,0 +1,123 @@
+package domain
+
+import (
+	"errors"
+	"slices"
+	"time"
+)
+
+var (
+	ErrInvalidCredentials = errors.New("invalid credentials")
+	ErrSignupClosed       = errors.New("signup is closed")
+	ErrUsernameTaken      = errors.New("username is taken")
+	ErrPasskeysDisabled   = errors.New("passkeys are not configured")
+)
+
+type User struct {
+	ID          string     `json:"id"`
+	Username    string     `json:"username"`
+	DisplayName string     `json:"display_name"`
+	IsAdmin     bool       `json:"is_admin"`
+	HasPassword bool       `json:"has_password"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+	DisabledAt  *time.Time `json:"disabled_at,omitempty"`
+
+	PasswordHash string `json:"-"`
+}
+
+// Session is a login. Its token is a JWT naming the session, so revoking the
+// session revokes the token.
+type Session struct {
+	ID         string     `json:"id"`
+	UserID     string     `json:"user_id"`
+	Method     string     `json:"method"` // password or passkey
+	UserAgent  string     `json:"user_agent"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastSeenAt time.Time  `json:"last_seen_at"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+}
+
+// API key kinds.
+const (
+	APIKeyDevice  = "device"  // acts as its user, for one device or bridge
+	APIKeyService = "service" // belongs to no user; carries scopes
+)
+
+// APIKey is a long-lived bearer token. Only a hash of the key is kept; the
+// key itself is shown once, when it's created.
+type APIKey struct {
+	ID         string     `json:"id"`
+	Kind       string     `json:"kind"`
+	UserID     *string    `json:"user_id,omitempty"`
+	Name       string     `json:"name"`
+	KeyPrefix  string     `json:"key_prefix"`
+	Scopes     []string   `json:"scopes"`
+	CreatedBy  *string    `json:"created_by,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+
+	KeyHash string `json:"-"`
+}
+
+// Service scopes. A service token may only connect to the hub in the modes
+// its scopes name, and only acts on behalf of users with ScopeActAsUser.
+const (
+	ScopeAgent     = "agent"
+	ScopeVoice     = "voice"
+	ScopeAssistant = "assistant"
+	ScopeWhatsApp  = "whatsapp"
+	ScopeMonitor   = "monitor"
+	ScopeActAsUser = "act_as_user" // may name the user with X-User-ID
+)
+
+// ServiceScopes are all the scopes a service token can have.
+var ServiceScopes = []string{ScopeAgent, ScopeVoice, ScopeAssistant, ScopeWhatsApp, ScopeMonitor, ScopeActAsUser}
+
+// Passkey is a WebAuthn credential a user can log in with.
+type Passkey struct {
+	ID         string     `json:"id"` // credential id, base64url
+	UserID     string     `json:"user_id"`
+	Name       string     `json:"name"`
+	Algorithm  int        `json:"algorithm"` // COSE algorithm identifier
+	SignCount  int64      `json:"sign_count"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+
+	PublicKey []byte `json:"-"` // SubjectPublicKeyInfo, DER
+}
+
+// AuthChallenge is an outstanding WebAuthn challenge.
+type AuthChallenge struct {
+	ID        string
+	Purpose   string  // register or login
+	UserID    *string // the user registering, or the user logging in if named
+	Challenge []byte
+	ExpiresAt time.Time
+}
+
+// Principal kinds.
+const (
+	PrincipalUser      = "user"      // a session
+	PrincipalDevice    = "device"    // a device API key
+	PrincipalService   = "service"   // a service token
+	PrincipalAnonymous = "anonymous" // no credentials, when auth isn't required
+)
+
+// Principal is who a request is authenticated as.
+type Principal struct {
+	Kind      string
+	UserID    string // empty for services not acting as a user
+	SessionID string // for PrincipalUser
+	KeyID     string // for PrincipalDevice and PrincipalService
+	IsAdmin   bool
+	Scopes    []string // for PrincipalService
+}
+
+// HasScope reports whether a service principal has scope.
+func (p *Principal) HasScope(scope string) bool {
+	return p != nil && p.Kind == PrincipalService && slices.Contains(p.Scopes, scope)
+}
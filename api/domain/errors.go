@@ -3,3 +3,7 @@ package domain
 import "errors"
 
 var ErrNotFound = errors.New("not found")
+
+// ErrInvalidInput wraps errors about a request the caller should fix; the
+// message is safe to show them.
+var ErrInvalidInput = errors.New("invalid input")
@@ -0,0 +1,33 @@
+package domain
+
+import "time"
+
+// GenerationJob is a generation request queued for the agent workers.
+type GenerationJob struct {
+	ID             string     `json:"id"`
+	ConversationID string     `json:"conversation_id"`
+	MessageID      string     `json:"message_id"`
+	Envelope       []byte     `json:"-"` // msgpack GenRequest envelope
+	Status         string     `json:"status"`
+	WorkerID       string     `json:"worker_id,omitempty"`
+	Attempts       int        `json:"attempts"`
+	MaxAttempts    int        `json:"max_attempts"`
+	LeaseExpiresAt *time.Time `json:"lease_expires_at,omitempty"`
+	LastError      string     `json:"last_error,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+	FinishedAt     *time.Time `json:"finished_at,omitempty"`
+}
+
+// Job states. A queued job is claimed by a worker, which reports it running
+// once it has started and done or failed when it ends.
+const (
+	JobStatusQueued  = "queued"
+	JobStatusClaimed = "claimed"
+	JobStatusRunning = "running"
+	JobStatusDone    = "done"
+	JobStatusFailed  = "failed"
+)
+
+// DefaultJobAttempts is how many workers may claim a job before it fails.
+const DefaultJobAttempts = 3
@@ -21,29 +21,56 @@ type Message struct {
 	Role           string     `json:"role"` // user, assistant
 	Content        string     `json:"content"`
 	Reasoning      string     `json:"reasoning,omitempty"`
-	Status         string     `json:"status"`             // pending, streaming, completed, error
+	Status         string     `json:"status"`             // pending, streaming, completed, error, cancelled
 	TraceID        *string    `json:"trace_id,omitempty"` // OTel trace ID for Langfuse correlation
 	CreatedAt      time.Time  `json:"created_at"`
 	DeletedAt      *time.Time `json:"-"`
 }
 
 type Memory struct {
-	ID            string     `json:"id"`
-	Content       string     `json:"content"`
-	Embedding     []float32  `json:"-"` // pgvector, not exposed via API
-	Importance    float32    `json:"importance"`
-	Pinned        bool       `json:"pinned"`
-	Archived      bool       `json:"archived"`
-	SourceMsgID   *string    `json:"source_message_id,omitempty"`
-	Tags          []string   `json:"tags"`
-	CreatedAt     time.Time  `json:"created_at"`
-	UpdatedAt     time.Time  `json:"updated_at"`
-	DeletedAt     *time.Time `json:"-"`
-	DeletedReason *string    `json:"deleted_reason,omitempty"`
+	ID             string        `json:"id"`
+	UserID         string        `json:"user_id"`
+	Content        string        `json:"content"`
+	Embedding      []float32     `json:"-"` // pgvector, not exposed via API
+	EmbeddingModel string        `json:"-"` // model of Embedding, "" if unknown
+	Importance     float32       `json:"importance"`
+	Ratings        MemoryRatings `json:"ratings"`
+	Version        int           `json:"version"`
+	Pinned         bool          `json:"pinned"`
+	Archived       bool          `json:"archived"`
+	SupersededBy   *string       `json:"superseded_by,omitempty"`
+	SourceMsgID    *string       `json:"source_message_id,omitempty"`
+	Tags           []string      `json:"tags"`
+	CreatedAt      time.Time     `json:"created_at"`
+	UpdatedAt      time.Time     `json:"updated_at"`
+	DeletedAt      *time.Time    `json:"-"`
+	DeletedReason  *string       `json:"deleted_reason,omitempty"`
+	Relevance      float64       `json:"relevance,omitempty"` // 0-1, set by search only
+}
+
+// MemoryRatings are the 1-5 ratings given to an extracted memory on each
+// evaluation dimension; nil when the memory wasn't rated.
+type MemoryRatings struct {
+	Importance *int `json:"importance,omitempty"`
+	Historical *int `json:"historical,omitempty"`
+	Personal   *int `json:"personal,omitempty"`
+	Factual    *int `json:"factual,omitempty"`
+}
+
+// MemoryVersion is an earlier content of a memory, kept when it was replaced.
+type MemoryVersion struct {
+	ID           string    `json:"id"`
+	MemoryID     string    `json:"memory_id"`
+	Version      int       `json:"version"`
+	Content      string    `json:"content"`
+	Change       string    `json:"change"` // what replaced it: edit, update or merge
+	GenerationID *string   `json:"generation_id,omitempty"`
+	CreatedAt    time.Time `json:"created_at"` // when it was replaced
 }
 
 type MemoryUse struct {
 	ID             string    `json:"id"`
+	UserID         string    `json:"user_id"`
 	MemoryID       string    `json:"memory_id"`
 	MessageID      string    `json:"message_id"`
 	ConversationID string    `json:"conversation_id"`
@@ -51,6 +78,60 @@ type MemoryUse struct {
 	CreatedAt      time.Time `json:"created_at"`
 }
 
+// MemoryGeneration is the record of one memory extraction: the candidate
+// memory, how it was rated on each dimension and why, and what was decided.
+type MemoryGeneration struct {
+	ID                   string          `json:"id"`
+	ConversationID       string          `json:"conversation_id"`
+	MessageID            string          `json:"message_id"`
+	MemoryContent        string          `json:"memory_content"`
+	ExtractPromptName    *string         `json:"extract_prompt_name,omitempty"`
+	ExtractPromptVersion *int            `json:"extract_prompt_version,omitempty"`
+	Importance           DimensionRating `json:"importance"`
+	Historical           DimensionRating `json:"historical"`
+	Personal             DimensionRating `json:"personal"`
+	Factual              DimensionRating `json:"factual"`
+	RerankDecision       *string         `json:"rerank_decision,omitempty"`
+	RerankPromptName     *string         `json:"rerank_prompt_name,omitempty"`
+	RerankPromptVersion  *int            `json:"rerank_prompt_version,omitempty"`
+	Accepted             bool            `json:"accepted"`
+	MemoryID             *string         `json:"memory_id,omitempty"`         // the memory it created, updated or merged into
+	TargetMemoryIDs      []string        `json:"target_memory_ids,omitempty"` // the existing memories it acted on
+	Source               string          `json:"source"`                      // extraction, or tool when the agent's memory tools made the change
+	CreatedAt            time.Time       `json:"created_at"`
+}
+
+// DimensionRating is the rating a memory generation gave on one dimension
+// and the model's reasoning for it.
+type DimensionRating struct {
+	Rating        *int    `json:"rating,omitempty"`
+	Reasoning     *string `json:"reasoning,omitempty"`
+	PromptName    *string `json:"prompt_name,omitempty"`
+	PromptVersion *int    `json:"prompt_version,omitempty"`
+}
+
+// MemoryProvenance is why the assistant believes a memory: the message it
+// was extracted from, the extractions that created and revised it, its
+// earlier contents, and the answers it was retrieved for with the feedback
+// on them.
+type MemoryProvenance struct {
+	Memory             *Memory                `json:"memory"`
+	SourceMessage      *Message               `json:"source_message,omitempty"` // nil if deleted
+	SourceConversation *Conversation          `json:"source_conversation,omitempty"`
+	Generations        []*MemoryGeneration    `json:"generations"`
+	Versions           []*MemoryVersion       `json:"versions"`
+	Uses               []*MemoryUseProvenance `json:"uses"` // newest first
+	UsesTotal          int                    `json:"uses_total"`
+}
+
+// MemoryUseProvenance is a retrieval of a memory with the message it was
+// retrieved for and the feedback on it.
+type MemoryUseProvenance struct {
+	MemoryUse
+	Message  *Message             `json:"message,omitempty"` // nil if deleted
+	Feedback []*MemoryUseFeedback `json:"feedback"`
+}
+
 type MessageFeedback struct {
 	ID        string    `json:"id"`
 	MessageID string    `json:"message_id"`
@@ -96,27 +177,45 @@ type ToolUse struct {
 	CreatedAt time.Time      `json:"created_at"`
 }
 
+// ToolUseAttachment is a binary part of a tool result, such as an image,
+// stored apart from the tool use's JSON result.
+type ToolUseAttachment struct {
+	ID        string    `json:"id"`
+	ToolUseID string    `json:"tool_use_id"`
+	MimeType  string    `json:"mime_type"`
+	Data      []byte    `json:"-"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
 type Note struct {
-	ID        string     `json:"id"`
-	UserID    string     `json:"user_id"`
-	Title     string     `json:"title"`
-	Content   string     `json:"content"`
-	Embedding []float32  `json:"-"`
-	CreatedAt time.Time  `json:"created_at"`
-	UpdatedAt time.Time  `json:"updated_at"`
-	DeletedAt *time.Time `json:"-"`
+	ID             string     `json:"id"`
+	UserID         string     `json:"user_id"`
+	Title          string     `json:"title"`
+	Content        string     `json:"content"`
+	Embedding      []float32  `json:"-"`
+	EmbeddingModel string     `json:"-"` // model of Embedding, "" if unknown
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+	DeletedAt      *time.Time `json:"-"`
 }
 
 type MCPServer struct {
-	ID            string     `json:"id"`
-	Name          string     `json:"name"`
-	TransportType string     `json:"transport_type"` // stdio, sse
-	Command       string     `json:"command,omitempty"`
-	Args          []string   `json:"args,omitempty"`
-	URL           string     `json:"url,omitempty"`
-	Enabled       bool       `json:"enabled"`
-	CreatedAt     time.Time  `json:"created_at"`
-	DeletedAt     *time.Time `json:"-"`
+	ID            string                   `json:"id"`
+	Name          string                   `json:"name"`
+	TransportType string                   `json:"transport_type"` // stdio, sse, streamable-http
+	Command       string                   `json:"command,omitempty"`
+	Args          []string                 `json:"args,omitempty"`
+	URL           string                   `json:"url,omitempty"`
+	Headers       map[string]string        `json:"-"`                      // sent to remote servers, e.g. Authorization; never returned
+	HeaderNames   []string                 `json:"header_names,omitempty"` // names of Headers, for display
+	MCPToolLimits                          // defaults for every tool of the server
+	ToolLimits    map[string]MCPToolLimits `json:"tool_limits,omitempty"` // per-tool overrides
+	Enabled       bool                     `json:"enabled"`
+	CreatedAt     time.Time                `json:"created_at"`
+	DeletedAt     *time.Time               `json:"-"`
+	// Runtime state reported by the agent; not stored.
+	Status    string `json:"status,omitempty"` // up, restarting, failed
+	LastError string `json:"last_error,omitempty"`
 }
 
 const (
@@ -134,17 +233,47 @@ const (
 	MessageStatusStreaming = "streaming"
 	MessageStatusCompleted = "completed"
 	MessageStatusError     = "error"
+	MessageStatusCancelled = "cancelled"
+)
+
+const (
+	ToolUseStatusAwaitingApproval = "awaiting_approval"
+	ToolUseStatusPending          = "pending"
+	ToolUseStatusSuccess          = "success"
+	ToolUseStatusError            = "error"
+)
+
+const (
+	MCPTransportStdio          = "stdio"
+	MCPTransportSSE            = "sse"
+	MCPTransportStreamableHTTP = "streamable-http"
+)
+
+// MCPToolLimits bounds a tool call and the result passed back to the model,
+// and decides whether the call needs the user's approval. Zero values fall
+// back to the agent's defaults.
+type MCPToolLimits struct {
+	TimeoutSeconds int    `json:"timeout_seconds,omitempty"`
+	MaxResultBytes int    `json:"max_result_bytes,omitempty"`
+	ResultPolicy   string `json:"result_policy,omitempty"`   // truncate or summarize
+	ApprovalPolicy string `json:"approval_policy,omitempty"` // always, never or ask
+}
+
+const (
+	MCPResultPolicyTruncate  = "truncate"
+	MCPResultPolicySummarize = "summarize"
 )
 
 const (
-	ToolUseStatusPending = "pending"
-	ToolUseStatusSuccess = "success"
-	ToolUseStatusError   = "error"
+	MCPApprovalAlways = "always"
+	MCPApprovalNever  = "never"
+	MCPApprovalAsk    = "ask"
 )
 
 const (
-	MCPTransportStdio = "stdio"
-	MCPTransportSSE   = "sse"
+	MCPStatusUp         = "up"
+	MCPStatusRestarting = "restarting"
+	MCPStatusFailed     = "failed"
 )
 
 const (
@@ -187,6 +316,8 @@ type UserPreferences struct {
 	// Notes
 	NotesSimilarityThreshold float32 `json:"notes_similarity_threshold"`
 	NotesMaxCount            int     `json:"notes_max_count"`
+	SearchVectorWeight       float32 `json:"search_vector_weight"`
+	SearchKeywordWeight      float32 `json:"search_keyword_weight"`
 
 	// UI behavior
 	ConfirmDeleteMemory bool `json:"confirm_delete_memory"`
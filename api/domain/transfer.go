@@ -0,0 +1,101 @@
+package domain
+
+import "time"
+
+// Memories and notes are exported and imported as JSON Lines: UTF-8 text
+// with one JSON object per line, a MemoryRecord for memories and a
+// NoteRecord for notes. Blank lines are ignored. Only content (for notes,
+// a title or content) is required, so records written by hand or by another
+// assistant import too:
+//
+//	{"content":"User prefers dark mode","tags":["preference"],"importance":0.7}
+//
+// An export has every field, and embeddings when asked for:
+//
+//	{"id":"mem_...","content":"User prefers dark mode","tags":["preference","ui"],
+//	 "importance":0.7,"ratings":{"importance":4,"personal":5},"pinned":false,
+//	 "archived":false,"created_at":"2026-01-02T15:04:05Z","updated_at":"2026-01-02T15:04:05Z",
+//	 "embedding":{"model":"text-embedding-3-small","vector":[0.012,-0.034,...]}}
+//
+// (wrapped here; each record is on a single line). Imported records get new
+// ids, and their embeddings are kept only if they were made with the active
+// embedding model; the rest are embedded again by the agent's re-embed.
+
+// TransferFormatVersion is the version of the JSON Lines format, sent with
+// exports in the X-Alicia-Format-Version header.
+const TransferFormatVersion = 1
+
+// MemoryRecord is a memory in the export format.
+type MemoryRecord struct {
+	ID         string           `json:"id,omitempty"` // the exporting instance's id, for reference
+	Content    string           `json:"content"`
+	Tags       []string         `json:"tags,omitempty"`
+	Importance *float32         `json:"importance,omitempty"` // 0-1, 0.5 if missing
+	Ratings    MemoryRatings    `json:"ratings"`              // 1-5 each
+	Pinned     bool             `json:"pinned"`
+	Archived   bool             `json:"archived"`
+	CreatedAt  *time.Time       `json:"created_at,omitempty"` // RFC 3339; import time if missing
+	UpdatedAt  *time.Time       `json:"updated_at,omitempty"`
+	Embedding  *RecordEmbedding `json:"embedding,omitempty"`
+}
+
+// NoteRecord is a note in the export format.
+type NoteRecord struct {
+	ID        string           `json:"id,omitempty"`
+	Title     string           `json:"title"`
+	Content   string           `json:"content"`
+	CreatedAt *time.Time       `json:"created_at,omitempty"`
+	UpdatedAt *time.Time       `json:"updated_at,omitempty"`
+	Embedding *RecordEmbedding `json:"embedding,omitempty"`
+}
+
+// RecordEmbedding is an embedding and the model that made it.
+type RecordEmbedding struct {
+	Model  string    `json:"model"`
+	Vector []float32 `json:"vector"`
+}
+
+// Import statuses of a record.
+const (
+	ImportImported  = "imported"
+	ImportDuplicate = "duplicate" // already there; skipped
+	ImportConflict  = "conflict"  // close to an existing one but different; skipped unless forced
+	ImportInvalid   = "invalid"
+)
+
+// ImportResult reports what an import did, or would do on a dry run.
+type ImportResult struct {
+	DryRun     bool         `json:"dry_run"`
+	Imported   int          `json:"imported"`
+	Duplicates int          `json:"duplicates"`
+	Conflicts  int          `json:"conflicts"`
+	Invalid    int          `json:"invalid"`
+	Items      []ImportItem `json:"items"`
+}
+
+// ImportItem is the outcome for one line of an import.
+type ImportItem struct {
+	Line            int     `json:"line"`
+	SourceID        string  `json:"source_id,omitempty"`
+	Status          string  `json:"status"`
+	ID              string  `json:"id,omitempty"`          // of the imported record
+	ExistingID      string  `json:"existing_id,omitempty"` // of the duplicate or conflicting record
+	ExistingContent string  `json:"existing_content,omitempty"`
+	Similarity      float64 `json:"similarity,omitempty"`
+	Error           string  `json:"error,omitempty"`
+}
+
+// Add records item and counts it.
+func (r *ImportResult) Add(item ImportItem) {
+	switch item.Status {
+	case ImportImported:
+		r.Imported++
+	case ImportDuplicate:
+		r.Duplicates++
+	case ImportConflict:
+		r.Conflicts++
+	case ImportInvalid:
+		r.Invalid++
+	}
+	r.Items = append(r.Items, item)
+}
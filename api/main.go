@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"crypto/rand"
 	"log/slog"
 	"os"
 	"os/signal"
@@ -66,6 +67,7 @@ func main() {
 	mcpSvc := services.NewMCPService(s)
 	prefsSvc := services.NewPreferencesService(s)
 	noteSvc := services.NewNoteService(s, nil)
+	authSvc := services.NewAuthService(s, authConfig(cfg))
 
 	var lkSvc *livekit.Service
 	if cfg.IsLiveKitConfigured() {
@@ -77,7 +79,12 @@ func main() {
 		}
 	}
 
-	srv := server.NewServer(cfg, s, convSvc, msgSvc, memorySvc, toolSvc, mcpSvc, prefsSvc, noteSvc, lkSvc)
+	if !cfg.Server.RequireAuth {
+		slog.Warn("authentication is not required; until the first account is created, requests without credentials act as the user named by X-User-ID")
+	}
+
+	srv := server.NewServer(cfg, s, convSvc, msgSvc, memorySvc, toolSvc, mcpSvc, prefsSvc, noteSvc, authSvc, lkSvc)
+	go srv.Hub().RunJobs(ctx)
 
 	errCh := make(chan error, 1)
 	go func() {
@@ -104,3 +111,34 @@ func main() {
 		slog.Info("server stopped")
 	}
 }
+
+func authConfig(cfg *config.Config) services.AuthConfig {
+	secret := []byte(cfg.Auth.Secret)
+	if len(secret) == 0 {
+		// Sessions then only last until the server restarts.
+		secret = make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			slog.Error("failed to generate auth secret", "error", err)
+			os.Exit(1)
+		}
+		slog.Warn("ALICIA_AUTH_SECRET not set, using a random secret; sessions will not survive a restart")
+	}
+
+	origins := cfg.Auth.WebAuthnOrigins
+	if cfg.Auth.WebAuthnRPID != "" && len(origins) == 0 {
+		origins = []string{"https://" + cfg.Auth.WebAuthnRPID}
+	}
+
+	return services.AuthConfig{
+		Secret:       secret,
+		SessionTTL:   cfg.Auth.SessionTTL,
+		AllowSignup:  cfg.Auth.AllowSignup,
+		LegacySecret: cfg.Server.AgentSecret,
+		FirstUserID:  cfg.Auth.FirstUserID,
+		WebAuthn: services.WebAuthnConfig{
+			RPID:    cfg.Auth.WebAuthnRPID,
+			RPName:  cfg.Auth.WebAuthnRPName,
+			Origins: origins,
+		},
+	}
+}
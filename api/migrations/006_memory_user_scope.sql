@@ -0,0 +1,43 @@
+-- Per-user ownership of memories, memory uses and memory generations.
+ALTER TABLE memories ADD COLUMN IF NOT EXISTS user_id TEXT;
+ALTER TABLE memory_uses ADD COLUMN IF NOT EXISTS user_id TEXT;
+ALTER TABLE memory_generations ADD COLUMN IF NOT EXISTS user_id TEXT;
+
+-- Existing memories belong to the owner of the conversation their source
+-- message came from.
+UPDATE memories mem
+SET user_id = c.user_id
+FROM messages m
+JOIN conversations c ON c.id = m.conversation_id
+WHERE mem.user_id IS NULL AND mem.source_msg_id = m.id;
+
+-- Memories extracted by the agent were stored without source_msg_id; recover
+-- the owner from the generation record that created them.
+UPDATE memories mem
+SET user_id = c.user_id
+FROM memory_generations g
+JOIN conversations c ON c.id = g.conversation_id
+WHERE mem.user_id IS NULL AND g.memory_id = mem.id;
+
+-- Anything left was created through the API without a source message, which
+-- only happened for the single-user default.
+UPDATE memories SET user_id = 'default_user' WHERE user_id IS NULL;
+
+UPDATE memory_uses mu
+SET user_id = c.user_id
+FROM conversations c
+WHERE mu.user_id IS NULL AND c.id = mu.conversation_id;
+
+UPDATE memory_generations g
+SET user_id = c.user_id
+FROM conversations c
+WHERE g.user_id IS NULL AND c.id = g.conversation_id;
+
+ALTER TABLE memories ALTER COLUMN user_id SET NOT NULL;
+ALTER TABLE memory_uses ALTER COLUMN user_id SET NOT NULL;
+ALTER TABLE memory_generations ALTER COLUMN user_id SET NOT NULL;
+
+CREATE INDEX IF NOT EXISTS idx_mem_user ON memories(user_id, importance DESC)
+    WHERE deleted_at IS NULL AND archived = FALSE;
+CREATE INDEX IF NOT EXISTS idx_mem_use_user ON memory_uses(user_id);
+CREATE INDEX IF NOT EXISTS idx_memgen_user ON memory_generations(user_id);
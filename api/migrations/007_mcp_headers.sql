@@ -0,0 +1,3 @@
+-- Optional HTTP headers (e.g. Authorization) sent to remote MCP servers.
+ALTER TABLE mcp_servers
+    ADD COLUMN IF NOT EXISTS headers JSONB NOT NULL DEFAULT '{}';
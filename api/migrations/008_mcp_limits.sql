@@ -0,0 +1,8 @@
+-- Per-server tool call limits. Zero or empty values use the agent's defaults.
+-- tool_limits holds per-tool overrides keyed by tool name, e.g.
+-- {"read": {"timeout_seconds": 120, "max_result_bytes": 40000}}.
+ALTER TABLE mcp_servers
+    ADD COLUMN IF NOT EXISTS timeout_seconds  INTEGER NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS max_result_bytes INTEGER NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS result_policy    TEXT NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS tool_limits      JSONB NOT NULL DEFAULT '{}';
@@ -0,0 +1,5 @@
+-- Whether tool calls need the user's approval: always (run without asking),
+-- never (refuse) or ask. Empty means always. Per-tool overrides live in
+-- tool_limits, e.g. {"execute_sql": {"approval_policy": "ask"}}.
+ALTER TABLE mcp_servers
+    ADD COLUMN IF NOT EXISTS approval_policy TEXT NOT NULL DEFAULT '';
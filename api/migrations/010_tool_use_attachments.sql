@@ -0,0 +1,11 @@
+-- Binary parts of tool results, such as screenshots. They are kept out of
+-- tool_uses.result, which only references them by attachment ID.
+CREATE TABLE IF NOT EXISTS tool_use_attachments (
+    id TEXT PRIMARY KEY,
+    tool_use_id TEXT NOT NULL,
+    mime_type TEXT NOT NULL,
+    data BYTEA NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_tool_use_attachments_tool_use ON tool_use_attachments(tool_use_id);
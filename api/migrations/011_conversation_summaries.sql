@@ -0,0 +1,18 @@
+-- Rolling summaries of the older part of a conversation branch. A summary
+-- covers every message from the root of the branch up to and including
+-- message_id; the agent sends it in place of those messages. Summaries are
+-- invalidated when a regenerate or edit moves the branch off their cut point.
+CREATE TABLE IF NOT EXISTS conversation_summaries (
+    id               TEXT PRIMARY KEY,
+    conversation_id  TEXT NOT NULL REFERENCES conversations(id),
+    message_id       TEXT NOT NULL REFERENCES messages(id),
+    content          TEXT NOT NULL,
+    message_count    INT NOT NULL,
+    prompt_name      TEXT,
+    prompt_version   INT,
+    created_at       TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    invalidated_at   TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_conversation_summaries_message ON conversation_summaries(message_id) WHERE invalidated_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_conversation_summaries_conversation ON conversation_summaries(conversation_id);
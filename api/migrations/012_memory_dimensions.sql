@@ -0,0 +1,22 @@
+-- The 1-5 ratings a memory received on each evaluation dimension when it was
+-- extracted. Retrieval filters on them using the user's memory_min_*
+-- preferences; NULL (e.g. memories created by hand) passes every filter.
+ALTER TABLE memories ADD COLUMN IF NOT EXISTS importance_rating SMALLINT;
+ALTER TABLE memories ADD COLUMN IF NOT EXISTS historical_rating SMALLINT;
+ALTER TABLE memories ADD COLUMN IF NOT EXISTS personal_rating SMALLINT;
+ALTER TABLE memories ADD COLUMN IF NOT EXISTS factual_rating SMALLINT;
+
+-- Backfill from the generation that created each memory.
+UPDATE memories m SET
+    importance_rating = NULLIF(g.importance_rating, 0),
+    historical_rating = NULLIF(g.historical_rating, 0),
+    personal_rating   = NULLIF(g.personal_rating, 0),
+    factual_rating    = NULLIF(g.factual_rating, 0)
+FROM memory_generations g
+WHERE g.memory_id = m.id
+  AND m.importance_rating IS NULL AND m.historical_rating IS NULL
+  AND m.personal_rating IS NULL AND m.factual_rating IS NULL;
+
+-- Pinned memories are included in every retrieval.
+CREATE INDEX IF NOT EXISTS idx_mem_pinned ON memories(user_id)
+    WHERE pinned = TRUE AND deleted_at IS NULL AND archived = FALSE;
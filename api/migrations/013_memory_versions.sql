@@ -0,0 +1,22 @@
+-- Memories can be revised in place (UPDATE), absorb similar memories (MERGE)
+-- or be replaced by a newer one (SUPERSEDE). version counts the revisions of
+-- a memory's content; superseded_by points an archived memory at the memory
+-- that replaced it.
+ALTER TABLE memories ADD COLUMN IF NOT EXISTS version INT NOT NULL DEFAULT 1;
+ALTER TABLE memories ADD COLUMN IF NOT EXISTS superseded_by TEXT REFERENCES memories(id);
+
+-- Earlier contents of a memory. A row is written whenever a memory's content
+-- is replaced, by a user edit or by a memory decision during extraction.
+CREATE TABLE IF NOT EXISTS memory_versions (
+    id             TEXT PRIMARY KEY,
+    memory_id      TEXT NOT NULL REFERENCES memories(id),
+    version        INT NOT NULL,
+    content        TEXT NOT NULL,
+    change         TEXT NOT NULL,  -- what replaced it: edit, update or merge
+    generation_id  TEXT,           -- the memory_generations row that replaced it, if any
+    created_at     TIMESTAMPTZ NOT NULL DEFAULT NOW(),  -- when it was replaced
+    UNIQUE (memory_id, version)
+);
+
+-- The existing memories a decision acted on.
+ALTER TABLE memory_generations ADD COLUMN IF NOT EXISTS target_memory_ids TEXT[] NOT NULL DEFAULT '{}';
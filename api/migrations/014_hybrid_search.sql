@@ -0,0 +1,21 @@
+-- Full-text search vectors for hybrid search, which fuses their ranking with
+-- vector similarity. Queries must use the same 'english' configuration.
+ALTER TABLE memories ADD COLUMN IF NOT EXISTS search_vector tsvector
+    GENERATED ALWAYS AS (to_tsvector('english', content)) STORED;
+CREATE INDEX IF NOT EXISTS idx_mem_search ON memories USING gin (search_vector)
+    WHERE deleted_at IS NULL;
+
+-- A match in a note's title counts more than one in its body.
+ALTER TABLE notes ADD COLUMN IF NOT EXISTS search_vector tsvector
+    GENERATED ALWAYS AS (
+        setweight(to_tsvector('english', title), 'A') ||
+        setweight(to_tsvector('english', content), 'B')
+    ) STORED;
+CREATE INDEX IF NOT EXISTS idx_notes_search ON notes USING gin (search_vector)
+    WHERE deleted_at IS NULL;
+
+-- How much vector similarity and keyword matching each count when the two
+-- rankings are fused. Zero switches one off.
+ALTER TABLE user_preferences
+    ADD COLUMN IF NOT EXISTS search_vector_weight REAL NOT NULL DEFAULT 1.0,
+    ADD COLUMN IF NOT EXISTS search_keyword_weight REAL NOT NULL DEFAULT 1.0;
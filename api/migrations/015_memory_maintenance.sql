@@ -0,0 +1,19 @@
+-- When the maintenance job last lowered a memory's importance. Decay is
+-- computed from here, so a run only applies the decay since the last one.
+ALTER TABLE memories ADD COLUMN IF NOT EXISTS decayed_at TIMESTAMPTZ;
+
+-- One row per run of the memory maintenance job, with the report of what it
+-- changed or, for a dry run, would have changed.
+CREATE TABLE IF NOT EXISTS memory_maintenance_runs (
+    id           TEXT PRIMARY KEY,
+    dry_run      BOOLEAN NOT NULL,
+    decayed      INT NOT NULL DEFAULT 0,
+    archived     INT NOT NULL DEFAULT 0,
+    clusters     INT NOT NULL DEFAULT 0,
+    merged       INT NOT NULL DEFAULT 0,
+    report       JSONB NOT NULL DEFAULT '{}',
+    started_at   TIMESTAMPTZ NOT NULL,
+    finished_at  TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_memory_maintenance_runs_finished ON memory_maintenance_runs(dry_run, finished_at DESC);
@@ -0,0 +1,107 @@
+-- Embedding models. Exactly one is active: the stored embeddings were made
+-- with it and queries must be embedded with it too. A model being backfilled
+-- fills the embedding_next columns until the cutover makes it active; see
+-- the agent's -reembed and -embedding-cutover commands.
+CREATE TABLE IF NOT EXISTS embedding_models (
+    model         TEXT PRIMARY KEY,
+    dims          INT,
+    status        TEXT NOT NULL,  -- active, backfilling or retired
+    created_at    TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    activated_at  TIMESTAMPTZ
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_embedding_models_active ON embedding_models(status) WHERE status = 'active';
+
+-- The model and dimension each embedding was made with, and the staging
+-- embedding for the model being backfilled. Rows from before this migration
+-- are stamped with the active model when the agent first registers it.
+ALTER TABLE memories ADD COLUMN IF NOT EXISTS embedding_model TEXT;
+ALTER TABLE memories ADD COLUMN IF NOT EXISTS embedding_dims INT;
+ALTER TABLE memories ADD COLUMN IF NOT EXISTS embedding_next vector;
+ALTER TABLE memories ADD COLUMN IF NOT EXISTS embedding_next_model TEXT;
+
+ALTER TABLE notes ADD COLUMN IF NOT EXISTS embedding_model TEXT;
+ALTER TABLE notes ADD COLUMN IF NOT EXISTS embedding_dims INT;
+ALTER TABLE notes ADD COLUMN IF NOT EXISTS embedding_next vector;
+ALTER TABLE notes ADD COLUMN IF NOT EXISTS embedding_next_model TEXT;
+
+-- Keep embedding_dims in step with the embedding, forget the model of a
+-- cleared embedding and drop a staged embedding whose text changed.
+CREATE OR REPLACE FUNCTION memories_track_embedding() RETURNS trigger AS $$
+BEGIN
+    IF NEW.embedding IS NULL THEN
+        NEW.embedding_model := NULL;
+        NEW.embedding_dims := NULL;
+    ELSE
+        NEW.embedding_dims := vector_dims(NEW.embedding);
+    END IF;
+    IF TG_OP = 'UPDATE' AND NEW.content IS DISTINCT FROM OLD.content THEN
+        NEW.embedding_next := NULL;
+        NEW.embedding_next_model := NULL;
+    END IF;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE OR REPLACE FUNCTION notes_track_embedding() RETURNS trigger AS $$
+BEGIN
+    IF NEW.embedding IS NULL THEN
+        NEW.embedding_model := NULL;
+        NEW.embedding_dims := NULL;
+    ELSE
+        NEW.embedding_dims := vector_dims(NEW.embedding);
+    END IF;
+    IF TG_OP = 'UPDATE' AND (NEW.title IS DISTINCT FROM OLD.title OR NEW.content IS DISTINCT FROM OLD.content) THEN
+        NEW.embedding_next := NULL;
+        NEW.embedding_next_model := NULL;
+    END IF;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS memories_track_embedding ON memories;
+CREATE TRIGGER memories_track_embedding BEFORE INSERT OR UPDATE ON memories
+    FOR EACH ROW EXECUTE FUNCTION memories_track_embedding();
+
+DROP TRIGGER IF EXISTS notes_track_embedding ON notes;
+CREATE TRIGGER notes_track_embedding BEFORE INSERT OR UPDATE ON notes
+    FOR EACH ROW EXECUTE FUNCTION notes_track_embedding();
+
+UPDATE memories SET embedding_dims = vector_dims(embedding) WHERE embedding IS NOT NULL AND embedding_dims IS NULL;
+UPDATE notes SET embedding_dims = vector_dims(embedding) WHERE embedding IS NOT NULL AND embedding_dims IS NULL;
+
+-- query_embedding embeds with the active model unless told otherwise.
+CREATE OR REPLACE FUNCTION query_embedding(
+    input_text TEXT,
+    url TEXT DEFAULT 'http://localhost:8000/v1/embeddings',
+    model TEXT DEFAULT NULL,
+    dims INT DEFAULT NULL
+) RETURNS vector AS $$
+DECLARE
+    response http_response;
+    embedding_json jsonb;
+BEGIN
+    IF model IS NULL THEN
+        SELECT em.model, em.dims INTO model, dims FROM embedding_models em WHERE em.status = 'active';
+        IF model IS NULL THEN
+            RAISE EXCEPTION 'No active embedding model; start the agent once or pass a model';
+        END IF;
+    END IF;
+
+    SELECT * INTO response FROM http_post(
+        url,
+        json_build_object('input', input_text, 'model', model)::text,
+        'application/json'
+    );
+
+    IF response.status != 200 THEN
+        RAISE EXCEPTION 'Embedding API returned status %: %', response.status, response.content;
+    END IF;
+
+    embedding_json := response.content::jsonb->'data'->0->'embedding';
+    IF dims IS NULL THEN
+        RETURN embedding_json::text::vector;
+    END IF;
+    RETURN embedding_json::text::vector(dims);
+END;
+$$ LANGUAGE plpgsql;
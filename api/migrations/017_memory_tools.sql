@@ -0,0 +1,10 @@
+-- The agent's memory and note tools change memories and notes during a
+-- conversation. Their changes are recorded as memory generations with
+-- source 'tool', the decision (ADD, UPDATE or DELETE) in rerank_decision,
+-- and memory versions they replace have change 'tool'.
+ALTER TABLE memory_generations ADD COLUMN IF NOT EXISTS source TEXT NOT NULL DEFAULT 'extraction';  -- extraction or tool
+
+-- The message a note was created from and the one that last changed it, when
+-- the agent's tools did.
+ALTER TABLE notes ADD COLUMN IF NOT EXISTS source_msg_id TEXT REFERENCES messages(id);
+ALTER TABLE notes ADD COLUMN IF NOT EXISTS updated_msg_id TEXT REFERENCES messages(id);
@@ -0,0 +1,23 @@
+-- Generation requests, queued until an agent worker claims them. A claim is a
+-- lease the worker keeps alive with heartbeats; jobs whose lease runs out, or
+-- whose worker disconnects, go back to the queue until max_attempts is used up.
+CREATE TABLE IF NOT EXISTS generation_jobs (
+    id TEXT PRIMARY KEY,
+    conversation_id TEXT NOT NULL REFERENCES conversations(id),
+    message_id TEXT NOT NULL,  -- the message the request is about
+    envelope BYTEA NOT NULL,   -- the msgpack GenRequest envelope sent to the worker
+    status TEXT NOT NULL DEFAULT 'queued'
+        CHECK (status IN ('queued', 'claimed', 'running', 'done', 'failed')),
+    worker_id TEXT,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    max_attempts INTEGER NOT NULL DEFAULT 3,
+    lease_expires_at TIMESTAMPTZ,
+    last_error TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    finished_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_generation_jobs_queued ON generation_jobs (created_at) WHERE status = 'queued';
+CREATE INDEX IF NOT EXISTS idx_generation_jobs_leased ON generation_jobs (lease_expires_at) WHERE status IN ('claimed', 'running');
+CREATE INDEX IF NOT EXISTS idx_generation_jobs_conversation ON generation_jobs (conversation_id, created_at DESC);
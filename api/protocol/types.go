@@ -17,9 +17,14 @@ const (
 	TypeStartAnswer      = protocol.TypeStartAnswer
 	TypeMemoryTrace      = protocol.TypeMemoryTrace
 	TypeAssistantSentence = protocol.TypeAssistantSentence
+	TypeAssistantDelta    = protocol.TypeAssistantDelta
 	TypeGenRequest       = protocol.TypeGenRequest
 	TypeThinkingSummary  = protocol.TypeThinkingSummary
 	TypeTitleUpdate      = protocol.TypeTitleUpdate
+	TypeGenerationCancel = protocol.TypeGenerationCancel
+	TypeToolApproval     = protocol.TypeToolApproval
+	TypeJobStatus        = protocol.TypeJobStatus
+	TypeJobHeartbeat     = protocol.TypeJobHeartbeat
 	TypeSubscribe        = protocol.TypeSubscribe
 	TypeUnsubscribe      = protocol.TypeUnsubscribe
 	TypeSubscribeAck     = protocol.TypeSubscribeAck
@@ -32,6 +37,8 @@ const (
 	TypeVoiceStatus       = protocol.TypeVoiceStatus
 	TypeVoiceSpeaking     = protocol.TypeVoiceSpeaking
 	TypePreferencesUpdate          = protocol.TypePreferencesUpdate
+	TypeMCPConfigUpdate            = protocol.TypeMCPConfigUpdate
+	TypeMCPToolsReport             = protocol.TypeMCPToolsReport
 	TypeAssistantToolsRegister     = protocol.TypeAssistantToolsRegister
 	TypeAssistantToolsAck          = protocol.TypeAssistantToolsAck
 	TypeAssistantHeartbeat         = protocol.TypeAssistantHeartbeat
@@ -42,18 +49,35 @@ const (
 	TypeWhatsAppDebug              = protocol.TypeWhatsAppDebug
 )
 
+const (
+	ToolExecutionServer           = protocol.ToolExecutionServer
+	ToolExecutionClient           = protocol.ToolExecutionClient
+	ToolExecutionAwaitingApproval = protocol.ToolExecutionAwaitingApproval
+)
+
+const (
+	JobRunning = protocol.JobRunning
+	JobDone    = protocol.JobDone
+	JobFailed  = protocol.JobFailed
+)
+
 type (
 	Error              = protocol.Error
 	UserMessage        = protocol.UserMessage
 	AssistantMessage   = protocol.AssistantMessage
 	AssistantSentence  = protocol.AssistantSentence
+	AssistantDelta     = protocol.AssistantDelta
 	StartAnswer        = protocol.StartAnswer
 	ToolUseRequest     = protocol.ToolUseRequest
 	ToolUseResult      = protocol.ToolUseResult
+	ToolApproval       = protocol.ToolApproval
 	MemoryTrace        = protocol.MemoryTrace
 	ThinkingSummary    = protocol.ThinkingSummary
 	TitleUpdate        = protocol.TitleUpdate
 	GenerationRequest  = protocol.GenerationRequest
+	GenerationCancel   = protocol.GenerationCancel
+	JobStatus          = protocol.JobStatus
+	JobHeartbeat       = protocol.JobHeartbeat
 	Subscribe          = protocol.Subscribe
 	Unsubscribe        = protocol.Unsubscribe
 	SubscribeAck       = protocol.SubscribeAck
@@ -69,6 +93,12 @@ type (
 	VoiceStatus        = protocol.VoiceStatus
 	VoiceSpeaking      = protocol.VoiceSpeaking
 	PreferencesUpdate          = protocol.PreferencesUpdate
+	MCPConfigUpdate            = protocol.MCPConfigUpdate
+	MCPServerConfig            = protocol.MCPServerConfig
+	MCPToolsReport             = protocol.MCPToolsReport
+	MCPServerTools             = protocol.MCPServerTools
+	MCPTool                    = protocol.MCPTool
+	MCPToolLimits              = protocol.MCPToolLimits
 	AssistantToolsRegister     = protocol.AssistantToolsRegister
 	AssistantTool              = protocol.AssistantTool
 	AssistantToolsAck          = protocol.AssistantToolsAck
@@ -0,0 +1,455 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/longregen/alicia/api/domain"
+	"github.com/longregen/alicia/api/services"
+)
+
+type AuthHandler struct {
+	authSvc     *services.AuthService
+	requireAuth bool
+}
+
+func NewAuthHandler(authSvc *services.AuthService, requireAuth bool) *AuthHandler {
+	return &AuthHandler{authSvc: authSvc, requireAuth: requireAuth}
+}
+
+// respondAuthError maps auth errors to responses. Errors wrapping
+// domain.ErrInvalidInput carry a message meant for the user.
+func respondAuthError(w http.ResponseWriter, err error, fallback string) {
+	switch {
+	case errors.Is(err, domain.ErrInvalidInput):
+		respondError(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, domain.ErrInvalidCredentials):
+		respondError(w, "invalid credentials", http.StatusUnauthorized)
+	case errors.Is(err, domain.ErrSignupClosed):
+		respondError(w, "signup is closed", http.StatusForbidden)
+	case errors.Is(err, domain.ErrUsernameTaken):
+		respondError(w, "username is taken", http.StatusConflict)
+	case errors.Is(err, domain.ErrPasskeysDisabled):
+		respondError(w, "passkeys are not configured", http.StatusNotFound)
+	case errors.Is(err, domain.ErrNotFound):
+		respondError(w, "not found", http.StatusNotFound)
+	default:
+		slog.Error(fallback, "error", err)
+		respondError(w, fallback, http.StatusInternalServerError)
+	}
+}
+
+// Config tells clients how to log in. It needs no authentication.
+func (h *AuthHandler) Config(w http.ResponseWriter, r *http.Request) {
+	signupOpen, err := h.authSvc.SignupOpen(r.Context())
+	if err != nil {
+		respondAuthError(w, err, "failed to get auth config")
+		return
+	}
+	// Once someone has registered, every request needs credentials.
+	requireAuth := h.requireAuth
+	if !requireAuth {
+		if requireAuth, err = h.authSvc.AccountsExist(r.Context()); err != nil {
+			respondAuthError(w, err, "failed to get auth config")
+			return
+		}
+	}
+	respondJSON(w, map[string]any{
+		"require_auth": requireAuth,
+		"signup_open":  signupOpen,
+		"passkeys":     h.authSvc.PasskeysEnabled(),
+	}, http.StatusOK)
+}
+
+func (h *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Username    string `json:"username"`
+		Password    string `json:"password"`
+		DisplayName string `json:"display_name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	issued, err := h.authSvc.Register(r.Context(), req.Username, req.Password, req.DisplayName, r.UserAgent())
+	if err != nil {
+		respondAuthError(w, err, "failed to register")
+		return
+	}
+
+	respondJSON(w, issued, http.StatusCreated)
+}
+
+func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	issued, err := h.authSvc.Login(r.Context(), req.Username, req.Password, r.UserAgent())
+	if err != nil {
+		respondAuthError(w, err, "failed to log in")
+		return
+	}
+
+	respondJSON(w, issued, http.StatusOK)
+}
+
+func (h *AuthHandler) BeginPasskeyLogin(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Username string `json:"username"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	challengeID, options, err := h.authSvc.BeginPasskeyLogin(r.Context(), req.Username)
+	if err != nil {
+		respondAuthError(w, err, "failed to start passkey login")
+		return
+	}
+
+	respondJSON(w, map[string]any{"challenge_id": challengeID, "options": options}, http.StatusOK)
+}
+
+func (h *AuthHandler) FinishPasskeyLogin(w http.ResponseWriter, r *http.Request) {
+	var req services.PasskeyAssertion
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	issued, err := h.authSvc.FinishPasskeyLogin(r.Context(), req, r.UserAgent())
+	if err != nil {
+		respondAuthError(w, err, "failed to log in")
+		return
+	}
+
+	respondJSON(w, issued, http.StatusOK)
+}
+
+// currentUser returns the principal if it is a user's session or device key;
+// otherwise it responds and returns nil. Account routes aren't for services
+// or anonymous requests.
+func currentUser(w http.ResponseWriter, r *http.Request) *domain.Principal {
+	p := PrincipalFromContext(r.Context())
+	if p == nil || (p.Kind != domain.PrincipalUser && p.Kind != domain.PrincipalDevice) {
+		respondError(w, "log in to manage your account", http.StatusUnauthorized)
+		return nil
+	}
+	return p
+}
+
+func (h *AuthHandler) Me(w http.ResponseWriter, r *http.Request) {
+	p := currentUser(w, r)
+	if p == nil {
+		return
+	}
+
+	user, err := h.authSvc.GetUser(r.Context(), p.UserID)
+	if err != nil {
+		respondAuthError(w, err, "failed to get user")
+		return
+	}
+	if user == nil {
+		respondError(w, "user not found", http.StatusNotFound)
+		return
+	}
+
+	respondJSON(w, map[string]any{"user": user, "principal": p.Kind, "session_id": p.SessionID}, http.StatusOK)
+}
+
+func (h *AuthHandler) Logout(w http.ResponseWriter, r *http.Request) {
+	p := currentUser(w, r)
+	if p == nil {
+		return
+	}
+	if p.SessionID == "" {
+		respondError(w, "not a session", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.authSvc.RevokeSession(r.Context(), p.SessionID, p.UserID); err != nil {
+		respondAuthError(w, err, "failed to log out")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *AuthHandler) ChangePassword(w http.ResponseWriter, r *http.Request) {
+	p := currentUser(w, r)
+	if p == nil {
+		return
+	}
+
+	var req struct {
+		CurrentPassword string `json:"current_password"`
+		NewPassword     string `json:"new_password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.authSvc.ChangePassword(r.Context(), p.UserID, p.SessionID, req.CurrentPassword, req.NewPassword); err != nil {
+		respondAuthError(w, err, "failed to change password")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *AuthHandler) ListSessions(w http.ResponseWriter, r *http.Request) {
+	p := currentUser(w, r)
+	if p == nil {
+		return
+	}
+
+	sessions, err := h.authSvc.ListSessions(r.Context(), p.UserID)
+	if err != nil {
+		respondAuthError(w, err, "failed to list sessions")
+		return
+	}
+	if sessions == nil {
+		sessions = []*domain.Session{}
+	}
+
+	respondJSON(w, map[string]any{"sessions": sessions, "current": p.SessionID}, http.StatusOK)
+}
+
+func (h *AuthHandler) RevokeSession(w http.ResponseWriter, r *http.Request) {
+	p := currentUser(w, r)
+	if p == nil {
+		return
+	}
+
+	if err := h.authSvc.RevokeSession(r.Context(), chi.URLParam(r, "id"), p.UserID); err != nil {
+		respondAuthError(w, err, "failed to revoke session")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type createKeyRequest struct {
+	Name      string   `json:"name"`
+	Scopes    []string `json:"scopes"`
+	ExpiresIn string   `json:"expires_in"` // a Go duration, e.g. 2160h; empty never expires
+}
+
+func (req createKeyRequest) ttl() (time.Duration, error) {
+	if req.ExpiresIn == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(req.ExpiresIn)
+	if err != nil || d <= 0 {
+		return 0, errors.New("expires_in must be a positive duration")
+	}
+	return d, nil
+}
+
+func (h *AuthHandler) ListAPIKeys(w http.ResponseWriter, r *http.Request) {
+	p := currentUser(w, r)
+	if p == nil {
+		return
+	}
+
+	keys, err := h.authSvc.ListDeviceKeys(r.Context(), p.UserID)
+	if err != nil {
+		respondAuthError(w, err, "failed to list api keys")
+		return
+	}
+	if keys == nil {
+		keys = []*domain.APIKey{}
+	}
+
+	respondJSON(w, map[string]any{"api_keys": keys}, http.StatusOK)
+}
+
+// CreateAPIKey issues a device key. The key is in the response only.
+func (h *AuthHandler) CreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	p := currentUser(w, r)
+	if p == nil {
+		return
+	}
+
+	var req createKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	ttl, err := req.ttl()
+	if err != nil {
+		respondError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	key, token, err := h.authSvc.CreateDeviceKey(r.Context(), p.UserID, req.Name, ttl)
+	if err != nil {
+		respondAuthError(w, err, "failed to create api key")
+		return
+	}
+
+	respondJSON(w, map[string]any{"api_key": key, "token": token}, http.StatusCreated)
+}
+
+func (h *AuthHandler) RevokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	p := currentUser(w, r)
+	if p == nil {
+		return
+	}
+
+	if err := h.authSvc.RevokeDeviceKey(r.Context(), chi.URLParam(r, "id"), p.UserID); err != nil {
+		respondAuthError(w, err, "failed to revoke api key")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *AuthHandler) BeginPasskeyRegistration(w http.ResponseWriter, r *http.Request) {
+	p := currentUser(w, r)
+	if p == nil {
+		return
+	}
+
+	challengeID, options, err := h.authSvc.BeginPasskeyRegistration(r.Context(), p.UserID)
+	if err != nil {
+		respondAuthError(w, err, "failed to start passkey registration")
+		return
+	}
+
+	respondJSON(w, map[string]any{"challenge_id": challengeID, "options": options}, http.StatusOK)
+}
+
+func (h *AuthHandler) FinishPasskeyRegistration(w http.ResponseWriter, r *http.Request) {
+	p := currentUser(w, r)
+	if p == nil {
+		return
+	}
+
+	var req services.PasskeyRegistration
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	passkey, err := h.authSvc.FinishPasskeyRegistration(r.Context(), p.UserID, req)
+	if err != nil {
+		respondAuthError(w, err, "failed to register passkey")
+		return
+	}
+
+	respondJSON(w, passkey, http.StatusCreated)
+}
+
+func (h *AuthHandler) ListPasskeys(w http.ResponseWriter, r *http.Request) {
+	p := currentUser(w, r)
+	if p == nil {
+		return
+	}
+
+	passkeys, err := h.authSvc.ListPasskeys(r.Context(), p.UserID)
+	if err != nil {
+		respondAuthError(w, err, "failed to list passkeys")
+		return
+	}
+	if passkeys == nil {
+		passkeys = []*domain.Passkey{}
+	}
+
+	respondJSON(w, map[string]any{"passkeys": passkeys}, http.StatusOK)
+}
+
+func (h *AuthHandler) DeletePasskey(w http.ResponseWriter, r *http.Request) {
+	p := currentUser(w, r)
+	if p == nil {
+		return
+	}
+
+	if err := h.authSvc.DeletePasskey(r.Context(), chi.URLParam(r, "id"), p.UserID); err != nil {
+		respondAuthError(w, err, "failed to delete passkey")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// currentAdmin is currentUser for routes only admins may use.
+func currentAdmin(w http.ResponseWriter, r *http.Request) *domain.Principal {
+	p := currentUser(w, r)
+	if p != nil && !p.IsAdmin {
+		respondError(w, "admin only", http.StatusForbidden)
+		return nil
+	}
+	return p
+}
+
+func (h *AuthHandler) ListServiceTokens(w http.ResponseWriter, r *http.Request) {
+	if currentAdmin(w, r) == nil {
+		return
+	}
+
+	tokens, err := h.authSvc.ListServiceTokens(r.Context())
+	if err != nil {
+		respondAuthError(w, err, "failed to list service tokens")
+		return
+	}
+	if tokens == nil {
+		tokens = []*domain.APIKey{}
+	}
+
+	respondJSON(w, map[string]any{"service_tokens": tokens, "scopes": domain.ServiceScopes}, http.StatusOK)
+}
+
+// CreateServiceToken issues a scoped token for a component. The token is in
+// the response only.
+func (h *AuthHandler) CreateServiceToken(w http.ResponseWriter, r *http.Request) {
+	p := currentAdmin(w, r)
+	if p == nil {
+		return
+	}
+
+	var req createKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	ttl, err := req.ttl()
+	if err != nil {
+		respondError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	key, token, err := h.authSvc.CreateServiceToken(r.Context(), p.UserID, req.Name, req.Scopes, ttl)
+	if err != nil {
+		respondAuthError(w, err, "failed to create service token")
+		return
+	}
+
+	respondJSON(w, map[string]any{"service_token": key, "token": token}, http.StatusCreated)
+}
+
+func (h *AuthHandler) RevokeServiceToken(w http.ResponseWriter, r *http.Request) {
+	if currentAdmin(w, r) == nil {
+		return
+	}
+
+	if err := h.authSvc.RevokeServiceToken(r.Context(), chi.URLParam(r, "id")); err != nil {
+		respondAuthError(w, err, "failed to revoke service token")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -118,6 +118,9 @@ func handleGetFeedback[T any](w http.ResponseWriter, r *http.Request, resourceID
 // CreateMessageFeedback handles POST /messages/{id}/feedback
 func (h *FeedbackHandler) CreateMessageFeedback(w http.ResponseWriter, r *http.Request) {
 	messageID := chi.URLParam(r, "id")
+	if !authorize(w, r, h.store, store.ResourceMessage, messageID) {
+		return
+	}
 	handleCreateFeedback(h, w, r, messageID, feedbackOps[domain.MessageFeedback]{
 		getExisting: h.store.GetMessageFeedbackByMessage,
 		updateExisting: func(ctx context.Context, fb *domain.MessageFeedback, rating int16, note string) error {
@@ -154,12 +157,20 @@ func (h *FeedbackHandler) CreateMessageFeedback(w http.ResponseWriter, r *http.R
 
 // GetMessageFeedback handles GET /messages/{id}/feedback
 func (h *FeedbackHandler) GetMessageFeedback(w http.ResponseWriter, r *http.Request) {
-	handleGetFeedback(w, r, chi.URLParam(r, "id"), h.store.GetMessageFeedbackByMessage)
+	messageID := chi.URLParam(r, "id")
+	if !authorize(w, r, h.store, store.ResourceMessage, messageID) {
+		return
+	}
+	handleGetFeedback(w, r, messageID, h.store.GetMessageFeedbackByMessage)
 }
 
 // CreateToolUseFeedback handles POST /tool-uses/{id}/feedback
 func (h *FeedbackHandler) CreateToolUseFeedback(w http.ResponseWriter, r *http.Request) {
-	handleCreateFeedback(h, w, r, chi.URLParam(r, "id"), feedbackOps[domain.ToolUseFeedback]{
+	toolUseID := chi.URLParam(r, "id")
+	if !authorize(w, r, h.store, store.ResourceToolUse, toolUseID) {
+		return
+	}
+	handleCreateFeedback(h, w, r, toolUseID, feedbackOps[domain.ToolUseFeedback]{
 		getExisting: h.store.GetToolUseFeedbackByToolUse,
 		updateExisting: func(ctx context.Context, fb *domain.ToolUseFeedback, rating int16, note string) error {
 			fb.Rating = rating
@@ -182,12 +193,20 @@ func (h *FeedbackHandler) CreateToolUseFeedback(w http.ResponseWriter, r *http.R
 
 // GetToolUseFeedback handles GET /tool-uses/{id}/feedback
 func (h *FeedbackHandler) GetToolUseFeedback(w http.ResponseWriter, r *http.Request) {
-	handleGetFeedback(w, r, chi.URLParam(r, "id"), h.store.GetToolUseFeedbackByToolUse)
+	toolUseID := chi.URLParam(r, "id")
+	if !authorize(w, r, h.store, store.ResourceToolUse, toolUseID) {
+		return
+	}
+	handleGetFeedback(w, r, toolUseID, h.store.GetToolUseFeedbackByToolUse)
 }
 
 // CreateMemoryUseFeedback handles POST /memory-uses/{id}/feedback
 func (h *FeedbackHandler) CreateMemoryUseFeedback(w http.ResponseWriter, r *http.Request) {
-	handleCreateFeedback(h, w, r, chi.URLParam(r, "id"), feedbackOps[domain.MemoryUseFeedback]{
+	memoryUseID := chi.URLParam(r, "id")
+	if !authorize(w, r, h.store, store.ResourceMemoryUse, memoryUseID) {
+		return
+	}
+	handleCreateFeedback(h, w, r, memoryUseID, feedbackOps[domain.MemoryUseFeedback]{
 		getExisting: h.store.GetMemoryUseFeedbackByMemoryUse,
 		updateExisting: func(ctx context.Context, fb *domain.MemoryUseFeedback, rating int16, note string) error {
 			fb.Rating = rating
@@ -210,7 +229,11 @@ func (h *FeedbackHandler) CreateMemoryUseFeedback(w http.ResponseWriter, r *http
 
 // GetMemoryUseFeedback handles GET /memory-uses/{id}/feedback
 func (h *FeedbackHandler) GetMemoryUseFeedback(w http.ResponseWriter, r *http.Request) {
-	handleGetFeedback(w, r, chi.URLParam(r, "id"), h.store.GetMemoryUseFeedbackByMemoryUse)
+	memoryUseID := chi.URLParam(r, "id")
+	if !authorize(w, r, h.store, store.ResourceMemoryUse, memoryUseID) {
+		return
+	}
+	handleGetFeedback(w, r, memoryUseID, h.store.GetMemoryUseFeedbackByMemoryUse)
 }
 
 // sendMessageFeedbackToLangfuse looks up the message's trace_id and sends feedback to Langfuse.
@@ -3,11 +3,14 @@ package handlers
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
 	"net/http"
 	"os"
 	"strconv"
+
+	"github.com/longregen/alicia/api/domain"
 )
 
 var debugEnabled = os.Getenv("DEBUG") != ""
@@ -20,7 +23,10 @@ func debugf(format string, args ...any) {
 
 type contextKey string
 
-const userIDKey contextKey = "user_id"
+const (
+	userIDKey    contextKey = "user_id"
+	principalKey contextKey = "principal"
+)
 
 func UserIDFromContext(ctx context.Context) string {
 	if id, ok := ctx.Value(userIDKey).(string); ok {
@@ -33,6 +39,38 @@ func SetUserIDInContext(ctx context.Context, userID string) context.Context {
 	return context.WithValue(ctx, userIDKey, userID)
 }
 
+// PrincipalFromContext returns who the request is authenticated as, or nil
+// outside the auth middleware.
+func PrincipalFromContext(ctx context.Context) *domain.Principal {
+	p, _ := ctx.Value(principalKey).(*domain.Principal)
+	return p
+}
+
+func SetPrincipalInContext(ctx context.Context, p *domain.Principal) context.Context {
+	return context.WithValue(ctx, principalKey, p)
+}
+
+// Authorizer checks that a resource belongs to a user, returning
+// domain.ErrNotFound if it doesn't.
+type Authorizer interface {
+	Authorize(ctx context.Context, resource, id, userID string) error
+}
+
+// authorize responds with not found and returns false unless the resource
+// (one of the store.Resource kinds) belongs to the current user.
+func authorize(w http.ResponseWriter, r *http.Request, a Authorizer, resource, id string) bool {
+	err := a.Authorize(r.Context(), resource, id, UserIDFromContext(r.Context()))
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, domain.ErrNotFound):
+		respondError(w, resource+" not found", http.StatusNotFound)
+	default:
+		respondError(w, "failed to verify ownership", http.StatusInternalServerError)
+	}
+	return false
+}
+
 func respondJSON(w http.ResponseWriter, data any, status int) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(status)
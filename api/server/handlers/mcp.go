@@ -1,19 +1,32 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
+	"log/slog"
 	"net/http"
+	"sort"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/longregen/alicia/api/domain"
+	"github.com/longregen/alicia/api/protocol"
 	"github.com/longregen/alicia/api/services"
 )
 
+// MCPBroadcaster pushes server config changes to the agent and exposes the
+// tools it reports back.
+type MCPBroadcaster interface {
+	BroadcastMCPConfig(servers []*domain.MCPServer)
+	MCPTools() []protocol.MCPServerTools
+}
+
 type MCPHandler struct {
 	mcpSvc *services.MCPService
+	hub    MCPBroadcaster
 }
 
-func NewMCPHandler(svc *services.MCPService) *MCPHandler {
-	return &MCPHandler{mcpSvc: svc}
+func NewMCPHandler(svc *services.MCPService, hub MCPBroadcaster) *MCPHandler {
+	return &MCPHandler{mcpSvc: svc, hub: hub}
 }
 
 func (h *MCPHandler) List(w http.ResponseWriter, r *http.Request) {
@@ -23,18 +36,29 @@ func (h *MCPHandler) List(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	h.addStatus(servers...)
+	listHeaderNames(servers...)
 	respondJSON(w, map[string]any{
 		"servers": servers,
 	}, http.StatusOK)
 }
 
+// Create, Update and Delete are for admins only: the agent runs a stdio
+// server's command on its host.
 func (h *MCPHandler) Create(w http.ResponseWriter, r *http.Request) {
+	if currentAdmin(w, r) == nil {
+		return
+	}
+
 	var req struct {
-		Name          string   `json:"name"`
-		TransportType string   `json:"transport_type"`
-		Command       string   `json:"command"`
-		Args          []string `json:"args"`
-		URL           string   `json:"url"`
+		Name          string            `json:"name"`
+		TransportType string            `json:"transport_type"`
+		Command       string            `json:"command"`
+		Args          []string          `json:"args"`
+		URL           string            `json:"url"`
+		Headers       map[string]string `json:"headers"`
+		domain.MCPToolLimits
+		ToolLimits map[string]domain.MCPToolLimits `json:"tool_limits"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		respondError(w, "invalid request body", http.StatusBadRequest)
@@ -47,15 +71,26 @@ func (h *MCPHandler) Create(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if req.TransportType == "" {
-		req.TransportType = "stdio"
+		req.TransportType = domain.MCPTransportStdio
+	}
+	if msg := validateMCPTransport(req.TransportType, req.Command, req.URL); msg != "" {
+		respondError(w, msg, http.StatusBadRequest)
+		return
 	}
 
-	server, err := h.mcpSvc.CreateServer(r.Context(), req.Name, req.TransportType, req.Command, req.Args, req.URL)
+	if msg := validateMCPLimits(req.MCPToolLimits, req.ToolLimits); msg != "" {
+		respondError(w, msg, http.StatusBadRequest)
+		return
+	}
+
+	server, err := h.mcpSvc.CreateServer(r.Context(), req.Name, req.TransportType, req.Command, req.Args, req.URL, req.Headers, req.MCPToolLimits, req.ToolLimits)
 	if err != nil {
 		respondError(w, "failed to create server", http.StatusInternalServerError)
 		return
 	}
+	h.broadcastConfig(r.Context())
 
+	listHeaderNames(server)
 	respondJSON(w, server, http.StatusCreated)
 }
 
@@ -68,10 +103,16 @@ func (h *MCPHandler) Get(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	h.addStatus(server)
+	listHeaderNames(server)
 	respondJSON(w, server, http.StatusOK)
 }
 
 func (h *MCPHandler) Update(w http.ResponseWriter, r *http.Request) {
+	if currentAdmin(w, r) == nil {
+		return
+	}
+
 	name := chi.URLParam(r, "name")
 
 	server, err := h.mcpSvc.GetServerByName(r.Context(), name)
@@ -81,11 +122,17 @@ func (h *MCPHandler) Update(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var req struct {
-		TransportType *string  `json:"transport_type"`
-		Command       *string  `json:"command"`
-		Args          []string `json:"args"`
-		URL           *string  `json:"url"`
-		Enabled       *bool    `json:"enabled"`
+		TransportType  *string                         `json:"transport_type"`
+		Command        *string                         `json:"command"`
+		Args           []string                        `json:"args"`
+		URL            *string                         `json:"url"`
+		Headers        map[string]string               `json:"headers"`
+		TimeoutSeconds *int                            `json:"timeout_seconds"`
+		MaxResultBytes *int                            `json:"max_result_bytes"`
+		ResultPolicy   *string                         `json:"result_policy"`
+		ApprovalPolicy *string                         `json:"approval_policy"`
+		ToolLimits     map[string]domain.MCPToolLimits `json:"tool_limits"`
+		Enabled        *bool                           `json:"enabled"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		respondError(w, "invalid request body", http.StatusBadRequest)
@@ -104,25 +151,164 @@ func (h *MCPHandler) Update(w http.ResponseWriter, r *http.Request) {
 	if req.URL != nil {
 		server.URL = *req.URL
 	}
+	if req.Headers != nil {
+		server.Headers = req.Headers
+	}
+	if req.TimeoutSeconds != nil {
+		server.TimeoutSeconds = *req.TimeoutSeconds
+	}
+	if req.MaxResultBytes != nil {
+		server.MaxResultBytes = *req.MaxResultBytes
+	}
+	if req.ResultPolicy != nil {
+		server.ResultPolicy = *req.ResultPolicy
+	}
+	if req.ApprovalPolicy != nil {
+		server.ApprovalPolicy = *req.ApprovalPolicy
+	}
+	if req.ToolLimits != nil {
+		server.ToolLimits = req.ToolLimits
+	}
 	if req.Enabled != nil {
 		server.Enabled = *req.Enabled
 	}
+	if msg := validateMCPTransport(server.TransportType, server.Command, server.URL); msg != "" {
+		respondError(w, msg, http.StatusBadRequest)
+		return
+	}
+	if msg := validateMCPLimits(server.MCPToolLimits, server.ToolLimits); msg != "" {
+		respondError(w, msg, http.StatusBadRequest)
+		return
+	}
 
 	if err := h.mcpSvc.UpdateServer(r.Context(), server); err != nil {
 		respondError(w, "failed to update server", http.StatusInternalServerError)
 		return
 	}
+	h.broadcastConfig(r.Context())
 
+	listHeaderNames(server)
 	respondJSON(w, server, http.StatusOK)
 }
 
 func (h *MCPHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	if currentAdmin(w, r) == nil {
+		return
+	}
+
 	name := chi.URLParam(r, "name")
 
 	if err := h.mcpSvc.DeleteServerByName(r.Context(), name); err != nil {
 		respondError(w, "failed to delete server", http.StatusInternalServerError)
 		return
 	}
+	h.broadcastConfig(r.Context())
 
 	w.WriteHeader(http.StatusNoContent)
 }
+
+// Tools returns the tools of each server the agent is running, keyed by
+// server name, along with any servers that have failed.
+func (h *MCPHandler) Tools(w http.ResponseWriter, r *http.Request) {
+	tools := make(map[string][]protocol.MCPTool)
+	errs := make(map[string]string)
+	for _, srv := range h.hub.MCPTools() {
+		if srv.Status == domain.MCPStatusFailed {
+			errs[srv.Name] = srv.Error
+			continue
+		}
+		tools[srv.Name] = srv.Tools
+	}
+
+	respondJSON(w, map[string]any{
+		"tools":  tools,
+		"errors": errs,
+	}, http.StatusOK)
+}
+
+// addStatus fills in the runtime status the agent last reported for each
+// server. Servers the agent isn't running are left without one.
+func (h *MCPHandler) addStatus(servers ...*domain.MCPServer) {
+	reported := make(map[string]protocol.MCPServerTools)
+	for _, srv := range h.hub.MCPTools() {
+		reported[srv.Name] = srv
+	}
+	for _, server := range servers {
+		if srv, ok := reported[server.Name]; ok {
+			server.Status = srv.Status
+			server.LastError = srv.Error
+		}
+	}
+}
+
+// listHeaderNames fills in the names of each server's headers. Their values
+// often hold credentials, so responses carry only the names.
+func listHeaderNames(servers ...*domain.MCPServer) {
+	for _, server := range servers {
+		server.HeaderNames = make([]string, 0, len(server.Headers))
+		for name := range server.Headers {
+			server.HeaderNames = append(server.HeaderNames, name)
+		}
+		sort.Strings(server.HeaderNames)
+	}
+}
+
+// broadcastConfig sends the current set of enabled servers to the agent so
+// changes take effect without a restart.
+func (h *MCPHandler) broadcastConfig(ctx context.Context) {
+	servers, err := h.mcpSvc.ListEnabledServers(ctx)
+	if err != nil {
+		slog.Error("failed to load mcp servers for broadcast", "error", err)
+		return
+	}
+	h.hub.BroadcastMCPConfig(servers)
+}
+
+// validateMCPTransport checks that a server has what its transport needs to
+// connect, returning a message for the client if it doesn't.
+func validateMCPTransport(transportType, command, url string) string {
+	switch transportType {
+	case domain.MCPTransportStdio:
+		if command == "" {
+			return "command is required for stdio servers"
+		}
+	case domain.MCPTransportSSE, domain.MCPTransportStreamableHTTP:
+		if url == "" {
+			return "url is required for remote servers"
+		}
+	default:
+		return "unsupported transport_type"
+	}
+	return ""
+}
+
+// validateMCPLimits checks server and per-tool limits, returning a message for
+// the client if any are invalid.
+func validateMCPLimits(limits domain.MCPToolLimits, toolLimits map[string]domain.MCPToolLimits) string {
+	check := func(l domain.MCPToolLimits) string {
+		if l.TimeoutSeconds < 0 || l.MaxResultBytes < 0 {
+			return "timeout_seconds and max_result_bytes must not be negative"
+		}
+		switch l.ResultPolicy {
+		case "", domain.MCPResultPolicyTruncate, domain.MCPResultPolicySummarize:
+		default:
+			return "result_policy must be truncate or summarize"
+		}
+		switch l.ApprovalPolicy {
+		case "", domain.MCPApprovalAlways, domain.MCPApprovalNever, domain.MCPApprovalAsk:
+		default:
+			return "approval_policy must be always, never or ask"
+		}
+		return ""
+	}
+
+	if msg := check(limits); msg != "" {
+		return msg
+	}
+	for tool, l := range toolLimits {
+		if msg := check(l); msg != "" {
+			return tool + ": " + msg
+		}
+	}
+	return ""
+}
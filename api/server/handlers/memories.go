@@ -9,6 +9,7 @@ import (
 	"github.com/go-chi/chi/v5"
 	"github.com/longregen/alicia/api/domain"
 	"github.com/longregen/alicia/api/services"
+	"github.com/longregen/alicia/api/store"
 )
 
 type MemoryHandler struct {
@@ -22,11 +23,12 @@ func NewMemoryHandler(svc *services.MemoryService, msgSvc *services.MessageServi
 }
 
 func (h *MemoryHandler) List(w http.ResponseWriter, r *http.Request) {
+	userID := UserIDFromContext(r.Context())
 	limit := parseIntQuery(r, "limit", 50)
 	offset := parseIntQuery(r, "offset", 0)
 	slog.Debug("listing memories", "limit", limit, "offset", offset)
 
-	memories, total, err := h.memorySvc.ListMemories(r.Context(), limit, offset)
+	memories, total, err := h.memorySvc.ListMemories(r.Context(), userID, limit, offset)
 	if err != nil {
 		slog.Error("failed to list memories", "error", err)
 		respondError(w, "failed to list memories", http.StatusInternalServerError)
@@ -43,9 +45,10 @@ func (h *MemoryHandler) List(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *MemoryHandler) Get(w http.ResponseWriter, r *http.Request) {
+	userID := UserIDFromContext(r.Context())
 	id := chi.URLParam(r, "id")
 
-	memory, err := h.memorySvc.GetMemory(r.Context(), id)
+	memory, err := h.memorySvc.GetMemory(r.Context(), id, userID)
 	if err != nil {
 		respondError(w, "memory not found", http.StatusNotFound)
 		return
@@ -55,6 +58,7 @@ func (h *MemoryHandler) Get(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *MemoryHandler) Create(w http.ResponseWriter, r *http.Request) {
+	userID := UserIDFromContext(r.Context())
 	var req struct {
 		Content string `json:"content"`
 	}
@@ -69,7 +73,7 @@ func (h *MemoryHandler) Create(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	memory, err := h.memorySvc.CreateMemory(r.Context(), req.Content, nil)
+	memory, err := h.memorySvc.CreateMemory(r.Context(), userID, req.Content, nil)
 	if err != nil {
 		slog.Error("failed to create memory", "error", err)
 		respondError(w, "failed to create memory", http.StatusInternalServerError)
@@ -81,9 +85,10 @@ func (h *MemoryHandler) Create(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *MemoryHandler) Update(w http.ResponseWriter, r *http.Request) {
+	userID := UserIDFromContext(r.Context())
 	id := chi.URLParam(r, "id")
 
-	memory, err := h.memorySvc.GetMemory(r.Context(), id)
+	memory, err := h.memorySvc.GetMemory(r.Context(), id, userID)
 	if err != nil {
 		respondError(w, "memory not found", http.StatusNotFound)
 		return
@@ -114,6 +119,7 @@ func (h *MemoryHandler) Update(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *MemoryHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	userID := UserIDFromContext(r.Context())
 	id := chi.URLParam(r, "id")
 
 	var reason *string
@@ -126,15 +132,55 @@ func (h *MemoryHandler) Delete(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	if err := h.memorySvc.DeleteMemory(r.Context(), id, reason); err != nil {
-		respondError(w, "failed to delete memory", http.StatusInternalServerError)
+	if err := h.memorySvc.DeleteMemory(r.Context(), id, userID, reason); err != nil {
+		respondMemoryError(w, err, "failed to delete memory")
 		return
 	}
 
 	w.WriteHeader(http.StatusNoContent)
 }
 
+// Versions lists the earlier contents of a memory, oldest first, so users
+// can see how it evolved. The current content is the memory itself.
+func (h *MemoryHandler) Versions(w http.ResponseWriter, r *http.Request) {
+	userID := UserIDFromContext(r.Context())
+	id := chi.URLParam(r, "id")
+
+	versions, err := h.memorySvc.ListMemoryVersions(r.Context(), id, userID)
+	if err != nil {
+		respondMemoryError(w, err, "failed to list memory versions")
+		return
+	}
+	if versions == nil {
+		versions = []*domain.MemoryVersion{}
+	}
+
+	respondJSON(w, map[string]any{"versions": versions}, http.StatusOK)
+}
+
+// Provenance shows where a memory came from and which answers it
+// influenced. ?uses_limit caps the retrievals listed, 50 by default.
+func (h *MemoryHandler) Provenance(w http.ResponseWriter, r *http.Request) {
+	userID := UserIDFromContext(r.Context())
+	id := chi.URLParam(r, "id")
+
+	limit := parseIntQuery(r, "uses_limit", 50)
+	if limit < 0 || limit > 500 {
+		respondError(w, "uses_limit must be between 0 and 500", http.StatusBadRequest)
+		return
+	}
+
+	provenance, err := h.memorySvc.GetProvenance(r.Context(), id, userID, limit)
+	if err != nil {
+		respondMemoryError(w, err, "failed to get memory provenance")
+		return
+	}
+
+	respondJSON(w, provenance, http.StatusOK)
+}
+
 func (h *MemoryHandler) Search(w http.ResponseWriter, r *http.Request) {
+	userID := UserIDFromContext(r.Context())
 	var req struct {
 		Query string `json:"query"`
 		Limit int    `json:"limit"`
@@ -154,7 +200,7 @@ func (h *MemoryHandler) Search(w http.ResponseWriter, r *http.Request) {
 		limit = 10
 	}
 
-	memories, err := h.memorySvc.SearchMemories(r.Context(), req.Query, limit)
+	memories, err := h.memorySvc.SearchMemories(r.Context(), userID, req.Query, limit)
 	if err != nil {
 		respondError(w, "search failed", http.StatusInternalServerError)
 		return
@@ -166,6 +212,7 @@ func (h *MemoryHandler) Search(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *MemoryHandler) GetByTags(w http.ResponseWriter, r *http.Request) {
+	userID := UserIDFromContext(r.Context())
 	tags := r.URL.Query()["tag"]
 	if len(tags) == 0 {
 		respondError(w, "at least one tag is required", http.StatusBadRequest)
@@ -174,7 +221,7 @@ func (h *MemoryHandler) GetByTags(w http.ResponseWriter, r *http.Request) {
 
 	limit := parseIntQuery(r, "limit", 50)
 
-	memories, err := h.memorySvc.GetMemoriesByTags(r.Context(), tags, limit)
+	memories, err := h.memorySvc.GetMemoriesByTags(r.Context(), userID, tags, limit)
 	if err != nil {
 		respondError(w, "failed to get memories", http.StatusInternalServerError)
 		return
@@ -186,6 +233,7 @@ func (h *MemoryHandler) GetByTags(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *MemoryHandler) Pin(w http.ResponseWriter, r *http.Request) {
+	userID := UserIDFromContext(r.Context())
 	id := chi.URLParam(r, "id")
 
 	var req struct {
@@ -196,8 +244,8 @@ func (h *MemoryHandler) Pin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := h.memorySvc.PinMemory(r.Context(), id, req.Pinned); err != nil {
-		respondError(w, "failed to pin memory", http.StatusInternalServerError)
+	if err := h.memorySvc.PinMemory(r.Context(), id, userID, req.Pinned); err != nil {
+		respondMemoryError(w, err, "failed to pin memory")
 		return
 	}
 
@@ -205,10 +253,11 @@ func (h *MemoryHandler) Pin(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *MemoryHandler) Archive(w http.ResponseWriter, r *http.Request) {
+	userID := UserIDFromContext(r.Context())
 	id := chi.URLParam(r, "id")
 
-	if err := h.memorySvc.ArchiveMemory(r.Context(), id); err != nil {
-		respondError(w, "failed to archive memory", http.StatusInternalServerError)
+	if err := h.memorySvc.ArchiveMemory(r.Context(), id, userID); err != nil {
+		respondMemoryError(w, err, "failed to archive memory")
 		return
 	}
 
@@ -216,6 +265,7 @@ func (h *MemoryHandler) Archive(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *MemoryHandler) AddTag(w http.ResponseWriter, r *http.Request) {
+	userID := UserIDFromContext(r.Context())
 	id := chi.URLParam(r, "id")
 
 	var req struct {
@@ -226,8 +276,8 @@ func (h *MemoryHandler) AddTag(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := h.memorySvc.AddTag(r.Context(), id, req.Tag); err != nil {
-		respondError(w, "failed to add tag", http.StatusInternalServerError)
+	if err := h.memorySvc.AddTag(r.Context(), id, userID, req.Tag); err != nil {
+		respondMemoryError(w, err, "failed to add tag")
 		return
 	}
 
@@ -235,17 +285,28 @@ func (h *MemoryHandler) AddTag(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *MemoryHandler) RemoveTag(w http.ResponseWriter, r *http.Request) {
+	userID := UserIDFromContext(r.Context())
 	id := chi.URLParam(r, "id")
 	tag := chi.URLParam(r, "tag")
 
-	if err := h.memorySvc.RemoveTag(r.Context(), id, tag); err != nil {
-		respondError(w, "failed to remove tag", http.StatusInternalServerError)
+	if err := h.memorySvc.RemoveTag(r.Context(), id, userID, tag); err != nil {
+		respondMemoryError(w, err, "failed to remove tag")
 		return
 	}
 
 	w.WriteHeader(http.StatusNoContent)
 }
 
+// respondMemoryError maps a memory that does not exist or belongs to another
+// user to 404, and anything else to 500.
+func respondMemoryError(w http.ResponseWriter, err error, msg string) {
+	if errors.Is(err, domain.ErrNotFound) {
+		respondError(w, "memory not found", http.StatusNotFound)
+		return
+	}
+	respondError(w, msg, http.StatusInternalServerError)
+}
+
 // EnrichedMemoryUse includes the memory content with the memory use record.
 type EnrichedMemoryUse struct {
 	ID         string  `json:"id"`
@@ -260,29 +321,11 @@ func (h *MemoryHandler) GetMemoryUsesByMessage(w http.ResponseWriter, r *http.Re
 	userID := UserIDFromContext(r.Context())
 	msgID := chi.URLParam(r, "id")
 
-	// Get the message to find its conversation
-	msg, err := h.msgSvc.GetMessage(r.Context(), msgID)
-	if err != nil {
-		if errors.Is(err, domain.ErrNotFound) {
-			respondError(w, "message not found", http.StatusNotFound)
-		} else {
-			respondError(w, "failed to get message", http.StatusInternalServerError)
-		}
-		return
-	}
-
-	// Verify user owns the conversation
-	_, err = h.convSvc.GetByUser(r.Context(), msg.ConversationID, userID)
-	if err != nil {
-		if errors.Is(err, domain.ErrNotFound) {
-			respondError(w, "message not found", http.StatusNotFound)
-		} else {
-			respondError(w, "failed to verify ownership", http.StatusInternalServerError)
-		}
+	if !authorize(w, r, h.convSvc, store.ResourceMessage, msgID) {
 		return
 	}
 
-	uses, err := h.memorySvc.GetUsesByMessage(r.Context(), msgID)
+	uses, err := h.memorySvc.GetUsesByMessage(r.Context(), msgID, userID)
 	if err != nil {
 		respondError(w, "failed to get memory uses", http.StatusInternalServerError)
 		return
@@ -291,7 +334,7 @@ func (h *MemoryHandler) GetMemoryUsesByMessage(w http.ResponseWriter, r *http.Re
 	// Enrich memory uses with content
 	enriched := make([]EnrichedMemoryUse, 0, len(uses))
 	for _, use := range uses {
-		mem, err := h.memorySvc.GetMemory(r.Context(), use.MemoryID)
+		mem, err := h.memorySvc.GetMemory(r.Context(), use.MemoryID, userID)
 		if err != nil {
 			// Skip memories that can't be found (may have been deleted)
 			continue
@@ -10,10 +10,12 @@ import (
 	"github.com/go-chi/chi/v5"
 	"github.com/longregen/alicia/api/domain"
 	"github.com/longregen/alicia/api/services"
+	"github.com/longregen/alicia/api/store"
 )
 
 type Broadcaster interface {
 	SendGenerationRequest(ctx context.Context, convID, userMsgID string, previousID *string, usePareto bool)
+	SendGenerationCancel(ctx context.Context, convID, messageID string)
 }
 
 type SyncGenerationResult struct {
@@ -117,6 +119,9 @@ func (h *MessageHandler) Create(w http.ResponseWriter, r *http.Request) {
 	previousID := req.PreviousID
 	if previousID == nil {
 		previousID = conv.TipMessageID
+	} else if prev, err := h.msgSvc.GetMessage(r.Context(), *previousID); err != nil || prev.ConversationID != convID {
+		respondError(w, "previous message not found", http.StatusBadRequest)
+		return
 	}
 	debugf("[MessageHandler.Create] using previousID=%v", previousID)
 
@@ -174,39 +179,38 @@ func (h *MessageHandler) Create(w http.ResponseWriter, r *http.Request) {
 	respondJSON(w, msg, http.StatusAccepted)
 }
 
-func (h *MessageHandler) Get(w http.ResponseWriter, r *http.Request) {
+// Cancel stops the in-flight generation of a conversation. An optional
+// message_id narrows it to one assistant (or triggering user) message.
+func (h *MessageHandler) Cancel(w http.ResponseWriter, r *http.Request) {
 	userID := UserIDFromContext(r.Context())
-	msgID := chi.URLParam(r, "id")
+	convID := chi.URLParam(r, "id")
 
-	msg, err := h.msgSvc.GetMessage(r.Context(), msgID)
-	if err != nil {
-		if errors.Is(err, domain.ErrNotFound) {
-			respondError(w, "message not found", http.StatusNotFound)
-		} else {
-			respondError(w, "failed to get message", http.StatusInternalServerError)
-		}
+	if _, err := h.convSvc.GetByUser(r.Context(), convID, userID); err != nil {
+		respondError(w, "conversation not found", http.StatusNotFound)
 		return
 	}
 
-	// Verify user owns the conversation
-	_, err = h.convSvc.GetByUser(r.Context(), msg.ConversationID, userID)
-	if err != nil {
-		if errors.Is(err, domain.ErrNotFound) {
-			respondError(w, "message not found", http.StatusNotFound)
-		} else {
-			respondError(w, "failed to verify ownership", http.StatusInternalServerError)
+	var req struct {
+		MessageID string `json:"message_id"`
+	}
+	if r.ContentLength > 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondError(w, "invalid request body", http.StatusBadRequest)
+			return
 		}
-		return
 	}
 
-	respondJSON(w, msg, http.StatusOK)
+	h.hub.SendGenerationCancel(r.Context(), convID, req.MessageID)
+	w.WriteHeader(http.StatusAccepted)
 }
 
-func (h *MessageHandler) GetSiblings(w http.ResponseWriter, r *http.Request) {
-	userID := UserIDFromContext(r.Context())
+func (h *MessageHandler) Get(w http.ResponseWriter, r *http.Request) {
 	msgID := chi.URLParam(r, "id")
 
-	// First get the message to find its conversation
+	if !authorize(w, r, h.convSvc, store.ResourceMessage, msgID) {
+		return
+	}
+
 	msg, err := h.msgSvc.GetMessage(r.Context(), msgID)
 	if err != nil {
 		if errors.Is(err, domain.ErrNotFound) {
@@ -217,14 +221,13 @@ func (h *MessageHandler) GetSiblings(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Verify user owns the conversation
-	_, err = h.convSvc.GetByUser(r.Context(), msg.ConversationID, userID)
-	if err != nil {
-		if errors.Is(err, domain.ErrNotFound) {
-			respondError(w, "message not found", http.StatusNotFound)
-		} else {
-			respondError(w, "failed to verify ownership", http.StatusInternalServerError)
-		}
+	respondJSON(w, msg, http.StatusOK)
+}
+
+func (h *MessageHandler) GetSiblings(w http.ResponseWriter, r *http.Request) {
+	msgID := chi.URLParam(r, "id")
+
+	if !authorize(w, r, h.convSvc, store.ResourceMessage, msgID) {
 		return
 	}
 
@@ -0,0 +1,426 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/longregen/alicia/api/domain"
+	"github.com/longregen/alicia/api/protocol"
+)
+
+// OpenAIConversationHeader names the conversation a chat completion continues.
+// Without it each request starts a new conversation, seeded with the history
+// sent along. Responses always carry the conversation they went to.
+const OpenAIConversationHeader = "X-Alicia-Conversation-ID"
+
+const (
+	openAIModel = "alicia"
+	// openAIKeepAlive is how often a waiting stream gets an SSE comment, so
+	// proxies and clients don't give up on it.
+	openAIKeepAlive = 15 * time.Second
+)
+
+// ChatConversations is the part of the conversation service the
+// OpenAI-compatible endpoint uses.
+type ChatConversations interface {
+	Create(ctx context.Context, userID, title string) (*domain.Conversation, error)
+	GetByUser(ctx context.Context, id, userID string) (*domain.Conversation, error)
+	Delete(ctx context.Context, id string) error
+}
+
+// ChatMessages is the part of the message service the OpenAI-compatible
+// endpoint uses.
+type ChatMessages interface {
+	CreateUserMessage(ctx context.Context, convID, content string, previousID *string) (*domain.Message, error)
+	CreateAssistantMessage(ctx context.Context, convID, content, reasoning string, previousID *string) (*domain.Message, error)
+}
+
+// ChatHub runs the agent for the OpenAI-compatible endpoint.
+type ChatHub interface {
+	WaitForGeneration(ctx context.Context, convID, userMsgID string, previousID *string, usePareto bool) (*SyncGenerationResult, error)
+	// StreamGeneration also has the agent stream its answer as deltas to
+	// the conversation's listeners.
+	StreamGeneration(ctx context.Context, convID, userMsgID string, previousID *string) (*SyncGenerationResult, error)
+	Listen(convID string) (events <-chan *protocol.Envelope, stop func())
+}
+
+// OpenAIHandler serves an OpenAI-compatible chat completions API, so tools
+// that only speak it get Alicia's memory, notes and tools.
+type OpenAIHandler struct {
+	convs ChatConversations
+	msgs  ChatMessages
+	hub   ChatHub
+}
+
+func NewOpenAIHandler(convs ChatConversations, msgs ChatMessages, hub ChatHub) *OpenAIHandler {
+	return &OpenAIHandler{convs: convs, msgs: msgs, hub: hub}
+}
+
+type openAIMessage struct {
+	Role    string          `json:"role"`
+	Content json.RawMessage `json:"content"`
+}
+
+// text returns the message's content, given either as a string or as a list
+// of parts of which only the text ones are kept.
+func (m openAIMessage) text() (string, error) {
+	if len(m.Content) == 0 || string(m.Content) == "null" {
+		return "", nil
+	}
+	var s string
+	if err := json.Unmarshal(m.Content, &s); err == nil {
+		return s, nil
+	}
+	var parts []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	}
+	if err := json.Unmarshal(m.Content, &parts); err != nil {
+		return "", errors.New("content must be a string or a list of parts")
+	}
+	var texts []string
+	for _, p := range parts {
+		if p.Type == "text" {
+			texts = append(texts, p.Text)
+		}
+	}
+	return strings.Join(texts, "\n"), nil
+}
+
+type chatCompletion struct {
+	ID       string                  `json:"id"`
+	Object   string                  `json:"object"`
+	Created  int64                   `json:"created"`
+	Model    string                  `json:"model"`
+	Choices  []chatCompletionChoice  `json:"choices"`
+	Metadata *chatCompletionMetadata `json:"metadata,omitempty"`
+}
+
+type chatCompletionChoice struct {
+	Index        int                    `json:"index"`
+	Message      *chatCompletionMessage `json:"message,omitempty"`
+	Delta        *chatCompletionMessage `json:"delta,omitempty"`
+	FinishReason *string                `json:"finish_reason"`
+}
+
+type chatCompletionMessage struct {
+	Role    string  `json:"role,omitempty"`
+	Content *string `json:"content,omitempty"`
+}
+
+// chatCompletionMetadata tells where a completion lives in Alicia and which
+// tools the agent ran for it. The tool calls have already been executed, so
+// they're not returned as tool_calls for the client to run.
+type chatCompletionMetadata struct {
+	ConversationID string           `json:"conversation_id"`
+	MessageID      string           `json:"message_id,omitempty"`
+	ToolCalls      []openAIToolCall `json:"tool_calls,omitempty"`
+}
+
+type openAIToolCall struct {
+	ID       string             `json:"id"`
+	Type     string             `json:"type"`
+	Function openAIFunctionCall `json:"function"`
+	Status   string             `json:"status,omitempty"`
+}
+
+type openAIFunctionCall struct {
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"`
+}
+
+func completionMetadata(convID string, result *SyncGenerationResult) *chatCompletionMetadata {
+	meta := &chatCompletionMetadata{ConversationID: convID, MessageID: result.MessageID}
+	for _, tu := range result.ToolUses {
+		args := []byte("{}")
+		if tu.Arguments != nil {
+			if data, err := json.Marshal(tu.Arguments); err == nil {
+				args = data
+			}
+		}
+		meta.ToolCalls = append(meta.ToolCalls, openAIToolCall{
+			ID:       tu.ID,
+			Type:     "function",
+			Function: openAIFunctionCall{Name: tu.ToolName, Arguments: string(args)},
+			Status:   tu.Status,
+		})
+	}
+	return meta
+}
+
+func stopReason() *string {
+	s := "stop"
+	return &s
+}
+
+func respondOpenAIError(w http.ResponseWriter, message string, status int) {
+	errType := "invalid_request_error"
+	if status >= http.StatusInternalServerError {
+		errType = "server_error"
+	}
+	respondJSON(w, map[string]any{
+		"error": map[string]string{"message": message, "type": errType},
+	}, status)
+}
+
+// Models lists the one model this API serves.
+func (h *OpenAIHandler) Models(w http.ResponseWriter, r *http.Request) {
+	respondJSON(w, map[string]any{
+		"object": "list",
+		"data": []map[string]any{
+			{"id": openAIModel, "object": "model", "created": 0, "owned_by": "alicia"},
+		},
+	}, http.StatusOK)
+}
+
+// ChatCompletions answers the last user message of an OpenAI chat completion
+// request with Alicia's agent, streaming the answer as server-sent events if
+// asked to.
+func (h *OpenAIHandler) ChatCompletions(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID := UserIDFromContext(ctx)
+
+	var req struct {
+		Model    string          `json:"model"`
+		Messages []openAIMessage `json:"messages"`
+		Stream   bool            `json:"stream"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondOpenAIError(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	if len(req.Messages) == 0 {
+		respondOpenAIError(w, "messages is required", http.StatusBadRequest)
+		return
+	}
+	last := req.Messages[len(req.Messages)-1]
+	if last.Role != domain.RoleUser {
+		respondOpenAIError(w, "the last message must be from the user", http.StatusBadRequest)
+		return
+	}
+	content, err := last.text()
+	if err != nil {
+		respondOpenAIError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if content == "" {
+		respondOpenAIError(w, "the last message has no text", http.StatusBadRequest)
+		return
+	}
+
+	convID := r.Header.Get(OpenAIConversationHeader)
+	var previousID *string
+	if convID != "" {
+		conv, err := h.convs.GetByUser(ctx, convID, userID)
+		if err != nil {
+			respondOpenAIError(w, "conversation not found", http.StatusNotFound)
+			return
+		}
+		previousID = conv.TipMessageID
+	} else {
+		convID, previousID, err = h.startConversation(ctx, userID, req.Messages[:len(req.Messages)-1])
+		if err != nil {
+			slog.Error("failed to start conversation for chat completion", "error", err, "user_id", userID)
+			respondOpenAIError(w, "failed to create conversation", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	msg, err := h.msgs.CreateUserMessage(ctx, convID, content, previousID)
+	if err != nil {
+		slog.Error("failed to create user message", "error", err, "conversation_id", convID)
+		respondOpenAIError(w, "failed to create message", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set(OpenAIConversationHeader, convID)
+
+	model := req.Model
+	if model == "" {
+		model = openAIModel
+	}
+	completion := chatCompletion{ID: "chatcmpl-" + msg.ID, Created: msg.CreatedAt.Unix(), Model: model}
+
+	if req.Stream {
+		h.streamCompletion(w, r, completion, convID, msg.ID, previousID)
+		return
+	}
+
+	result, err := h.hub.WaitForGeneration(ctx, convID, msg.ID, previousID, false)
+	if err != nil {
+		slog.Error("chat completion generation failed", "error", err, "conversation_id", convID)
+		respondOpenAIError(w, "generation failed", http.StatusGatewayTimeout)
+		return
+	}
+
+	completion.Object = "chat.completion"
+	completion.Choices = []chatCompletionChoice{{
+		Message:      &chatCompletionMessage{Role: domain.RoleAssistant, Content: &result.Content},
+		FinishReason: stopReason(),
+	}}
+	completion.Metadata = completionMetadata(convID, result)
+	respondJSON(w, completion, http.StatusOK)
+}
+
+// startConversation creates a conversation holding the history sent before
+// the last message, and returns it with the message to reply after. System
+// messages are left out; the agent has its own. If seeding fails the
+// conversation is deleted again.
+func (h *OpenAIHandler) startConversation(ctx context.Context, userID string, history []openAIMessage) (string, *string, error) {
+	conv, err := h.convs.Create(ctx, userID, "")
+	if err != nil {
+		return "", nil, err
+	}
+
+	previousID, err := h.seedHistory(ctx, conv.ID, history)
+	if err != nil {
+		if delErr := h.convs.Delete(context.WithoutCancel(ctx), conv.ID); delErr != nil {
+			slog.Error("failed to delete unseeded conversation", "error", delErr, "conversation_id", conv.ID)
+		}
+		return "", nil, err
+	}
+	return conv.ID, previousID, nil
+}
+
+func (h *OpenAIHandler) seedHistory(ctx context.Context, convID string, history []openAIMessage) (*string, error) {
+	var previousID *string
+	for _, m := range history {
+		if m.Role != domain.RoleUser && m.Role != domain.RoleAssistant {
+			continue
+		}
+		content, err := m.text()
+		if err != nil {
+			return nil, err
+		}
+		var msg *domain.Message
+		if m.Role == domain.RoleUser {
+			msg, err = h.msgs.CreateUserMessage(ctx, convID, content, previousID)
+		} else {
+			msg, err = h.msgs.CreateAssistantMessage(ctx, convID, content, "", previousID)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("seed %s message: %w", m.Role, err)
+		}
+		previousID = &msg.ID
+	}
+	return previousID, nil
+}
+
+// streamCompletion sends the answer as chat.completion.chunk events while the
+// agent writes it. Whatever the stream missed, say because it fell behind,
+// goes out in one chunk once generation is done.
+func (h *OpenAIHandler) streamCompletion(w http.ResponseWriter, r *http.Request, completion chatCompletion, convID, userMsgID string, previousID *string) {
+	ctx := r.Context()
+	rc := http.NewResponseController(w)
+
+	// Listen before the generation starts, so its first deltas aren't missed.
+	events, stop := h.hub.Listen(convID)
+	defer stop()
+
+	type outcome struct {
+		result *SyncGenerationResult
+		err    error
+	}
+	done := make(chan outcome, 1)
+	go func() {
+		result, err := h.hub.StreamGeneration(ctx, convID, userMsgID, previousID)
+		done <- outcome{result, err}
+	}()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+
+	completion.Object = "chat.completion.chunk"
+	send := func(data any) {
+		payload, err := json.Marshal(data)
+		if err != nil {
+			slog.Error("json encode error", "error", err)
+			return
+		}
+		fmt.Fprintf(w, "data: %s\n\n", payload)
+		rc.Flush()
+	}
+	chunk := func(delta chatCompletionMessage, finish *string) chatCompletion {
+		c := completion
+		c.Choices = []chatCompletionChoice{{Delta: &delta, FinishReason: finish}}
+		return c
+	}
+
+	send(chunk(chatCompletionMessage{Role: domain.RoleAssistant}, nil))
+
+	// Deltas count once the agent has started the answer to this message;
+	// the conversation may have other generations going.
+	var answerID string
+	var streamed strings.Builder
+	forward := func(env *protocol.Envelope) {
+		switch env.Type {
+		case protocol.TypeStartAnswer:
+			start, err := protocol.DecodeBody[protocol.StartAnswer](env)
+			if err == nil && start.PreviousID == userMsgID {
+				answerID = start.MessageID
+			}
+		case protocol.TypeAssistantDelta:
+			delta, err := protocol.DecodeBody[protocol.AssistantDelta](env)
+			if err == nil && answerID != "" && delta.MessageID == answerID && delta.Delta != "" {
+				streamed.WriteString(delta.Delta)
+				send(chunk(chatCompletionMessage{Content: &delta.Delta}, nil))
+			}
+		}
+	}
+
+	ticker := time.NewTicker(openAIKeepAlive)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+			rc.Flush()
+
+		case env, ok := <-events:
+			if !ok {
+				events = nil
+				continue
+			}
+			forward(env)
+
+		case o := <-done:
+			if o.err != nil {
+				slog.Error("chat completion generation failed", "error", o.err, "conversation_id", convID)
+				send(map[string]any{
+					"error": map[string]string{"message": "generation failed", "type": "server_error"},
+				})
+				return
+			}
+			// Deltas already published may still be queued.
+			for drained := events == nil; !drained; {
+				select {
+				case env, ok := <-events:
+					if ok {
+						forward(env)
+					} else {
+						drained = true
+					}
+				default:
+					drained = true
+				}
+			}
+			// The final message is authoritative; send what the deltas
+			// didn't cover, unless they strayed from it.
+			if rest, ok := strings.CutPrefix(o.result.Content, streamed.String()); ok && rest != "" {
+				send(chunk(chatCompletionMessage{Content: &rest}, nil))
+			}
+			final := chunk(chatCompletionMessage{}, stopReason())
+			final.Metadata = completionMetadata(convID, o.result)
+			send(final)
+			fmt.Fprint(w, "data: [DONE]\n\n")
+			rc.Flush()
+			return
+		}
+	}
+}
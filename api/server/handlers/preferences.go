@@ -87,6 +87,8 @@ func (h *PreferencesHandler) Update(w http.ResponseWriter, r *http.Request) {
 		ParetoEnableCrossover    *bool    `json:"pareto_enable_crossover"`
 		NotesSimilarityThreshold *float32 `json:"notes_similarity_threshold"`
 		NotesMaxCount            *int     `json:"notes_max_count"`
+		SearchVectorWeight       *float32 `json:"search_vector_weight"`
+		SearchKeywordWeight      *float32 `json:"search_keyword_weight"`
 		ConfirmDeleteMemory      *bool    `json:"confirm_delete_memory"`
 		ShowRelevanceScores      *bool    `json:"show_relevance_scores"`
 	}
@@ -122,6 +124,8 @@ func (h *PreferencesHandler) Update(w http.ResponseWriter, r *http.Request) {
 		ParetoEnableCrossover:    current.ParetoEnableCrossover,
 		NotesSimilarityThreshold: current.NotesSimilarityThreshold,
 		NotesMaxCount:            current.NotesMaxCount,
+		SearchVectorWeight:       current.SearchVectorWeight,
+		SearchKeywordWeight:      current.SearchKeywordWeight,
 		ConfirmDeleteMemory:      current.ConfirmDeleteMemory,
 		ShowRelevanceScores:      current.ShowRelevanceScores,
 	}
@@ -234,6 +238,24 @@ func (h *PreferencesHandler) Update(w http.ResponseWriter, r *http.Request) {
 		}
 		updates.NotesMaxCount = *req.NotesMaxCount
 	}
+	if req.SearchVectorWeight != nil {
+		if *req.SearchVectorWeight < 0.0 || *req.SearchVectorWeight > 1.0 {
+			respondError(w, "search_vector_weight must be 0.0-1.0", http.StatusBadRequest)
+			return
+		}
+		updates.SearchVectorWeight = *req.SearchVectorWeight
+	}
+	if req.SearchKeywordWeight != nil {
+		if *req.SearchKeywordWeight < 0.0 || *req.SearchKeywordWeight > 1.0 {
+			respondError(w, "search_keyword_weight must be 0.0-1.0", http.StatusBadRequest)
+			return
+		}
+		updates.SearchKeywordWeight = *req.SearchKeywordWeight
+	}
+	if updates.SearchVectorWeight == 0 && updates.SearchKeywordWeight == 0 {
+		respondError(w, "search_vector_weight and search_keyword_weight cannot both be 0", http.StatusBadRequest)
+		return
+	}
 	if req.ConfirmDeleteMemory != nil {
 		updates.ConfirmDeleteMemory = *req.ConfirmDeleteMemory
 	}
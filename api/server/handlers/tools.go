@@ -3,10 +3,12 @@ package handlers
 import (
 	"errors"
 	"net/http"
+	"strconv"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/longregen/alicia/api/domain"
 	"github.com/longregen/alicia/api/services"
+	"github.com/longregen/alicia/api/store"
 )
 
 type ToolHandler struct {
@@ -32,10 +34,11 @@ func (h *ToolHandler) ListTools(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *ToolHandler) ListToolUses(w http.ResponseWriter, r *http.Request) {
+	userID := UserIDFromContext(r.Context())
 	limit := parseIntQuery(r, "limit", 50)
 	offset := parseIntQuery(r, "offset", 0)
 
-	uses, total, err := h.toolSvc.ListToolUses(r.Context(), limit, offset)
+	uses, total, err := h.toolSvc.ListToolUses(r.Context(), userID, limit, offset)
 	if err != nil {
 		respondError(w, "failed to list tool uses", http.StatusInternalServerError)
 		return
@@ -50,58 +53,63 @@ func (h *ToolHandler) ListToolUses(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *ToolHandler) GetToolUse(w http.ResponseWriter, r *http.Request) {
-	userID := UserIDFromContext(r.Context())
-	id := chi.URLParam(r, "id")
-
-	tu, err := h.toolSvc.GetToolUse(r.Context(), id)
-	if err != nil {
-		if errors.Is(err, domain.ErrNotFound) {
-			respondError(w, "tool use not found", http.StatusNotFound)
-		} else {
-			respondError(w, "failed to get tool use", http.StatusInternalServerError)
-		}
+	tu, ok := h.ownedToolUse(w, r)
+	if !ok {
 		return
 	}
 
-	// Verify user owns the conversation via the message
-	msg, err := h.msgSvc.GetMessage(r.Context(), tu.MessageID)
-	if err != nil {
-		respondError(w, "tool use not found", http.StatusNotFound)
+	respondJSON(w, tu, http.StatusOK)
+}
+
+// GetToolUseAttachment serves a binary part of a tool result, such as a
+// screenshot, which the result references by attachment ID.
+func (h *ToolHandler) GetToolUseAttachment(w http.ResponseWriter, r *http.Request) {
+	tu, ok := h.ownedToolUse(w, r)
+	if !ok {
 		return
 	}
 
-	_, err = h.convSvc.GetByUser(r.Context(), msg.ConversationID, userID)
+	a, err := h.toolSvc.GetToolUseAttachment(r.Context(), tu.ID, chi.URLParam(r, "attachmentId"))
 	if err != nil {
-		respondError(w, "tool use not found", http.StatusNotFound)
+		if errors.Is(err, domain.ErrNotFound) {
+			respondError(w, "attachment not found", http.StatusNotFound)
+		} else {
+			respondError(w, "failed to get attachment", http.StatusInternalServerError)
+		}
 		return
 	}
 
-	respondJSON(w, tu, http.StatusOK)
+	w.Header().Set("Content-Type", a.MimeType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(a.Data)))
+	w.Header().Set("Cache-Control", "private, max-age=86400")
+	w.Write(a.Data)
 }
 
-func (h *ToolHandler) GetToolUsesByMessage(w http.ResponseWriter, r *http.Request) {
-	userID := UserIDFromContext(r.Context())
-	msgID := chi.URLParam(r, "id")
+// ownedToolUse loads the tool use named in the URL, responding with not found
+// unless it belongs to a conversation of the current user.
+func (h *ToolHandler) ownedToolUse(w http.ResponseWriter, r *http.Request) (*domain.ToolUse, bool) {
+	id := chi.URLParam(r, "id")
 
-	// Get the message to find its conversation
-	msg, err := h.msgSvc.GetMessage(r.Context(), msgID)
-	if err != nil {
-		if errors.Is(err, domain.ErrNotFound) {
-			respondError(w, "message not found", http.StatusNotFound)
-		} else {
-			respondError(w, "failed to get message", http.StatusInternalServerError)
-		}
-		return
+	if !authorize(w, r, h.convSvc, store.ResourceToolUse, id) {
+		return nil, false
 	}
 
-	// Verify user owns the conversation
-	_, err = h.convSvc.GetByUser(r.Context(), msg.ConversationID, userID)
+	tu, err := h.toolSvc.GetToolUse(r.Context(), id)
 	if err != nil {
 		if errors.Is(err, domain.ErrNotFound) {
-			respondError(w, "message not found", http.StatusNotFound)
+			respondError(w, "tool use not found", http.StatusNotFound)
 		} else {
-			respondError(w, "failed to verify ownership", http.StatusInternalServerError)
+			respondError(w, "failed to get tool use", http.StatusInternalServerError)
 		}
+		return nil, false
+	}
+	return tu, true
+}
+
+func (h *ToolHandler) GetToolUsesByMessage(w http.ResponseWriter, r *http.Request) {
+	msgID := chi.URLParam(r, "id")
+
+	if !authorize(w, r, h.convSvc, store.ResourceMessage, msgID) {
 		return
 	}
 
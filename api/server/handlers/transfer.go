@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/longregen/alicia/api/domain"
+	"github.com/longregen/alicia/api/services"
+)
+
+// maxImportBytes bounds the size of an import body.
+const maxImportBytes = 64 << 20
+
+// Export writes all of the user's memories as JSON Lines (see
+// domain.MemoryRecord), with their embeddings if ?embeddings=true.
+func (h *MemoryHandler) Export(w http.ResponseWriter, r *http.Request) {
+	userID := UserIDFromContext(r.Context())
+
+	records, err := h.memorySvc.ExportMemories(r.Context(), userID, queryBool(r, "embeddings"))
+	if err != nil {
+		slog.Error("failed to export memories", "error", err)
+		respondError(w, "failed to export memories", http.StatusInternalServerError)
+		return
+	}
+	respondJSONLines(w, "memories.jsonl", records)
+}
+
+// Import adds memories from a JSON Lines body and reports, line by line,
+// which were imported, skipped as duplicates or conflicts, or invalid.
+// ?dry_run=true only reports; ?on_conflict=import imports conflicts too.
+func (h *MemoryHandler) Import(w http.ResponseWriter, r *http.Request) {
+	userID := UserIDFromContext(r.Context())
+	opts, ok := importOptions(w, r)
+	if !ok {
+		return
+	}
+
+	result, err := h.memorySvc.ImportMemories(r.Context(), userID, http.MaxBytesReader(w, r.Body, maxImportBytes), opts)
+	if err != nil {
+		respondImportError(w, err, "failed to import memories")
+		return
+	}
+	respondJSON(w, result, http.StatusOK)
+}
+
+// Export writes all of the user's notes as JSON Lines (see
+// domain.NoteRecord), with their embeddings if ?embeddings=true.
+func (h *NoteHandler) Export(w http.ResponseWriter, r *http.Request) {
+	userID := UserIDFromContext(r.Context())
+
+	records, err := h.noteSvc.ExportNotes(r.Context(), userID, queryBool(r, "embeddings"))
+	if err != nil {
+		slog.Error("failed to export notes", "error", err)
+		respondError(w, "failed to export notes", http.StatusInternalServerError)
+		return
+	}
+	respondJSONLines(w, "notes.jsonl", records)
+}
+
+// Import adds notes from a JSON Lines body, like MemoryHandler.Import.
+func (h *NoteHandler) Import(w http.ResponseWriter, r *http.Request) {
+	userID := UserIDFromContext(r.Context())
+	opts, ok := importOptions(w, r)
+	if !ok {
+		return
+	}
+
+	result, err := h.noteSvc.ImportNotes(r.Context(), userID, http.MaxBytesReader(w, r.Body, maxImportBytes), opts)
+	if err != nil {
+		respondImportError(w, err, "failed to import notes")
+		return
+	}
+	respondJSON(w, result, http.StatusOK)
+}
+
+func importOptions(w http.ResponseWriter, r *http.Request) (services.ImportOptions, bool) {
+	opts := services.ImportOptions{DryRun: queryBool(r, "dry_run")}
+	switch r.URL.Query().Get("on_conflict") {
+	case "", "skip":
+	case "import":
+		opts.ImportConflicts = true
+	default:
+		respondError(w, "on_conflict must be skip or import", http.StatusBadRequest)
+		return opts, false
+	}
+	return opts, true
+}
+
+func respondImportError(w http.ResponseWriter, err error, msg string) {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		respondError(w, "import too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+	slog.Error(msg, "error", err)
+	respondError(w, msg, http.StatusInternalServerError)
+}
+
+// respondJSONLines writes records one JSON object per line, as a download
+// named filename.
+func respondJSONLines[T any](w http.ResponseWriter, filename string, records []T) {
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+	w.Header().Set("X-Alicia-Format-Version", strconv.Itoa(domain.TransferFormatVersion))
+	w.WriteHeader(http.StatusOK)
+	enc := json.NewEncoder(w)
+	for _, rec := range records {
+		if err := enc.Encode(rec); err != nil {
+			slog.Error("json encode error", "error", err)
+			return
+		}
+	}
+}
+
+func queryBool(r *http.Request, name string) bool {
+	v, _ := strconv.ParseBool(r.URL.Query().Get(name))
+	return v
+}
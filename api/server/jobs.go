@@ -0,0 +1,337 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/longregen/alicia/api/domain"
+	"github.com/longregen/alicia/api/protocol"
+	"github.com/longregen/alicia/api/store"
+)
+
+const (
+	// jobLease is how long a worker holds a job without a heartbeat.
+	jobLease = 30 * time.Second
+	// jobSweepInterval is how often expired leases are looked for.
+	jobSweepInterval = 10 * time.Second
+	// defaultAgentConcurrency is how many jobs a worker gets at once when it
+	// doesn't say.
+	defaultAgentConcurrency = 4
+)
+
+// JobQueue is where the hub keeps generation jobs; *store.Store implements it.
+type JobQueue interface {
+	EnqueueJob(ctx context.Context, j *domain.GenerationJob) error
+	ClaimJob(ctx context.Context, workerID string, leaseUntil time.Time) (*domain.GenerationJob, error)
+	StartJob(ctx context.Context, id, workerID string) error
+	HeartbeatJobs(ctx context.Context, workerID string, ids []string, leaseUntil time.Time) error
+	FinishJob(ctx context.Context, id, workerID, status, errMsg string) error
+	ReleaseWorkerJobs(ctx context.Context, workerID, reason string) ([]*domain.GenerationJob, error)
+	ReleaseExpiredJobs(ctx context.Context, now time.Time) ([]*domain.GenerationJob, error)
+	CancelQueuedJobs(ctx context.Context, convID, messageID string) ([]*domain.GenerationJob, error)
+}
+
+// agentWorker is an agent connection taking jobs from the queue.
+type agentWorker struct {
+	id          string
+	conn        *websocket.Conn
+	concurrency int
+	jobs        map[string]*domain.GenerationJob // dispatched and not finished
+	mcpTools    []protocol.MCPServerTools        // last tool report
+}
+
+func (w *agentWorker) free() int {
+	return w.concurrency - len(w.jobs)
+}
+
+func (h *Hub) SubscribeAgent(conn *websocket.Conn, concurrency int) {
+	if concurrency <= 0 {
+		concurrency = defaultAgentConcurrency
+	}
+	w := &agentWorker{
+		id:          store.NewWorkerID(),
+		conn:        conn,
+		concurrency: concurrency,
+		jobs:        make(map[string]*domain.GenerationJob),
+	}
+
+	h.agentMu.Lock()
+	h.agents[conn] = w
+	total := len(h.agents)
+	h.agentMu.Unlock()
+
+	slog.Info("ws: agent connected", "worker_id", w.id, "concurrency", concurrency, "total", total)
+	h.wakeJobs()
+}
+
+// UnsubscribeAgent forgets a worker and puts the jobs it was working on back
+// in the queue.
+func (h *Hub) UnsubscribeAgent(conn *websocket.Conn) {
+	h.agentMu.Lock()
+	w, ok := h.agents[conn]
+	delete(h.agents, conn)
+	total := len(h.agents)
+	h.agentMu.Unlock()
+	if !ok {
+		return
+	}
+	slog.Info("ws: agent disconnected", "worker_id", w.id, "jobs", len(w.jobs), "total", total)
+	h.releaseWorker(w.id)
+}
+
+func (h *Hub) releaseWorker(workerID string) {
+	if h.jobs == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	jobs, err := h.jobs.ReleaseWorkerJobs(ctx, workerID, "agent disconnected")
+	if err != nil {
+		slog.Error("ws: release worker jobs error", "error", err, "worker_id", workerID)
+		return
+	}
+	h.handleReleased(jobs)
+}
+
+// handleReleased fails the released jobs that have no attempts left and
+// dispatches the rest again.
+func (h *Hub) handleReleased(jobs []*domain.GenerationJob) {
+	// A worker whose lease ran out no longer holds the job, so it frees up a
+	// slot even if it never reports back.
+	h.agentMu.Lock()
+	for _, w := range h.agents {
+		for _, j := range jobs {
+			delete(w.jobs, j.ID)
+		}
+	}
+	h.agentMu.Unlock()
+
+	requeued := 0
+	for _, j := range jobs {
+		if j.Status == domain.JobStatusFailed {
+			slog.Warn("ws: generation job failed", "job_id", j.ID, "conversation_id", j.ConversationID, "attempts", j.Attempts, "error", j.LastError)
+			h.failGeneration(j, j.LastError)
+			continue
+		}
+		requeued++
+	}
+	if requeued > 0 {
+		slog.Info("ws: generation jobs requeued", "count", requeued)
+		h.wakeJobs()
+	}
+}
+
+// failGeneration tells the conversation's clients and any sync waiter that
+// the generation for a job won't happen.
+func (h *Hub) failGeneration(j *domain.GenerationJob, errMsg string) {
+	h.BroadcastEnvelope(j.ConversationID, protocol.TypeGenerationComplete, &protocol.GenerationComplete{
+		ConversationID: j.ConversationID,
+		Success:        false,
+		Error:          errMsg,
+	})
+	h.notifySyncWaiterError(j.ConversationID, j.MessageID, errMsg)
+}
+
+// EnqueueGeneration queues a generation request for the agent workers. The
+// envelope's body is replaced by req, tagged with the new job's ID.
+func (h *Hub) EnqueueGeneration(ctx context.Context, env *protocol.Envelope, req protocol.GenerationRequest) (*domain.GenerationJob, error) {
+	if h.jobs == nil {
+		return nil, errors.New("no job queue configured")
+	}
+	convID := env.ConversationID
+	if convID == "" {
+		convID = req.ConversationID
+	}
+
+	req.JobID = store.NewGenerationJobID()
+	env.Body = req
+	data, err := env.Encode()
+	if err != nil {
+		return nil, fmt.Errorf("encode generation request: %w", err)
+	}
+
+	job := &domain.GenerationJob{
+		ID:             req.JobID,
+		ConversationID: convID,
+		MessageID:      req.MessageID,
+		Envelope:       data,
+		CreatedAt:      time.Now().UTC(),
+	}
+	if err := h.jobs.EnqueueJob(ctx, job); err != nil {
+		return nil, err
+	}
+	slog.Info("ws: generation job queued", "job_id", job.ID, "conversation_id", convID, "message_id", req.MessageID)
+	h.wakeJobs()
+	return job, nil
+}
+
+// cancelQueuedJobs drops the jobs for a message, or a whole conversation,
+// that no worker has claimed yet.
+func (h *Hub) cancelQueuedJobs(ctx context.Context, convID, messageID string) {
+	if h.jobs == nil {
+		return
+	}
+	jobs, err := h.jobs.CancelQueuedJobs(ctx, convID, messageID)
+	if err != nil {
+		slog.Error("ws: cancel queued jobs error", "error", err, "conversation_id", convID)
+		return
+	}
+	for _, j := range jobs {
+		slog.Info("ws: queued generation job cancelled", "job_id", j.ID, "conversation_id", j.ConversationID)
+		h.BroadcastEnvelope(j.ConversationID, protocol.TypeGenerationComplete, &protocol.GenerationComplete{
+			ConversationID: j.ConversationID,
+			Cancelled:      true,
+		})
+		h.notifySyncWaiterError(j.ConversationID, j.MessageID, "cancelled")
+	}
+}
+
+func (h *Hub) wakeJobs() {
+	select {
+	case h.jobWake <- struct{}{}:
+	default:
+	}
+}
+
+// RunJobs hands queued jobs to the connected workers and takes back jobs
+// whose lease expired, until ctx is done.
+func (h *Hub) RunJobs(ctx context.Context) {
+	if h.jobs == nil {
+		return
+	}
+	ticker := time.NewTicker(jobSweepInterval)
+	defer ticker.Stop()
+
+	h.sweepJobs(ctx)
+	for {
+		h.dispatchJobs(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-h.jobWake:
+		case <-ticker.C:
+			h.sweepJobs(ctx)
+		}
+	}
+}
+
+func (h *Hub) sweepJobs(ctx context.Context) {
+	jobs, err := h.jobs.ReleaseExpiredJobs(ctx, time.Now().UTC())
+	if err != nil {
+		slog.Error("ws: release expired jobs error", "error", err)
+		return
+	}
+	h.handleReleased(jobs)
+}
+
+// dispatchJobs claims jobs for the least loaded workers until every worker is
+// busy or the queue is empty.
+func (h *Hub) dispatchJobs(ctx context.Context) {
+	for ctx.Err() == nil {
+		w := h.leastLoadedAgent()
+		if w == nil {
+			return
+		}
+		job, err := h.jobs.ClaimJob(ctx, w.id, time.Now().UTC().Add(jobLease))
+		if err != nil {
+			slog.Error("ws: claim job error", "error", err, "worker_id", w.id)
+			return
+		}
+		if job == nil {
+			return
+		}
+
+		h.agentMu.Lock()
+		_, connected := h.agents[w.conn]
+		if connected {
+			w.jobs[job.ID] = job
+		}
+		h.agentMu.Unlock()
+		if !connected {
+			// The worker left between choosing it and claiming the job.
+			h.releaseWorker(w.id)
+			continue
+		}
+
+		slog.Info("ws: generation job dispatched", "job_id", job.ID, "worker_id", w.id, "attempt", job.Attempts)
+		h.broadcastToMonitors(job.Envelope, "server", "agent")
+		if err := h.writeMessage(w.conn, websocket.BinaryMessage, job.Envelope); err != nil {
+			// The connection is going away; its jobs are released when it does.
+			slog.Error("ws: agent send error", "error", err, "worker_id", w.id)
+		}
+	}
+}
+
+func (h *Hub) leastLoadedAgent() *agentWorker {
+	h.agentMu.RLock()
+	defer h.agentMu.RUnlock()
+	var best *agentWorker
+	for _, w := range h.agents {
+		if w.free() > 0 && (best == nil || w.free() > best.free()) {
+			best = w
+		}
+	}
+	return best
+}
+
+func (h *Hub) agentWorker(conn *websocket.Conn) *agentWorker {
+	h.agentMu.RLock()
+	defer h.agentMu.RUnlock()
+	return h.agents[conn]
+}
+
+// handleJobStatus records a worker's progress on a job.
+func (h *Hub) handleJobStatus(ctx context.Context, conn *websocket.Conn, status *protocol.JobStatus) {
+	w := h.agentWorker(conn)
+	if w == nil || h.jobs == nil {
+		return
+	}
+
+	if status.Status == protocol.JobRunning {
+		if err := h.jobs.StartJob(ctx, status.JobID, w.id); err != nil && !errors.Is(err, domain.ErrNotFound) {
+			slog.Error("ws: start job error", "error", err, "job_id", status.JobID)
+		}
+		return
+	}
+
+	h.agentMu.Lock()
+	job := w.jobs[status.JobID]
+	delete(w.jobs, status.JobID)
+	h.agentMu.Unlock()
+	defer h.wakeJobs()
+
+	jobStatus := domain.JobStatusDone
+	if status.Status == protocol.JobFailed {
+		jobStatus = domain.JobStatusFailed
+	}
+	err := h.jobs.FinishJob(ctx, status.JobID, w.id, jobStatus, status.Error)
+	if errors.Is(err, domain.ErrNotFound) {
+		// The lease ran out and the job went to another worker.
+		slog.Warn("ws: worker finished a job it no longer holds", "job_id", status.JobID, "worker_id", w.id)
+		return
+	}
+	if err != nil {
+		slog.Error("ws: finish job error", "error", err, "job_id", status.JobID)
+		return
+	}
+	slog.Info("ws: generation job finished", "job_id", status.JobID, "worker_id", w.id, "status", jobStatus)
+	if jobStatus == domain.JobStatusFailed && job != nil {
+		h.failGeneration(job, status.Error)
+	}
+}
+
+// handleJobHeartbeat extends the leases of the jobs a worker is working on.
+func (h *Hub) handleJobHeartbeat(ctx context.Context, conn *websocket.Conn, hb *protocol.JobHeartbeat) {
+	w := h.agentWorker(conn)
+	if w == nil || h.jobs == nil {
+		return
+	}
+	if err := h.jobs.HeartbeatJobs(ctx, w.id, hb.JobIDs, time.Now().UTC().Add(jobLease)); err != nil {
+		slog.Error("ws: job heartbeat error", "error", err, "worker_id", w.id)
+	}
+}
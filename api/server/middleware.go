@@ -2,46 +2,103 @@ package server
 
 import (
 	"bufio"
+	"errors"
+	"fmt"
 	"log/slog"
 	"net"
 	"net/http"
-	"regexp"
+	"strings"
 	"time"
 
+	"github.com/longregen/alicia/api/domain"
 	"github.com/longregen/alicia/api/server/handlers"
+	"github.com/longregen/alicia/api/services"
 	"github.com/longregen/alicia/pkg/otel"
 )
 
 type AuthConfig struct {
 	RequireAuth bool
+	Auth        *services.AuthService
 }
 
+// AuthWithConfig authenticates requests by their bearer token: a session
+// token or device key acts as its user, and a service token with the
+// act_as_user scope acts as the user named by X-User-ID. Without a token the
+// request is rejected if auth is required or anyone has registered, and
+// otherwise acts as X-User-ID, as it did before there were accounts.
 func AuthWithConfig(cfg AuthConfig) func(http.Handler) http.Handler {
-	validUserID := regexp.MustCompile(`^[a-zA-Z0-9_\-\.@]+$`)
-
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			userID := r.Header.Get("X-User-ID")
+			p, status, msg := authenticate(r, cfg, bearerToken(r))
+			if p == nil {
+				http.Error(w, fmt.Sprintf(`{"error":%q}`, msg), status)
+				return
+			}
+
+			userID := p.UserID
 			if userID == "" {
-				if cfg.RequireAuth {
-					http.Error(w, `{"error":"authentication required"}`, http.StatusUnauthorized)
+				userID = r.Header.Get("X-User-ID")
+				switch {
+				case p.Kind == domain.PrincipalService && !p.HasScope(domain.ScopeActAsUser):
+					http.Error(w, `{"error":"token may not act as a user"}`, http.StatusForbidden)
+					return
+				case userID == "" && p.Kind == domain.PrincipalService:
+					http.Error(w, `{"error":"X-User-ID is required"}`, http.StatusBadRequest)
+					return
+				case userID == "":
+					userID = "default_user"
+				}
+				if !services.ValidUserID.MatchString(userID) {
+					http.Error(w, `{"error":"invalid user ID format"}`, http.StatusBadRequest)
 					return
 				}
-				userID = "default_user"
-			}
-
-			if !validUserID.MatchString(userID) {
-				http.Error(w, `{"error":"invalid user ID format"}`, http.StatusBadRequest)
-				return
 			}
 
 			ctx := handlers.SetUserIDInContext(r.Context(), userID)
+			ctx = handlers.SetPrincipalInContext(ctx, p)
 			ctx = otel.WithUserID(ctx, userID)
 			next.ServeHTTP(w, r.WithContext(ctx))
 		})
 	}
 }
 
+// authenticate resolves a request's token to a principal, or returns the
+// status and message to reject it with. No token is the anonymous principal
+// until auth is required or the first account is created.
+func authenticate(r *http.Request, cfg AuthConfig, token string) (*domain.Principal, int, string) {
+	if token == "" {
+		if cfg.RequireAuth {
+			return nil, http.StatusUnauthorized, "authentication required"
+		}
+		accounts, err := cfg.Auth.AccountsExist(r.Context())
+		if err != nil {
+			slog.Error("authentication failed", "error", err)
+			return nil, http.StatusInternalServerError, "internal server error"
+		}
+		if accounts {
+			return nil, http.StatusUnauthorized, "authentication required"
+		}
+		return &domain.Principal{Kind: domain.PrincipalAnonymous}, 0, ""
+	}
+	p, err := cfg.Auth.Authenticate(r.Context(), token)
+	if errors.Is(err, domain.ErrInvalidCredentials) {
+		return nil, http.StatusUnauthorized, "invalid or expired credentials"
+	}
+	if err != nil {
+		slog.Error("authentication failed", "error", err)
+		return nil, http.StatusInternalServerError, "internal server error"
+	}
+	return p, 0, ""
+}
+
+func bearerToken(r *http.Request) string {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return ""
+	}
+	return strings.TrimSpace(token)
+}
+
 func Logger(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
@@ -70,6 +127,12 @@ func (w *statusWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
 	return nil, nil, http.ErrNotSupported
 }
 
+func (w *statusWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
 func Recovery(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		defer func() {
@@ -103,7 +166,8 @@ func CORS(allowedOrigins []string) func(http.Handler) http.Handler {
 			if origin != "" && isAllowed(origin) {
 				w.Header().Set("Access-Control-Allow-Origin", origin)
 				w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
-				w.Header().Set("Access-Control-Allow-Headers", "Content-Type, X-User-ID")
+				w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type, X-User-ID, "+handlers.OpenAIConversationHeader)
+				w.Header().Set("Access-Control-Expose-Headers", handlers.OpenAIConversationHeader)
 				w.Header().Set("Access-Control-Allow-Credentials", "true")
 			}
 
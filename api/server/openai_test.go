@@ -0,0 +1,431 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/longregen/alicia/api/domain"
+	"github.com/longregen/alicia/api/protocol"
+	"github.com/longregen/alicia/api/server/handlers"
+)
+
+// memJobQueue hands enqueued jobs straight to a stub agent.
+type memJobQueue struct {
+	enqueued chan *domain.GenerationJob
+}
+
+func (q *memJobQueue) EnqueueJob(ctx context.Context, j *domain.GenerationJob) error {
+	q.enqueued <- j
+	return nil
+}
+
+func (q *memJobQueue) ClaimJob(context.Context, string, time.Time) (*domain.GenerationJob, error) {
+	return nil, nil
+}
+func (q *memJobQueue) StartJob(context.Context, string, string) error { return nil }
+func (q *memJobQueue) HeartbeatJobs(context.Context, string, []string, time.Time) error {
+	return nil
+}
+func (q *memJobQueue) FinishJob(context.Context, string, string, string, string) error { return nil }
+func (q *memJobQueue) ReleaseWorkerJobs(context.Context, string, string) ([]*domain.GenerationJob, error) {
+	return nil, nil
+}
+func (q *memJobQueue) ReleaseExpiredJobs(context.Context, time.Time) ([]*domain.GenerationJob, error) {
+	return nil, nil
+}
+func (q *memJobQueue) CancelQueuedJobs(context.Context, string, string) ([]*domain.GenerationJob, error) {
+	return nil, nil
+}
+
+// memChats keeps conversations and messages for the handler.
+type memChats struct {
+	mu       sync.Mutex
+	convs    map[string]*domain.Conversation
+	messages map[string]*domain.Message
+	nextID   int
+}
+
+func (c *memChats) id(prefix string) string {
+	c.nextID++
+	return fmt.Sprintf("%s_%d", prefix, c.nextID)
+}
+
+func (c *memChats) Create(ctx context.Context, userID, title string) (*domain.Conversation, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	conv := &domain.Conversation{ID: c.id("conv"), UserID: userID, Title: title}
+	c.convs[conv.ID] = conv
+	return conv, nil
+}
+
+func (c *memChats) GetByUser(ctx context.Context, id, userID string) (*domain.Conversation, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	conv, ok := c.convs[id]
+	if !ok || conv.UserID != userID {
+		return nil, domain.ErrNotFound
+	}
+	copied := *conv
+	return &copied, nil
+}
+
+func (c *memChats) Delete(ctx context.Context, id string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.convs, id)
+	return nil
+}
+
+func (c *memChats) count() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.convs)
+}
+
+func (c *memChats) create(convID, role, content string, previousID *string) *domain.Message {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	msg := &domain.Message{
+		ID:             c.id("msg"),
+		ConversationID: convID,
+		PreviousID:     previousID,
+		Role:           role,
+		Content:        content,
+		CreatedAt:      time.Now().UTC(),
+	}
+	c.messages[msg.ID] = msg
+	c.convs[convID].TipMessageID = &msg.ID
+	return msg
+}
+
+func (c *memChats) CreateUserMessage(ctx context.Context, convID, content string, previousID *string) (*domain.Message, error) {
+	return c.create(convID, domain.RoleUser, content, previousID), nil
+}
+
+func (c *memChats) CreateAssistantMessage(ctx context.Context, convID, content, reasoning string, previousID *string) (*domain.Message, error) {
+	return c.create(convID, domain.RoleAssistant, content, previousID), nil
+}
+
+func (c *memChats) message(id string) *domain.Message {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.messages[id]
+}
+
+// chain returns the roles and contents from the first message to id.
+func (c *memChats) chain(id string) []string {
+	var out []string
+	for msg := c.message(id); msg != nil; {
+		out = append([]string{msg.Role + ": " + msg.Content}, out...)
+		if msg.PreviousID == nil {
+			break
+		}
+		msg = c.message(*msg.PreviousID)
+	}
+	return out
+}
+
+// runStubAgent answers each queued generation the way the agent does over the
+// WebSocket: it reports a tool use and then the assistant message, echoing the
+// user, streaming the answer word by word first if asked to. A user message
+// saying "fail" makes the generation fail.
+func runStubAgent(hub *Hub, q *memJobQueue, chats *memChats) {
+	for job := range q.enqueued {
+		env, err := protocol.DecodeEnvelope(job.Envelope)
+		if err != nil {
+			panic(err)
+		}
+		req, err := protocol.DecodeBody[protocol.GenerationRequest](env)
+		if err != nil {
+			panic(err)
+		}
+		user := chats.message(req.MessageID)
+		if user.Content == "fail" {
+			hub.notifySyncWaiterError(req.ConversationID, req.MessageID, "model unavailable")
+			continue
+		}
+
+		assistantID := "am_" + req.MessageID
+		content := "echo: " + user.Content
+		if req.EnableStreaming {
+			// A delta from another answer in the conversation.
+			hub.BroadcastEnvelope(req.ConversationID, protocol.TypeAssistantDelta, protocol.AssistantDelta{
+				MessageID: "am_other", ConversationID: req.ConversationID, Delta: "noise",
+			})
+			hub.BroadcastEnvelope(req.ConversationID, protocol.TypeStartAnswer, protocol.StartAnswer{
+				MessageID: assistantID, ConversationID: req.ConversationID, PreviousID: req.MessageID,
+			})
+			for i, word := range strings.SplitAfter(content, " ") {
+				hub.BroadcastEnvelope(req.ConversationID, protocol.TypeAssistantDelta, protocol.AssistantDelta{
+					MessageID: assistantID, ConversationID: req.ConversationID, Sequence: i, Delta: word,
+				})
+			}
+		}
+		hub.NotifySyncWaiterToolUse(req.ConversationID, &protocol.ToolUseRequest{
+			ID:             "tu_" + req.MessageID,
+			MessageID:      assistantID,
+			ConversationID: req.ConversationID,
+			ToolName:       "memory_search",
+			Arguments:      map[string]any{"query": user.Content},
+		})
+		hub.NotifySyncWaiter(req.ConversationID, &protocol.AssistantMessage{
+			ID:             assistantID,
+			ConversationID: req.ConversationID,
+			PreviousID:     req.MessageID,
+			Content:        content,
+		})
+	}
+}
+
+func newOpenAITestServer(t *testing.T) (*httptest.Server, *memChats) {
+	t.Helper()
+	q := &memJobQueue{enqueued: make(chan *domain.GenerationJob, 8)}
+	chats := &memChats{convs: make(map[string]*domain.Conversation), messages: make(map[string]*domain.Message)}
+	hub := NewHub(q)
+	go runStubAgent(hub, q, chats)
+	t.Cleanup(func() { close(q.enqueued) })
+
+	h := handlers.NewOpenAIHandler(chats, chats, hub)
+	router := chi.NewRouter()
+	router.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, r.WithContext(handlers.SetUserIDInContext(r.Context(), "usr_test")))
+		})
+	})
+	router.Post("/v1/chat/completions", h.ChatCompletions)
+	srv := httptest.NewServer(router)
+	t.Cleanup(srv.Close)
+	return srv, chats
+}
+
+func postCompletion(t *testing.T, srv *httptest.Server, convID, body string) *http.Response {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodPost, srv.URL+"/v1/chat/completions", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if convID != "" {
+		req.Header.Set(handlers.OpenAIConversationHeader, convID)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+type testCompletion struct {
+	ID      string `json:"id"`
+	Object  string `json:"object"`
+	Model   string `json:"model"`
+	Choices []struct {
+		Message      *struct{ Role, Content string } `json:"message"`
+		Delta        *struct{ Role, Content string } `json:"delta"`
+		FinishReason *string                         `json:"finish_reason"`
+	} `json:"choices"`
+	Metadata *struct {
+		ConversationID string `json:"conversation_id"`
+		MessageID      string `json:"message_id"`
+		ToolCalls      []struct {
+			ID       string `json:"id"`
+			Type     string `json:"type"`
+			Function struct {
+				Name      string `json:"name"`
+				Arguments string `json:"arguments"`
+			} `json:"function"`
+		} `json:"tool_calls"`
+	} `json:"metadata"`
+	Error *struct{ Message, Type string } `json:"error"`
+}
+
+func TestChatCompletions(t *testing.T) {
+	srv, chats := newOpenAITestServer(t)
+
+	resp := postCompletion(t, srv, "", `{
+		"model": "gpt-4o",
+		"messages": [
+			{"role": "system", "content": "You are helpful."},
+			{"role": "user", "content": "hi"},
+			{"role": "assistant", "content": "hello"},
+			{"role": "user", "content": [{"type": "text", "text": "what did I say?"}]}
+		]
+	}`)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d, want 200", resp.StatusCode)
+	}
+	convID := resp.Header.Get(handlers.OpenAIConversationHeader)
+	if convID == "" {
+		t.Fatal("response has no conversation header")
+	}
+
+	var c testCompletion
+	if err := json.NewDecoder(resp.Body).Decode(&c); err != nil {
+		t.Fatal(err)
+	}
+	if c.Object != "chat.completion" || c.Model != "gpt-4o" || len(c.Choices) != 1 {
+		t.Fatalf("unexpected completion: %+v", c)
+	}
+	if got := c.Choices[0].Message; got == nil || got.Role != "assistant" || got.Content != "echo: what did I say?" {
+		t.Errorf("message = %+v", got)
+	}
+	if c.Choices[0].FinishReason == nil || *c.Choices[0].FinishReason != "stop" {
+		t.Errorf("finish_reason = %v, want stop", c.Choices[0].FinishReason)
+	}
+	if c.Metadata == nil || c.Metadata.ConversationID != convID || len(c.Metadata.ToolCalls) != 1 {
+		t.Fatalf("metadata = %+v", c.Metadata)
+	}
+	call := c.Metadata.ToolCalls[0]
+	if call.Type != "function" || call.Function.Name != "memory_search" || call.Function.Arguments != `{"query":"what did I say?"}` {
+		t.Errorf("tool call = %+v", call)
+	}
+
+	// The history was stored in order, without the system message.
+	userMsgID := strings.TrimPrefix(c.Metadata.MessageID, "am_")
+	want := []string{"user: hi", "assistant: hello", "user: what did I say?"}
+	if got := chats.chain(userMsgID); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("stored chain = %q, want %q", got, want)
+	}
+
+	t.Run("continue conversation", func(t *testing.T) {
+		resp := postCompletion(t, srv, convID, `{"messages": [
+			{"role": "user", "content": "ignored, already stored"},
+			{"role": "user", "content": "and now?"}
+		]}`)
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("status = %d, want 200", resp.StatusCode)
+		}
+		var c testCompletion
+		if err := json.NewDecoder(resp.Body).Decode(&c); err != nil {
+			t.Fatal(err)
+		}
+		if c.Model != "alicia" || c.Choices[0].Message.Content != "echo: and now?" {
+			t.Errorf("completion = %+v", c)
+		}
+		// Only the new message is appended, after the conversation's tip.
+		got := chats.chain(strings.TrimPrefix(c.Metadata.MessageID, "am_"))
+		want := []string{"user: hi", "assistant: hello", "user: what did I say?", "user: and now?"}
+		if fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Errorf("stored chain = %q, want %q", got, want)
+		}
+	})
+
+	t.Run("unseeded conversation is deleted", func(t *testing.T) {
+		before := chats.count()
+		resp := postCompletion(t, srv, "", `{"messages": [
+			{"role": "user", "content": 42},
+			{"role": "user", "content": "hi"}
+		]}`)
+		if resp.StatusCode != http.StatusInternalServerError {
+			t.Fatalf("status = %d, want 500", resp.StatusCode)
+		}
+		if n := chats.count(); n != before {
+			t.Errorf("%d conversations after a failed seed, want %d", n, before)
+		}
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		tests := []struct {
+			name   string
+			convID string
+			body   string
+			status int
+		}{
+			{"bad json", "", `{`, http.StatusBadRequest},
+			{"no messages", "", `{"messages": []}`, http.StatusBadRequest},
+			{"last not user", "", `{"messages": [{"role": "assistant", "content": "hi"}]}`, http.StatusBadRequest},
+			{"unknown conversation", "conv_missing", `{"messages": [{"role": "user", "content": "hi"}]}`, http.StatusNotFound},
+			{"generation fails", "", `{"messages": [{"role": "user", "content": "fail"}]}`, http.StatusGatewayTimeout},
+		}
+		for _, tt := range tests {
+			resp := postCompletion(t, srv, tt.convID, tt.body)
+			if resp.StatusCode != tt.status {
+				t.Errorf("%s: status = %d, want %d", tt.name, resp.StatusCode, tt.status)
+				continue
+			}
+			var c testCompletion
+			if err := json.NewDecoder(resp.Body).Decode(&c); err != nil || c.Error == nil || c.Error.Message == "" {
+				t.Errorf("%s: no OpenAI-style error in response (%v)", tt.name, err)
+			} else if strings.Contains(c.Error.Message, "model unavailable") {
+				t.Errorf("%s: error %q leaks the agent's error", tt.name, c.Error.Message)
+			}
+		}
+	})
+}
+
+func TestChatCompletionsStream(t *testing.T) {
+	srv, _ := newOpenAITestServer(t)
+
+	resp := postCompletion(t, srv, "", `{"stream": true, "messages": [{"role": "user", "content": "stream me"}]}`)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d, want 200", resp.StatusCode)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("content type = %q", ct)
+	}
+
+	var chunks []testCompletion
+	done := false
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data: ")
+		if !ok {
+			continue
+		}
+		if data == "[DONE]" {
+			done = true
+			break
+		}
+		var c testCompletion
+		if err := json.Unmarshal([]byte(data), &c); err != nil {
+			t.Fatalf("bad chunk %q: %v", data, err)
+		}
+		chunks = append(chunks, c)
+	}
+	if !done {
+		t.Fatal("stream did not end with [DONE]")
+	}
+	if len(chunks) < 3 {
+		t.Fatalf("got %d chunks, want a role chunk, content and a final chunk", len(chunks))
+	}
+	for _, c := range chunks {
+		if c.Object != "chat.completion.chunk" || c.ID != chunks[0].ID {
+			t.Errorf("chunk object %q id %q, want chat.completion.chunk %q", c.Object, c.ID, chunks[0].ID)
+		}
+	}
+	if chunks[0].Choices[0].Delta.Role != "assistant" {
+		t.Errorf("first chunk delta = %+v, want the assistant role", chunks[0].Choices[0].Delta)
+	}
+
+	// The answer arrives as the agent streams it, without other answers'
+	// deltas, and adds up to the final message.
+	var content []string
+	for _, c := range chunks[1 : len(chunks)-1] {
+		content = append(content, c.Choices[0].Delta.Content)
+	}
+	if got := strings.Join(content, ""); got != "echo: stream me" {
+		t.Errorf("streamed content = %q in %d chunks, want %q", got, len(content), "echo: stream me")
+	}
+	if len(content) != 3 {
+		t.Errorf("content came in %d chunks %q, want one per delta", len(content), content)
+	}
+
+	last := chunks[len(chunks)-1]
+	if last.Choices[0].FinishReason == nil || *last.Choices[0].FinishReason != "stop" {
+		t.Errorf("last chunk finish_reason = %v, want stop", last.Choices[0].FinishReason)
+	}
+	if last.Metadata == nil || len(last.Metadata.ToolCalls) != 1 || last.Metadata.ConversationID != resp.Header.Get(handlers.OpenAIConversationHeader) {
+		t.Errorf("last chunk metadata = %+v", last.Metadata)
+	}
+}
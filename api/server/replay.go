@@ -0,0 +1,264 @@
+package server
+
+import (
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/longregen/alicia/api/protocol"
+)
+
+const (
+	// replayBufferSize is how many events per conversation are kept for
+	// clients that reconnect. Answer deltas aren't kept, so this is counted
+	// in sentences, messages and tool events rather than tokens.
+	replayBufferSize = 512
+	// maxEventLogs is how many conversations keep a replay buffer; the least
+	// recently active ones are dropped first.
+	maxEventLogs = 1000
+)
+
+type loggedEvent struct {
+	seq  uint64
+	data []byte
+}
+
+type outgoingEvent struct {
+	env  *protocol.Envelope
+	data []byte
+}
+
+// eventLog numbers a conversation's events and keeps the latest ones for
+// replay. Sequence numbers follow the clock in microseconds while increasing
+// by at least one per event, so a log created after a restart or an eviction
+// starts above every number the old one handed out, and a client holding one
+// of those is told to resync rather than replayed the wrong events.
+type eventLog struct {
+	mu     sync.Mutex
+	seq    uint64        // last number handed out
+	floor  uint64        // events after floor are all in events
+	events []loggedEvent // ring buffer, grown up to replayBufferSize
+	start  int           // index of the oldest event
+	// outbox holds events waiting to go out to subscribers. Whoever finds
+	// sending unset sends them, in order and without holding mu.
+	outbox  []outgoingEvent
+	sending bool
+
+	lastUsed time.Time // guarded by Hub.eventLogsMu
+}
+
+func newEventLog(now time.Time) *eventLog {
+	seq := uint64(now.UnixMicro())
+	return &eventLog{seq: seq, floor: seq}
+}
+
+func (l *eventLog) next(now time.Time) uint64 {
+	l.seq = max(l.seq+1, uint64(now.UnixMicro()))
+	return l.seq
+}
+
+func (l *eventLog) append(seq uint64, data []byte) {
+	e := loggedEvent{seq: seq, data: data}
+	if len(l.events) < replayBufferSize {
+		l.events = append(l.events, e)
+		return
+	}
+	l.floor = l.events[l.start].seq
+	l.events[l.start] = e
+	l.start = (l.start + 1) % len(l.events)
+}
+
+// at returns the i-th oldest buffered event.
+func (l *eventLog) at(i int) loggedEvent {
+	return l.events[(l.start+i)%len(l.events)]
+}
+
+// since returns the events after lastSeq. resync is set when some of them are
+// no longer buffered, or lastSeq didn't come from this log.
+func (l *eventLog) since(lastSeq uint64) (events []loggedEvent, resync bool) {
+	if lastSeq < l.floor || lastSeq > l.seq {
+		return nil, true
+	}
+	i := sort.Search(len(l.events), func(i int) bool { return l.at(i).seq > lastSeq })
+	for ; i < len(l.events); i++ {
+		events = append(events, l.at(i))
+	}
+	return events, false
+}
+
+// eventLog returns the conversation's log, creating it if needed.
+func (h *Hub) eventLog(convID string) *eventLog {
+	h.eventLogsMu.Lock()
+	defer h.eventLogsMu.Unlock()
+
+	now := time.Now()
+	l, ok := h.eventLogs[convID]
+	if !ok {
+		if len(h.eventLogs) >= maxEventLogs {
+			h.evictEventLog()
+		}
+		l = newEventLog(now)
+		h.eventLogs[convID] = l
+	}
+	l.lastUsed = now
+	return l
+}
+
+func (h *Hub) evictEventLog() {
+	var oldestID string
+	var oldest time.Time
+	for id, l := range h.eventLogs {
+		if oldestID == "" || l.lastUsed.Before(oldest) {
+			oldestID, oldest = id, l.lastUsed
+		}
+	}
+	delete(h.eventLogs, oldestID)
+}
+
+// publish numbers an event, keeps it for replay and sends it to the
+// conversation's subscribers in the order it was numbered. Answer deltas go
+// out unnumbered and aren't kept: the sentences and the final message that
+// follow carry the same text.
+func (h *Hub) publish(convID string, env *protocol.Envelope) {
+	l := h.eventLog(convID)
+	l.mu.Lock()
+	if env.Type != protocol.TypeAssistantDelta {
+		env.Seq = l.next(time.Now())
+	}
+	data, err := env.Encode()
+	if err != nil {
+		l.mu.Unlock()
+		slog.Error("ws: encode envelope error", "error", err, "conversation_id", convID)
+		return
+	}
+	if env.Seq != 0 {
+		l.append(env.Seq, data)
+	}
+	l.outbox = append(l.outbox, outgoingEvent{env: env, data: data})
+	if l.sending {
+		l.mu.Unlock()
+		return
+	}
+
+	l.sending = true
+	for len(l.outbox) > 0 {
+		batch := l.outbox
+		l.outbox = nil
+		l.mu.Unlock()
+		for _, e := range batch {
+			h.sendToConversation(convID, e.data)
+			h.notifyListeners(convID, e.env)
+		}
+		l.mu.Lock()
+	}
+	l.sending = false
+	l.mu.Unlock()
+}
+
+// Subscribe adds conn to a conversation's subscribers and returns the
+// conversation's latest sequence number. With a lastSeq, the events after it
+// are sent first; resync reports that they are no longer buffered and the
+// client should reload the conversation instead.
+func (h *Hub) Subscribe(convID string, conn *websocket.Conn, lastSeq *uint64) (seq uint64, resync bool) {
+	l := h.eventLog(convID)
+	l.mu.Lock()
+	if lastSeq == nil {
+		h.addConvSub(convID, conn)
+		seq = l.seq
+		l.mu.Unlock()
+		return seq, false
+	}
+
+	// Replay without holding the log, then catch up on whatever was
+	// published meanwhile. conn joins the subscribers once nothing is left,
+	// so the events it gets live all come after the replayed ones.
+	last, replayed := *lastSeq, 0
+	for {
+		events, gap := l.since(last)
+		if gap || len(events) == 0 {
+			h.addConvSub(convID, conn)
+			seq = l.seq
+			l.mu.Unlock()
+			if gap {
+				slog.Info("ws: replay gap, client must resync", "conversation_id", convID, "last_seq", *lastSeq)
+			} else if replayed > 0 {
+				slog.Info("ws: replayed events", "conversation_id", convID, "count", replayed)
+			}
+			return seq, gap
+		}
+		l.mu.Unlock()
+
+		for _, e := range events {
+			if err := h.writeMessage(conn, websocket.BinaryMessage, e.data); err != nil {
+				slog.Warn("ws: replay error", "error", err, "conversation_id", convID)
+				return e.seq, false
+			}
+		}
+		last = events[len(events)-1].seq
+		replayed += len(events)
+		l.mu.Lock()
+	}
+}
+
+func (h *Hub) addConvSub(convID string, conn *websocket.Conn) {
+	h.convMu.Lock()
+	if h.convSubs[convID] == nil {
+		h.convSubs[convID] = make(map[*websocket.Conn]struct{})
+	}
+	h.convSubs[convID][conn] = struct{}{}
+	total := len(h.convSubs[convID])
+	h.convMu.Unlock()
+	slog.Info("ws: subscribed", "conversation_id", convID, "total", total)
+}
+
+// listenBuffer is how many events a listener may fall behind by before it is
+// dropped.
+const listenBuffer = 256
+
+// Listen follows a conversation's events, deltas included, in the order
+// subscribers get them. A listener that falls too far behind has its channel
+// closed; stop must be called once it's no longer read.
+func (h *Hub) Listen(convID string) (events <-chan *protocol.Envelope, stop func()) {
+	ch := make(chan *protocol.Envelope, listenBuffer)
+	h.listenersMu.Lock()
+	if h.listeners[convID] == nil {
+		h.listeners[convID] = make(map[chan *protocol.Envelope]struct{})
+	}
+	h.listeners[convID][ch] = struct{}{}
+	h.listenersMu.Unlock()
+
+	return ch, func() {
+		h.listenersMu.Lock()
+		defer h.listenersMu.Unlock()
+		h.removeListener(convID, ch)
+	}
+}
+
+func (h *Hub) notifyListeners(convID string, env *protocol.Envelope) {
+	h.listenersMu.Lock()
+	defer h.listenersMu.Unlock()
+	for ch := range h.listeners[convID] {
+		select {
+		case ch <- env:
+		default:
+			slog.Warn("ws: listener fell behind, dropping it", "conversation_id", convID)
+			h.removeListener(convID, ch)
+		}
+	}
+}
+
+// removeListener closes a listener's channel unless that was done already.
+// The caller holds listenersMu.
+func (h *Hub) removeListener(convID string, ch chan *protocol.Envelope) {
+	if _, ok := h.listeners[convID][ch]; !ok {
+		return
+	}
+	delete(h.listeners[convID], ch)
+	if len(h.listeners[convID]) == 0 {
+		delete(h.listeners, convID)
+	}
+	close(ch)
+}
@@ -0,0 +1,111 @@
+package server
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/longregen/alicia/api/protocol"
+)
+
+func TestEventLog(t *testing.T) {
+	start := time.Now()
+	l := newEventLog(start)
+	base := l.seq
+
+	// Nothing has happened since the client last saw the log's number.
+	events, resync := l.since(base)
+	if resync || len(events) != 0 {
+		t.Fatalf("since(base) = %d events, resync %v; want none", len(events), resync)
+	}
+
+	// Several events in the same microsecond still get increasing numbers.
+	var seqs []uint64
+	for i := 0; i < 3; i++ {
+		seq := l.next(start)
+		l.append(seq, []byte(fmt.Sprint(i)))
+		seqs = append(seqs, seq)
+	}
+	if seqs[0] != base+1 || seqs[1] != base+2 || seqs[2] != base+3 {
+		t.Fatalf("seqs = %v, want %d..%d", seqs, base+1, base+3)
+	}
+
+	// After a pause the numbers jump ahead with the clock.
+	later := l.next(start.Add(time.Second))
+	if later != uint64(start.Add(time.Second).UnixMicro()) {
+		t.Errorf("seq after a second = %d, want %d", later, start.Add(time.Second).UnixMicro())
+	}
+	l.append(later, []byte("3"))
+
+	events, resync = l.since(seqs[0])
+	if resync {
+		t.Fatal("since(first) asked for resync")
+	}
+	if len(events) != 3 || string(events[0].data) != "1" || string(events[2].data) != "3" {
+		t.Errorf("since(first) = %+v, want [1 2 3]", events)
+	}
+
+	// A number the log never handed out, e.g. from before a restart.
+	if _, resync := l.since(base - 1); !resync {
+		t.Error("since(before base) should ask for resync")
+	}
+	if _, resync := l.since(later + 1); !resync {
+		t.Error("since(future) should ask for resync")
+	}
+
+	// Once events fall out of the buffer, clients that missed them resync.
+	for i := 0; i < replayBufferSize; i++ {
+		seq := l.next(start)
+		l.append(seq, nil)
+	}
+	if len(l.events) != replayBufferSize {
+		t.Fatalf("buffer holds %d events, want %d", len(l.events), replayBufferSize)
+	}
+	if _, resync := l.since(seqs[0]); !resync {
+		t.Error("since(dropped event) should ask for resync")
+	}
+	events, resync = l.since(l.floor)
+	if resync || len(events) != replayBufferSize {
+		t.Errorf("since(floor) = %d events, resync %v; want %d", len(events), resync, replayBufferSize)
+	}
+	for i := 1; i < len(events); i++ {
+		if events[i].seq <= events[i-1].seq {
+			t.Fatalf("events out of order at %d: %d after %d", i, events[i].seq, events[i-1].seq)
+		}
+	}
+}
+
+func TestPublishSkipsDeltas(t *testing.T) {
+	h := NewHub(nil)
+	h.BroadcastEnvelope("conv", protocol.TypeAssistantSentence, protocol.AssistantSentence{ConversationID: "conv", Text: "Hi."})
+	l := h.eventLog("conv")
+	seq := l.seq
+
+	for i := 0; i < 2*replayBufferSize; i++ {
+		h.BroadcastEnvelope("conv", protocol.TypeAssistantDelta, protocol.AssistantDelta{ConversationID: "conv", Delta: "x"})
+	}
+	if l.seq != seq || len(l.events) != 1 {
+		t.Errorf("after deltas seq = %d with %d events, want %d with 1", l.seq, len(l.events), seq)
+	}
+	if _, resync := l.since(seq - 1); resync {
+		t.Error("deltas pushed the sentence out of the buffer")
+	}
+	if len(l.outbox) != 0 || l.sending {
+		t.Errorf("outbox holds %d events, sending %v; want it drained", len(l.outbox), l.sending)
+	}
+}
+
+func TestEventLogEviction(t *testing.T) {
+	h := NewHub(nil)
+	first := h.eventLog("conv_first")
+	first.lastUsed = time.Now().Add(-time.Hour)
+	for i := 0; i < maxEventLogs; i++ {
+		h.eventLog(fmt.Sprintf("conv_%d", i))
+	}
+	if len(h.eventLogs) != maxEventLogs {
+		t.Fatalf("%d logs kept, want %d", len(h.eventLogs), maxEventLogs)
+	}
+	if h.eventLog("conv_first") == first {
+		t.Error("least recently used log was not evicted")
+	}
+}
@@ -36,9 +36,10 @@ func NewServer(
 	mcpSvc *services.MCPService,
 	prefsSvc *services.PreferencesService,
 	noteSvc *services.NoteService,
+	authSvc *services.AuthService,
 	lkSvc *livekit.Service,
 ) *Server {
-	hub := NewHub()
+	hub := NewHub(s)
 	router := chi.NewRouter()
 
 	router.Use(otel.Middleware("alicia-api"))
@@ -60,11 +61,51 @@ func NewServer(
 	router.Get("/health/live", healthH.Liveness)
 	router.Get("/health/full", healthH.Health)
 
-	wsHandler := NewWSHandler(hub, cfg, s)
+	wsHandler := NewWSHandler(hub, cfg, s, authSvc)
 	router.Get("/api/v1/ws", wsHandler.ServeHTTP)
 
+	authCfg := AuthConfig{RequireAuth: cfg.Server.RequireAuth, Auth: authSvc}
+	authH := handlers.NewAuthHandler(authSvc, cfg.Server.RequireAuth)
+
+	// Logging in needs no credentials.
+	router.Route("/api/v1/auth", func(r chi.Router) {
+		r.Get("/config", authH.Config)
+		r.Post("/register", authH.Register)
+		r.Post("/login", authH.Login)
+		r.Post("/passkeys/login/begin", authH.BeginPasskeyLogin)
+		r.Post("/passkeys/login/finish", authH.FinishPasskeyLogin)
+
+		r.Group(func(r chi.Router) {
+			r.Use(AuthWithConfig(authCfg))
+			r.Get("/me", authH.Me)
+			r.Post("/logout", authH.Logout)
+			r.Put("/password", authH.ChangePassword)
+			r.Get("/sessions", authH.ListSessions)
+			r.Delete("/sessions/{id}", authH.RevokeSession)
+			r.Get("/api-keys", authH.ListAPIKeys)
+			r.Post("/api-keys", authH.CreateAPIKey)
+			r.Delete("/api-keys/{id}", authH.RevokeAPIKey)
+			r.Get("/passkeys", authH.ListPasskeys)
+			r.Post("/passkeys/register/begin", authH.BeginPasskeyRegistration)
+			r.Post("/passkeys/register/finish", authH.FinishPasskeyRegistration)
+			r.Delete("/passkeys/{id}", authH.DeletePasskey)
+			r.Get("/service-tokens", authH.ListServiceTokens)
+			r.Post("/service-tokens", authH.CreateServiceToken)
+			r.Delete("/service-tokens/{id}", authH.RevokeServiceToken)
+		})
+	})
+
+	// OpenAI-compatible API, for tools that only speak it
+	router.Route("/v1", func(r chi.Router) {
+		r.Use(AuthWithConfig(authCfg))
+
+		openAIH := handlers.NewOpenAIHandler(convSvc, msgSvc, hub)
+		r.Get("/models", openAIH.Models)
+		r.Post("/chat/completions", openAIH.ChatCompletions)
+	})
+
 	router.Route("/api/v1", func(r chi.Router) {
-		r.Use(AuthWithConfig(AuthConfig{RequireAuth: cfg.Server.RequireAuth}))
+		r.Use(AuthWithConfig(authCfg))
 
 		convH := handlers.NewConversationHandler(convSvc)
 		r.Post("/conversations", convH.Create)
@@ -76,6 +117,7 @@ func NewServer(
 		msgH := handlers.NewMessageHandler(msgSvc, convSvc, hub)
 		r.Get("/conversations/{id}/messages", msgH.List)
 		r.Post("/conversations/{id}/messages", msgH.Create)
+		r.Post("/conversations/{id}/cancel", msgH.Cancel)
 		r.Get("/messages/{id}", msgH.Get)
 		r.Get("/messages/{id}/siblings", msgH.GetSiblings)
 
@@ -83,6 +125,7 @@ func NewServer(
 		r.Get("/tools", toolH.ListTools)
 		r.Get("/tool-uses", toolH.ListToolUses)
 		r.Get("/tool-uses/{id}", toolH.GetToolUse)
+		r.Get("/tool-uses/{id}/attachments/{attachmentId}", toolH.GetToolUseAttachment)
 		r.Get("/messages/{id}/tool-uses", toolH.GetToolUsesByMessage)
 
 		feedbackH := handlers.NewFeedbackHandlerWithLangfuse(s, lfClient)
@@ -97,10 +140,14 @@ func NewServer(
 		r.Get("/memories", memH.List)
 		r.Post("/memories", memH.Create)
 		r.Post("/memories/search", memH.Search)
+		r.Get("/memories/export", memH.Export)
+		r.Post("/memories/import", memH.Import)
 		r.Get("/memories/by-tags", memH.GetByTags)
 		r.Get("/memories/{id}", memH.Get)
 		r.Put("/memories/{id}", memH.Update)
 		r.Delete("/memories/{id}", memH.Delete)
+		r.Get("/memories/{id}/versions", memH.Versions)
+		r.Get("/memories/{id}/provenance", memH.Provenance)
 		r.Post("/memories/{id}/pin", memH.Pin)
 		r.Post("/memories/{id}/archive", memH.Archive)
 		r.Post("/memories/{id}/tags", memH.AddTag)
@@ -110,16 +157,19 @@ func NewServer(
 		noteH := handlers.NewNoteHandler(noteSvc)
 		r.Post("/notes", noteH.Create)
 		r.Get("/notes", noteH.List)
+		r.Get("/notes/export", noteH.Export)
+		r.Post("/notes/import", noteH.Import)
 		r.Get("/notes/{id}", noteH.Get)
 		r.Put("/notes/{id}", noteH.Update)
 		r.Delete("/notes/{id}", noteH.Delete)
 
-		mcpH := handlers.NewMCPHandler(mcpSvc)
+		mcpH := handlers.NewMCPHandler(mcpSvc, hub)
 		r.Get("/mcp/servers", mcpH.List)
 		r.Post("/mcp/servers", mcpH.Create)
 		r.Get("/mcp/servers/{name}", mcpH.Get)
 		r.Put("/mcp/servers/{name}", mcpH.Update)
 		r.Delete("/mcp/servers/{name}", mcpH.Delete)
+		r.Get("/mcp/tools", mcpH.Tools)
 
 		prefsH := handlers.NewPreferencesHandler(prefsSvc, hub)
 		r.Get("/preferences", prefsH.Get)
@@ -2,9 +2,11 @@ package server
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
 	"net/http"
+	"sort"
 	"sync"
 	"time"
 
@@ -15,6 +17,7 @@ import (
 	"github.com/longregen/alicia/api/domain"
 	"github.com/longregen/alicia/api/protocol"
 	"github.com/longregen/alicia/api/server/handlers"
+	"github.com/longregen/alicia/api/services"
 	"github.com/longregen/alicia/api/store"
 	"github.com/longregen/alicia/pkg/otel"
 	"go.opentelemetry.io/otel/attribute"
@@ -35,8 +38,10 @@ type Hub struct {
 	convMu                 sync.RWMutex
 	clientConns            map[*websocket.Conn]struct{}
 	clientMu               sync.RWMutex
-	agentConn              *websocket.Conn
+	agents                 map[*websocket.Conn]*agentWorker
 	agentMu                sync.RWMutex
+	jobs                   JobQueue
+	jobWake                chan struct{}
 	voiceConn              *websocket.Conn
 	voiceMu                sync.RWMutex
 	whatsappConn           *websocket.Conn
@@ -47,12 +52,13 @@ type Hub struct {
 	lastAssistantHeartbeat time.Time
 	monitorConns           map[*websocket.Conn]struct{}
 	monitorMu              sync.RWMutex
+	eventLogs              map[string]*eventLog // replay buffers by conversation
+	eventLogsMu            sync.Mutex
+	listeners              map[string]map[chan *protocol.Envelope]struct{} // in-process followers by conversation
+	listenersMu            sync.Mutex
 	// Per-connection write mutex to serialize WebSocket writes (gorilla/websocket requires this)
 	connWriteMu   map[*websocket.Conn]*sync.Mutex
 	connWriteMuMu sync.Mutex
-	// Tracks active generations: convID → messageID (set on GenRequest, cleared on AssistantMsg)
-	activeGens   map[string]string
-	activeGensMu sync.Mutex
 	// Enables blocking request/response pattern over async WebSocket for the REST API's sync endpoint
 	syncWaiters      map[string]chan SyncResult
 	syncToolUses     map[string][]protocol.ToolUseRequest // tool uses accumulated by assistant message ID for sync responses
@@ -60,13 +66,17 @@ type Hub struct {
 	syncMu           sync.Mutex
 }
 
-func NewHub() *Hub {
+func NewHub(jobs JobQueue) *Hub {
 	return &Hub{
 		convSubs:         make(map[string]map[*websocket.Conn]struct{}),
 		clientConns:      make(map[*websocket.Conn]struct{}),
+		agents:           make(map[*websocket.Conn]*agentWorker),
+		jobs:             jobs,
+		jobWake:          make(chan struct{}, 1),
 		monitorConns:     make(map[*websocket.Conn]struct{}),
+		eventLogs:        make(map[string]*eventLog),
+		listeners:        make(map[string]map[chan *protocol.Envelope]struct{}),
 		connWriteMu:      make(map[*websocket.Conn]*sync.Mutex),
-		activeGens:       make(map[string]string),
 		syncWaiters:      make(map[string]chan SyncResult),
 		syncToolUses:     make(map[string][]protocol.ToolUseRequest),
 		syncToolUsesKeys: make(map[string][]string),
@@ -101,17 +111,6 @@ func (h *Hub) writeMessage(conn *websocket.Conn, msgType int, data []byte) error
 	return conn.WriteMessage(msgType, data)
 }
 
-func (h *Hub) Subscribe(convID string, conn *websocket.Conn) {
-	h.convMu.Lock()
-	defer h.convMu.Unlock()
-
-	if h.convSubs[convID] == nil {
-		h.convSubs[convID] = make(map[*websocket.Conn]struct{})
-	}
-	h.convSubs[convID][conn] = struct{}{}
-	slog.Info("ws: subscribed", "conversation_id", convID, "total", len(h.convSubs[convID]))
-}
-
 func (h *Hub) Unsubscribe(convID string, conn *websocket.Conn) {
 	h.convMu.Lock()
 	defer h.convMu.Unlock()
@@ -137,22 +136,6 @@ func (h *Hub) UnsubscribeAll(conn *websocket.Conn) {
 	}
 }
 
-func (h *Hub) SubscribeAgent(conn *websocket.Conn) {
-	h.agentMu.Lock()
-	defer h.agentMu.Unlock()
-	h.agentConn = conn
-	slog.Info("ws: agent connected")
-}
-
-func (h *Hub) UnsubscribeAgent(conn *websocket.Conn) {
-	h.agentMu.Lock()
-	defer h.agentMu.Unlock()
-	if h.agentConn == conn {
-		h.agentConn = nil
-		slog.Info("ws: agent disconnected")
-	}
-}
-
 func (h *Hub) SubscribeVoice(conn *websocket.Conn) {
 	h.voiceMu.Lock()
 	defer h.voiceMu.Unlock()
@@ -322,7 +305,18 @@ func (h *Hub) BroadcastToVoice(data []byte) {
 	}
 }
 
+// BroadcastToConversation sends an encoded envelope to the conversation's
+// subscribers, numbered and kept for replay like BroadcastEnvelope.
 func (h *Hub) BroadcastToConversation(convID string, data []byte) {
+	env, err := protocol.DecodeEnvelope(data)
+	if err != nil {
+		slog.Error("ws: decode envelope error", "error", err, "conversation_id", convID)
+		return
+	}
+	h.publish(convID, env)
+}
+
+func (h *Hub) sendToConversation(convID string, data []byte) {
 	h.broadcastToMonitors(data, "server", "client")
 
 	h.convMu.RLock()
@@ -356,23 +350,44 @@ func (h *Hub) broadcastAllClients(data []byte) {
 	}
 }
 
+// broadcastToAgentAs sends a client's frame on to the agent workers with body
+// in place of what the client sent.
+func (h *Hub) broadcastToAgentAs(env *protocol.Envelope, body any) {
+	env.Body = body
+	data, err := env.Encode()
+	if err != nil {
+		slog.Error("ws: encode envelope error", "error", err, "type", env.Type)
+		return
+	}
+	h.BroadcastToAgent(data)
+}
+
+// BroadcastToAgent sends data to every agent worker. Generation requests go
+// through the job queue instead, to one worker.
 func (h *Hub) BroadcastToAgent(data []byte) {
 	h.broadcastToMonitors(data, "server", "agent")
 
 	h.agentMu.RLock()
-	conn := h.agentConn
+	conns := make([]*websocket.Conn, 0, len(h.agents))
+	for conn := range h.agents {
+		conns = append(conns, conn)
+	}
 	h.agentMu.RUnlock()
 
-	if conn == nil {
+	if len(conns) == 0 {
 		slog.Warn("ws: no agent connected")
 		return
 	}
 
-	if err := h.writeMessage(conn, websocket.BinaryMessage, data); err != nil {
-		slog.Error("ws: agent send error", "error", err)
+	for _, conn := range conns {
+		if err := h.writeMessage(conn, websocket.BinaryMessage, data); err != nil {
+			slog.Error("ws: agent send error", "error", err)
+		}
 	}
 }
 
+// SendGenerationRequest queues a generation for the user message. It runs once
+// an agent worker is free, even if none is connected yet.
 func (h *Hub) SendGenerationRequest(ctx context.Context, convID, userMsgID string, previousID *string, usePareto bool) {
 	req := protocol.GenerationRequest{
 		ConversationID:  convID,
@@ -395,27 +410,41 @@ func (h *Hub) SendGenerationRequest(ctx context.Context, convID, userMsgID strin
 	env.SessionID = tc.SessionID
 	env.UserID = tc.UserID
 
+	if _, err := h.EnqueueGeneration(ctx, env, req); err != nil {
+		slog.Error("ws: queue generation request error", "error", err, "conversation_id", convID)
+		h.BroadcastEnvelope(convID, protocol.TypeGenerationComplete, &protocol.GenerationComplete{
+			ConversationID: convID,
+			Success:        false,
+			Error:          "failed to queue generation",
+		})
+	}
+}
+
+// SendGenerationCancel asks the agent to stop the generation for a message,
+// or every generation in the conversation when messageID is empty.
+func (h *Hub) SendGenerationCancel(ctx context.Context, convID, messageID string) {
+	env := protocol.NewEnvelope(convID, protocol.TypeGenerationCancel, protocol.GenerationCancel{
+		ConversationID: convID,
+		MessageID:      messageID,
+	})
+	tc := otel.InjectToTraceContext(ctx, convID, otel.UserIDFromContext(ctx))
+	env.TraceID = tc.TraceID
+	env.SpanID = tc.SpanID
+	env.TraceFlags = tc.TraceFlags
+	env.SessionID = tc.SessionID
+	env.UserID = tc.UserID
+
 	data, err := env.Encode()
 	if err != nil {
-		slog.Error("ws: encode generation request error", "error", err)
+		slog.Error("ws: encode generation cancel error", "error", err)
 		return
 	}
-
-	h.activeGensMu.Lock()
-	h.activeGens[convID] = userMsgID
-	h.activeGensMu.Unlock()
-
+	h.cancelQueuedJobs(ctx, convID, messageID)
 	h.BroadcastToAgent(data)
 }
 
 func (h *Hub) BroadcastEnvelope(convID string, msgType protocol.MessageType, body any) {
-	env := protocol.NewEnvelope(convID, msgType, body)
-	data, err := env.Encode()
-	if err != nil {
-		slog.Error("ws: encode envelope error", "error", err)
-		return
-	}
-	h.BroadcastToConversation(convID, data)
+	h.publish(convID, protocol.NewEnvelope(convID, msgType, body))
 }
 
 func (h *Hub) BroadcastPreferencesUpdate(prefs *domain.UserPreferences) {
@@ -438,6 +467,8 @@ func (h *Hub) BroadcastPreferencesUpdate(prefs *domain.UserPreferences) {
 		ParetoEnableCrossover:    prefs.ParetoEnableCrossover,
 		NotesSimilarityThreshold: prefs.NotesSimilarityThreshold,
 		NotesMaxCount:            prefs.NotesMaxCount,
+		SearchVectorWeight:       prefs.SearchVectorWeight,
+		SearchKeywordWeight:      prefs.SearchKeywordWeight,
 		ConfirmDeleteMemory:      prefs.ConfirmDeleteMemory,
 		ShowRelevanceScores:      prefs.ShowRelevanceScores,
 	}
@@ -454,7 +485,84 @@ func (h *Hub) BroadcastPreferencesUpdate(prefs *domain.UserPreferences) {
 	slog.Info("ws: broadcasted preferences update", "user_id", prefs.UserID)
 }
 
-func (h *Hub) SendGenerationRequestSync(ctx context.Context, convID, userMsgID string, previousID *string, usePareto bool) (*SyncResult, error) {
+// BroadcastMCPConfig sends the full set of enabled MCP servers to the agent,
+// which reconciles its running servers against it.
+func (h *Hub) BroadcastMCPConfig(servers []*domain.MCPServer) {
+	update := protocol.MCPConfigUpdate{Servers: make([]protocol.MCPServerConfig, 0, len(servers))}
+	for _, s := range servers {
+		cfg := protocol.MCPServerConfig{
+			Name:          s.Name,
+			TransportType: s.TransportType,
+			Command:       s.Command,
+			Args:          s.Args,
+			URL:           s.URL,
+			Headers:       s.Headers,
+			Limits:        toProtocolToolLimits(s.MCPToolLimits),
+			ToolLimits:    make(map[string]protocol.MCPToolLimits, len(s.ToolLimits)),
+		}
+		for tool, limits := range s.ToolLimits {
+			cfg.ToolLimits[tool] = toProtocolToolLimits(limits)
+		}
+		update.Servers = append(update.Servers, cfg)
+	}
+
+	env := protocol.NewEnvelope("", protocol.TypeMCPConfigUpdate, update)
+	data, err := env.Encode()
+	if err != nil {
+		slog.Error("ws: encode mcp config update error", "error", err)
+		return
+	}
+
+	h.BroadcastToAgent(data)
+	slog.Info("ws: broadcasted mcp config update", "server_count", len(servers))
+}
+
+func toProtocolToolLimits(l domain.MCPToolLimits) protocol.MCPToolLimits {
+	return protocol.MCPToolLimits{
+		TimeoutSeconds: l.TimeoutSeconds,
+		MaxResultBytes: l.MaxResultBytes,
+		ResultPolicy:   l.ResultPolicy,
+		ApprovalPolicy: l.ApprovalPolicy,
+	}
+}
+
+// SetMCPTools records the tool report of an agent worker.
+func (h *Hub) SetMCPTools(conn *websocket.Conn, servers []protocol.MCPServerTools) {
+	h.agentMu.Lock()
+	defer h.agentMu.Unlock()
+	if w, ok := h.agents[conn]; ok {
+		w.mcpTools = servers
+	}
+}
+
+// MCPTools returns the servers and tools the connected agents last reported as
+// running. A server counts as up if any agent runs it.
+func (h *Hub) MCPTools() []protocol.MCPServerTools {
+	h.agentMu.RLock()
+	defer h.agentMu.RUnlock()
+
+	merged := make(map[string]protocol.MCPServerTools)
+	for _, w := range h.agents {
+		for _, srv := range w.mcpTools {
+			cur, ok := merged[srv.Name]
+			if !ok || (cur.Status != domain.MCPStatusUp && srv.Status == domain.MCPStatusUp) {
+				merged[srv.Name] = srv
+			}
+		}
+	}
+	names := make([]string, 0, len(merged))
+	for name := range merged {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	servers := make([]protocol.MCPServerTools, 0, len(names))
+	for _, name := range names {
+		servers = append(servers, merged[name])
+	}
+	return servers
+}
+
+func (h *Hub) SendGenerationRequestSync(ctx context.Context, convID, userMsgID string, previousID *string, usePareto, streaming bool) (*SyncResult, error) {
 	// Register a waiter for this conversation
 	key := convID + ":" + userMsgID
 	ch := make(chan SyncResult, 1)
@@ -480,7 +588,7 @@ func (h *Hub) SendGenerationRequestSync(ctx context.Context, convID, userMsgID s
 		RequestType:     "send",
 		EnableTools:     true,
 		EnableReasoning: true,
-		EnableStreaming: false,
+		EnableStreaming: streaming,
 		UsePareto:       usePareto,
 	}
 	if previousID != nil {
@@ -495,13 +603,10 @@ func (h *Hub) SendGenerationRequestSync(ctx context.Context, convID, userMsgID s
 	env.SessionID = tc.SessionID
 	env.UserID = tc.UserID
 
-	data, err := env.Encode()
-	if err != nil {
-		return nil, fmt.Errorf("encode generation request: %w", err)
+	if _, err := h.EnqueueGeneration(ctx, env, req); err != nil {
+		return nil, fmt.Errorf("queue generation request: %w", err)
 	}
 
-	h.BroadcastToAgent(data)
-
 	// Wait for result or context cancellation
 	select {
 	case result := <-ch:
@@ -539,6 +644,22 @@ func (h *Hub) NotifySyncWaiter(convID string, msg *protocol.AssistantMessage) bo
 	}
 }
 
+// notifySyncWaiterError tells a sync waiter for the user message that its
+// generation failed.
+func (h *Hub) notifySyncWaiterError(convID, userMsgID, errMsg string) {
+	h.syncMu.Lock()
+	defer h.syncMu.Unlock()
+
+	ch, ok := h.syncWaiters[convID+":"+userMsgID]
+	if !ok {
+		return
+	}
+	select {
+	case ch <- SyncResult{Error: errMsg}:
+	default:
+	}
+}
+
 // NotifySyncWaiterToolUse records a tool use for sync waiters.
 // Tool uses are accumulated by assistant message ID until the AssistantMessage arrives,
 // then included in the SyncResult.
@@ -560,10 +681,23 @@ func (h *Hub) NotifySyncWaiterToolUse(convID string, tu *protocol.ToolUseRequest
 }
 
 func (h *Hub) WaitForGeneration(ctx context.Context, convID, userMsgID string, previousID *string, usePareto bool) (*handlers.SyncGenerationResult, error) {
-	result, err := h.SendGenerationRequestSync(ctx, convID, userMsgID, previousID, usePareto)
+	return h.waitForGeneration(ctx, convID, userMsgID, previousID, usePareto, false)
+}
+
+// StreamGeneration is WaitForGeneration with the answer also streamed to the
+// conversation as deltas, which Listen picks up.
+func (h *Hub) StreamGeneration(ctx context.Context, convID, userMsgID string, previousID *string) (*handlers.SyncGenerationResult, error) {
+	return h.waitForGeneration(ctx, convID, userMsgID, previousID, false, true)
+}
+
+func (h *Hub) waitForGeneration(ctx context.Context, convID, userMsgID string, previousID *string, usePareto, streaming bool) (*handlers.SyncGenerationResult, error) {
+	result, err := h.SendGenerationRequestSync(ctx, convID, userMsgID, previousID, usePareto, streaming)
 	if err != nil {
 		return nil, err
 	}
+	if result.Error != "" {
+		return nil, fmt.Errorf("generation failed: %s", result.Error)
+	}
 	if result.AssistantMessage == nil {
 		return nil, fmt.Errorf("no assistant message received")
 	}
@@ -588,11 +722,12 @@ type WSHandler struct {
 	hub      *Hub
 	cfg      *config.Config
 	store    *store.Store
+	auth     *services.AuthService
 	upgrader websocket.Upgrader
 }
 
-func NewWSHandler(hub *Hub, cfg *config.Config, s *store.Store) *WSHandler {
-	h := &WSHandler{hub: hub, cfg: cfg, store: s}
+func NewWSHandler(hub *Hub, cfg *config.Config, s *store.Store, authSvc *services.AuthService) *WSHandler {
+	h := &WSHandler{hub: hub, cfg: cfg, store: s, auth: authSvc}
 	h.upgrader = websocket.Upgrader{
 		ReadBufferSize:  1024,
 		WriteBufferSize: 1024,
@@ -621,6 +756,27 @@ func (h *WSHandler) checkOrigin(r *http.Request) bool {
 }
 
 func (h *WSHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// Browsers can't set headers on a WebSocket, so the token may also come
+	// in the query string.
+	token := bearerToken(r)
+	if token == "" {
+		token = r.URL.Query().Get("token")
+	}
+	if token == "" {
+		token = r.URL.Query().Get("agent_secret")
+	}
+	principal, status, msg := authenticate(r, AuthConfig{RequireAuth: h.cfg.Server.RequireAuth, Auth: h.auth}, token)
+	if principal == nil {
+		slog.Warn("ws: authentication failed", "status", status)
+		http.Error(w, fmt.Sprintf(`{"error":%q}`, msg), status)
+		return
+	}
+	userID := connUserID(r, principal)
+	if principal.Kind != domain.PrincipalService && !services.ValidUserID.MatchString(userID) {
+		http.Error(w, `{"error":"invalid user ID format"}`, http.StatusBadRequest)
+		return
+	}
+
 	conn, err := h.upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		slog.Error("ws: upgrade error", "error", err)
@@ -638,6 +794,15 @@ func (h *WSHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	h.hub.TrackClient(conn)
 	isClient := true
 
+	// mayAccess reports whether the connection may see or act on a
+	// conversation. Components may act on any; clients only on their own.
+	mayAccess := func(ctx context.Context, convID string) bool {
+		if principal.Kind == domain.PrincipalService || isAgent || isVoice || isMonitor || isAssistant || isWhatsApp {
+			return true
+		}
+		return h.ownsConversation(ctx, convID, userID)
+	}
+
 	for {
 		_, data, err := conn.ReadMessage()
 		if err != nil {
@@ -667,6 +832,8 @@ func (h *WSHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			slog.Error("ws: decode error", "error", err)
 			continue
 		}
+		// A frame acts for the connection's user, whichever user it names.
+		env.UserID = userID
 
 		// Detached from connection context: message processing must complete
 		// even if the client disconnects.
@@ -682,6 +849,9 @@ func (h *WSHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 					UserID:     env.UserID,
 				})
 			}
+			if userID != "" {
+				ctx = otel.WithUserID(ctx, userID)
+			}
 
 			switch env.Type {
 			case protocol.TypeSubscribe:
@@ -699,17 +869,17 @@ func (h *WSHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 				}
 
 				if sub.AgentMode {
-					if !h.verifyAgentAuth(r) {
+					if !h.allowService(principal, domain.ScopeAgent) {
 						slog.Warn("ws: agent auth failed")
 						h.sendSubscribeAck(conn, "", true, false, "authentication required")
 						return
 					}
 					untrackClient()
 					isAgent = true
-					h.hub.SubscribeAgent(conn)
+					h.hub.SubscribeAgent(conn, sub.Concurrency)
 					h.sendSubscribeAck(conn, "", true, true, "")
 				} else if sub.VoiceMode {
-					if !h.verifyAgentAuth(r) {
+					if !h.allowService(principal, domain.ScopeVoice) {
 						slog.Warn("ws: voice auth failed")
 						h.sendSubscribeAck(conn, "", false, false, "authentication required")
 						return
@@ -719,12 +889,17 @@ func (h *WSHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 					h.hub.SubscribeVoice(conn)
 					h.sendSubscribeAck(conn, "", false, true, "")
 				} else if sub.MonitorMode {
+					if !h.allowMonitor(principal) {
+						slog.Warn("ws: monitor auth failed")
+						h.sendSubscribeAck(conn, "", false, false, "authentication required")
+						return
+					}
 					untrackClient()
 					isMonitor = true
 					h.hub.SubscribeMonitor(conn)
 					h.sendSubscribeAck(conn, "", false, true, "")
 				} else if sub.AssistantMode {
-					if !h.verifyAgentAuth(r) {
+					if !h.allowService(principal, domain.ScopeAssistant) {
 						slog.Warn("ws: assistant auth failed")
 						h.sendSubscribeAck(conn, "", false, false, "authentication required")
 						return
@@ -734,7 +909,7 @@ func (h *WSHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 					h.hub.SubscribeAssistant(conn)
 					h.sendSubscribeAck(conn, "", false, true, "")
 				} else if sub.WhatsAppMode {
-					if !h.verifyAgentAuth(r) {
+					if !h.allowService(principal, domain.ScopeWhatsApp) {
 						slog.Warn("ws: whatsapp auth failed")
 						h.sendSubscribeAck(conn, "", false, false, "authentication required")
 						return
@@ -744,8 +919,17 @@ func (h *WSHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 					h.hub.SubscribeWhatsApp(conn)
 					h.sendSubscribeAck(conn, "", false, true, "")
 				} else if sub.ConversationID != "" {
-					h.hub.Subscribe(sub.ConversationID, conn)
-					h.sendSubscribeAck(conn, sub.ConversationID, false, true, "")
+					if !mayAccess(ctx, sub.ConversationID) {
+						h.sendSubscribeAck(conn, sub.ConversationID, false, false, "conversation not found")
+						return
+					}
+					seq, resync := h.hub.Subscribe(sub.ConversationID, conn, sub.LastSeq)
+					h.writeSubscribeAck(conn, protocol.SubscribeAck{
+						ConversationID: sub.ConversationID,
+						Success:        true,
+						LastSeq:        seq,
+						Resync:         resync,
+					})
 				}
 
 			case protocol.TypeUnsubscribe:
@@ -756,7 +940,7 @@ func (h *WSHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 				h.hub.Unsubscribe(unsub.ConversationID, conn)
 
 			case protocol.TypeVoiceJoinRequest:
-				if env.ConversationID != "" {
+				if env.ConversationID != "" && mayAccess(ctx, env.ConversationID) {
 					slog.Info("ws: voice join request", "conversation_id", env.ConversationID)
 					h.hub.BroadcastToVoice(data)
 				}
@@ -768,7 +952,7 @@ func (h *WSHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 				}
 
 			case protocol.TypeVoiceLeaveRequest:
-				if env.ConversationID != "" {
+				if env.ConversationID != "" && mayAccess(ctx, env.ConversationID) {
 					slog.Info("ws: voice leave request", "conversation_id", env.ConversationID)
 					h.hub.BroadcastToVoice(data)
 				}
@@ -810,13 +994,86 @@ func (h *WSHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 				}
 
 			case protocol.TypeUserMessage:
-				if env.ConversationID != "" {
+				if env.ConversationID != "" && mayAccess(ctx, env.ConversationID) {
 					h.handleClientUserMessage(ctx, env)
 				}
 
 			case protocol.TypeGenRequest:
-				if !isAgent && !isVoice && env.ConversationID != "" {
-					h.hub.BroadcastToAgent(data)
+				if !isAgent && !isVoice && env.ConversationID != "" && mayAccess(ctx, env.ConversationID) {
+					req, err := protocol.DecodeBody[protocol.GenerationRequest](env)
+					if err != nil {
+						slog.Error("ws: decode generation request error", "error", err)
+						return
+					}
+					if !bodyInConversation(env, req.ConversationID) {
+						return
+					}
+					req.ConversationID = env.ConversationID
+					if _, err := h.hub.EnqueueGeneration(ctx, env, *req); err != nil {
+						slog.Error("ws: queue generation request error", "error", err, "conversation_id", env.ConversationID)
+					}
+				}
+
+			case protocol.TypeGenerationCancel:
+				if !isAgent && env.ConversationID != "" && mayAccess(ctx, env.ConversationID) {
+					cancelReq, err := protocol.DecodeBody[protocol.GenerationCancel](env)
+					if err != nil {
+						slog.Error("ws: decode generation cancel error", "error", err)
+						return
+					}
+					if !bodyInConversation(env, cancelReq.ConversationID) {
+						return
+					}
+					slog.Info("ws: generation cancel request", "conversation_id", env.ConversationID)
+					cancelReq.ConversationID = env.ConversationID
+					h.hub.cancelQueuedJobs(ctx, env.ConversationID, cancelReq.MessageID)
+					h.hub.broadcastToAgentAs(env, *cancelReq)
+				}
+
+			case protocol.TypeToolApproval:
+				if !isAgent && env.ConversationID != "" && mayAccess(ctx, env.ConversationID) {
+					approval, err := protocol.DecodeBody[protocol.ToolApproval](env)
+					if err != nil {
+						slog.Error("ws: decode tool approval error", "error", err)
+						return
+					}
+					if !bodyInConversation(env, approval.ConversationID) {
+						return
+					}
+					slog.Info("ws: tool approval", "conversation_id", env.ConversationID, "tool_use_id", approval.ToolUseID, "approved", approval.Approved)
+					approval.ConversationID = env.ConversationID
+					h.hub.broadcastToAgentAs(env, *approval)
+				}
+
+			case protocol.TypeJobStatus:
+				if isAgent {
+					status, err := protocol.DecodeBody[protocol.JobStatus](env)
+					if err != nil {
+						slog.Error("ws: decode job status error", "error", err)
+						return
+					}
+					h.hub.handleJobStatus(ctx, conn, status)
+				}
+
+			case protocol.TypeJobHeartbeat:
+				if isAgent {
+					hb, err := protocol.DecodeBody[protocol.JobHeartbeat](env)
+					if err != nil {
+						slog.Error("ws: decode job heartbeat error", "error", err)
+						return
+					}
+					h.hub.handleJobHeartbeat(ctx, conn, hb)
+				}
+
+			case protocol.TypeMCPToolsReport:
+				if isAgent {
+					report, err := protocol.DecodeBody[protocol.MCPToolsReport](env)
+					if err != nil {
+						slog.Error("ws: decode mcp tools report error", "error", err)
+						return
+					}
+					h.hub.SetMCPTools(conn, report.Servers)
+					slog.Info("ws: agent reported mcp tools", "server_count", len(report.Servers))
 				}
 
 			case protocol.TypeAssistantHeartbeat:
@@ -864,20 +1121,20 @@ func (h *WSHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 					h.hub.BroadcastToConversation(env.ConversationID, data)
 					// Route client-execution tools to the assistant device
 					req, err := protocol.DecodeBody[protocol.ToolUseRequest](env)
-					if err == nil && req.Execution == "client" {
+					if err == nil && req.Execution == protocol.ToolExecutionClient {
 						h.hub.BroadcastToAssistant(data)
 					}
 				} else if isMonitor {
 					// mcp-assistant bridge sends tool requests via monitor mode
 					req, err := protocol.DecodeBody[protocol.ToolUseRequest](env)
-					if err == nil && req.Execution == "client" {
+					if err == nil && req.Execution == protocol.ToolExecutionClient {
 						h.hub.BroadcastToAssistant(data)
 					}
 				}
 
 			default:
 				if isAgent && env.ConversationID != "" {
-					slog.Info("ws: agent->user", "type", env.Type, "conversation_id", env.ConversationID)
+					slog.Debug("ws: agent->user", "type", env.Type, "conversation_id", env.ConversationID)
 					h.persistAgentMessage(ctx, env)
 					h.hub.BroadcastToConversation(env.ConversationID, data)
 				}
@@ -886,23 +1143,7 @@ func (h *WSHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if isAgent {
-		// Broadcast GenerationComplete with error for any active generations
-		h.hub.activeGensMu.Lock()
-		activeGens := make(map[string]string, len(h.hub.activeGens))
-		for k, v := range h.hub.activeGens {
-			activeGens[k] = v
-		}
-		h.hub.activeGens = make(map[string]string)
-		h.hub.activeGensMu.Unlock()
-
-		for convID := range activeGens {
-			h.hub.BroadcastEnvelope(convID, protocol.TypeGenerationComplete, &protocol.GenerationComplete{
-				ConversationID: convID,
-				Success:        false,
-				Error:          "agent disconnected",
-			})
-		}
-
+		// Its jobs go back to the queue for the other workers.
 		h.hub.UnsubscribeAgent(conn)
 	} else if isVoice {
 		h.hub.UnsubscribeVoice(conn)
@@ -921,29 +1162,72 @@ func (h *WSHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	h.hub.removeConnMu(conn)
 }
 
-func (h *WSHandler) verifyAgentAuth(r *http.Request) bool {
-	secret := h.cfg.Server.AgentSecret
-	if secret == "" {
+// bodyInConversation reports whether a frame's body names no conversation or
+// the one the frame was checked against. Access is only checked for the
+// envelope's, so a body naming another is refused.
+func bodyInConversation(env *protocol.Envelope, bodyConvID string) bool {
+	if bodyConvID == "" || bodyConvID == env.ConversationID {
 		return true
 	}
-	auth := r.Header.Get("Authorization")
-	if auth == "Bearer "+secret {
-		return true
+	slog.Warn("ws: frame body names another conversation", "type", env.Type, "conversation_id", env.ConversationID, "body_conversation_id", bodyConvID)
+	return false
+}
+
+// connUserID is the user a connection acts as: its principal's, or for an
+// unauthenticated connection the user_id query parameter or X-User-ID, as on
+// REST routes. Services act as no user.
+func connUserID(r *http.Request, p *domain.Principal) string {
+	if p.UserID != "" || p.Kind == domain.PrincipalService {
+		return p.UserID
+	}
+	if userID := r.URL.Query().Get("user_id"); userID != "" {
+		return userID
+	}
+	if userID := r.Header.Get("X-User-ID"); userID != "" {
+		return userID
+	}
+	return "default_user"
+}
+
+func (h *WSHandler) ownsConversation(ctx context.Context, convID, userID string) bool {
+	if h.store == nil {
+		return false
 	}
-	if r.URL.Query().Get("agent_secret") == secret {
+	err := h.store.Authorize(ctx, store.ResourceConversation, convID, userID)
+	if err != nil && !errors.Is(err, domain.ErrNotFound) {
+		slog.Error("ws: verify conversation ownership error", "error", err, "conversation_id", convID)
+	}
+	return err == nil
+}
+
+// allowService reports whether a connection may subscribe as a component,
+// which needs a service token with the component's scope. Without an agent
+// secret configured, unauthenticated connections may too, as before there
+// were service tokens.
+func (h *WSHandler) allowService(p *domain.Principal, scope string) bool {
+	if p.HasScope(scope) {
 		return true
 	}
-	return false
+	return p.Kind == domain.PrincipalAnonymous && h.cfg.Server.AgentSecret == ""
+}
+
+// allowMonitor reports whether a connection may watch all hub traffic: a
+// service with the monitor scope, or an admin.
+func (h *WSHandler) allowMonitor(p *domain.Principal) bool {
+	return p.IsAdmin || h.allowService(p, domain.ScopeMonitor)
 }
 
 func (h *WSHandler) sendSubscribeAck(conn *websocket.Conn, convID string, agentMode, success bool, errMsg string) {
-	ack := protocol.SubscribeAck{
+	h.writeSubscribeAck(conn, protocol.SubscribeAck{
 		ConversationID: convID,
 		AgentMode:      agentMode,
 		Success:        success,
 		Error:          errMsg,
-	}
-	env := protocol.NewEnvelope(convID, protocol.TypeSubscribeAck, ack)
+	})
+}
+
+func (h *WSHandler) writeSubscribeAck(conn *websocket.Conn, ack protocol.SubscribeAck) {
+	env := protocol.NewEnvelope(ack.ConversationID, protocol.TypeSubscribeAck, ack)
 	data, err := env.Encode()
 	if err != nil {
 		slog.Error("ws: encode subscribe ack error", "error", err)
@@ -984,6 +1268,12 @@ func (h *WSHandler) persistAgentMessage(ctx context.Context, env *protocol.Envel
 			previousID = &msg.PreviousID
 		}
 
+		status := domain.MessageStatusCompleted
+		cancelled := msg.Status == domain.MessageStatusCancelled
+		if cancelled {
+			status = domain.MessageStatusCancelled
+		}
+
 		dbMsg := &domain.Message{
 			ID:             msg.ID,
 			ConversationID: msg.ConversationID,
@@ -991,7 +1281,7 @@ func (h *WSHandler) persistAgentMessage(ctx context.Context, env *protocol.Envel
 			Role:           domain.RoleAssistant,
 			Content:        msg.Content,
 			Reasoning:      msg.Reasoning,
-			Status:         domain.MessageStatusCompleted,
+			Status:         status,
 			CreatedAt:      time.Now().UTC(),
 		}
 
@@ -1004,15 +1294,11 @@ func (h *WSHandler) persistAgentMessage(ctx context.Context, env *protocol.Envel
 			slog.Error("ws: update conversation tip error", "error", err, "conversation_id", msg.ConversationID)
 		}
 
-		// Clear active generation and broadcast GenerationComplete
-		h.hub.activeGensMu.Lock()
-		delete(h.hub.activeGens, msg.ConversationID)
-		h.hub.activeGensMu.Unlock()
-
 		h.hub.BroadcastEnvelope(msg.ConversationID, protocol.TypeGenerationComplete, &protocol.GenerationComplete{
 			MessageID:      msg.ID,
 			ConversationID: msg.ConversationID,
-			Success:        true,
+			Success:        !cancelled,
+			Cancelled:      cancelled,
 		})
 
 		// Notify any sync waiters for this conversation
@@ -1050,12 +1336,26 @@ func (h *WSHandler) persistAgentMessage(ctx context.Context, env *protocol.Envel
 			return
 		}
 
+		status := domain.ToolUseStatusPending
+		if req.Execution == protocol.ToolExecutionAwaitingApproval {
+			status = domain.ToolUseStatusAwaitingApproval
+		}
+
+		// A call that waited for approval is announced again once it runs.
+		if tu, err := h.store.GetToolUse(ctx, req.ID); err == nil {
+			tu.Status = status
+			if err := h.store.UpdateToolUse(ctx, tu); err != nil {
+				slog.Error("ws: update tool use error", "error", err, "tool_use_id", req.ID)
+			}
+			return
+		}
+
 		tu := &domain.ToolUse{
 			ID:        req.ID,
 			MessageID: req.MessageID,
 			ToolName:  req.ToolName,
 			Arguments: req.Arguments,
-			Status:    domain.ToolUseStatusPending,
+			Status:    status,
 			CreatedAt: time.Now().UTC(),
 		}
 
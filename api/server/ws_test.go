@@ -0,0 +1,62 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/longregen/alicia/api/domain"
+	"github.com/longregen/alicia/api/protocol"
+)
+
+func TestMCPToolsPerAgent(t *testing.T) {
+	h := NewHub(nil)
+	a, b := &websocket.Conn{}, &websocket.Conn{}
+	h.SubscribeAgent(a, 1)
+	h.SubscribeAgent(b, 1)
+
+	h.SetMCPTools(a, []protocol.MCPServerTools{
+		{Name: "search", Status: domain.MCPStatusFailed, Error: "exit 1"},
+		{Name: "files", Status: domain.MCPStatusUp},
+	})
+	h.SetMCPTools(b, []protocol.MCPServerTools{
+		{Name: "search", Status: domain.MCPStatusUp, Tools: []protocol.MCPTool{{Name: "web_search"}}},
+	})
+
+	got := h.MCPTools()
+	if len(got) != 2 || got[0].Name != "files" || got[1].Name != "search" {
+		t.Fatalf("MCPTools() = %+v, want files and search", got)
+	}
+	if got[1].Status != domain.MCPStatusUp || len(got[1].Tools) != 1 {
+		t.Errorf("search = %+v, want it up as one agent runs it", got[1])
+	}
+
+	// One agent leaving keeps the other's report.
+	h.UnsubscribeAgent(b)
+	got = h.MCPTools()
+	if len(got) != 2 || got[1].Status != domain.MCPStatusFailed {
+		t.Errorf("after b left MCPTools() = %+v, want a's report", got)
+	}
+
+	h.UnsubscribeAgent(a)
+	if got := h.MCPTools(); len(got) != 0 {
+		t.Errorf("with no agents MCPTools() = %+v, want none", got)
+	}
+}
+
+func TestBodyInConversation(t *testing.T) {
+	env := protocol.NewEnvelope("conv_a", protocol.TypeToolApproval, nil)
+	tests := []struct {
+		body string
+		want bool
+	}{
+		{"", true},
+		{"conv_a", true},
+		{"conv_b", false},
+	}
+	for _, tt := range tests {
+		if got := bodyInConversation(env, tt.body); got != tt.want {
+			t.Errorf("bodyInConversation(conv_a, %q) = %v, want %v", tt.body, got, tt.want)
+		}
+	}
+}
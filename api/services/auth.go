@@ -0,0 +1,480 @@
+package services
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/longregen/alicia/api/domain"
+	"github.com/longregen/alicia/api/store"
+	"github.com/longregen/alicia/shared/id"
+)
+
+// Bearer tokens that aren't session JWTs start with one of these.
+const (
+	deviceKeyPrefix    = "alicia_dk_"
+	serviceTokenPrefix = "alicia_st_"
+)
+
+const (
+	minPasswordLength = 8
+	maxPasswordLength = 72 // bcrypt ignores anything longer
+)
+
+var (
+	ValidUsername = regexp.MustCompile(`^[a-zA-Z0-9_\-\.@]{3,64}$`)
+	// ValidUserID matches the user IDs a request may name in X-User-ID.
+	ValidUserID = regexp.MustCompile(`^[a-zA-Z0-9_\-\.@]+$`)
+)
+
+// legacySecretKeyID names the principal of the configured agent secret.
+const legacySecretKeyID = "agent_secret"
+
+type AuthConfig struct {
+	Secret      []byte        // signs session tokens
+	SessionTTL  time.Duration // how long a login lasts
+	AllowSignup bool          // anyone may register; the first user always may
+	// LegacySecret, when set, is accepted as a service token with every
+	// scope, so components configured with AGENT_SECRET keep working.
+	LegacySecret string
+	// FirstUserID is the id given to the first user, so that data created
+	// before there were accounts, under that user id, stays theirs.
+	FirstUserID string
+	WebAuthn    WebAuthnConfig
+}
+
+// IssuedSession is a new login and its bearer token.
+type IssuedSession struct {
+	Token   string          `json:"token"`
+	Session *domain.Session `json:"session"`
+	User    *domain.User    `json:"user"`
+}
+
+type AuthService struct {
+	store *store.Store
+	cfg   AuthConfig
+	// dummyHash is compared against when a username doesn't exist, so that
+	// failed logins take as long whether or not it does.
+	dummyHash []byte
+	// accounts is set once a user is known to exist. Users are never
+	// deleted, so it never goes back.
+	accounts atomic.Bool
+}
+
+func NewAuthService(s *store.Store, cfg AuthConfig) *AuthService {
+	dummy, _ := bcrypt.GenerateFromPassword([]byte("not a password"), bcrypt.DefaultCost)
+	return &AuthService{store: s, cfg: cfg, dummyHash: dummy}
+}
+
+// SignupOpen reports whether Register would accept a new user.
+func (svc *AuthService) SignupOpen(ctx context.Context) (bool, error) {
+	if svc.cfg.AllowSignup {
+		return true, nil
+	}
+	n, err := svc.store.CountUsers(ctx)
+	return n == 0, err
+}
+
+// AccountsExist reports whether anyone has registered. From then on requests
+// must be authenticated, whether or not auth is required.
+func (svc *AuthService) AccountsExist(ctx context.Context) (bool, error) {
+	if svc.accounts.Load() {
+		return true, nil
+	}
+	n, err := svc.store.CountUsers(ctx)
+	if err != nil {
+		return false, err
+	}
+	if n > 0 {
+		svc.accounts.Store(true)
+	}
+	return n > 0, nil
+}
+
+// PasskeysEnabled reports whether WebAuthn is configured.
+func (svc *AuthService) PasskeysEnabled() bool {
+	return svc.cfg.WebAuthn.RPID != ""
+}
+
+// Register creates a user with a password and logs them in. A user without
+// a password can only log in with a passkey, which they must then register
+// straight away with the returned session.
+func (svc *AuthService) Register(ctx context.Context, username, password, displayName, userAgent string) (*IssuedSession, error) {
+	if !ValidUsername.MatchString(username) {
+		return nil, fmt.Errorf("%w: username must be 3-64 letters, digits or _-.@", domain.ErrInvalidInput)
+	}
+
+	var hash string
+	if password != "" {
+		var err error
+		if hash, err = hashPassword(password); err != nil {
+			return nil, err
+		}
+	}
+	if displayName == "" {
+		displayName = username
+	}
+	now := time.Now().UTC()
+	user := &domain.User{
+		ID:           id.NewUser(),
+		Username:     username,
+		DisplayName:  displayName,
+		PasswordHash: hash,
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}
+
+	// Registrations take turns, so that only one of several racing to be
+	// first gets in while signup is otherwise closed.
+	err := svc.store.WithTx(ctx, func(ctx context.Context) error {
+		if err := svc.store.LockUsers(ctx); err != nil {
+			return err
+		}
+		users, err := svc.store.CountUsers(ctx)
+		if err != nil {
+			return err
+		}
+		if users > 0 && !svc.cfg.AllowSignup {
+			return domain.ErrSignupClosed
+		}
+		if users == 0 && svc.cfg.FirstUserID != "" {
+			user.ID = svc.cfg.FirstUserID
+		}
+		return svc.store.CreateUser(ctx, user)
+	})
+	if err != nil {
+		return nil, err
+	}
+	svc.accounts.Store(true)
+	slog.Info("user registered", "user_id", user.ID, "admin", user.IsAdmin)
+	return svc.issueSession(ctx, user, "password", userAgent)
+}
+
+// Login checks a username and password and starts a session.
+func (svc *AuthService) Login(ctx context.Context, username, password, userAgent string) (*IssuedSession, error) {
+	user, err := svc.store.GetUserByUsername(ctx, username)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil || user.PasswordHash == "" {
+		_ = bcrypt.CompareHashAndPassword(svc.dummyHash, []byte(password))
+		return nil, domain.ErrInvalidCredentials
+	}
+	if bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)) != nil || user.DisabledAt != nil {
+		return nil, domain.ErrInvalidCredentials
+	}
+	return svc.issueSession(ctx, user, "password", userAgent)
+}
+
+func (svc *AuthService) issueSession(ctx context.Context, user *domain.User, method, userAgent string) (*IssuedSession, error) {
+	now := time.Now().UTC()
+	sess := &domain.Session{
+		ID:        id.NewSession(),
+		UserID:    user.ID,
+		Method:    method,
+		UserAgent: truncate(userAgent, 512),
+		CreatedAt: now,
+		ExpiresAt: now.Add(svc.cfg.SessionTTL),
+	}
+	if err := svc.store.CreateSession(ctx, sess); err != nil {
+		return nil, err
+	}
+	token, err := signSessionToken(svc.cfg.Secret, sessionClaims{
+		Subject:   user.ID,
+		SessionID: sess.ID,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: sess.ExpiresAt.Unix(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &IssuedSession{Token: token, Session: sess, User: user}, nil
+}
+
+// Authenticate resolves a bearer token: a session token, a device key, a
+// service token or the legacy agent secret. Any token that isn't valid,
+// current and unrevoked gives domain.ErrInvalidCredentials.
+func (svc *AuthService) Authenticate(ctx context.Context, token string) (*domain.Principal, error) {
+	if svc.cfg.LegacySecret != "" && subtle.ConstantTimeCompare([]byte(token), []byte(svc.cfg.LegacySecret)) == 1 {
+		return &domain.Principal{Kind: domain.PrincipalService, KeyID: legacySecretKeyID, Scopes: domain.ServiceScopes}, nil
+	}
+	if strings.HasPrefix(token, deviceKeyPrefix) || strings.HasPrefix(token, serviceTokenPrefix) {
+		return svc.authenticateKey(ctx, token)
+	}
+	return svc.authenticateSession(ctx, token)
+}
+
+func (svc *AuthService) authenticateSession(ctx context.Context, token string) (*domain.Principal, error) {
+	claims, err := parseSessionToken(svc.cfg.Secret, token, time.Now())
+	if err != nil {
+		return nil, domain.ErrInvalidCredentials
+	}
+	sess, err := svc.store.GetSession(ctx, claims.SessionID)
+	if err != nil {
+		return nil, err
+	}
+	if sess == nil || sess.RevokedAt != nil || sess.UserID != claims.Subject || time.Now().After(sess.ExpiresAt) {
+		return nil, domain.ErrInvalidCredentials
+	}
+	user, err := svc.activeUser(ctx, sess.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if err := svc.store.TouchSession(ctx, sess.ID); err != nil {
+		slog.Warn("failed to update session last seen", "session_id", sess.ID, "error", err)
+	}
+	return &domain.Principal{Kind: domain.PrincipalUser, UserID: user.ID, SessionID: sess.ID, IsAdmin: user.IsAdmin}, nil
+}
+
+func (svc *AuthService) authenticateKey(ctx context.Context, token string) (*domain.Principal, error) {
+	key, err := svc.store.GetAPIKeyByHash(ctx, hashKey(token))
+	if err != nil {
+		return nil, err
+	}
+	if key == nil || key.RevokedAt != nil || (key.ExpiresAt != nil && time.Now().After(*key.ExpiresAt)) {
+		return nil, domain.ErrInvalidCredentials
+	}
+
+	p := &domain.Principal{KeyID: key.ID}
+	switch key.Kind {
+	case domain.APIKeyDevice:
+		user, err := svc.activeUser(ctx, *key.UserID)
+		if err != nil {
+			return nil, err
+		}
+		p.Kind, p.UserID, p.IsAdmin = domain.PrincipalDevice, user.ID, user.IsAdmin
+	case domain.APIKeyService:
+		p.Kind, p.Scopes = domain.PrincipalService, key.Scopes
+	default:
+		return nil, domain.ErrInvalidCredentials
+	}
+	if err := svc.store.TouchAPIKey(ctx, key.ID); err != nil {
+		slog.Warn("failed to update api key last used", "key_id", key.ID, "error", err)
+	}
+	return p, nil
+}
+
+// activeUser returns the user, or domain.ErrInvalidCredentials if they no
+// longer exist or are disabled.
+func (svc *AuthService) activeUser(ctx context.Context, userID string) (*domain.User, error) {
+	user, err := svc.store.GetUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil || user.DisabledAt != nil {
+		return nil, domain.ErrInvalidCredentials
+	}
+	return user, nil
+}
+
+func (svc *AuthService) GetUser(ctx context.Context, userID string) (*domain.User, error) {
+	return svc.store.GetUser(ctx, userID)
+}
+
+// ChangePassword sets the user's password, checking the current one if they
+// have one, and logs out their other sessions.
+func (svc *AuthService) ChangePassword(ctx context.Context, userID, sessionID, current, password string) error {
+	user, err := svc.activeUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if user.PasswordHash != "" && bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(current)) != nil {
+		return domain.ErrInvalidCredentials
+	}
+	hash, err := hashPassword(password)
+	if err != nil {
+		return err
+	}
+	return svc.store.WithTx(ctx, func(ctx context.Context) error {
+		if err := svc.store.UpdateUserPassword(ctx, userID, hash); err != nil {
+			return err
+		}
+		return svc.store.RevokeUserSessions(ctx, userID, sessionID)
+	})
+}
+
+func (svc *AuthService) ListSessions(ctx context.Context, userID string) ([]*domain.Session, error) {
+	return svc.store.ListSessions(ctx, userID)
+}
+
+func (svc *AuthService) RevokeSession(ctx context.Context, sessionID, userID string) error {
+	return svc.store.RevokeSession(ctx, sessionID, userID)
+}
+
+// CreateDeviceKey issues an API key that acts as the user, for one device or
+// bridge. The key is returned only here. A zero ttl never expires.
+func (svc *AuthService) CreateDeviceKey(ctx context.Context, userID, name string, ttl time.Duration) (*domain.APIKey, string, error) {
+	return svc.createKey(ctx, domain.APIKeyDevice, &userID, userID, name, nil, ttl)
+}
+
+func (svc *AuthService) ListDeviceKeys(ctx context.Context, userID string) ([]*domain.APIKey, error) {
+	return svc.store.ListAPIKeys(ctx, domain.APIKeyDevice, userID)
+}
+
+func (svc *AuthService) RevokeDeviceKey(ctx context.Context, keyID, userID string) error {
+	return svc.store.RevokeAPIKey(ctx, keyID, domain.APIKeyDevice, userID)
+}
+
+// CreateServiceToken issues a token for a component, with scopes from
+// domain.ServiceScopes. The token is returned only here.
+func (svc *AuthService) CreateServiceToken(ctx context.Context, createdBy, name string, scopes []string, ttl time.Duration) (*domain.APIKey, string, error) {
+	if len(scopes) == 0 {
+		return nil, "", fmt.Errorf("%w: a service token needs at least one scope", domain.ErrInvalidInput)
+	}
+	for _, scope := range scopes {
+		if !slices.Contains(domain.ServiceScopes, scope) {
+			return nil, "", fmt.Errorf("%w: unknown scope %q", domain.ErrInvalidInput, scope)
+		}
+	}
+	return svc.createKey(ctx, domain.APIKeyService, nil, createdBy, name, scopes, ttl)
+}
+
+func (svc *AuthService) ListServiceTokens(ctx context.Context) ([]*domain.APIKey, error) {
+	return svc.store.ListAPIKeys(ctx, domain.APIKeyService, "")
+}
+
+func (svc *AuthService) RevokeServiceToken(ctx context.Context, keyID string) error {
+	return svc.store.RevokeAPIKey(ctx, keyID, domain.APIKeyService, "")
+}
+
+func (svc *AuthService) createKey(ctx context.Context, kind string, userID *string, createdBy, name string, scopes []string, ttl time.Duration) (*domain.APIKey, string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, "", fmt.Errorf("%w: name is required", domain.ErrInvalidInput)
+	}
+	prefix := deviceKeyPrefix
+	if kind == domain.APIKeyService {
+		prefix = serviceTokenPrefix
+	}
+	secret, err := randomToken(32)
+	if err != nil {
+		return nil, "", err
+	}
+	token := prefix + secret
+
+	now := time.Now().UTC()
+	key := &domain.APIKey{
+		ID:        id.NewAPIKey(),
+		Kind:      kind,
+		UserID:    userID,
+		Name:      truncate(name, 200),
+		KeyPrefix: token[:len(prefix)+6],
+		KeyHash:   hashKey(token),
+		Scopes:    scopes,
+		CreatedBy: &createdBy,
+		CreatedAt: now,
+	}
+	if ttl > 0 {
+		expires := now.Add(ttl)
+		key.ExpiresAt = &expires
+	}
+	if err := svc.store.CreateAPIKey(ctx, key); err != nil {
+		return nil, "", err
+	}
+	return key, token, nil
+}
+
+func hashPassword(password string) (string, error) {
+	if len(password) < minPasswordLength {
+		return "", fmt.Errorf("%w: password must be at least %d characters", domain.ErrInvalidInput, minPasswordLength)
+	}
+	if len(password) > maxPasswordLength {
+		return "", fmt.Errorf("%w: password must be at most %d bytes", domain.ErrInvalidInput, maxPasswordLength)
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", fmt.Errorf("hash password: %w", err)
+	}
+	return string(hash), nil
+}
+
+// hashKey is how API keys are stored and looked up. Keys are random, so a
+// plain hash is enough.
+func hashKey(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func randomToken(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("generate token: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func truncate(s string, n int) string {
+	if len(s) > n {
+		return s[:n]
+	}
+	return s
+}
+
+// --- Session tokens ---
+
+// sessionClaims are the claims of a session token, an HS256 JWT.
+type sessionClaims struct {
+	Subject   string `json:"sub"` // user id
+	SessionID string `json:"sid"`
+	IssuedAt  int64  `json:"iat"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+var errInvalidToken = errors.New("invalid session token")
+
+// jwtHeader is the only header session tokens are issued or accepted with.
+var jwtHeader = base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+
+func signSessionToken(secret []byte, claims sessionClaims) (string, error) {
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", fmt.Errorf("encode session claims: %w", err)
+	}
+	signing := jwtHeader + "." + base64.RawURLEncoding.EncodeToString(payload)
+	return signing + "." + base64.RawURLEncoding.EncodeToString(jwtSignature(secret, signing)), nil
+}
+
+func parseSessionToken(secret []byte, token string, now time.Time) (sessionClaims, error) {
+	var claims sessionClaims
+	header, rest, ok := strings.Cut(token, ".")
+	if !ok || header != jwtHeader {
+		return claims, errInvalidToken
+	}
+	payload, sig, ok := strings.Cut(rest, ".")
+	if !ok {
+		return claims, errInvalidToken
+	}
+	gotSig, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil || !hmac.Equal(gotSig, jwtSignature(secret, header+"."+payload)) {
+		return claims, errInvalidToken
+	}
+	data, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil || json.Unmarshal(data, &claims) != nil {
+		return claims, errInvalidToken
+	}
+	if claims.Subject == "" || claims.SessionID == "" || now.Unix() >= claims.ExpiresAt {
+		return claims, errInvalidToken
+	}
+	return claims, nil
+}
+
+func jwtSignature(secret []byte, signing string) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(signing))
+	return mac.Sum(nil)
+}
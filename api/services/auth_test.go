@@ -0,0 +1,155 @@
+package services
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/longregen/alicia/api/domain"
+)
+
+func TestSessionToken(t *testing.T) {
+	secret := []byte("test-secret")
+	now := time.Now()
+	claims := sessionClaims{Subject: "usr_1", SessionID: "sess_1", IssuedAt: now.Unix(), ExpiresAt: now.Add(time.Hour).Unix()}
+
+	token, err := signSessionToken(secret, claims)
+	if err != nil {
+		t.Fatalf("signSessionToken failed: %v", err)
+	}
+
+	got, err := parseSessionToken(secret, token, now)
+	if err != nil {
+		t.Fatalf("parseSessionToken failed: %v", err)
+	}
+	if got != claims {
+		t.Errorf("claims mismatch: got %+v, want %+v", got, claims)
+	}
+
+	if _, err := parseSessionToken([]byte("other-secret"), token, now); err == nil {
+		t.Error("token accepted with the wrong secret")
+	}
+	if _, err := parseSessionToken(secret, token, now.Add(2*time.Hour)); err == nil {
+		t.Error("expired token accepted")
+	}
+
+	// A payload swapped in under the original signature must not verify.
+	forged, _ := signSessionToken([]byte("attacker"), sessionClaims{Subject: "usr_2", SessionID: "sess_2", ExpiresAt: claims.ExpiresAt})
+	parts, forgedParts := strings.Split(token, "."), strings.Split(forged, ".")
+	tampered := parts[0] + "." + forgedParts[1] + "." + parts[2]
+	if _, err := parseSessionToken(secret, tampered, now); err == nil {
+		t.Error("tampered token accepted")
+	}
+
+	// Only the HS256 header is accepted.
+	none := "eyJhbGciOiJub25lIiwidHlwIjoiSldUIn0." + parts[1] + "."
+	if _, err := parseSessionToken(secret, none, now); err == nil {
+		t.Error("unsigned token accepted")
+	}
+}
+
+func TestHashPasswordLength(t *testing.T) {
+	if _, err := hashPassword("short"); !errors.Is(err, domain.ErrInvalidInput) {
+		t.Errorf("short password: expected ErrInvalidInput, got %v", err)
+	}
+	if _, err := hashPassword(strings.Repeat("a", maxPasswordLength+1)); !errors.Is(err, domain.ErrInvalidInput) {
+		t.Errorf("long password: expected ErrInvalidInput, got %v", err)
+	}
+	if _, err := hashPassword("correct horse battery staple"); err != nil {
+		t.Errorf("hashPassword failed: %v", err)
+	}
+}
+
+func TestVerifyClientData(t *testing.T) {
+	challenge := []byte("0123456789abcdef")
+	origins := []string{"https://alicia.example.com"}
+	clientData := func(typ, origin string) []byte {
+		b, _ := json.Marshal(map[string]string{"type": typ, "challenge": b64(challenge), "origin": origin})
+		return b
+	}
+
+	if err := verifyClientData(clientData("webauthn.get", origins[0]), "webauthn.get", challenge, origins); err != nil {
+		t.Errorf("valid client data rejected: %v", err)
+	}
+	if err := verifyClientData(clientData("webauthn.create", origins[0]), "webauthn.get", challenge, origins); err == nil {
+		t.Error("client data for another ceremony accepted")
+	}
+	if err := verifyClientData(clientData("webauthn.get", "https://evil.example.com"), "webauthn.get", challenge, origins); err == nil {
+		t.Error("client data from another origin accepted")
+	}
+	if err := verifyClientData(clientData("webauthn.get", origins[0]), "webauthn.get", []byte("other"), origins); err == nil {
+		t.Error("client data for another challenge accepted")
+	}
+}
+
+func TestVerifyAssertion(t *testing.T) {
+	const rpID = "alicia.example.com"
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	spki, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	passkey := &domain.Passkey{ID: "cred", PublicKey: spki, Algorithm: coseES256, SignCount: 4}
+	clientData := []byte(`{"type":"webauthn.get"}`)
+
+	assertion := func(rp string, flags byte, count uint32) ([]byte, []byte) {
+		rpHash := sha256.Sum256([]byte(rp))
+		authData := append(rpHash[:], flags, 0, 0, 0, 0)
+		binary.BigEndian.PutUint32(authData[33:], count)
+		cdHash := sha256.Sum256(clientData)
+		digest := sha256.Sum256(append(append([]byte{}, authData...), cdHash[:]...))
+		sig, err := ecdsa.SignASN1(rand.Reader, key, digest[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		return authData, sig
+	}
+
+	authData, sig := assertion(rpID, 0x05, 5)
+	count, err := verifyAssertion(passkey, authData, clientData, sig, rpID)
+	if err != nil {
+		t.Fatalf("valid assertion rejected: %v", err)
+	}
+	if count != 5 {
+		t.Errorf("sign count: got %d, want 5", count)
+	}
+
+	if _, err := verifyAssertion(passkey, authData, []byte(`{"type":"other"}`), sig, rpID); err == nil {
+		t.Error("assertion over other client data accepted")
+	}
+	if _, err := verifyAssertion(passkey, authData, clientData, sig, "other.example.com"); err == nil {
+		t.Error("assertion for another relying party accepted")
+	}
+
+	authData, sig = assertion(rpID, 0x04, 6)
+	if _, err := verifyAssertion(passkey, authData, clientData, sig, rpID); err == nil {
+		t.Error("assertion without user presence accepted")
+	}
+
+	authData, sig = assertion(rpID, 0x01, 4)
+	if _, err := verifyAssertion(passkey, authData, clientData, sig, rpID); err == nil {
+		t.Error("assertion with a stale sign count accepted")
+	}
+
+	// Authenticators that don't count always report zero.
+	passkey.SignCount = 0
+	authData, sig = assertion(rpID, 0x01, 0)
+	if _, err := verifyAssertion(passkey, authData, clientData, sig, rpID); err != nil {
+		t.Errorf("assertion from a non-counting authenticator rejected: %v", err)
+	}
+
+	if _, err := parsePasskeyKey(spki, coseRS256); err == nil {
+		t.Error("EC key accepted for RS256")
+	}
+}
@@ -40,6 +40,12 @@ func (svc *ConversationService) GetByUser(ctx context.Context, id, userID string
 	return svc.store.GetConversationByUser(ctx, id, userID)
 }
 
+// Authorize checks that a conversation, or a message, tool use or memory use
+// in one, belongs to the user. See store.Authorize.
+func (svc *ConversationService) Authorize(ctx context.Context, resource, id, userID string) error {
+	return svc.store.Authorize(ctx, resource, id, userID)
+}
+
 func (svc *ConversationService) List(ctx context.Context, userID string, limit, offset int) ([]*domain.Conversation, int, error) {
 	return svc.store.ListConversations(ctx, userID, limit, offset)
 }
@@ -19,7 +19,7 @@ func NewMCPService(s *store.Store) *MCPService {
 }
 
 // CreateServer creates a new MCP server configuration.
-func (svc *MCPService) CreateServer(ctx context.Context, name, transportType, command string, args []string, url string) (*domain.MCPServer, error) {
+func (svc *MCPService) CreateServer(ctx context.Context, name, transportType, command string, args []string, url string, headers map[string]string, limits domain.MCPToolLimits, toolLimits map[string]domain.MCPToolLimits) (*domain.MCPServer, error) {
 	server := &domain.MCPServer{
 		ID:            store.NewMCPServerID(),
 		Name:          name,
@@ -27,6 +27,9 @@ func (svc *MCPService) CreateServer(ctx context.Context, name, transportType, co
 		Command:       command,
 		Args:          args,
 		URL:           url,
+		Headers:       headers,
+		MCPToolLimits: limits,
+		ToolLimits:    toolLimits,
 		Enabled:       true,
 		CreatedAt:     time.Now().UTC(),
 	}
@@ -2,11 +2,13 @@ package services
 
 import (
 	"context"
+	"errors"
 	"log/slog"
 	"time"
 
 	"github.com/longregen/alicia/api/domain"
 	"github.com/longregen/alicia/api/store"
+	"github.com/longregen/alicia/shared/search"
 )
 
 // EmbeddingService generates embeddings for text.
@@ -26,9 +28,10 @@ func NewMemoryService(s *store.Store, embedder EmbeddingService) *MemoryService
 }
 
 // CreateMemory creates a new memory with optional embedding.
-func (svc *MemoryService) CreateMemory(ctx context.Context, content string, sourceMsgID *string) (*domain.Memory, error) {
+func (svc *MemoryService) CreateMemory(ctx context.Context, userID, content string, sourceMsgID *string) (*domain.Memory, error) {
 	mem := &domain.Memory{
 		ID:          store.NewMemoryID(),
+		UserID:      userID,
 		Content:     content,
 		Importance:  0.5,
 		SourceMsgID: sourceMsgID,
@@ -54,9 +57,9 @@ func (svc *MemoryService) CreateMemory(ctx context.Context, content string, sour
 	return mem, nil
 }
 
-// GetMemory retrieves a memory by ID.
-func (svc *MemoryService) GetMemory(ctx context.Context, id string) (*domain.Memory, error) {
-	return svc.store.GetMemory(ctx, id)
+// GetMemory retrieves a memory by ID if it belongs to the user.
+func (svc *MemoryService) GetMemory(ctx context.Context, id, userID string) (*domain.Memory, error) {
+	return svc.store.GetMemory(ctx, id, userID)
 }
 
 // UpdateMemory updates a memory.
@@ -64,41 +67,106 @@ func (svc *MemoryService) UpdateMemory(ctx context.Context, mem *domain.Memory)
 	return svc.store.UpdateMemory(ctx, mem)
 }
 
-// DeleteMemory soft-deletes a memory with optional reason.
-func (svc *MemoryService) DeleteMemory(ctx context.Context, id string, reason *string) error {
-	return svc.store.DeleteMemory(ctx, id, reason)
+// ListMemoryVersions returns the earlier contents of the user's memory.
+func (svc *MemoryService) ListMemoryVersions(ctx context.Context, id, userID string) ([]*domain.MemoryVersion, error) {
+	if _, err := svc.store.GetMemory(ctx, id, userID); err != nil {
+		return nil, err
+	}
+	return svc.store.ListMemoryVersions(ctx, id, userID)
 }
 
-// ListMemories returns all non-archived memories with total count.
-func (svc *MemoryService) ListMemories(ctx context.Context, limit, offset int) ([]*domain.Memory, int, error) {
-	return svc.store.ListMemories(ctx, limit, offset)
-}
+// GetProvenance returns why the assistant believes the user's memory: its
+// source message and conversation, the extractions behind it, its earlier
+// contents and its latest useLimit retrievals with their feedback.
+func (svc *MemoryService) GetProvenance(ctx context.Context, id, userID string, useLimit int) (*domain.MemoryProvenance, error) {
+	mem, err := svc.store.GetMemory(ctx, id, userID)
+	if err != nil {
+		return nil, err
+	}
+	p := &domain.MemoryProvenance{Memory: mem}
 
-// SearchMemories searches memories by semantic similarity.
-func (svc *MemoryService) SearchMemories(ctx context.Context, query string, limit int) ([]*domain.Memory, error) {
-	if svc.embedder == nil {
-		// Fall back to listing if no embedder
-		mems, _, err := svc.store.ListMemories(ctx, limit, 0)
-		return mems, err
+	if mem.SourceMsgID != nil {
+		msg, err := svc.store.GetMessage(ctx, *mem.SourceMsgID)
+		if err != nil && !errors.Is(err, domain.ErrNotFound) {
+			return nil, err
+		}
+		if msg != nil {
+			conv, err := svc.store.GetConversationByUser(ctx, msg.ConversationID, userID)
+			if err != nil && !errors.Is(err, domain.ErrNotFound) {
+				return nil, err
+			}
+			if conv != nil {
+				p.SourceMessage, p.SourceConversation = msg, conv
+			}
+		}
+	}
+
+	if p.Generations, err = svc.store.ListMemoryGenerations(ctx, id, userID); err != nil {
+		return nil, err
+	}
+	if p.Versions, err = svc.store.ListMemoryVersions(ctx, id, userID); err != nil {
+		return nil, err
+	}
+	if p.Uses, p.UsesTotal, err = svc.store.ListMemoryUseProvenance(ctx, id, userID, useLimit); err != nil {
+		return nil, err
+	}
+	if p.Generations == nil {
+		p.Generations = []*domain.MemoryGeneration{}
+	}
+	if p.Versions == nil {
+		p.Versions = []*domain.MemoryVersion{}
+	}
+	if p.Uses == nil {
+		p.Uses = []*domain.MemoryUseProvenance{}
 	}
+	return p, nil
+}
+
+// DeleteMemory soft-deletes a memory with optional reason.
+func (svc *MemoryService) DeleteMemory(ctx context.Context, id, userID string, reason *string) error {
+	return svc.store.DeleteMemory(ctx, id, userID, reason)
+}
 
-	embedding, err := svc.embedder.Embed(ctx, query)
+// ListMemories returns the user's non-archived memories with total count.
+func (svc *MemoryService) ListMemories(ctx context.Context, userID string, limit, offset int) ([]*domain.Memory, int, error) {
+	return svc.store.ListMemories(ctx, userID, limit, offset)
+}
+
+// SearchMemories searches memories by hybrid keyword and semantic search,
+// fused with the user's search weights. Without an embedder, or if
+// embedding the query fails, it searches by keyword only.
+func (svc *MemoryService) SearchMemories(ctx context.Context, userID, query string, limit int) ([]*domain.Memory, error) {
+	prefs, err := svc.store.GetUserPreferences(ctx, userID)
 	if err != nil {
 		return nil, err
 	}
+	if prefs == nil {
+		prefs = DefaultPreferences(userID)
+	}
+	weights := search.Weights{Vector: float64(prefs.SearchVectorWeight), Keyword: float64(prefs.SearchKeywordWeight)}
+
+	var embedding []float32
+	if svc.embedder != nil && weights.Vector > 0 {
+		embedding, err = svc.embedder.Embed(ctx, query)
+		if err != nil {
+			slog.Warn("embedding generation failed for memory search, searching by keyword", "error", err)
+			embedding = nil
+		}
+	}
 
-	return svc.store.SearchMemories(ctx, embedding, limit, 0.5) // 0.5 threshold
+	return svc.store.SearchMemories(ctx, userID, query, embedding, limit, 0.5, weights) // 0.5 threshold
 }
 
 // GetMemoriesByTags returns memories matching tags.
-func (svc *MemoryService) GetMemoriesByTags(ctx context.Context, tags []string, limit int) ([]*domain.Memory, error) {
-	return svc.store.GetMemoriesByTags(ctx, tags, limit)
+func (svc *MemoryService) GetMemoriesByTags(ctx context.Context, userID string, tags []string, limit int) ([]*domain.Memory, error) {
+	return svc.store.GetMemoriesByTags(ctx, userID, tags, limit)
 }
 
 // TrackUsage records that a memory was retrieved for a message.
-func (svc *MemoryService) TrackUsage(ctx context.Context, memoryID, convID, msgID string, similarity float32) (*domain.MemoryUse, error) {
+func (svc *MemoryService) TrackUsage(ctx context.Context, userID, memoryID, convID, msgID string, similarity float32) (*domain.MemoryUse, error) {
 	use := &domain.MemoryUse{
 		ID:             store.NewMemoryUseID(),
+		UserID:         userID,
 		MemoryID:       memoryID,
 		MessageID:      msgID,
 		ConversationID: convID,
@@ -117,19 +185,19 @@ func (svc *MemoryService) GetMemoryUse(ctx context.Context, id string) (*domain.
 	return svc.store.GetMemoryUse(ctx, id)
 }
 
-// GetUsesByMessage returns memory uses for a message.
-func (svc *MemoryService) GetUsesByMessage(ctx context.Context, messageID string) ([]*domain.MemoryUse, error) {
-	return svc.store.GetMemoryUsesByMessage(ctx, messageID)
+// GetUsesByMessage returns the user's memory uses for a message.
+func (svc *MemoryService) GetUsesByMessage(ctx context.Context, messageID, userID string) ([]*domain.MemoryUse, error) {
+	return svc.store.GetMemoryUsesByMessage(ctx, messageID, userID)
 }
 
-// GetUsesByConversation returns memory uses for a conversation.
-func (svc *MemoryService) GetUsesByConversation(ctx context.Context, conversationID string) ([]*domain.MemoryUse, error) {
-	return svc.store.GetMemoryUsesByConversation(ctx, conversationID)
+// GetUsesByConversation returns the user's memory uses for a conversation.
+func (svc *MemoryService) GetUsesByConversation(ctx context.Context, conversationID, userID string) ([]*domain.MemoryUse, error) {
+	return svc.store.GetMemoryUsesByConversation(ctx, conversationID, userID)
 }
 
 // PinMemory pins or unpins a memory.
-func (svc *MemoryService) PinMemory(ctx context.Context, id string, pinned bool) error {
-	mem, err := svc.store.GetMemory(ctx, id)
+func (svc *MemoryService) PinMemory(ctx context.Context, id, userID string, pinned bool) error {
+	mem, err := svc.store.GetMemory(ctx, id, userID)
 	if err != nil {
 		return err
 	}
@@ -138,8 +206,8 @@ func (svc *MemoryService) PinMemory(ctx context.Context, id string, pinned bool)
 }
 
 // ArchiveMemory archives a memory.
-func (svc *MemoryService) ArchiveMemory(ctx context.Context, id string) error {
-	mem, err := svc.store.GetMemory(ctx, id)
+func (svc *MemoryService) ArchiveMemory(ctx context.Context, id, userID string) error {
+	mem, err := svc.store.GetMemory(ctx, id, userID)
 	if err != nil {
 		return err
 	}
@@ -148,8 +216,8 @@ func (svc *MemoryService) ArchiveMemory(ctx context.Context, id string) error {
 }
 
 // SetImportance sets a memory's importance score.
-func (svc *MemoryService) SetImportance(ctx context.Context, id string, importance float32) error {
-	mem, err := svc.store.GetMemory(ctx, id)
+func (svc *MemoryService) SetImportance(ctx context.Context, id, userID string, importance float32) error {
+	mem, err := svc.store.GetMemory(ctx, id, userID)
 	if err != nil {
 		return err
 	}
@@ -158,8 +226,8 @@ func (svc *MemoryService) SetImportance(ctx context.Context, id string, importan
 }
 
 // AddTag adds a tag to a memory.
-func (svc *MemoryService) AddTag(ctx context.Context, id, tag string) error {
-	mem, err := svc.store.GetMemory(ctx, id)
+func (svc *MemoryService) AddTag(ctx context.Context, id, userID, tag string) error {
+	mem, err := svc.store.GetMemory(ctx, id, userID)
 	if err != nil {
 		return err
 	}
@@ -173,8 +241,8 @@ func (svc *MemoryService) AddTag(ctx context.Context, id, tag string) error {
 }
 
 // RemoveTag removes a tag from a memory.
-func (svc *MemoryService) RemoveTag(ctx context.Context, id, tag string) error {
-	mem, err := svc.store.GetMemory(ctx, id)
+func (svc *MemoryService) RemoveTag(ctx context.Context, id, userID, tag string) error {
+	mem, err := svc.store.GetMemory(ctx, id, userID)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,369 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/longregen/alicia/api/domain"
+	"github.com/longregen/alicia/shared/id"
+)
+
+// WebAuthnConfig identifies this server to authenticators. Passkeys are
+// disabled without an RPID.
+type WebAuthnConfig struct {
+	RPID    string   // the site's domain, e.g. alicia.example.com
+	RPName  string   // shown by the authenticator
+	Origins []string // origins the browser may report, e.g. https://alicia.example.com
+}
+
+// COSE algorithm identifiers of the supported passkey signatures.
+const (
+	coseES256 = -7
+	coseEdDSA = -8
+	coseRS256 = -257
+)
+
+const (
+	challengeTTL      = 5 * time.Minute
+	challengeRegister = "register"
+	challengeLogin    = "login"
+)
+
+// PasskeyRegistration is a new credential as the browser reports it. The
+// public key is what AuthenticatorAttestationResponse.getPublicKey()
+// returns, so the attestation object needn't be decoded; attestation isn't
+// verified.
+type PasskeyRegistration struct {
+	ChallengeID        string `json:"challenge_id"`
+	Name               string `json:"name"`
+	CredentialID       string `json:"credential_id"`    // base64url
+	ClientDataJSON     string `json:"client_data_json"` // base64url
+	PublicKey          string `json:"public_key"`       // base64url SubjectPublicKeyInfo
+	PublicKeyAlgorithm int    `json:"public_key_algorithm"`
+}
+
+// PasskeyAssertion is a login signature as the browser reports it.
+type PasskeyAssertion struct {
+	ChallengeID       string `json:"challenge_id"`
+	CredentialID      string `json:"credential_id"`      // base64url
+	ClientDataJSON    string `json:"client_data_json"`   // base64url
+	AuthenticatorData string `json:"authenticator_data"` // base64url
+	Signature         string `json:"signature"`          // base64url
+}
+
+// BeginPasskeyRegistration returns a challenge id and the options for
+// navigator.credentials.create() to register a passkey for the user.
+func (svc *AuthService) BeginPasskeyRegistration(ctx context.Context, userID string) (string, map[string]any, error) {
+	if !svc.PasskeysEnabled() {
+		return "", nil, domain.ErrPasskeysDisabled
+	}
+	user, err := svc.activeUser(ctx, userID)
+	if err != nil {
+		return "", nil, err
+	}
+	existing, err := svc.store.ListPasskeys(ctx, userID)
+	if err != nil {
+		return "", nil, err
+	}
+	challenge, err := svc.newChallenge(ctx, challengeRegister, &userID)
+	if err != nil {
+		return "", nil, err
+	}
+
+	exclude := make([]map[string]any, 0, len(existing))
+	for _, p := range existing {
+		exclude = append(exclude, map[string]any{"type": "public-key", "id": p.ID})
+	}
+	options := map[string]any{
+		"challenge": b64(challenge.Challenge),
+		"rp":        map[string]any{"id": svc.cfg.WebAuthn.RPID, "name": svc.cfg.WebAuthn.RPName},
+		"user": map[string]any{
+			"id":          b64([]byte(user.ID)),
+			"name":        user.Username,
+			"displayName": user.DisplayName,
+		},
+		"pubKeyCredParams": []map[string]any{
+			{"type": "public-key", "alg": coseES256},
+			{"type": "public-key", "alg": coseEdDSA},
+			{"type": "public-key", "alg": coseRS256},
+		},
+		"timeout":            challengeTTL.Milliseconds(),
+		"attestation":        "none",
+		"excludeCredentials": exclude,
+		"authenticatorSelection": map[string]any{
+			"residentKey":      "preferred",
+			"userVerification": "preferred",
+		},
+	}
+	return challenge.ID, options, nil
+}
+
+// FinishPasskeyRegistration checks the browser's response to a registration
+// challenge and stores the passkey.
+func (svc *AuthService) FinishPasskeyRegistration(ctx context.Context, userID string, req PasskeyRegistration) (*domain.Passkey, error) {
+	if !svc.PasskeysEnabled() {
+		return nil, domain.ErrPasskeysDisabled
+	}
+	challenge, err := svc.store.ConsumeAuthChallenge(ctx, req.ChallengeID, challengeRegister)
+	if err != nil {
+		return nil, err
+	}
+	if challenge == nil || challenge.UserID == nil || *challenge.UserID != userID {
+		return nil, fmt.Errorf("%w: unknown or expired challenge", domain.ErrInvalidInput)
+	}
+
+	clientData, err1 := unb64(req.ClientDataJSON)
+	publicKey, err2 := unb64(req.PublicKey)
+	credentialID, err3 := unb64(req.CredentialID)
+	if err := errors.Join(err1, err2, err3); err != nil || len(credentialID) == 0 {
+		return nil, fmt.Errorf("%w: malformed credential", domain.ErrInvalidInput)
+	}
+	if err := verifyClientData(clientData, "webauthn.create", challenge.Challenge, svc.cfg.WebAuthn.Origins); err != nil {
+		return nil, fmt.Errorf("%w: %v", domain.ErrInvalidInput, err)
+	}
+	if _, err := parsePasskeyKey(publicKey, req.PublicKeyAlgorithm); err != nil {
+		return nil, fmt.Errorf("%w: %v", domain.ErrInvalidInput, err)
+	}
+
+	passkey := &domain.Passkey{
+		ID:        b64(credentialID),
+		UserID:    userID,
+		Name:      truncate(strings.TrimSpace(req.Name), 200),
+		PublicKey: publicKey,
+		Algorithm: req.PublicKeyAlgorithm,
+		CreatedAt: time.Now().UTC(),
+	}
+	if err := svc.store.CreatePasskey(ctx, passkey); err != nil {
+		return nil, err
+	}
+	return passkey, nil
+}
+
+// BeginPasskeyLogin returns a challenge id and the options for
+// navigator.credentials.get(). Without a username any discoverable passkey
+// may answer.
+func (svc *AuthService) BeginPasskeyLogin(ctx context.Context, username string) (string, map[string]any, error) {
+	if !svc.PasskeysEnabled() {
+		return "", nil, domain.ErrPasskeysDisabled
+	}
+	allow := []map[string]any{}
+	var userID *string
+	if username != "" {
+		user, err := svc.store.GetUserByUsername(ctx, username)
+		if err != nil {
+			return "", nil, err
+		}
+		// An unknown username gets an empty allow list rather than an error,
+		// so usernames can't be probed.
+		if user != nil {
+			userID = &user.ID
+			passkeys, err := svc.store.ListPasskeys(ctx, user.ID)
+			if err != nil {
+				return "", nil, err
+			}
+			for _, p := range passkeys {
+				allow = append(allow, map[string]any{"type": "public-key", "id": p.ID})
+			}
+		}
+	}
+	challenge, err := svc.newChallenge(ctx, challengeLogin, userID)
+	if err != nil {
+		return "", nil, err
+	}
+	options := map[string]any{
+		"challenge":        b64(challenge.Challenge),
+		"rpId":             svc.cfg.WebAuthn.RPID,
+		"timeout":          challengeTTL.Milliseconds(),
+		"allowCredentials": allow,
+		"userVerification": "preferred",
+	}
+	return challenge.ID, options, nil
+}
+
+// FinishPasskeyLogin checks a signed login challenge and starts a session.
+func (svc *AuthService) FinishPasskeyLogin(ctx context.Context, req PasskeyAssertion, userAgent string) (*IssuedSession, error) {
+	if !svc.PasskeysEnabled() {
+		return nil, domain.ErrPasskeysDisabled
+	}
+	challenge, err := svc.store.ConsumeAuthChallenge(ctx, req.ChallengeID, challengeLogin)
+	if err != nil {
+		return nil, err
+	}
+	if challenge == nil {
+		return nil, domain.ErrInvalidCredentials
+	}
+	credentialID, err1 := unb64(req.CredentialID)
+	clientData, err2 := unb64(req.ClientDataJSON)
+	authData, err3 := unb64(req.AuthenticatorData)
+	sig, err4 := unb64(req.Signature)
+	if errors.Join(err1, err2, err3, err4) != nil {
+		return nil, domain.ErrInvalidCredentials
+	}
+
+	passkey, err := svc.store.GetPasskey(ctx, b64(credentialID))
+	if err != nil {
+		return nil, err
+	}
+	if passkey == nil || (challenge.UserID != nil && *challenge.UserID != passkey.UserID) {
+		return nil, domain.ErrInvalidCredentials
+	}
+	if err := verifyClientData(clientData, "webauthn.get", challenge.Challenge, svc.cfg.WebAuthn.Origins); err != nil {
+		return nil, domain.ErrInvalidCredentials
+	}
+	signCount, err := verifyAssertion(passkey, authData, clientData, sig, svc.cfg.WebAuthn.RPID)
+	if err != nil {
+		return nil, domain.ErrInvalidCredentials
+	}
+
+	user, err := svc.activeUser(ctx, passkey.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if err := svc.store.UsePasskey(ctx, passkey.ID, int64(signCount)); err != nil {
+		return nil, err
+	}
+	return svc.issueSession(ctx, user, "passkey", userAgent)
+}
+
+func (svc *AuthService) ListPasskeys(ctx context.Context, userID string) ([]*domain.Passkey, error) {
+	return svc.store.ListPasskeys(ctx, userID)
+}
+
+func (svc *AuthService) DeletePasskey(ctx context.Context, passkeyID, userID string) error {
+	return svc.store.DeletePasskey(ctx, passkeyID, userID)
+}
+
+func (svc *AuthService) newChallenge(ctx context.Context, purpose string, userID *string) (*domain.AuthChallenge, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return nil, fmt.Errorf("generate challenge: %w", err)
+	}
+	c := &domain.AuthChallenge{
+		ID:        id.NewAuthChallenge(),
+		Purpose:   purpose,
+		UserID:    userID,
+		Challenge: b,
+		ExpiresAt: time.Now().Add(challengeTTL),
+	}
+	if err := svc.store.CreateAuthChallenge(ctx, c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// verifyClientData checks the collected client data the browser signed over:
+// that it is for this ceremony, this challenge and one of our origins.
+func verifyClientData(clientDataJSON []byte, ceremony string, challenge []byte, origins []string) error {
+	var cd struct {
+		Type      string `json:"type"`
+		Challenge string `json:"challenge"`
+		Origin    string `json:"origin"`
+	}
+	if err := json.Unmarshal(clientDataJSON, &cd); err != nil {
+		return fmt.Errorf("malformed client data: %w", err)
+	}
+	if cd.Type != ceremony {
+		return fmt.Errorf("client data is for %q, not %q", cd.Type, ceremony)
+	}
+	got, err := unb64(cd.Challenge)
+	if err != nil || !bytes.Equal(got, challenge) {
+		return errors.New("challenge does not match")
+	}
+	if !slices.Contains(origins, cd.Origin) {
+		return fmt.Errorf("origin %q is not allowed", cd.Origin)
+	}
+	return nil
+}
+
+// verifyAssertion checks a passkey's signature over the authenticator data
+// and the client data hash, and returns the authenticator's new signature
+// counter.
+func verifyAssertion(passkey *domain.Passkey, authData, clientDataJSON, sig []byte, rpID string) (uint32, error) {
+	// rpIdHash (32) | flags (1) | signCount (4) | extensions...
+	if len(authData) < 37 {
+		return 0, errors.New("authenticator data too short")
+	}
+	rpIDHash := sha256.Sum256([]byte(rpID))
+	if !bytes.Equal(authData[:32], rpIDHash[:]) {
+		return 0, errors.New("authenticator data is for another relying party")
+	}
+	if authData[32]&0x01 == 0 {
+		return 0, errors.New("user was not present")
+	}
+	signCount := binary.BigEndian.Uint32(authData[33:37])
+	// Authenticators that count must count up; a counter that doesn't may
+	// mean the credential was cloned.
+	if (signCount != 0 || passkey.SignCount != 0) && int64(signCount) <= passkey.SignCount {
+		return 0, errors.New("signature counter did not increase")
+	}
+
+	key, err := parsePasskeyKey(passkey.PublicKey, passkey.Algorithm)
+	if err != nil {
+		return 0, err
+	}
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	signed := append(slices.Clip(authData), clientDataHash[:]...)
+	digest := sha256.Sum256(signed)
+
+	ok := false
+	switch k := key.(type) {
+	case *ecdsa.PublicKey:
+		ok = ecdsa.VerifyASN1(k, digest[:], sig)
+	case *rsa.PublicKey:
+		ok = rsa.VerifyPKCS1v15(k, crypto.SHA256, digest[:], sig) == nil
+	case ed25519.PublicKey:
+		ok = ed25519.Verify(k, signed, sig)
+	}
+	if !ok {
+		return 0, errors.New("bad signature")
+	}
+	return signCount, nil
+}
+
+// parsePasskeyKey parses a SubjectPublicKeyInfo and checks that it suits the
+// COSE algorithm.
+func parsePasskeyKey(der []byte, alg int) (crypto.PublicKey, error) {
+	key, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("malformed public key: %w", err)
+	}
+	switch key.(type) {
+	case *ecdsa.PublicKey:
+		if alg == coseES256 {
+			return key, nil
+		}
+	case *rsa.PublicKey:
+		if alg == coseRS256 {
+			return key, nil
+		}
+	case ed25519.PublicKey:
+		if alg == coseEdDSA {
+			return key, nil
+		}
+	}
+	return nil, fmt.Errorf("unsupported key for algorithm %d", alg)
+}
+
+func b64(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// unb64 decodes base64url, with or without padding.
+func unb64(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+}
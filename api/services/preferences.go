@@ -41,6 +41,8 @@ func DefaultPreferences(userID string) *domain.UserPreferences {
 		ParetoEnableCrossover:    d.ParetoEnableCrossover,
 		NotesSimilarityThreshold: d.NotesSimilarityThreshold,
 		NotesMaxCount:            d.NotesMaxCount,
+		SearchVectorWeight:       d.SearchVectorWeight,
+		SearchKeywordWeight:      d.SearchKeywordWeight,
 		ConfirmDeleteMemory:      d.ConfirmDeleteMemory,
 		ShowRelevanceScores:      d.ShowRelevanceScores,
 		CreatedAt:                now,
@@ -186,12 +186,17 @@ func (svc *ToolService) GetToolUse(ctx context.Context, id string) (*domain.Tool
 	return svc.store.GetToolUse(ctx, id)
 }
 
+// GetToolUseAttachment retrieves a binary part of a tool use's result.
+func (svc *ToolService) GetToolUseAttachment(ctx context.Context, toolUseID, id string) (*domain.ToolUseAttachment, error) {
+	return svc.store.GetToolUseAttachment(ctx, toolUseID, id)
+}
+
 // GetToolUsesByMessage returns tool uses for a message.
 func (svc *ToolService) GetToolUsesByMessage(ctx context.Context, messageID string) ([]*domain.ToolUse, error) {
 	return svc.store.GetToolUsesByMessage(ctx, messageID)
 }
 
-// ListToolUses returns all tool uses with pagination and total count.
-func (svc *ToolService) ListToolUses(ctx context.Context, limit, offset int) ([]*domain.ToolUse, int, error) {
-	return svc.store.ListToolUses(ctx, limit, offset)
+// ListToolUses returns the user's tool uses with pagination and total count.
+func (svc *ToolService) ListToolUses(ctx context.Context, userID string, limit, offset int) ([]*domain.ToolUse, int, error) {
+	return svc.store.ListToolUses(ctx, userID, limit, offset)
 }
@@ -0,0 +1,357 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/longregen/alicia/api/domain"
+	"github.com/longregen/alicia/api/store"
+	"github.com/longregen/alicia/shared/id"
+)
+
+const (
+	// importDuplicateSimilarity is how similar an imported memory must be to
+	// an existing one to be taken for the same memory. It matches the
+	// agent's consolidation of near-duplicates.
+	importDuplicateSimilarity = 0.92
+
+	// importConflictSimilarity is how similar it must be to be reported as
+	// possibly saying the same thing differently, or contradicting it.
+	importConflictSimilarity = 0.8
+)
+
+// ImportOptions control an import.
+type ImportOptions struct {
+	DryRun          bool // report what would be imported without importing it
+	ImportConflicts bool // import records that conflict with existing ones too
+}
+
+// errDryRun rolls back the transaction of a dry run.
+var errDryRun = errors.New("dry run")
+
+// ExportMemories returns all of the user's memories as export records.
+func (svc *MemoryService) ExportMemories(ctx context.Context, userID string, withEmbeddings bool) ([]domain.MemoryRecord, error) {
+	mems, err := svc.store.ExportMemories(ctx, userID, withEmbeddings)
+	if err != nil {
+		return nil, err
+	}
+	records := make([]domain.MemoryRecord, 0, len(mems))
+	for _, m := range mems {
+		records = append(records, domain.MemoryRecord{
+			ID:         m.ID,
+			Content:    m.Content,
+			Tags:       m.Tags,
+			Importance: &m.Importance,
+			Ratings:    m.Ratings,
+			Pinned:     m.Pinned,
+			Archived:   m.Archived,
+			CreatedAt:  &m.CreatedAt,
+			UpdatedAt:  &m.UpdatedAt,
+			Embedding:  recordEmbedding(m.Embedding, m.EmbeddingModel),
+		})
+	}
+	return records, nil
+}
+
+// ImportMemories adds the memories read from r, in the export format, to the
+// user's. A memory that is already there, by content or by similarity, is
+// skipped as a duplicate; one that is close to an existing memory but not
+// close enough is a conflict, reported with the memory it conflicts with
+// and skipped unless opts.ImportConflicts is set. Bad lines are reported
+// and skipped. Nothing is imported if the import fails.
+func (svc *MemoryService) ImportMemories(ctx context.Context, userID string, r io.Reader, opts ImportOptions) (*domain.ImportResult, error) {
+	result := &domain.ImportResult{DryRun: opts.DryRun, Items: []domain.ImportItem{}}
+	err := svc.store.WithTx(ctx, func(ctx context.Context) error {
+		model, dims, err := svc.store.ActiveEmbeddingModel(ctx)
+		if err != nil {
+			return err
+		}
+		err = readRecords(r, func(line int, data []byte) error {
+			var rec domain.MemoryRecord
+			if err := json.Unmarshal(data, &rec); err != nil {
+				result.Add(domain.ImportItem{Line: line, Status: domain.ImportInvalid, Error: err.Error()})
+				return nil
+			}
+			item, err := svc.importMemory(ctx, userID, rec, model, dims, opts)
+			if err != nil {
+				return fmt.Errorf("line %d: %w", line, err)
+			}
+			item.Line = line
+			item.SourceID = rec.ID
+			result.Add(item)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		if opts.DryRun {
+			return errDryRun
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, errDryRun) {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (svc *MemoryService) importMemory(ctx context.Context, userID string, rec domain.MemoryRecord, model string, dims int, opts ImportOptions) (domain.ImportItem, error) {
+	content := strings.TrimSpace(rec.Content)
+	if content == "" {
+		return domain.ImportItem{Status: domain.ImportInvalid, Error: "content is required"}, nil
+	}
+	if err := validateMemoryRecord(rec); err != nil {
+		return domain.ImportItem{Status: domain.ImportInvalid, Error: err.Error()}, nil
+	}
+
+	// Keep the record's embedding only if it can be searched alongside the
+	// stored ones.
+	var embedding []float32
+	var embeddingModel string
+	if e := rec.Embedding; e != nil && e.Model == model && len(e.Vector) == dims && dims > 0 {
+		embedding, embeddingModel = e.Vector, e.Model
+	} else if svc.embedder != nil {
+		var err error
+		if embedding, err = svc.embedder.Embed(ctx, content); err != nil {
+			slog.Warn("embedding generation failed for imported memory", "error", err)
+			embedding = nil
+		}
+	}
+
+	existing, similarity, err := svc.store.FindSimilarMemory(ctx, userID, content, embedding)
+	if err != nil {
+		return domain.ImportItem{}, err
+	}
+	if existing != nil && similarity >= importConflictSimilarity {
+		status := domain.ImportConflict
+		if similarity >= importDuplicateSimilarity {
+			status = domain.ImportDuplicate
+		}
+		if status == domain.ImportDuplicate || !opts.ImportConflicts {
+			return domain.ImportItem{
+				Status:          status,
+				ExistingID:      existing.ID,
+				ExistingContent: existing.Content,
+				Similarity:      similarity,
+			}, nil
+		}
+	}
+
+	now := time.Now().UTC()
+	mem := &domain.Memory{
+		ID:             store.NewMemoryID(),
+		UserID:         userID,
+		Content:        content,
+		Embedding:      embedding,
+		EmbeddingModel: embeddingModel,
+		Importance:     0.5,
+		Ratings:        rec.Ratings,
+		Pinned:         rec.Pinned,
+		Archived:       rec.Archived,
+		Tags:           rec.Tags,
+		CreatedAt:      now,
+		UpdatedAt:      now,
+	}
+	if rec.Importance != nil {
+		mem.Importance = *rec.Importance
+	}
+	if mem.Tags == nil {
+		mem.Tags = []string{}
+	}
+	if rec.CreatedAt != nil {
+		mem.CreatedAt = rec.CreatedAt.UTC()
+		mem.UpdatedAt = mem.CreatedAt
+	}
+	if rec.UpdatedAt != nil {
+		mem.UpdatedAt = rec.UpdatedAt.UTC()
+	}
+	if err := svc.store.CreateMemory(ctx, mem); err != nil {
+		return domain.ImportItem{}, err
+	}
+
+	item := domain.ImportItem{Status: domain.ImportImported, ID: mem.ID}
+	if existing != nil && similarity >= importConflictSimilarity {
+		// A conflict imported on request still reports what it conflicts with.
+		item.ExistingID, item.ExistingContent, item.Similarity = existing.ID, existing.Content, similarity
+	}
+	return item, nil
+}
+
+func validateMemoryRecord(rec domain.MemoryRecord) error {
+	if rec.Importance != nil && (*rec.Importance < 0 || *rec.Importance > 1) {
+		return errors.New("importance must be between 0 and 1")
+	}
+	ratings := []struct {
+		name   string
+		rating *int
+	}{
+		{"importance", rec.Ratings.Importance},
+		{"historical", rec.Ratings.Historical},
+		{"personal", rec.Ratings.Personal},
+		{"factual", rec.Ratings.Factual},
+	}
+	for _, r := range ratings {
+		if r.rating != nil && (*r.rating < 1 || *r.rating > 5) {
+			return fmt.Errorf("%s rating must be between 1 and 5", r.name)
+		}
+	}
+	return nil
+}
+
+// ExportNotes returns all of the user's notes as export records.
+func (svc *NoteService) ExportNotes(ctx context.Context, userID string, withEmbeddings bool) ([]domain.NoteRecord, error) {
+	notes, err := svc.store.ExportNotes(ctx, userID, withEmbeddings)
+	if err != nil {
+		return nil, err
+	}
+	records := make([]domain.NoteRecord, 0, len(notes))
+	for _, n := range notes {
+		records = append(records, domain.NoteRecord{
+			ID:        n.ID,
+			Title:     n.Title,
+			Content:   n.Content,
+			CreatedAt: &n.CreatedAt,
+			UpdatedAt: &n.UpdatedAt,
+			Embedding: recordEmbedding(n.Embedding, n.EmbeddingModel),
+		})
+	}
+	return records, nil
+}
+
+// ImportNotes adds the notes read from r, in the export format, to the
+// user's. A note with the same title and content as an existing one is
+// skipped as a duplicate; one with the same title but other content is a
+// conflict, reported and skipped unless opts.ImportConflicts is set. Bad
+// lines are reported and skipped. Nothing is imported if the import fails.
+func (svc *NoteService) ImportNotes(ctx context.Context, userID string, r io.Reader, opts ImportOptions) (*domain.ImportResult, error) {
+	result := &domain.ImportResult{DryRun: opts.DryRun, Items: []domain.ImportItem{}}
+	err := svc.store.WithTx(ctx, func(ctx context.Context) error {
+		model, dims, err := svc.store.ActiveEmbeddingModel(ctx)
+		if err != nil {
+			return err
+		}
+		err = readRecords(r, func(line int, data []byte) error {
+			var rec domain.NoteRecord
+			if err := json.Unmarshal(data, &rec); err != nil {
+				result.Add(domain.ImportItem{Line: line, Status: domain.ImportInvalid, Error: err.Error()})
+				return nil
+			}
+			item, err := svc.importNote(ctx, userID, rec, model, dims, opts)
+			if err != nil {
+				return fmt.Errorf("line %d: %w", line, err)
+			}
+			item.Line = line
+			item.SourceID = rec.ID
+			result.Add(item)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		if opts.DryRun {
+			return errDryRun
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, errDryRun) {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (svc *NoteService) importNote(ctx context.Context, userID string, rec domain.NoteRecord, model string, dims int, opts ImportOptions) (domain.ImportItem, error) {
+	if strings.TrimSpace(rec.Title) == "" && strings.TrimSpace(rec.Content) == "" {
+		return domain.ImportItem{Status: domain.ImportInvalid, Error: "title or content is required"}, nil
+	}
+
+	sameTitle, err := svc.store.FindNotesByTitle(ctx, userID, rec.Title)
+	if err != nil {
+		return domain.ImportItem{}, err
+	}
+	var conflict *domain.Note
+	for _, n := range sameTitle {
+		if strings.TrimSpace(n.Content) == strings.TrimSpace(rec.Content) {
+			return domain.ImportItem{
+				Status:          domain.ImportDuplicate,
+				ExistingID:      n.ID,
+				ExistingContent: n.Content,
+				Similarity:      1,
+			}, nil
+		}
+		if conflict == nil {
+			conflict = n
+		}
+	}
+	if conflict != nil && !opts.ImportConflicts {
+		return domain.ImportItem{
+			Status:          domain.ImportConflict,
+			ExistingID:      conflict.ID,
+			ExistingContent: conflict.Content,
+		}, nil
+	}
+
+	now := time.Now().UTC()
+	note := &domain.Note{
+		ID:        id.NewNote(),
+		UserID:    userID,
+		Title:     rec.Title,
+		Content:   rec.Content,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if e := rec.Embedding; e != nil && e.Model == model && len(e.Vector) == dims && dims > 0 {
+		note.Embedding, note.EmbeddingModel = e.Vector, e.Model
+	} else {
+		note.Embedding = svc.generateEmbedding(ctx, note.ID, note.Title, note.Content)
+	}
+	if rec.CreatedAt != nil {
+		note.CreatedAt = rec.CreatedAt.UTC()
+		note.UpdatedAt = note.CreatedAt
+	}
+	if rec.UpdatedAt != nil {
+		note.UpdatedAt = rec.UpdatedAt.UTC()
+	}
+	if err := svc.store.CreateNote(ctx, note); err != nil {
+		return domain.ImportItem{}, err
+	}
+
+	item := domain.ImportItem{Status: domain.ImportImported, ID: note.ID}
+	if conflict != nil {
+		item.ExistingID, item.ExistingContent = conflict.ID, conflict.Content
+	}
+	return item, nil
+}
+
+func recordEmbedding(vector []float32, model string) *domain.RecordEmbedding {
+	if len(vector) == 0 || model == "" {
+		return nil
+	}
+	return &domain.RecordEmbedding{Model: model, Vector: vector}
+}
+
+// readRecords calls fn with each non-blank line of r and its 1-based number.
+func readRecords(r io.Reader, fn func(line int, data []byte) error) error {
+	br := bufio.NewReader(r)
+	for line := 1; ; line++ {
+		data, err := br.ReadBytes('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return fmt.Errorf("read line %d: %w", line, err)
+		}
+		if data = bytes.TrimSpace(data); len(data) > 0 {
+			if err := fn(line, data); err != nil {
+				return err
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+	}
+}
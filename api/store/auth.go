@@ -0,0 +1,392 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/longregen/alicia/api/domain"
+)
+
+// touchInterval is how stale last_seen_at and last_used_at may get before a
+// request updates them, to spare a write per request.
+const touchInterval = 5 * time.Minute
+
+// --- Users ---
+
+const userColumns = `id, username, display_name, COALESCE(password_hash, ''), is_admin, created_at, updated_at, disabled_at`
+
+func scanUser(row pgx.Row) (*domain.User, error) {
+	u := &domain.User{}
+	if err := row.Scan(&u.ID, &u.Username, &u.DisplayName, &u.PasswordHash, &u.IsAdmin,
+		&u.CreatedAt, &u.UpdatedAt, &u.DisabledAt); err != nil {
+		return nil, err
+	}
+	u.HasPassword = u.PasswordHash != ""
+	return u, nil
+}
+
+// CreateUser adds a user. The first user created is made an admin, whatever
+// u.IsAdmin says.
+func (s *Store) CreateUser(ctx context.Context, u *domain.User) error {
+	query := `
+		INSERT INTO users (id, username, display_name, password_hash, is_admin, created_at, updated_at)
+		VALUES ($1, $2, $3, NULLIF($4, ''), $5 OR NOT EXISTS (SELECT 1 FROM users), $6, $7)
+		RETURNING is_admin`
+
+	err := s.conn(ctx).QueryRow(ctx, query,
+		u.ID, u.Username, u.DisplayName, u.PasswordHash, u.IsAdmin, u.CreatedAt, u.UpdatedAt).Scan(&u.IsAdmin)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			return domain.ErrUsernameTaken
+		}
+		return fmt.Errorf("create user: %w", err)
+	}
+	u.HasPassword = u.PasswordHash != ""
+	return nil
+}
+
+// LockUsers keeps other transactions from adding users until the current one
+// ends. It must be called within WithTx.
+func (s *Store) LockUsers(ctx context.Context) error {
+	if _, err := s.conn(ctx).Exec(ctx, `LOCK TABLE users IN SHARE ROW EXCLUSIVE MODE`); err != nil {
+		return fmt.Errorf("lock users: %w", err)
+	}
+	return nil
+}
+
+func (s *Store) CountUsers(ctx context.Context) (int, error) {
+	var n int
+	if err := s.conn(ctx).QueryRow(ctx, `SELECT COUNT(*) FROM users`).Scan(&n); err != nil {
+		return 0, fmt.Errorf("count users: %w", err)
+	}
+	return n, nil
+}
+
+func (s *Store) GetUser(ctx context.Context, id string) (*domain.User, error) {
+	u, err := scanUser(s.conn(ctx).QueryRow(ctx, `SELECT `+userColumns+` FROM users WHERE id = $1`, id))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("get user: %w", err)
+	}
+	return u, nil
+}
+
+// GetUserByUsername looks a user up by username, ignoring case.
+func (s *Store) GetUserByUsername(ctx context.Context, username string) (*domain.User, error) {
+	u, err := scanUser(s.conn(ctx).QueryRow(ctx, `SELECT `+userColumns+` FROM users WHERE lower(username) = lower($1)`, username))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("get user by username: %w", err)
+	}
+	return u, nil
+}
+
+func (s *Store) UpdateUserPassword(ctx context.Context, id, passwordHash string) error {
+	tag, err := s.conn(ctx).Exec(ctx,
+		`UPDATE users SET password_hash = $2, updated_at = NOW() WHERE id = $1`, id, passwordHash)
+	if err != nil {
+		return fmt.Errorf("update user password: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return domain.ErrNotFound
+	}
+	return nil
+}
+
+// --- Sessions ---
+
+func (s *Store) CreateSession(ctx context.Context, sess *domain.Session) error {
+	query := `
+		INSERT INTO auth_sessions (id, user_id, method, user_agent, created_at, last_seen_at, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $5, $6)`
+
+	_, err := s.conn(ctx).Exec(ctx, query,
+		sess.ID, sess.UserID, sess.Method, sess.UserAgent, sess.CreatedAt, sess.ExpiresAt)
+	if err != nil {
+		return fmt.Errorf("create session: %w", err)
+	}
+	sess.LastSeenAt = sess.CreatedAt
+	return nil
+}
+
+const sessionColumns = `id, user_id, method, user_agent, created_at, last_seen_at, expires_at, revoked_at`
+
+func scanSession(row pgx.Row) (*domain.Session, error) {
+	sess := &domain.Session{}
+	err := row.Scan(&sess.ID, &sess.UserID, &sess.Method, &sess.UserAgent,
+		&sess.CreatedAt, &sess.LastSeenAt, &sess.ExpiresAt, &sess.RevokedAt)
+	return sess, err
+}
+
+func (s *Store) GetSession(ctx context.Context, id string) (*domain.Session, error) {
+	sess, err := scanSession(s.conn(ctx).QueryRow(ctx, `SELECT `+sessionColumns+` FROM auth_sessions WHERE id = $1`, id))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("get session: %w", err)
+	}
+	return sess, nil
+}
+
+// ListSessions returns the user's sessions that are neither revoked nor
+// expired, newest first.
+func (s *Store) ListSessions(ctx context.Context, userID string) ([]*domain.Session, error) {
+	rows, err := s.conn(ctx).Query(ctx, `
+		SELECT `+sessionColumns+` FROM auth_sessions
+		WHERE user_id = $1 AND revoked_at IS NULL AND expires_at > NOW()
+		ORDER BY created_at DESC`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("list sessions: %w", err)
+	}
+	defer rows.Close()
+
+	var sessions []*domain.Session
+	for rows.Next() {
+		sess, err := scanSession(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan session: %w", err)
+		}
+		sessions = append(sessions, sess)
+	}
+	return sessions, rows.Err()
+}
+
+func (s *Store) TouchSession(ctx context.Context, id string) error {
+	_, err := s.conn(ctx).Exec(ctx, `
+		UPDATE auth_sessions SET last_seen_at = NOW()
+		WHERE id = $1 AND last_seen_at < $2`, id, time.Now().Add(-touchInterval))
+	if err != nil {
+		return fmt.Errorf("touch session: %w", err)
+	}
+	return nil
+}
+
+// RevokeSession revokes one of the user's sessions.
+func (s *Store) RevokeSession(ctx context.Context, id, userID string) error {
+	tag, err := s.conn(ctx).Exec(ctx, `
+		UPDATE auth_sessions SET revoked_at = NOW()
+		WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL`, id, userID)
+	if err != nil {
+		return fmt.Errorf("revoke session: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return domain.ErrNotFound
+	}
+	return nil
+}
+
+// RevokeUserSessions revokes all of the user's sessions except keepID.
+func (s *Store) RevokeUserSessions(ctx context.Context, userID, keepID string) error {
+	_, err := s.conn(ctx).Exec(ctx, `
+		UPDATE auth_sessions SET revoked_at = NOW()
+		WHERE user_id = $1 AND id <> $2 AND revoked_at IS NULL`, userID, keepID)
+	if err != nil {
+		return fmt.Errorf("revoke user sessions: %w", err)
+	}
+	return nil
+}
+
+// --- API keys ---
+
+func (s *Store) CreateAPIKey(ctx context.Context, k *domain.APIKey) error {
+	if k.Scopes == nil {
+		k.Scopes = []string{}
+	}
+	query := `
+		INSERT INTO api_keys (id, kind, user_id, name, key_prefix, key_hash, scopes, created_by, created_at, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`
+
+	_, err := s.conn(ctx).Exec(ctx, query,
+		k.ID, k.Kind, k.UserID, k.Name, k.KeyPrefix, k.KeyHash, k.Scopes, k.CreatedBy, k.CreatedAt, k.ExpiresAt)
+	if err != nil {
+		return fmt.Errorf("create api key: %w", err)
+	}
+	return nil
+}
+
+const apiKeyColumns = `id, kind, user_id, name, key_prefix, key_hash, scopes, created_by, created_at, last_used_at, expires_at, revoked_at`
+
+func scanAPIKey(row pgx.Row) (*domain.APIKey, error) {
+	k := &domain.APIKey{}
+	err := row.Scan(&k.ID, &k.Kind, &k.UserID, &k.Name, &k.KeyPrefix, &k.KeyHash, &k.Scopes,
+		&k.CreatedBy, &k.CreatedAt, &k.LastUsedAt, &k.ExpiresAt, &k.RevokedAt)
+	return k, err
+}
+
+// GetAPIKeyByHash returns the key with the given hash, revoked or not.
+func (s *Store) GetAPIKeyByHash(ctx context.Context, hash string) (*domain.APIKey, error) {
+	k, err := scanAPIKey(s.conn(ctx).QueryRow(ctx, `SELECT `+apiKeyColumns+` FROM api_keys WHERE key_hash = $1`, hash))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("get api key: %w", err)
+	}
+	return k, nil
+}
+
+// ListAPIKeys returns the unrevoked keys of a kind, newest first: a user's
+// device keys, or all service tokens when userID is empty.
+func (s *Store) ListAPIKeys(ctx context.Context, kind, userID string) ([]*domain.APIKey, error) {
+	rows, err := s.conn(ctx).Query(ctx, `
+		SELECT `+apiKeyColumns+` FROM api_keys
+		WHERE kind = $1 AND ($2 = '' OR user_id = $2) AND revoked_at IS NULL
+		ORDER BY created_at DESC`, kind, userID)
+	if err != nil {
+		return nil, fmt.Errorf("list api keys: %w", err)
+	}
+	defer rows.Close()
+
+	var keys []*domain.APIKey
+	for rows.Next() {
+		k, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan api key: %w", err)
+		}
+		keys = append(keys, k)
+	}
+	return keys, rows.Err()
+}
+
+func (s *Store) TouchAPIKey(ctx context.Context, id string) error {
+	_, err := s.conn(ctx).Exec(ctx, `
+		UPDATE api_keys SET last_used_at = NOW()
+		WHERE id = $1 AND (last_used_at IS NULL OR last_used_at < $2)`, id, time.Now().Add(-touchInterval))
+	if err != nil {
+		return fmt.Errorf("touch api key: %w", err)
+	}
+	return nil
+}
+
+// RevokeAPIKey revokes a key of a kind; for device keys, only the user's own.
+func (s *Store) RevokeAPIKey(ctx context.Context, id, kind, userID string) error {
+	tag, err := s.conn(ctx).Exec(ctx, `
+		UPDATE api_keys SET revoked_at = NOW()
+		WHERE id = $1 AND kind = $2 AND ($3 = '' OR user_id = $3) AND revoked_at IS NULL`, id, kind, userID)
+	if err != nil {
+		return fmt.Errorf("revoke api key: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return domain.ErrNotFound
+	}
+	return nil
+}
+
+// --- Passkeys ---
+
+func (s *Store) CreatePasskey(ctx context.Context, p *domain.Passkey) error {
+	query := `
+		INSERT INTO passkeys (id, user_id, name, public_key, algorithm, sign_count, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)`
+
+	_, err := s.conn(ctx).Exec(ctx, query,
+		p.ID, p.UserID, p.Name, p.PublicKey, p.Algorithm, p.SignCount, p.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("create passkey: %w", err)
+	}
+	return nil
+}
+
+const passkeyColumns = `id, user_id, name, public_key, algorithm, sign_count, created_at, last_used_at`
+
+func scanPasskey(row pgx.Row) (*domain.Passkey, error) {
+	p := &domain.Passkey{}
+	err := row.Scan(&p.ID, &p.UserID, &p.Name, &p.PublicKey, &p.Algorithm, &p.SignCount, &p.CreatedAt, &p.LastUsedAt)
+	return p, err
+}
+
+func (s *Store) GetPasskey(ctx context.Context, id string) (*domain.Passkey, error) {
+	p, err := scanPasskey(s.conn(ctx).QueryRow(ctx, `SELECT `+passkeyColumns+` FROM passkeys WHERE id = $1`, id))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("get passkey: %w", err)
+	}
+	return p, nil
+}
+
+func (s *Store) ListPasskeys(ctx context.Context, userID string) ([]*domain.Passkey, error) {
+	rows, err := s.conn(ctx).Query(ctx, `SELECT `+passkeyColumns+` FROM passkeys WHERE user_id = $1 ORDER BY created_at`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("list passkeys: %w", err)
+	}
+	defer rows.Close()
+
+	var passkeys []*domain.Passkey
+	for rows.Next() {
+		p, err := scanPasskey(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan passkey: %w", err)
+		}
+		passkeys = append(passkeys, p)
+	}
+	return passkeys, rows.Err()
+}
+
+// UsePasskey records a login with the passkey and its new signature counter.
+func (s *Store) UsePasskey(ctx context.Context, id string, signCount int64) error {
+	_, err := s.conn(ctx).Exec(ctx,
+		`UPDATE passkeys SET sign_count = $2, last_used_at = NOW() WHERE id = $1`, id, signCount)
+	if err != nil {
+		return fmt.Errorf("use passkey: %w", err)
+	}
+	return nil
+}
+
+func (s *Store) DeletePasskey(ctx context.Context, id, userID string) error {
+	tag, err := s.conn(ctx).Exec(ctx, `DELETE FROM passkeys WHERE id = $1 AND user_id = $2`, id, userID)
+	if err != nil {
+		return fmt.Errorf("delete passkey: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return domain.ErrNotFound
+	}
+	return nil
+}
+
+// --- WebAuthn challenges ---
+
+// CreateAuthChallenge stores a challenge, clearing out expired ones.
+func (s *Store) CreateAuthChallenge(ctx context.Context, c *domain.AuthChallenge) error {
+	if _, err := s.conn(ctx).Exec(ctx, `DELETE FROM auth_challenges WHERE expires_at < NOW()`); err != nil {
+		return fmt.Errorf("delete expired challenges: %w", err)
+	}
+	_, err := s.conn(ctx).Exec(ctx, `
+		INSERT INTO auth_challenges (id, purpose, user_id, challenge, expires_at)
+		VALUES ($1, $2, $3, $4, $5)`, c.ID, c.Purpose, c.UserID, c.Challenge, c.ExpiresAt)
+	if err != nil {
+		return fmt.Errorf("create auth challenge: %w", err)
+	}
+	return nil
+}
+
+// ConsumeAuthChallenge removes and returns an unexpired challenge for
+// purpose, or nil if there is none, so that each is used at most once.
+func (s *Store) ConsumeAuthChallenge(ctx context.Context, id, purpose string) (*domain.AuthChallenge, error) {
+	c := &domain.AuthChallenge{}
+	err := s.conn(ctx).QueryRow(ctx, `
+		DELETE FROM auth_challenges WHERE id = $1 AND purpose = $2
+		RETURNING id, purpose, user_id, challenge, expires_at`, id, purpose).
+		Scan(&c.ID, &c.Purpose, &c.UserID, &c.Challenge, &c.ExpiresAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("consume auth challenge: %w", err)
+	}
+	if time.Now().After(c.ExpiresAt) {
+		return nil, nil
+	}
+	return c, nil
+}
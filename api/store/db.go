@@ -77,4 +77,8 @@ var (
 	NewMessageFeedbackID   = id.NewMessageFeedback
 	NewToolUseFeedbackID   = id.NewToolUseFeedback
 	NewMemoryUseFeedbackID = id.NewMemoryUseFeedback
+	NewToolUseAttachmentID = id.NewToolUseAttachment
+	NewMemoryVersionID     = id.NewMemoryVersion
+	NewGenerationJobID     = id.NewGenerationJob
+	NewWorkerID            = id.NewWorker
 )
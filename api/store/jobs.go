@@ -0,0 +1,206 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/longregen/alicia/api/domain"
+)
+
+const jobColumns = `id, conversation_id, message_id, envelope, status, COALESCE(worker_id, ''), attempts, max_attempts,
+	lease_expires_at, last_error, created_at, updated_at, finished_at`
+
+func scanJob(row pgx.Row) (*domain.GenerationJob, error) {
+	j := &domain.GenerationJob{}
+	if err := row.Scan(&j.ID, &j.ConversationID, &j.MessageID, &j.Envelope, &j.Status, &j.WorkerID,
+		&j.Attempts, &j.MaxAttempts, &j.LeaseExpiresAt, &j.LastError, &j.CreatedAt, &j.UpdatedAt, &j.FinishedAt); err != nil {
+		return nil, err
+	}
+	return j, nil
+}
+
+func scanJobs(rows pgx.Rows) ([]*domain.GenerationJob, error) {
+	defer rows.Close()
+	var jobs []*domain.GenerationJob
+	for rows.Next() {
+		j, err := scanJob(rows)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, j)
+	}
+	return jobs, rows.Err()
+}
+
+// EnqueueJob adds a job to the queue.
+func (s *Store) EnqueueJob(ctx context.Context, j *domain.GenerationJob) error {
+	if j.MaxAttempts <= 0 {
+		j.MaxAttempts = domain.DefaultJobAttempts
+	}
+	j.Status = domain.JobStatusQueued
+	j.UpdatedAt = j.CreatedAt
+
+	query := `
+		INSERT INTO generation_jobs (id, conversation_id, message_id, envelope, status, max_attempts, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $7)`
+
+	_, err := s.conn(ctx).Exec(ctx, query,
+		j.ID, j.ConversationID, j.MessageID, j.Envelope, j.Status, j.MaxAttempts, j.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("enqueue job: %w", err)
+	}
+	return nil
+}
+
+func (s *Store) GetJob(ctx context.Context, id string) (*domain.GenerationJob, error) {
+	j, err := scanJob(s.conn(ctx).QueryRow(ctx, `SELECT `+jobColumns+` FROM generation_jobs WHERE id = $1`, id))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, domain.ErrNotFound
+		}
+		return nil, fmt.Errorf("get job: %w", err)
+	}
+	return j, nil
+}
+
+// ClaimJob hands the oldest queued job to a worker, leased until leaseUntil.
+// It returns nil when the queue is empty. Concurrent claims never get the
+// same job.
+func (s *Store) ClaimJob(ctx context.Context, workerID string, leaseUntil time.Time) (*domain.GenerationJob, error) {
+	query := `
+		UPDATE generation_jobs
+		SET status = 'claimed', worker_id = $1, attempts = attempts + 1, lease_expires_at = $2, updated_at = $3
+		WHERE id = (
+			SELECT id FROM generation_jobs
+			WHERE status = 'queued'
+			ORDER BY created_at
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING ` + jobColumns
+
+	j, err := scanJob(s.conn(ctx).QueryRow(ctx, query, workerID, leaseUntil, time.Now().UTC()))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("claim job: %w", err)
+	}
+	return j, nil
+}
+
+// StartJob records that a worker has started on a job it claimed. It returns
+// domain.ErrNotFound when the worker no longer holds the job.
+func (s *Store) StartJob(ctx context.Context, id, workerID string) error {
+	query := `
+		UPDATE generation_jobs SET status = 'running', updated_at = $3
+		WHERE id = $1 AND worker_id = $2 AND status IN ('claimed', 'running')`
+
+	result, err := s.conn(ctx).Exec(ctx, query, id, workerID, time.Now().UTC())
+	if err != nil {
+		return fmt.Errorf("start job: %w", err)
+	}
+	if result.RowsAffected() == 0 {
+		return domain.ErrNotFound
+	}
+	return nil
+}
+
+// HeartbeatJobs extends the leases of the jobs a worker is still working on.
+// Jobs it no longer holds are left alone.
+func (s *Store) HeartbeatJobs(ctx context.Context, workerID string, ids []string, leaseUntil time.Time) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	query := `
+		UPDATE generation_jobs SET lease_expires_at = $3, updated_at = $4
+		WHERE id = ANY($1) AND worker_id = $2 AND status IN ('claimed', 'running')`
+
+	if _, err := s.conn(ctx).Exec(ctx, query, ids, workerID, leaseUntil, time.Now().UTC()); err != nil {
+		return fmt.Errorf("heartbeat jobs: %w", err)
+	}
+	return nil
+}
+
+// FinishJob marks a worker's job done or failed. It returns
+// domain.ErrNotFound when the worker no longer holds the job, for instance
+// because its lease ran out and the job went back to the queue.
+func (s *Store) FinishJob(ctx context.Context, id, workerID, status, errMsg string) error {
+	if status != domain.JobStatusDone && status != domain.JobStatusFailed {
+		return fmt.Errorf("finish job: invalid status %q", status)
+	}
+	now := time.Now().UTC()
+	query := `
+		UPDATE generation_jobs
+		SET status = $3, last_error = $4, lease_expires_at = NULL, finished_at = $5, updated_at = $5
+		WHERE id = $1 AND worker_id = $2 AND status IN ('claimed', 'running')`
+
+	result, err := s.conn(ctx).Exec(ctx, query, id, workerID, status, errMsg, now)
+	if err != nil {
+		return fmt.Errorf("finish job: %w", err)
+	}
+	if result.RowsAffected() == 0 {
+		return domain.ErrNotFound
+	}
+	return nil
+}
+
+// ReleaseWorkerJobs takes back every job held by a worker that has gone away.
+// Jobs with attempts left are queued again and the rest fail; both are
+// returned.
+func (s *Store) ReleaseWorkerJobs(ctx context.Context, workerID, reason string) ([]*domain.GenerationJob, error) {
+	jobs, err := s.releaseJobs(ctx, `worker_id = $2`, reason, workerID)
+	if err != nil {
+		return nil, fmt.Errorf("release worker jobs: %w", err)
+	}
+	return jobs, nil
+}
+
+// ReleaseExpiredJobs takes back the jobs whose lease ran out before now, as
+// ReleaseWorkerJobs does.
+func (s *Store) ReleaseExpiredJobs(ctx context.Context, now time.Time) ([]*domain.GenerationJob, error) {
+	jobs, err := s.releaseJobs(ctx, `lease_expires_at < $2`, "lease expired", now)
+	if err != nil {
+		return nil, fmt.Errorf("release expired jobs: %w", err)
+	}
+	return jobs, nil
+}
+
+func (s *Store) releaseJobs(ctx context.Context, cond, reason string, arg any) ([]*domain.GenerationJob, error) {
+	query := `
+		UPDATE generation_jobs SET
+			status = CASE WHEN attempts >= max_attempts THEN 'failed' ELSE 'queued' END,
+			finished_at = CASE WHEN attempts >= max_attempts THEN NOW() END,
+			worker_id = NULL, lease_expires_at = NULL, last_error = $1, updated_at = NOW()
+		WHERE status IN ('claimed', 'running') AND ` + cond + `
+		RETURNING ` + jobColumns
+
+	rows, err := s.conn(ctx).Query(ctx, query, reason, arg)
+	if err != nil {
+		return nil, err
+	}
+	return scanJobs(rows)
+}
+
+// CancelQueuedJobs fails the queued jobs for a message, or for every message
+// in the conversation when messageID is empty, so no worker picks them up. It
+// returns the jobs it cancelled.
+func (s *Store) CancelQueuedJobs(ctx context.Context, convID, messageID string) ([]*domain.GenerationJob, error) {
+	query := `
+		UPDATE generation_jobs SET status = 'failed', last_error = 'cancelled', finished_at = $3, updated_at = $3
+		WHERE conversation_id = $1 AND ($2 = '' OR message_id = $2) AND status = 'queued'
+		RETURNING ` + jobColumns
+
+	rows, err := s.conn(ctx).Query(ctx, query, convID, messageID, time.Now().UTC())
+	if err != nil {
+		return nil, fmt.Errorf("cancel queued jobs: %w", err)
+	}
+	jobs, err := scanJobs(rows)
+	if err != nil {
+		return nil, fmt.Errorf("cancel queued jobs: %w", err)
+	}
+	return jobs, nil
+}
@@ -13,13 +13,15 @@ import (
 // CreateMCPServer inserts a new MCP server.
 func (s *Store) CreateMCPServer(ctx context.Context, server *domain.MCPServer) error {
 	query := `
-		INSERT INTO mcp_servers (id, name, transport_type, command, args, url, enabled, created_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`
+		INSERT INTO mcp_servers (id, name, transport_type, command, args, url, headers,
+			timeout_seconds, max_result_bytes, result_policy, approval_policy, tool_limits, enabled, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)`
 
 	_, err := s.conn(ctx).Exec(ctx, query,
 		server.ID, server.Name, server.TransportType,
-		server.Command, server.Args, server.URL,
-		server.Enabled, server.CreatedAt)
+		server.Command, server.Args, server.URL, headersOrEmpty(server.Headers),
+		server.TimeoutSeconds, server.MaxResultBytes, server.ResultPolicy, server.ApprovalPolicy,
+		toolLimitsOrEmpty(server.ToolLimits), server.Enabled, server.CreatedAt)
 	if err != nil {
 		return fmt.Errorf("create mcp server: %w", err)
 	}
@@ -29,15 +31,11 @@ func (s *Store) CreateMCPServer(ctx context.Context, server *domain.MCPServer) e
 // GetMCPServer retrieves an MCP server by ID.
 func (s *Store) GetMCPServer(ctx context.Context, id string) (*domain.MCPServer, error) {
 	query := `
-		SELECT id, name, transport_type, command, args, url, enabled, created_at
+		SELECT ` + mcpServerColumns + `
 		FROM mcp_servers
 		WHERE id = $1 AND deleted_at IS NULL`
 
-	server := &domain.MCPServer{}
-	err := s.conn(ctx).QueryRow(ctx, query, id).Scan(
-		&server.ID, &server.Name, &server.TransportType,
-		&server.Command, &server.Args, &server.URL,
-		&server.Enabled, &server.CreatedAt)
+	server, err := scanMCPServer(s.conn(ctx).QueryRow(ctx, query, id))
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			return nil, domain.ErrNotFound
@@ -50,15 +48,11 @@ func (s *Store) GetMCPServer(ctx context.Context, id string) (*domain.MCPServer,
 // GetMCPServerByName retrieves an MCP server by name.
 func (s *Store) GetMCPServerByName(ctx context.Context, name string) (*domain.MCPServer, error) {
 	query := `
-		SELECT id, name, transport_type, command, args, url, enabled, created_at
+		SELECT ` + mcpServerColumns + `
 		FROM mcp_servers
 		WHERE name = $1 AND deleted_at IS NULL`
 
-	server := &domain.MCPServer{}
-	err := s.conn(ctx).QueryRow(ctx, query, name).Scan(
-		&server.ID, &server.Name, &server.TransportType,
-		&server.Command, &server.Args, &server.URL,
-		&server.Enabled, &server.CreatedAt)
+	server, err := scanMCPServer(s.conn(ctx).QueryRow(ctx, query, name))
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			return nil, domain.ErrNotFound
@@ -72,18 +66,53 @@ func (s *Store) GetMCPServerByName(ctx context.Context, name string) (*domain.MC
 func (s *Store) UpdateMCPServer(ctx context.Context, server *domain.MCPServer) error {
 	query := `
 		UPDATE mcp_servers
-		SET transport_type = $2, command = $3, args = $4, url = $5, enabled = $6
+		SET transport_type = $2, command = $3, args = $4, url = $5, headers = $6,
+			timeout_seconds = $7, max_result_bytes = $8, result_policy = $9, approval_policy = $10,
+			tool_limits = $11, enabled = $12
 		WHERE id = $1 AND deleted_at IS NULL`
 
 	_, err := s.conn(ctx).Exec(ctx, query,
 		server.ID, server.TransportType,
-		server.Command, server.Args, server.URL, server.Enabled)
+		server.Command, server.Args, server.URL, headersOrEmpty(server.Headers),
+		server.TimeoutSeconds, server.MaxResultBytes, server.ResultPolicy, server.ApprovalPolicy,
+		toolLimitsOrEmpty(server.ToolLimits), server.Enabled)
 	if err != nil {
 		return fmt.Errorf("update mcp server: %w", err)
 	}
 	return nil
 }
 
+const mcpServerColumns = `id, name, transport_type, command, args, url, headers,
+			timeout_seconds, max_result_bytes, result_policy, approval_policy, tool_limits, enabled, created_at`
+
+func scanMCPServer(row pgx.Row) (*domain.MCPServer, error) {
+	server := &domain.MCPServer{}
+	err := row.Scan(
+		&server.ID, &server.Name, &server.TransportType,
+		&server.Command, &server.Args, &server.URL, &server.Headers,
+		&server.TimeoutSeconds, &server.MaxResultBytes, &server.ResultPolicy, &server.ApprovalPolicy, &server.ToolLimits,
+		&server.Enabled, &server.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return server, nil
+}
+
+// headersOrEmpty keeps a nil map from being stored as JSON null.
+func headersOrEmpty(h map[string]string) map[string]string {
+	if h == nil {
+		return map[string]string{}
+	}
+	return h
+}
+
+func toolLimitsOrEmpty(l map[string]domain.MCPToolLimits) map[string]domain.MCPToolLimits {
+	if l == nil {
+		return map[string]domain.MCPToolLimits{}
+	}
+	return l
+}
+
 // DeleteMCPServer soft-deletes an MCP server.
 func (s *Store) DeleteMCPServer(ctx context.Context, id string) error {
 	query := `UPDATE mcp_servers SET deleted_at = $2 WHERE id = $1 AND deleted_at IS NULL`
@@ -113,7 +142,7 @@ func (s *Store) DeleteMCPServerByName(ctx context.Context, name string) error {
 // ListMCPServers returns all active MCP servers.
 func (s *Store) ListMCPServers(ctx context.Context) ([]*domain.MCPServer, error) {
 	query := `
-		SELECT id, name, transport_type, command, args, url, enabled, created_at
+		SELECT ` + mcpServerColumns + `
 		FROM mcp_servers
 		WHERE deleted_at IS NULL
 		ORDER BY name`
@@ -126,11 +155,8 @@ func (s *Store) ListMCPServers(ctx context.Context) ([]*domain.MCPServer, error)
 
 	var servers []*domain.MCPServer
 	for rows.Next() {
-		server := &domain.MCPServer{}
-		if err := rows.Scan(
-			&server.ID, &server.Name, &server.TransportType,
-			&server.Command, &server.Args, &server.URL,
-			&server.Enabled, &server.CreatedAt); err != nil {
+		server, err := scanMCPServer(rows)
+		if err != nil {
 			return nil, fmt.Errorf("scan mcp server: %w", err)
 		}
 		servers = append(servers, server)
@@ -141,7 +167,7 @@ func (s *Store) ListMCPServers(ctx context.Context) ([]*domain.MCPServer, error)
 // ListEnabledMCPServers returns all enabled MCP servers.
 func (s *Store) ListEnabledMCPServers(ctx context.Context) ([]*domain.MCPServer, error) {
 	query := `
-		SELECT id, name, transport_type, command, args, url, enabled, created_at
+		SELECT ` + mcpServerColumns + `
 		FROM mcp_servers
 		WHERE deleted_at IS NULL AND enabled = true
 		ORDER BY name`
@@ -154,11 +180,8 @@ func (s *Store) ListEnabledMCPServers(ctx context.Context) ([]*domain.MCPServer,
 
 	var servers []*domain.MCPServer
 	for rows.Next() {
-		server := &domain.MCPServer{}
-		if err := rows.Scan(
-			&server.ID, &server.Name, &server.TransportType,
-			&server.Command, &server.Args, &server.URL,
-			&server.Enabled, &server.CreatedAt); err != nil {
+		server, err := scanMCPServer(rows)
+		if err != nil {
 			return nil, fmt.Errorf("scan mcp server: %w", err)
 		}
 		servers = append(servers, server)
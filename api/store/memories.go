@@ -4,20 +4,30 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"sort"
 	"time"
 
 	"github.com/jackc/pgx/v5"
 	"github.com/longregen/alicia/api/domain"
+	"github.com/longregen/alicia/shared/search"
+	pgvector "github.com/pgvector/pgvector-go"
 )
 
+// searchCandidateFactor sets how many memories each ranking of a hybrid
+// search fetches per result, so that fusion has something to choose from.
+const searchCandidateFactor = 3
+
 // CreateMemory inserts a new memory.
 func (s *Store) CreateMemory(ctx context.Context, mem *domain.Memory) error {
 	query := `
-		INSERT INTO memories (id, content, embedding, importance, pinned, archived, source_msg_id, tags, created_at, updated_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`
+		INSERT INTO memories (id, user_id, content, embedding, embedding_model, importance,
+			importance_rating, historical_rating, personal_rating, factual_rating,
+			pinned, archived, source_msg_id, tags, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, NULLIF($5, ''), $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16)`
 
 	_, err := s.conn(ctx).Exec(ctx, query,
-		mem.ID, mem.Content, mem.Embedding, mem.Importance,
+		mem.ID, mem.UserID, mem.Content, mem.Embedding, mem.EmbeddingModel, mem.Importance,
+		mem.Ratings.Importance, mem.Ratings.Historical, mem.Ratings.Personal, mem.Ratings.Factual,
 		mem.Pinned, mem.Archived, mem.SourceMsgID, mem.Tags,
 		mem.CreatedAt, mem.UpdatedAt)
 	if err != nil {
@@ -26,17 +36,20 @@ func (s *Store) CreateMemory(ctx context.Context, mem *domain.Memory) error {
 	return nil
 }
 
-// GetMemory retrieves a memory by ID.
-func (s *Store) GetMemory(ctx context.Context, id string) (*domain.Memory, error) {
+// GetMemory retrieves a memory by ID, scoped to its owner.
+func (s *Store) GetMemory(ctx context.Context, id, userID string) (*domain.Memory, error) {
 	query := `
-		SELECT id, content, importance, pinned, archived, source_msg_id, tags, created_at, updated_at
+		SELECT id, user_id, content, importance,
+			importance_rating, historical_rating, personal_rating, factual_rating,
+			version, pinned, archived, superseded_by, source_msg_id, tags, created_at, updated_at
 		FROM memories
-		WHERE id = $1 AND deleted_at IS NULL`
+		WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL`
 
 	mem := &domain.Memory{}
-	err := s.conn(ctx).QueryRow(ctx, query, id).Scan(
-		&mem.ID, &mem.Content, &mem.Importance,
-		&mem.Pinned, &mem.Archived, &mem.SourceMsgID, &mem.Tags,
+	err := s.conn(ctx).QueryRow(ctx, query, id, userID).Scan(
+		&mem.ID, &mem.UserID, &mem.Content, &mem.Importance,
+		&mem.Ratings.Importance, &mem.Ratings.Historical, &mem.Ratings.Personal, &mem.Ratings.Factual,
+		&mem.Version, &mem.Pinned, &mem.Archived, &mem.SupersededBy, &mem.SourceMsgID, &mem.Tags,
 		&mem.CreatedAt, &mem.UpdatedAt)
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
@@ -47,27 +60,69 @@ func (s *Store) GetMemory(ctx context.Context, id string) (*domain.Memory, error
 	return mem, nil
 }
 
-// UpdateMemory updates a memory.
+// UpdateMemory updates a memory. A change of content keeps the old content
+// in memory_versions and bumps the version.
 func (s *Store) UpdateMemory(ctx context.Context, mem *domain.Memory) error {
 	query := `
-		UPDATE memories
-		SET content = $2, importance = $3, pinned = $4, archived = $5, tags = $6, updated_at = $7
-		WHERE id = $1 AND deleted_at IS NULL`
+		WITH old AS (
+			SELECT id, content, version FROM memories
+			WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL
+			FOR UPDATE
+		), saved AS (
+			INSERT INTO memory_versions (id, memory_id, version, content, change, created_at)
+			SELECT $9, id, version, content, 'edit', $8 FROM old WHERE content <> $3
+		)
+		UPDATE memories m
+		SET content = $3, importance = $4, pinned = $5, archived = $6, tags = $7, updated_at = $8,
+			version = CASE WHEN old.content <> $3 THEN old.version + 1 ELSE old.version END
+		FROM old
+		WHERE m.id = old.id
+		RETURNING m.version`
 
 	mem.UpdatedAt = time.Now().UTC()
-	_, err := s.conn(ctx).Exec(ctx, query,
-		mem.ID, mem.Content, mem.Importance,
-		mem.Pinned, mem.Archived, mem.Tags, mem.UpdatedAt)
+	err := s.conn(ctx).QueryRow(ctx, query,
+		mem.ID, mem.UserID, mem.Content, mem.Importance,
+		mem.Pinned, mem.Archived, mem.Tags, mem.UpdatedAt, NewMemoryVersionID()).Scan(&mem.Version)
 	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return domain.ErrNotFound
+		}
 		return fmt.Errorf("update memory: %w", err)
 	}
 	return nil
 }
 
+// ListMemoryVersions returns the earlier contents of the user's memory,
+// oldest first.
+func (s *Store) ListMemoryVersions(ctx context.Context, memoryID, userID string) ([]*domain.MemoryVersion, error) {
+	query := `
+		SELECT v.id, v.memory_id, v.version, v.content, v.change, v.generation_id, v.created_at
+		FROM memory_versions v
+		JOIN memories m ON m.id = v.memory_id
+		WHERE v.memory_id = $1 AND m.user_id = $2
+		ORDER BY v.version`
+
+	rows, err := s.conn(ctx).Query(ctx, query, memoryID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("list memory versions: %w", err)
+	}
+	defer rows.Close()
+
+	var versions []*domain.MemoryVersion
+	for rows.Next() {
+		v := &domain.MemoryVersion{}
+		if err := rows.Scan(&v.ID, &v.MemoryID, &v.Version, &v.Content, &v.Change, &v.GenerationID, &v.CreatedAt); err != nil {
+			return nil, fmt.Errorf("scan memory version: %w", err)
+		}
+		versions = append(versions, v)
+	}
+	return versions, rows.Err()
+}
+
 // DeleteMemory soft-deletes a memory with optional reason.
-func (s *Store) DeleteMemory(ctx context.Context, id string, reason *string) error {
-	query := `UPDATE memories SET deleted_at = $2, deleted_reason = $3 WHERE id = $1 AND deleted_at IS NULL`
-	result, err := s.conn(ctx).Exec(ctx, query, id, time.Now().UTC(), reason)
+func (s *Store) DeleteMemory(ctx context.Context, id, userID string, reason *string) error {
+	query := `UPDATE memories SET deleted_at = $3, deleted_reason = $4 WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL`
+	result, err := s.conn(ctx).Exec(ctx, query, id, userID, time.Now().UTC(), reason)
 	if err != nil {
 		return fmt.Errorf("delete memory: %w", err)
 	}
@@ -77,23 +132,25 @@ func (s *Store) DeleteMemory(ctx context.Context, id string, reason *string) err
 	return nil
 }
 
-// ListMemories returns all non-archived memories with total count.
-func (s *Store) ListMemories(ctx context.Context, limit, offset int) ([]*domain.Memory, int, error) {
+// ListMemories returns the user's non-archived memories with total count.
+func (s *Store) ListMemories(ctx context.Context, userID string, limit, offset int) ([]*domain.Memory, int, error) {
 	// Get total count
-	countQuery := `SELECT COUNT(*) FROM memories WHERE deleted_at IS NULL AND archived = false`
+	countQuery := `SELECT COUNT(*) FROM memories WHERE user_id = $1 AND deleted_at IS NULL AND archived = false`
 	var total int
-	if err := s.conn(ctx).QueryRow(ctx, countQuery).Scan(&total); err != nil {
+	if err := s.conn(ctx).QueryRow(ctx, countQuery, userID).Scan(&total); err != nil {
 		return nil, 0, fmt.Errorf("count memories: %w", err)
 	}
 
 	query := `
-		SELECT id, content, importance, pinned, archived, source_msg_id, tags, created_at, updated_at
+		SELECT id, user_id, content, importance,
+			importance_rating, historical_rating, personal_rating, factual_rating,
+			version, pinned, archived, superseded_by, source_msg_id, tags, created_at, updated_at
 		FROM memories
-		WHERE deleted_at IS NULL AND archived = false
+		WHERE user_id = $1 AND deleted_at IS NULL AND archived = false
 		ORDER BY importance DESC, created_at DESC
-		LIMIT $1 OFFSET $2`
+		LIMIT $2 OFFSET $3`
 
-	rows, err := s.conn(ctx).Query(ctx, query, limit, offset)
+	rows, err := s.conn(ctx).Query(ctx, query, userID, limit, offset)
 	if err != nil {
 		return nil, 0, fmt.Errorf("list memories: %w", err)
 	}
@@ -106,35 +163,89 @@ func (s *Store) ListMemories(ctx context.Context, limit, offset int) ([]*domain.
 	return mems, total, nil
 }
 
-// SearchMemories searches memories by embedding similarity.
-func (s *Store) SearchMemories(ctx context.Context, embedding []float32, limit int, threshold float32) ([]*domain.Memory, error) {
-	query := `
-		SELECT id, content, importance, pinned, archived, source_msg_id, tags, created_at, updated_at
-		FROM memories
-		WHERE deleted_at IS NULL AND archived = false
-		  AND embedding <=> $1 < $3
-		ORDER BY embedding <=> $1
-		LIMIT $2`
+// SearchMemories returns up to limit of the user's memories that best match
+// query by hybrid search: memories at least threshold similar to embedding
+// and memories matching the words of query are ranked separately and the
+// two rankings fused with weights. Each result carries its fused relevance.
+// A nil embedding searches by keyword only.
+func (s *Store) SearchMemories(ctx context.Context, userID, query string, embedding []float32, limit int, threshold float32, weights search.Weights) ([]*domain.Memory, error) {
+	var vec *pgvector.Vector
+	if len(embedding) > 0 {
+		v := pgvector.NewVector(embedding)
+		vec = &v
+	}
+	sql := `
+		WITH by_vector AS (
+			SELECT id, row_number() OVER (ORDER BY embedding <=> $1) AS rank
+			FROM memories
+			WHERE user_id = $2 AND deleted_at IS NULL AND archived = false
+			  AND $1::vector IS NOT NULL AND embedding IS NOT NULL
+			  AND 1 - (embedding <=> $1) >= $3
+			ORDER BY embedding <=> $1
+			LIMIT $4
+		), by_keyword AS (
+			SELECT id, row_number() OVER (ORDER BY ts_rank_cd(search_vector, q) DESC) AS rank
+			FROM memories, to_tsquery('english', $5) q
+			WHERE user_id = $2 AND deleted_at IS NULL AND archived = false
+			  AND search_vector @@ q
+			ORDER BY ts_rank_cd(search_vector, q) DESC
+			LIMIT $4
+		)
+		SELECT m.id, m.user_id, m.content, m.importance,
+			m.importance_rating, m.historical_rating, m.personal_rating, m.factual_rating,
+			m.version, m.pinned, m.archived, m.superseded_by, m.source_msg_id, m.tags, m.created_at, m.updated_at,
+			COALESCE(v.rank, 0), COALESCE(k.rank, 0)
+		FROM memories m
+		LEFT JOIN by_vector v ON v.id = m.id
+		LEFT JOIN by_keyword k ON k.id = m.id
+		WHERE v.id IS NOT NULL OR k.id IS NOT NULL`
 
-	rows, err := s.conn(ctx).Query(ctx, query, embedding, limit, 1-threshold)
+	rows, err := s.conn(ctx).Query(ctx, sql, vec, userID, threshold, limit*searchCandidateFactor, search.Query(query))
 	if err != nil {
 		return nil, fmt.Errorf("search memories: %w", err)
 	}
 	defer rows.Close()
 
-	return scanMemories(rows)
+	var mems []*domain.Memory
+	for rows.Next() {
+		mem := &domain.Memory{}
+		var vectorRank, keywordRank int
+		if err := rows.Scan(
+			&mem.ID, &mem.UserID, &mem.Content, &mem.Importance,
+			&mem.Ratings.Importance, &mem.Ratings.Historical, &mem.Ratings.Personal, &mem.Ratings.Factual,
+			&mem.Version, &mem.Pinned, &mem.Archived, &mem.SupersededBy, &mem.SourceMsgID, &mem.Tags,
+			&mem.CreatedAt, &mem.UpdatedAt, &vectorRank, &keywordRank); err != nil {
+			return nil, fmt.Errorf("scan memory: %w", err)
+		}
+		if weights.Score(vectorRank, keywordRank) == 0 {
+			continue
+		}
+		mem.Relevance = weights.Relevance(vectorRank, keywordRank)
+		mems = append(mems, mem)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("search memories: %w", err)
+	}
+
+	sort.SliceStable(mems, func(i, j int) bool { return mems[i].Relevance > mems[j].Relevance })
+	if len(mems) > limit {
+		mems = mems[:limit]
+	}
+	return mems, nil
 }
 
-// GetMemoriesByTags returns memories matching any of the given tags.
-func (s *Store) GetMemoriesByTags(ctx context.Context, tags []string, limit int) ([]*domain.Memory, error) {
+// GetMemoriesByTags returns the user's memories matching any of the given tags.
+func (s *Store) GetMemoriesByTags(ctx context.Context, userID string, tags []string, limit int) ([]*domain.Memory, error) {
 	query := `
-		SELECT id, content, importance, pinned, archived, source_msg_id, tags, created_at, updated_at
+		SELECT id, user_id, content, importance,
+			importance_rating, historical_rating, personal_rating, factual_rating,
+			version, pinned, archived, superseded_by, source_msg_id, tags, created_at, updated_at
 		FROM memories
-		WHERE deleted_at IS NULL AND archived = false AND tags && $1
+		WHERE user_id = $1 AND deleted_at IS NULL AND archived = false AND tags && $2
 		ORDER BY importance DESC
-		LIMIT $2`
+		LIMIT $3`
 
-	rows, err := s.conn(ctx).Query(ctx, query, tags, limit)
+	rows, err := s.conn(ctx).Query(ctx, query, userID, tags, limit)
 	if err != nil {
 		return nil, fmt.Errorf("get memories by tags: %w", err)
 	}
@@ -148,8 +259,9 @@ func scanMemories(rows pgx.Rows) ([]*domain.Memory, error) {
 	for rows.Next() {
 		mem := &domain.Memory{}
 		if err := rows.Scan(
-			&mem.ID, &mem.Content, &mem.Importance,
-			&mem.Pinned, &mem.Archived, &mem.SourceMsgID, &mem.Tags,
+			&mem.ID, &mem.UserID, &mem.Content, &mem.Importance,
+			&mem.Ratings.Importance, &mem.Ratings.Historical, &mem.Ratings.Personal, &mem.Ratings.Factual,
+			&mem.Version, &mem.Pinned, &mem.Archived, &mem.SupersededBy, &mem.SourceMsgID, &mem.Tags,
 			&mem.CreatedAt, &mem.UpdatedAt); err != nil {
 			return nil, fmt.Errorf("scan memory: %w", err)
 		}
@@ -163,11 +275,11 @@ func scanMemories(rows pgx.Rows) ([]*domain.Memory, error) {
 // CreateMemoryUse records that a memory was retrieved for a message.
 func (s *Store) CreateMemoryUse(ctx context.Context, use *domain.MemoryUse) error {
 	query := `
-		INSERT INTO memory_uses (id, memory_id, message_id, conversation_id, similarity, created_at)
-		VALUES ($1, $2, $3, $4, $5, $6)`
+		INSERT INTO memory_uses (id, user_id, memory_id, message_id, conversation_id, similarity, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)`
 
 	_, err := s.conn(ctx).Exec(ctx, query,
-		use.ID, use.MemoryID, use.MessageID,
+		use.ID, use.UserID, use.MemoryID, use.MessageID,
 		use.ConversationID, use.Similarity, use.CreatedAt)
 	if err != nil {
 		return fmt.Errorf("create memory use: %w", err)
@@ -178,13 +290,13 @@ func (s *Store) CreateMemoryUse(ctx context.Context, use *domain.MemoryUse) erro
 // GetMemoryUse retrieves a memory use by ID.
 func (s *Store) GetMemoryUse(ctx context.Context, id string) (*domain.MemoryUse, error) {
 	query := `
-		SELECT id, memory_id, message_id, conversation_id, similarity, created_at
+		SELECT id, user_id, memory_id, message_id, conversation_id, similarity, created_at
 		FROM memory_uses
 		WHERE id = $1`
 
 	use := &domain.MemoryUse{}
 	err := s.conn(ctx).QueryRow(ctx, query, id).Scan(
-		&use.ID, &use.MemoryID, &use.MessageID,
+		&use.ID, &use.UserID, &use.MemoryID, &use.MessageID,
 		&use.ConversationID, &use.Similarity, &use.CreatedAt)
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
@@ -195,15 +307,15 @@ func (s *Store) GetMemoryUse(ctx context.Context, id string) (*domain.MemoryUse,
 	return use, nil
 }
 
-// GetMemoryUsesByMessage returns memory uses for a message.
-func (s *Store) GetMemoryUsesByMessage(ctx context.Context, messageID string) ([]*domain.MemoryUse, error) {
+// GetMemoryUsesByMessage returns the user's memory uses for a message.
+func (s *Store) GetMemoryUsesByMessage(ctx context.Context, messageID, userID string) ([]*domain.MemoryUse, error) {
 	query := `
-		SELECT id, memory_id, message_id, conversation_id, similarity, created_at
+		SELECT id, user_id, memory_id, message_id, conversation_id, similarity, created_at
 		FROM memory_uses
-		WHERE message_id = $1
+		WHERE message_id = $1 AND user_id = $2
 		ORDER BY similarity DESC`
 
-	rows, err := s.conn(ctx).Query(ctx, query, messageID)
+	rows, err := s.conn(ctx).Query(ctx, query, messageID, userID)
 	if err != nil {
 		return nil, fmt.Errorf("get memory uses: %w", err)
 	}
@@ -212,7 +324,7 @@ func (s *Store) GetMemoryUsesByMessage(ctx context.Context, messageID string) ([
 	var uses []*domain.MemoryUse
 	for rows.Next() {
 		u := &domain.MemoryUse{}
-		if err := rows.Scan(&u.ID, &u.MemoryID, &u.MessageID, &u.ConversationID, &u.Similarity, &u.CreatedAt); err != nil {
+		if err := rows.Scan(&u.ID, &u.UserID, &u.MemoryID, &u.MessageID, &u.ConversationID, &u.Similarity, &u.CreatedAt); err != nil {
 			return nil, fmt.Errorf("scan memory use: %w", err)
 		}
 		uses = append(uses, u)
@@ -220,15 +332,15 @@ func (s *Store) GetMemoryUsesByMessage(ctx context.Context, messageID string) ([
 	return uses, rows.Err()
 }
 
-// GetMemoryUsesByConversation returns memory uses for a conversation.
-func (s *Store) GetMemoryUsesByConversation(ctx context.Context, conversationID string) ([]*domain.MemoryUse, error) {
+// GetMemoryUsesByConversation returns the user's memory uses for a conversation.
+func (s *Store) GetMemoryUsesByConversation(ctx context.Context, conversationID, userID string) ([]*domain.MemoryUse, error) {
 	query := `
-		SELECT id, memory_id, message_id, conversation_id, similarity, created_at
+		SELECT id, user_id, memory_id, message_id, conversation_id, similarity, created_at
 		FROM memory_uses
-		WHERE conversation_id = $1
+		WHERE conversation_id = $1 AND user_id = $2
 		ORDER BY created_at DESC`
 
-	rows, err := s.conn(ctx).Query(ctx, query, conversationID)
+	rows, err := s.conn(ctx).Query(ctx, query, conversationID, userID)
 	if err != nil {
 		return nil, fmt.Errorf("get memory uses: %w", err)
 	}
@@ -237,7 +349,7 @@ func (s *Store) GetMemoryUsesByConversation(ctx context.Context, conversationID
 	var uses []*domain.MemoryUse
 	for rows.Next() {
 		u := &domain.MemoryUse{}
-		if err := rows.Scan(&u.ID, &u.MemoryID, &u.MessageID, &u.ConversationID, &u.Similarity, &u.CreatedAt); err != nil {
+		if err := rows.Scan(&u.ID, &u.UserID, &u.MemoryID, &u.MessageID, &u.ConversationID, &u.Similarity, &u.CreatedAt); err != nil {
 			return nil, fmt.Errorf("scan memory use: %w", err)
 		}
 		uses = append(uses, u)
@@ -13,8 +13,8 @@ import (
 
 func (s *Store) CreateNote(ctx context.Context, note *domain.Note) error {
 	query := `
-		INSERT INTO notes (id, user_id, title, content, embedding, created_at, updated_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7)`
+		INSERT INTO notes (id, user_id, title, content, embedding, embedding_model, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, NULLIF($6, ''), $7, $8)`
 
 	var embedding *pgvector.Vector
 	if len(note.Embedding) > 0 {
@@ -23,7 +23,7 @@ func (s *Store) CreateNote(ctx context.Context, note *domain.Note) error {
 	}
 
 	_, err := s.conn(ctx).Exec(ctx, query,
-		note.ID, note.UserID, note.Title, note.Content, embedding,
+		note.ID, note.UserID, note.Title, note.Content, embedding, note.EmbeddingModel,
 		note.CreatedAt, note.UpdatedAt)
 	if err != nil {
 		return fmt.Errorf("create note: %w", err)
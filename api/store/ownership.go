@@ -0,0 +1,63 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/longregen/alicia/api/domain"
+)
+
+// Resources whose owner is the owner of the conversation they belong to.
+const (
+	ResourceConversation = "conversation"
+	ResourceMessage      = "message"
+	ResourceToolUse      = "tool use"
+	ResourceMemoryUse    = "memory use"
+)
+
+// ownerQueries resolve a resource ID to the ID of the user owning its
+// conversation. Deleted conversations have no owner.
+var ownerQueries = map[string]string{
+	ResourceConversation: `
+		SELECT c.user_id FROM conversations c
+		WHERE c.id = $1 AND c.deleted_at IS NULL`,
+	ResourceMessage: `
+		SELECT c.user_id FROM messages m
+		JOIN conversations c ON c.id = m.conversation_id
+		WHERE m.id = $1 AND c.deleted_at IS NULL`,
+	ResourceToolUse: `
+		SELECT c.user_id FROM tool_uses t
+		JOIN messages m ON m.id = t.message_id
+		JOIN conversations c ON c.id = m.conversation_id
+		WHERE t.id = $1 AND c.deleted_at IS NULL`,
+	ResourceMemoryUse: `
+		SELECT c.user_id FROM memory_uses u
+		JOIN conversations c ON c.id = u.conversation_id
+		WHERE u.id = $1 AND c.deleted_at IS NULL`,
+}
+
+// Authorize checks that the resource belongs to one of the user's
+// conversations. It returns domain.ErrNotFound both when the resource doesn't
+// exist and when it belongs to someone else, so that callers can't tell the
+// two apart.
+func (s *Store) Authorize(ctx context.Context, resource, id, userID string) error {
+	query, ok := ownerQueries[resource]
+	if !ok {
+		return fmt.Errorf("authorize: unknown resource %q", resource)
+	}
+
+	var owner string
+	err := s.conn(ctx).QueryRow(ctx, query, id).Scan(&owner)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return domain.ErrNotFound
+		}
+		return fmt.Errorf("authorize %s: %w", resource, err)
+	}
+	if owner != userID {
+		return domain.ErrNotFound
+	}
+	return nil
+}
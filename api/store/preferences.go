@@ -17,7 +17,7 @@ func (s *Store) GetUserPreferences(ctx context.Context, userID string) (*domain.
 		       memory_min_importance, memory_min_historical, memory_min_personal, memory_min_factual,
 		       memory_retrieval_count, max_tokens, max_tool_iterations, temperature,
 		       pareto_target_score, pareto_max_generations, pareto_branches_per_gen, pareto_archive_size, pareto_enable_crossover,
-		       notes_similarity_threshold, notes_max_count,
+		       notes_similarity_threshold, notes_max_count, search_vector_weight, search_keyword_weight,
 		       confirm_delete_memory, show_relevance_scores,
 		       created_at, updated_at
 		FROM user_preferences
@@ -29,7 +29,7 @@ func (s *Store) GetUserPreferences(ctx context.Context, userID string) (*domain.
 		&prefs.MemoryMinImportance, &prefs.MemoryMinHistorical, &prefs.MemoryMinPersonal, &prefs.MemoryMinFactual,
 		&prefs.MemoryRetrievalCount, &prefs.MaxTokens, &prefs.MaxToolIterations, &prefs.Temperature,
 		&prefs.ParetoTargetScore, &prefs.ParetoMaxGenerations, &prefs.ParetoBranchesPerGen, &prefs.ParetoArchiveSize, &prefs.ParetoEnableCrossover,
-		&prefs.NotesSimilarityThreshold, &prefs.NotesMaxCount,
+		&prefs.NotesSimilarityThreshold, &prefs.NotesMaxCount, &prefs.SearchVectorWeight, &prefs.SearchKeywordWeight,
 		&prefs.ConfirmDeleteMemory, &prefs.ShowRelevanceScores,
 		&prefs.CreatedAt, &prefs.UpdatedAt)
 	if err != nil {
@@ -48,10 +48,10 @@ func (s *Store) UpsertUserPreferences(ctx context.Context, prefs *domain.UserPre
 			memory_min_importance, memory_min_historical, memory_min_personal, memory_min_factual,
 			memory_retrieval_count, max_tokens, max_tool_iterations, temperature,
 			pareto_target_score, pareto_max_generations, pareto_branches_per_gen, pareto_archive_size, pareto_enable_crossover,
-			notes_similarity_threshold, notes_max_count,
+			notes_similarity_threshold, notes_max_count, search_vector_weight, search_keyword_weight,
 			confirm_delete_memory, show_relevance_scores,
 			created_at, updated_at
-		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21, $22, $23)
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21, $22, $23, $24, $25)
 		ON CONFLICT (user_id) DO UPDATE SET
 			theme = EXCLUDED.theme,
 			audio_output_enabled = EXCLUDED.audio_output_enabled,
@@ -71,6 +71,8 @@ func (s *Store) UpsertUserPreferences(ctx context.Context, prefs *domain.UserPre
 			pareto_enable_crossover = EXCLUDED.pareto_enable_crossover,
 			notes_similarity_threshold = EXCLUDED.notes_similarity_threshold,
 			notes_max_count = EXCLUDED.notes_max_count,
+			search_vector_weight = EXCLUDED.search_vector_weight,
+			search_keyword_weight = EXCLUDED.search_keyword_weight,
 			confirm_delete_memory = EXCLUDED.confirm_delete_memory,
 			show_relevance_scores = EXCLUDED.show_relevance_scores,
 			updated_at = EXCLUDED.updated_at`
@@ -86,7 +88,7 @@ func (s *Store) UpsertUserPreferences(ctx context.Context, prefs *domain.UserPre
 		prefs.MemoryMinImportance, prefs.MemoryMinHistorical, prefs.MemoryMinPersonal, prefs.MemoryMinFactual,
 		prefs.MemoryRetrievalCount, prefs.MaxTokens, prefs.MaxToolIterations, prefs.Temperature,
 		prefs.ParetoTargetScore, prefs.ParetoMaxGenerations, prefs.ParetoBranchesPerGen, prefs.ParetoArchiveSize, prefs.ParetoEnableCrossover,
-		prefs.NotesSimilarityThreshold, prefs.NotesMaxCount,
+		prefs.NotesSimilarityThreshold, prefs.NotesMaxCount, prefs.SearchVectorWeight, prefs.SearchKeywordWeight,
 		prefs.ConfirmDeleteMemory, prefs.ShowRelevanceScores,
 		prefs.CreatedAt, prefs.UpdatedAt)
 	if err != nil {
@@ -0,0 +1,129 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/longregen/alicia/api/domain"
+)
+
+// ListMemoryGenerations returns the extractions and memory tool calls that
+// created the user's memory or acted on it, oldest first.
+func (s *Store) ListMemoryGenerations(ctx context.Context, memoryID, userID string) ([]*domain.MemoryGeneration, error) {
+	query := `
+		SELECT g.id, g.conversation_id, g.message_id, g.memory_content,
+			g.extract_prompt_name, g.extract_prompt_version,
+			g.importance_rating, g.importance_thinking, g.importance_prompt_name, g.importance_prompt_version,
+			g.historical_rating, g.historical_thinking, g.historical_prompt_name, g.historical_prompt_version,
+			g.personal_rating, g.personal_thinking, g.personal_prompt_name, g.personal_prompt_version,
+			g.factual_rating, g.factual_thinking, g.factual_prompt_name, g.factual_prompt_version,
+			g.rerank_decision, g.rerank_prompt_name, g.rerank_prompt_version,
+			g.accepted, g.memory_id, g.target_memory_ids, g.source, g.created_at
+		FROM memory_generations g
+		JOIN conversations c ON c.id = g.conversation_id
+		WHERE (g.memory_id = $1 OR $1 = ANY(g.target_memory_ids)) AND c.user_id = $2
+		ORDER BY g.created_at, g.id`
+
+	rows, err := s.conn(ctx).Query(ctx, query, memoryID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("list memory generations: %w", err)
+	}
+	defer rows.Close()
+
+	var gens []*domain.MemoryGeneration
+	for rows.Next() {
+		g := &domain.MemoryGeneration{}
+		if err := rows.Scan(&g.ID, &g.ConversationID, &g.MessageID, &g.MemoryContent,
+			&g.ExtractPromptName, &g.ExtractPromptVersion,
+			&g.Importance.Rating, &g.Importance.Reasoning, &g.Importance.PromptName, &g.Importance.PromptVersion,
+			&g.Historical.Rating, &g.Historical.Reasoning, &g.Historical.PromptName, &g.Historical.PromptVersion,
+			&g.Personal.Rating, &g.Personal.Reasoning, &g.Personal.PromptName, &g.Personal.PromptVersion,
+			&g.Factual.Rating, &g.Factual.Reasoning, &g.Factual.PromptName, &g.Factual.PromptVersion,
+			&g.RerankDecision, &g.RerankPromptName, &g.RerankPromptVersion,
+			&g.Accepted, &g.MemoryID, &g.TargetMemoryIDs, &g.Source, &g.CreatedAt); err != nil {
+			return nil, fmt.Errorf("scan memory generation: %w", err)
+		}
+		gens = append(gens, g)
+	}
+	return gens, rows.Err()
+}
+
+// ListMemoryUseProvenance returns the user's latest limit retrievals of a
+// memory, newest first, each with its message and feedback, and how many
+// retrievals there are in all.
+func (s *Store) ListMemoryUseProvenance(ctx context.Context, memoryID, userID string, limit int) ([]*domain.MemoryUseProvenance, int, error) {
+	countQuery := `SELECT COUNT(*) FROM memory_uses WHERE memory_id = $1 AND user_id = $2`
+	var total int
+	if err := s.conn(ctx).QueryRow(ctx, countQuery, memoryID, userID).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("count memory uses: %w", err)
+	}
+
+	query := `
+		SELECT u.id, u.user_id, u.memory_id, u.message_id, u.conversation_id, u.similarity, u.created_at,
+			m.id, m.conversation_id, m.previous_id, m.branch_index, m.role, m.content, m.reasoning,
+			m.status, m.trace_id, m.created_at
+		FROM memory_uses u
+		LEFT JOIN messages m ON m.id = u.message_id AND m.deleted_at IS NULL
+		WHERE u.memory_id = $1 AND u.user_id = $2
+		ORDER BY u.created_at DESC, u.id
+		LIMIT $3`
+
+	rows, err := s.conn(ctx).Query(ctx, query, memoryID, userID, limit)
+	if err != nil {
+		return nil, 0, fmt.Errorf("list memory uses: %w", err)
+	}
+	defer rows.Close()
+
+	var uses []*domain.MemoryUseProvenance
+	byID := make(map[string]*domain.MemoryUseProvenance)
+	for rows.Next() {
+		u := &domain.MemoryUseProvenance{Feedback: []*domain.MemoryUseFeedback{}}
+		var msgID, convID, role, content, reasoning, status *string
+		var branchIndex *int16
+		var createdAt *time.Time
+		msg := &domain.Message{}
+		if err := rows.Scan(&u.ID, &u.UserID, &u.MemoryID, &u.MessageID, &u.ConversationID, &u.Similarity, &u.CreatedAt,
+			&msgID, &convID, &msg.PreviousID, &branchIndex, &role, &content, &reasoning,
+			&status, &msg.TraceID, &createdAt); err != nil {
+			return nil, 0, fmt.Errorf("scan memory use: %w", err)
+		}
+		if msgID != nil {
+			msg.ID, msg.ConversationID, msg.BranchIndex = *msgID, *convID, *branchIndex
+			msg.Role, msg.Content, msg.Reasoning, msg.Status = *role, *content, *reasoning, *status
+			msg.CreatedAt = *createdAt
+			u.Message = msg
+		}
+		uses = append(uses, u)
+		byID[u.ID] = u
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("list memory uses: %w", err)
+	}
+	if len(uses) == 0 {
+		return uses, total, nil
+	}
+
+	ids := make([]string, 0, len(uses))
+	for _, u := range uses {
+		ids = append(ids, u.ID)
+	}
+	fbRows, err := s.conn(ctx).Query(ctx, `
+		SELECT id, memory_use_id, rating, note, created_at
+		FROM memory_use_feedback
+		WHERE memory_use_id = ANY($1)
+		ORDER BY created_at DESC`, ids)
+	if err != nil {
+		return nil, 0, fmt.Errorf("list memory use feedback: %w", err)
+	}
+	defer fbRows.Close()
+
+	for fbRows.Next() {
+		fb := &domain.MemoryUseFeedback{}
+		if err := fbRows.Scan(&fb.ID, &fb.MemoryUseID, &fb.Rating, &fb.Note, &fb.CreatedAt); err != nil {
+			return nil, 0, fmt.Errorf("scan memory use feedback: %w", err)
+		}
+		byID[fb.MemoryUseID].Feedback = append(byID[fb.MemoryUseID].Feedback, fb)
+	}
+	return uses, total, fbRows.Err()
+}
@@ -3,11 +3,14 @@ package store
 import (
 	"context"
 	"os"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/longregen/alicia/api/domain"
+	"github.com/longregen/alicia/shared/id"
+	"github.com/longregen/alicia/shared/search"
 )
 
 var testStore *Store
@@ -253,10 +256,13 @@ func TestMessages(t *testing.T) {
 
 func TestMemories(t *testing.T) {
 	ctx := context.Background()
+	userID := "test-user-" + NewID("u")
+	otherUserID := "test-user-" + NewID("u")
 
 	// Create memory
 	mem := &domain.Memory{
 		ID:         NewMemoryID(),
+		UserID:     userID,
 		Content:    "User prefers dark mode",
 		Importance: 0.7,
 		Pinned:     false,
@@ -272,14 +278,39 @@ func TestMemories(t *testing.T) {
 	}
 	t.Logf("Created memory: %s", mem.ID)
 
+	// Found by keyword without an embedding, for its owner only
+	results, err := testStore.SearchMemories(ctx, userID, "what mode do I like?", nil, 10, 0.5, search.Weights{Vector: 1, Keyword: 1})
+	if err != nil {
+		t.Fatalf("SearchMemories failed: %v", err)
+	}
+	if len(results) != 1 || results[0].ID != mem.ID || results[0].Relevance <= 0 {
+		t.Errorf("SearchMemories by keyword: got %+v", results)
+	}
+	results, err = testStore.SearchMemories(ctx, otherUserID, "dark mode", nil, 10, 0.5, search.Weights{Vector: 1, Keyword: 1})
+	if err != nil {
+		t.Fatalf("SearchMemories failed: %v", err)
+	}
+	if len(results) != 0 {
+		t.Errorf("SearchMemories results another user's memories: %+v", results)
+	}
+
 	// Get
-	got, err := testStore.GetMemory(ctx, mem.ID)
+	got, err := testStore.GetMemory(ctx, mem.ID, userID)
 	if err != nil {
 		t.Fatalf("GetMemory failed: %v", err)
 	}
 	if got.Content != mem.Content {
 		t.Errorf("Content mismatch: got %q, want %q", got.Content, mem.Content)
 	}
+	if got.UserID != userID {
+		t.Errorf("UserID mismatch: got %q, want %q", got.UserID, userID)
+	}
+
+	// Other users can't see it
+	_, err = testStore.GetMemory(ctx, mem.ID, otherUserID)
+	if err != domain.ErrNotFound {
+		t.Errorf("Expected ErrNotFound for other user, got: %v", err)
+	}
 
 	// Update
 	mem.Importance = 0.9
@@ -289,7 +320,7 @@ func TestMemories(t *testing.T) {
 		t.Fatalf("UpdateMemory failed: %v", err)
 	}
 
-	got, err = testStore.GetMemory(ctx, mem.ID)
+	got, err = testStore.GetMemory(ctx, mem.ID, userID)
 	if err != nil {
 		t.Fatalf("GetMemory after update failed: %v", err)
 	}
@@ -301,14 +332,24 @@ func TestMemories(t *testing.T) {
 	}
 
 	// List
-	mems, total, err := testStore.ListMemories(ctx, 10, 0)
+	mems, total, err := testStore.ListMemories(ctx, userID, 10, 0)
 	if err != nil {
 		t.Fatalf("ListMemories failed: %v", err)
 	}
-	t.Logf("Listed %d memories (total: %d)", len(mems), total)
+	if total != 1 || len(mems) != 1 {
+		t.Errorf("Expected 1 memory for user, got %d (total: %d)", len(mems), total)
+	}
+
+	_, total, err = testStore.ListMemories(ctx, otherUserID, 10, 0)
+	if err != nil {
+		t.Fatalf("ListMemories for other user failed: %v", err)
+	}
+	if total != 0 {
+		t.Errorf("Expected no memories for other user, got %d", total)
+	}
 
 	// Get by tags
-	mems, err = testStore.GetMemoriesByTags(ctx, []string{"preference"}, 10)
+	mems, err = testStore.GetMemoriesByTags(ctx, userID, []string{"preference"}, 10)
 	if err != nil {
 		t.Fatalf("GetMemoriesByTags failed: %v", err)
 	}
@@ -323,19 +364,178 @@ func TestMemories(t *testing.T) {
 		t.Error("Memory not found by tag")
 	}
 
+	mems, err = testStore.GetMemoriesByTags(ctx, otherUserID, []string{"preference"}, 10)
+	if err != nil {
+		t.Fatalf("GetMemoriesByTags for other user failed: %v", err)
+	}
+	if len(mems) != 0 {
+		t.Errorf("Expected no tagged memories for other user, got %d", len(mems))
+	}
+
+	// Content edits keep the previous content as a version
+	oldContent := mem.Content
+	mem.Content = "User prefers light mode"
+	if err := testStore.UpdateMemory(ctx, mem); err != nil {
+		t.Fatalf("UpdateMemory content failed: %v", err)
+	}
+	if mem.Version != 2 {
+		t.Errorf("Expected version 2 after content edit, got %d", mem.Version)
+	}
+	versions, err := testStore.ListMemoryVersions(ctx, mem.ID, userID)
+	if err != nil {
+		t.Fatalf("ListMemoryVersions failed: %v", err)
+	}
+	if len(versions) != 1 || versions[0].Content != oldContent || versions[0].Version != 1 || versions[0].Change != "edit" {
+		t.Errorf("Unexpected versions: %+v", versions)
+	}
+	versions, err = testStore.ListMemoryVersions(ctx, mem.ID, otherUserID)
+	if err != nil {
+		t.Fatalf("ListMemoryVersions for other user failed: %v", err)
+	}
+	if len(versions) != 0 {
+		t.Errorf("Expected no versions for other user, got %d", len(versions))
+	}
+
+	// Export and the duplicate check of imports, for the owner only
+	exported, err := testStore.ExportMemories(ctx, userID, true)
+	if err != nil {
+		t.Fatalf("ExportMemories failed: %v", err)
+	}
+	if len(exported) != 1 || exported[0].ID != mem.ID || exported[0].Content != mem.Content {
+		t.Errorf("Unexpected export: %+v", exported)
+	}
+	exported, err = testStore.ExportMemories(ctx, otherUserID, true)
+	if err != nil {
+		t.Fatalf("ExportMemories for other user failed: %v", err)
+	}
+	if len(exported) != 0 {
+		t.Errorf("Expected no exported memories for other user, got %d", len(exported))
+	}
+	similar, similarity, err := testStore.FindSimilarMemory(ctx, userID, "  user prefers LIGHT mode ", nil)
+	if err != nil {
+		t.Fatalf("FindSimilarMemory failed: %v", err)
+	}
+	if similar == nil || similar.ID != mem.ID || similarity != 1 {
+		t.Errorf("FindSimilarMemory: got %+v, %v", similar, similarity)
+	}
+	similar, _, err = testStore.FindSimilarMemory(ctx, otherUserID, mem.Content, nil)
+	if err != nil {
+		t.Fatalf("FindSimilarMemory for other user failed: %v", err)
+	}
+	if similar != nil {
+		t.Errorf("FindSimilarMemory found another user's memory: %+v", similar)
+	}
+
 	// Delete
 	reason := "test cleanup"
-	err = testStore.DeleteMemory(ctx, mem.ID, &reason)
+	if err := testStore.DeleteMemory(ctx, mem.ID, otherUserID, &reason); err != domain.ErrNotFound {
+		t.Errorf("Expected ErrNotFound deleting as other user, got: %v", err)
+	}
+	err = testStore.DeleteMemory(ctx, mem.ID, userID, &reason)
 	if err != nil {
 		t.Fatalf("DeleteMemory failed: %v", err)
 	}
 
-	_, err = testStore.GetMemory(ctx, mem.ID)
+	_, err = testStore.GetMemory(ctx, mem.ID, userID)
 	if err != domain.ErrNotFound {
 		t.Errorf("Expected ErrNotFound after delete, got: %v", err)
 	}
 }
 
+func TestMemoryProvenance(t *testing.T) {
+	ctx := context.Background()
+	userID := "test-user-" + NewID("u")
+	otherUserID := "test-user-" + NewID("u")
+
+	conv := &domain.Conversation{
+		ID:        NewConversationID(),
+		UserID:    userID,
+		Title:     "Test Provenance",
+		Status:    "active",
+		CreatedAt: time.Now().UTC(),
+		UpdatedAt: time.Now().UTC(),
+	}
+	if err := testStore.CreateConversation(ctx, conv); err != nil {
+		t.Fatalf("CreateConversation failed: %v", err)
+	}
+	msg := &domain.Message{
+		ID:             NewMessageID(),
+		ConversationID: conv.ID,
+		Role:           "assistant",
+		Content:        "You mentioned you live in Lisbon",
+		Status:         domain.MessageStatusCompleted,
+		CreatedAt:      time.Now().UTC(),
+	}
+	if err := testStore.CreateMessage(ctx, msg); err != nil {
+		t.Fatalf("CreateMessage failed: %v", err)
+	}
+
+	mem := &domain.Memory{
+		ID:          NewMemoryID(),
+		UserID:      userID,
+		Content:     "User lives in Lisbon",
+		Importance:  0.6,
+		SourceMsgID: &msg.ID,
+		Tags:        []string{},
+		CreatedAt:   time.Now().UTC(),
+		UpdatedAt:   time.Now().UTC(),
+	}
+	if err := testStore.CreateMemory(ctx, mem); err != nil {
+		t.Fatalf("CreateMemory failed: %v", err)
+	}
+	use := &domain.MemoryUse{
+		ID:             NewMemoryUseID(),
+		UserID:         userID,
+		MemoryID:       mem.ID,
+		MessageID:      msg.ID,
+		ConversationID: conv.ID,
+		Similarity:     0.8,
+		CreatedAt:      time.Now().UTC(),
+	}
+	if err := testStore.CreateMemoryUse(ctx, use); err != nil {
+		t.Fatalf("CreateMemoryUse failed: %v", err)
+	}
+	fb := &domain.MemoryUseFeedback{
+		ID:          NewMemoryUseFeedbackID(),
+		MemoryUseID: use.ID,
+		Rating:      1,
+		CreatedAt:   time.Now().UTC(),
+	}
+	if err := testStore.CreateMemoryUseFeedback(ctx, fb); err != nil {
+		t.Fatalf("CreateMemoryUseFeedback failed: %v", err)
+	}
+
+	uses, total, err := testStore.ListMemoryUseProvenance(ctx, mem.ID, userID, 10)
+	if err != nil {
+		t.Fatalf("ListMemoryUseProvenance failed: %v", err)
+	}
+	if total != 1 || len(uses) != 1 {
+		t.Fatalf("Expected 1 use, got %d (total: %d)", len(uses), total)
+	}
+	if uses[0].Message == nil || uses[0].Message.Content != msg.Content {
+		t.Errorf("Use message not loaded: %+v", uses[0].Message)
+	}
+	if len(uses[0].Feedback) != 1 || uses[0].Feedback[0].ID != fb.ID {
+		t.Errorf("Use feedback not loaded: %+v", uses[0].Feedback)
+	}
+
+	uses, total, err = testStore.ListMemoryUseProvenance(ctx, mem.ID, otherUserID, 10)
+	if err != nil {
+		t.Fatalf("ListMemoryUseProvenance for other user failed: %v", err)
+	}
+	if total != 0 || len(uses) != 0 {
+		t.Errorf("Expected no uses for other user, got %d (total: %d)", len(uses), total)
+	}
+
+	gens, err := testStore.ListMemoryGenerations(ctx, mem.ID, userID)
+	if err != nil {
+		t.Fatalf("ListMemoryGenerations failed: %v", err)
+	}
+	if len(gens) != 0 {
+		t.Errorf("Expected no generations, got %d", len(gens))
+	}
+}
+
 func TestMessageFeedback(t *testing.T) {
 	ctx := context.Background()
 	userID := "test-user-" + NewID("u")
@@ -406,8 +606,13 @@ func TestMCPServers(t *testing.T) {
 		TransportType: "stdio",
 		Command:       "test-command",
 		Args:          []string{"--arg1", "--arg2"},
-		Enabled:       true,
-		CreatedAt:     time.Now().UTC(),
+		MCPToolLimits: domain.MCPToolLimits{TimeoutSeconds: 30, MaxResultBytes: 8000, ApprovalPolicy: domain.MCPApprovalAlways},
+		ToolLimits: map[string]domain.MCPToolLimits{
+			"read":  {MaxResultBytes: 20000, ResultPolicy: domain.MCPResultPolicySummarize},
+			"write": {ApprovalPolicy: domain.MCPApprovalAsk},
+		},
+		Enabled:   true,
+		CreatedAt: time.Now().UTC(),
 	}
 
 	err := testStore.CreateMCPServer(ctx, server)
@@ -424,6 +629,12 @@ func TestMCPServers(t *testing.T) {
 	if got.Command != server.Command {
 		t.Errorf("Command mismatch: got %q, want %q", got.Command, server.Command)
 	}
+	if got.MCPToolLimits != server.MCPToolLimits {
+		t.Errorf("Limits mismatch: got %+v, want %+v", got.MCPToolLimits, server.MCPToolLimits)
+	}
+	if got.ToolLimits["read"] != server.ToolLimits["read"] || got.ToolLimits["write"] != server.ToolLimits["write"] {
+		t.Errorf("Tool limits mismatch: got %+v, want %+v", got.ToolLimits, server.ToolLimits)
+	}
 
 	// Update
 	server.Enabled = false
@@ -519,6 +730,416 @@ func TestTools(t *testing.T) {
 	}
 }
 
+func TestToolUseAttachments(t *testing.T) {
+	ctx := context.Background()
+
+	a := &domain.ToolUseAttachment{
+		ID:        NewToolUseAttachmentID(),
+		ToolUseID: NewToolUseID(),
+		MimeType:  "image/png",
+		Data:      []byte{0x89, 'P', 'N', 'G'},
+		CreatedAt: time.Now().UTC(),
+	}
+	if err := testStore.CreateToolUseAttachment(ctx, a); err != nil {
+		t.Fatalf("CreateToolUseAttachment failed: %v", err)
+	}
+
+	got, err := testStore.GetToolUseAttachment(ctx, a.ToolUseID, a.ID)
+	if err != nil {
+		t.Fatalf("GetToolUseAttachment failed: %v", err)
+	}
+	if got.MimeType != a.MimeType || string(got.Data) != string(a.Data) {
+		t.Errorf("Attachment mismatch: got %s %v, want %s %v", got.MimeType, got.Data, a.MimeType, a.Data)
+	}
+
+	// Attachments are only found through their own tool use
+	if _, err := testStore.GetToolUseAttachment(ctx, NewToolUseID(), a.ID); err != domain.ErrNotFound {
+		t.Errorf("Expected ErrNotFound for another tool use, got %v", err)
+	}
+}
+
+func TestOwnership(t *testing.T) {
+	ctx := context.Background()
+	userID := "test-user-" + NewID("u")
+	otherUserID := "test-user-" + NewID("u")
+
+	conv := &domain.Conversation{
+		ID:        NewConversationID(),
+		UserID:    userID,
+		Title:     "Test Ownership",
+		Status:    "active",
+		CreatedAt: time.Now().UTC(),
+		UpdatedAt: time.Now().UTC(),
+	}
+	if err := testStore.CreateConversation(ctx, conv); err != nil {
+		t.Fatalf("CreateConversation failed: %v", err)
+	}
+	msg := &domain.Message{
+		ID:             NewMessageID(),
+		ConversationID: conv.ID,
+		Role:           "assistant",
+		Content:        "Checking the weather",
+		Status:         domain.MessageStatusCompleted,
+		CreatedAt:      time.Now().UTC(),
+	}
+	if err := testStore.CreateMessage(ctx, msg); err != nil {
+		t.Fatalf("CreateMessage failed: %v", err)
+	}
+	tu := &domain.ToolUse{
+		ID:        NewToolUseID(),
+		MessageID: msg.ID,
+		ToolName:  "weather",
+		Arguments: map[string]any{"city": "Lisbon"},
+		Status:    "success",
+		CreatedAt: time.Now().UTC(),
+	}
+	if err := testStore.CreateToolUse(ctx, tu); err != nil {
+		t.Fatalf("CreateToolUse failed: %v", err)
+	}
+	mem := &domain.Memory{
+		ID:         NewMemoryID(),
+		UserID:     userID,
+		Content:    "User lives in Lisbon",
+		Importance: 0.6,
+		Tags:       []string{},
+		CreatedAt:  time.Now().UTC(),
+		UpdatedAt:  time.Now().UTC(),
+	}
+	if err := testStore.CreateMemory(ctx, mem); err != nil {
+		t.Fatalf("CreateMemory failed: %v", err)
+	}
+	use := &domain.MemoryUse{
+		ID:             NewMemoryUseID(),
+		UserID:         userID,
+		MemoryID:       mem.ID,
+		MessageID:      msg.ID,
+		ConversationID: conv.ID,
+		Similarity:     0.8,
+		CreatedAt:      time.Now().UTC(),
+	}
+	if err := testStore.CreateMemoryUse(ctx, use); err != nil {
+		t.Fatalf("CreateMemoryUse failed: %v", err)
+	}
+
+	resources := map[string]string{
+		ResourceConversation: conv.ID,
+		ResourceMessage:      msg.ID,
+		ResourceToolUse:      tu.ID,
+		ResourceMemoryUse:    use.ID,
+	}
+
+	for resource, id := range resources {
+		if err := testStore.Authorize(ctx, resource, id, userID); err != nil {
+			t.Errorf("Owner denied %s: %v", resource, err)
+		}
+		if err := testStore.Authorize(ctx, resource, id, otherUserID); err != domain.ErrNotFound {
+			t.Errorf("Expected ErrNotFound for another user's %s, got %v", resource, err)
+		}
+		if err := testStore.Authorize(ctx, resource, "missing-"+id, userID); err != domain.ErrNotFound {
+			t.Errorf("Expected ErrNotFound for a missing %s, got %v", resource, err)
+		}
+	}
+
+	if err := testStore.Authorize(ctx, "widget", conv.ID, userID); err == nil || err == domain.ErrNotFound {
+		t.Errorf("Expected an error for an unknown resource, got %v", err)
+	}
+
+	// Tool uses are only listed for their owner
+	uses, total, err := testStore.ListToolUses(ctx, userID, 10, 0)
+	if err != nil {
+		t.Fatalf("ListToolUses failed: %v", err)
+	}
+	if total != 1 || len(uses) != 1 || uses[0].ID != tu.ID {
+		t.Errorf("Expected the owner's 1 tool use, got %d (total: %d)", len(uses), total)
+	}
+	_, total, err = testStore.ListToolUses(ctx, otherUserID, 10, 0)
+	if err != nil {
+		t.Fatalf("ListToolUses failed: %v", err)
+	}
+	if total != 0 {
+		t.Errorf("Expected no tool uses for another user, got %d", total)
+	}
+
+	// Nothing in a deleted conversation belongs to anyone
+	if err := testStore.DeleteConversation(ctx, conv.ID); err != nil {
+		t.Fatalf("DeleteConversation failed: %v", err)
+	}
+	for resource, id := range resources {
+		if err := testStore.Authorize(ctx, resource, id, userID); err != domain.ErrNotFound {
+			t.Errorf("Expected ErrNotFound for a %s in a deleted conversation, got %v", resource, err)
+		}
+	}
+}
+
+func TestGenerationJobs(t *testing.T) {
+	ctx := context.Background()
+	userID := "test-user-" + NewID("u")
+	lease := time.Now().UTC().Add(time.Minute)
+
+	// Leave nothing from earlier runs in the queue.
+	for {
+		j, err := testStore.ClaimJob(ctx, "drain", lease)
+		if err != nil {
+			t.Fatalf("ClaimJob failed: %v", err)
+		}
+		if j == nil {
+			break
+		}
+		testStore.FinishJob(ctx, j.ID, "drain", domain.JobStatusFailed, "drained")
+	}
+
+	conv := &domain.Conversation{
+		ID:        NewConversationID(),
+		UserID:    userID,
+		Title:     "Test Jobs",
+		Status:    "active",
+		CreatedAt: time.Now().UTC(),
+		UpdatedAt: time.Now().UTC(),
+	}
+	if err := testStore.CreateConversation(ctx, conv); err != nil {
+		t.Fatalf("CreateConversation failed: %v", err)
+	}
+	defer testStore.DeleteConversation(ctx, conv.ID)
+
+	enqueue := func(maxAttempts int) *domain.GenerationJob {
+		j := &domain.GenerationJob{
+			ID:             NewGenerationJobID(),
+			ConversationID: conv.ID,
+			MessageID:      NewMessageID(),
+			Envelope:       []byte{0x80},
+			MaxAttempts:    maxAttempts,
+			CreatedAt:      time.Now().UTC(),
+		}
+		if err := testStore.EnqueueJob(ctx, j); err != nil {
+			t.Fatalf("EnqueueJob failed: %v", err)
+		}
+		return j
+	}
+
+	first := enqueue(0)
+	second := enqueue(1)
+
+	// Jobs are claimed oldest first, each by one worker
+	claimed, err := testStore.ClaimJob(ctx, "worker-a", lease)
+	if err != nil || claimed == nil {
+		t.Fatalf("ClaimJob failed: %v", err)
+	}
+	if claimed.ID != first.ID || claimed.Status != domain.JobStatusClaimed || claimed.WorkerID != "worker-a" || claimed.Attempts != 1 {
+		t.Errorf("Unexpected claim: %+v", claimed)
+	}
+	if claimed.MaxAttempts != domain.DefaultJobAttempts {
+		t.Errorf("Expected %d max attempts, got %d", domain.DefaultJobAttempts, claimed.MaxAttempts)
+	}
+	if string(claimed.Envelope) != string(first.Envelope) {
+		t.Errorf("Envelope mismatch")
+	}
+	other, err := testStore.ClaimJob(ctx, "worker-b", lease)
+	if err != nil || other == nil || other.ID != second.ID {
+		t.Fatalf("Expected worker-b to claim the second job, got %+v (%v)", other, err)
+	}
+	if j, err := testStore.ClaimJob(ctx, "worker-c", lease); err != nil || j != nil {
+		t.Errorf("Expected an empty queue, got %+v (%v)", j, err)
+	}
+
+	// Only the holder may start or finish a job
+	if err := testStore.StartJob(ctx, first.ID, "worker-b"); err != domain.ErrNotFound {
+		t.Errorf("Expected ErrNotFound starting another worker's job, got %v", err)
+	}
+	if err := testStore.StartJob(ctx, first.ID, "worker-a"); err != nil {
+		t.Fatalf("StartJob failed: %v", err)
+	}
+
+	// Heartbeats keep a lease past the expiry sweep
+	if err := testStore.HeartbeatJobs(ctx, "worker-a", []string{first.ID}, time.Now().UTC().Add(time.Hour)); err != nil {
+		t.Fatalf("HeartbeatJobs failed: %v", err)
+	}
+	released, err := testStore.ReleaseExpiredJobs(ctx, time.Now().UTC().Add(2*time.Minute))
+	if err != nil {
+		t.Fatalf("ReleaseExpiredJobs failed: %v", err)
+	}
+	if len(released) != 1 || released[0].ID != second.ID {
+		t.Fatalf("Expected only the second job to expire, got %d jobs", len(released))
+	}
+	// It had a single attempt, so it fails rather than going back to the queue
+	if released[0].Status != domain.JobStatusFailed || released[0].LastError != "lease expired" {
+		t.Errorf("Expected the expired job to fail, got %s (%s)", released[0].Status, released[0].LastError)
+	}
+	if err := testStore.FinishJob(ctx, second.ID, "worker-b", domain.JobStatusDone, ""); err != domain.ErrNotFound {
+		t.Errorf("Expected ErrNotFound finishing a released job, got %v", err)
+	}
+
+	// A worker that goes away gives its jobs back to the queue
+	released, err = testStore.ReleaseWorkerJobs(ctx, "worker-a", "agent disconnected")
+	if err != nil {
+		t.Fatalf("ReleaseWorkerJobs failed: %v", err)
+	}
+	if len(released) != 1 || released[0].Status != domain.JobStatusQueued || released[0].WorkerID != "" {
+		t.Fatalf("Expected the first job to be requeued, got %+v", released)
+	}
+	reclaimed, err := testStore.ClaimJob(ctx, "worker-b", lease)
+	if err != nil || reclaimed == nil || reclaimed.ID != first.ID {
+		t.Fatalf("Expected the first job to be claimed again, got %+v (%v)", reclaimed, err)
+	}
+	if reclaimed.Attempts != 2 {
+		t.Errorf("Expected 2 attempts, got %d", reclaimed.Attempts)
+	}
+	if err := testStore.FinishJob(ctx, first.ID, "worker-b", domain.JobStatusDone, ""); err != nil {
+		t.Fatalf("FinishJob failed: %v", err)
+	}
+	done, err := testStore.GetJob(ctx, first.ID)
+	if err != nil {
+		t.Fatalf("GetJob failed: %v", err)
+	}
+	if done.Status != domain.JobStatusDone || done.FinishedAt == nil || done.LeaseExpiresAt != nil {
+		t.Errorf("Unexpected finished job: %+v", done)
+	}
+
+	// Queued jobs can be cancelled before anyone claims them
+	third := enqueue(0)
+	cancelled, err := testStore.CancelQueuedJobs(ctx, conv.ID, "")
+	if err != nil {
+		t.Fatalf("CancelQueuedJobs failed: %v", err)
+	}
+	if len(cancelled) != 1 || cancelled[0].ID != third.ID || cancelled[0].Status != domain.JobStatusFailed {
+		t.Errorf("Expected the third job to be cancelled, got %+v", cancelled)
+	}
+	if j, err := testStore.ClaimJob(ctx, "worker-a", lease); err != nil || j != nil {
+		t.Errorf("Expected nothing to claim after cancelling, got %+v (%v)", j, err)
+	}
+}
+
+func TestAuth(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now().UTC()
+
+	user := &domain.User{
+		ID:           id.NewUser(),
+		Username:     "test-" + NewID("u"),
+		PasswordHash: "hash",
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}
+	if err := testStore.CreateUser(ctx, user); err != nil {
+		t.Fatalf("CreateUser failed: %v", err)
+	}
+	defer testStore.Pool().Exec(ctx, `DELETE FROM users WHERE id = $1`, user.ID)
+
+	// Usernames are unique regardless of case
+	dup := *user
+	dup.ID = id.NewUser()
+	dup.Username = strings.ToUpper(user.Username)
+	if err := testStore.CreateUser(ctx, &dup); err != domain.ErrUsernameTaken {
+		t.Errorf("Expected ErrUsernameTaken, got %v", err)
+	}
+
+	// Locking the table needs a transaction
+	if err := testStore.LockUsers(ctx); err == nil {
+		t.Error("Expected LockUsers outside a transaction to fail")
+	}
+	if err := testStore.WithTx(ctx, testStore.LockUsers); err != nil {
+		t.Errorf("LockUsers in a transaction failed: %v", err)
+	}
+
+	got, err := testStore.GetUserByUsername(ctx, strings.ToUpper(user.Username))
+	if err != nil {
+		t.Fatalf("GetUserByUsername failed: %v", err)
+	}
+	if got == nil || got.ID != user.ID || !got.HasPassword {
+		t.Errorf("GetUserByUsername mismatch: got %+v", got)
+	}
+
+	// Sessions
+	sess := &domain.Session{
+		ID:        id.NewSession(),
+		UserID:    user.ID,
+		Method:    "password",
+		CreatedAt: now,
+		ExpiresAt: now.Add(time.Hour),
+	}
+	if err := testStore.CreateSession(ctx, sess); err != nil {
+		t.Fatalf("CreateSession failed: %v", err)
+	}
+	other := *sess
+	other.ID = id.NewSession()
+	if err := testStore.CreateSession(ctx, &other); err != nil {
+		t.Fatalf("CreateSession failed: %v", err)
+	}
+
+	// Only the user's own sessions can be revoked
+	if err := testStore.RevokeSession(ctx, sess.ID, "someone-else"); err != domain.ErrNotFound {
+		t.Errorf("Expected ErrNotFound revoking another user's session, got %v", err)
+	}
+	if err := testStore.RevokeUserSessions(ctx, user.ID, sess.ID); err != nil {
+		t.Fatalf("RevokeUserSessions failed: %v", err)
+	}
+	sessions, err := testStore.ListSessions(ctx, user.ID)
+	if err != nil {
+		t.Fatalf("ListSessions failed: %v", err)
+	}
+	if len(sessions) != 1 || sessions[0].ID != sess.ID {
+		t.Errorf("Expected only the kept session to be active, got %d sessions", len(sessions))
+	}
+	gotSess, err := testStore.GetSession(ctx, other.ID)
+	if err != nil {
+		t.Fatalf("GetSession failed: %v", err)
+	}
+	if gotSess == nil || gotSess.RevokedAt == nil {
+		t.Error("Expected the other session to be revoked")
+	}
+
+	// API keys are found by hash and revoked by kind and owner
+	key := &domain.APIKey{
+		ID:        id.NewAPIKey(),
+		Kind:      domain.APIKeyDevice,
+		UserID:    &user.ID,
+		Name:      "phone",
+		KeyPrefix: "alicia_dk_abcdef",
+		KeyHash:   "hash-" + NewID("k"),
+		CreatedBy: &user.ID,
+		CreatedAt: now,
+	}
+	if err := testStore.CreateAPIKey(ctx, key); err != nil {
+		t.Fatalf("CreateAPIKey failed: %v", err)
+	}
+	gotKey, err := testStore.GetAPIKeyByHash(ctx, key.KeyHash)
+	if err != nil {
+		t.Fatalf("GetAPIKeyByHash failed: %v", err)
+	}
+	if gotKey == nil || gotKey.ID != key.ID || *gotKey.UserID != user.ID {
+		t.Errorf("GetAPIKeyByHash mismatch: got %+v", gotKey)
+	}
+	if err := testStore.RevokeAPIKey(ctx, key.ID, domain.APIKeyService, ""); err != domain.ErrNotFound {
+		t.Errorf("Expected ErrNotFound revoking a device key as a service token, got %v", err)
+	}
+	if err := testStore.RevokeAPIKey(ctx, key.ID, domain.APIKeyDevice, user.ID); err != nil {
+		t.Fatalf("RevokeAPIKey failed: %v", err)
+	}
+	gotKey, _ = testStore.GetAPIKeyByHash(ctx, key.KeyHash)
+	if gotKey == nil || gotKey.RevokedAt == nil {
+		t.Error("Expected the key to be revoked")
+	}
+
+	// Challenges can be consumed once, and only for their purpose
+	challenge := &domain.AuthChallenge{
+		ID:        id.NewAuthChallenge(),
+		Purpose:   "login",
+		Challenge: []byte("challenge"),
+		ExpiresAt: now.Add(time.Minute),
+	}
+	if err := testStore.CreateAuthChallenge(ctx, challenge); err != nil {
+		t.Fatalf("CreateAuthChallenge failed: %v", err)
+	}
+	if c, _ := testStore.ConsumeAuthChallenge(ctx, challenge.ID, "register"); c != nil {
+		t.Error("Challenge consumed for the wrong purpose")
+	}
+	if c, err := testStore.ConsumeAuthChallenge(ctx, challenge.ID, "login"); err != nil || c == nil {
+		t.Fatalf("ConsumeAuthChallenge failed: %v", err)
+	}
+	if c, _ := testStore.ConsumeAuthChallenge(ctx, challenge.ID, "login"); c != nil {
+		t.Error("Challenge consumed twice")
+	}
+}
+
 func TestTransactions(t *testing.T) {
 	ctx := context.Background()
 	userID := "test-user-" + NewID("u")
@@ -165,6 +165,38 @@ func (s *Store) GetToolUse(ctx context.Context, id string) (*domain.ToolUse, err
 	return tu, nil
 }
 
+// CreateToolUseAttachment stores a binary part of a tool result.
+func (s *Store) CreateToolUseAttachment(ctx context.Context, a *domain.ToolUseAttachment) error {
+	query := `
+		INSERT INTO tool_use_attachments (id, tool_use_id, mime_type, data, created_at)
+		VALUES ($1, $2, $3, $4, $5)`
+
+	_, err := s.conn(ctx).Exec(ctx, query, a.ID, a.ToolUseID, a.MimeType, a.Data, a.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("create tool use attachment: %w", err)
+	}
+	return nil
+}
+
+// GetToolUseAttachment retrieves an attachment of a tool use.
+func (s *Store) GetToolUseAttachment(ctx context.Context, toolUseID, id string) (*domain.ToolUseAttachment, error) {
+	query := `
+		SELECT id, tool_use_id, mime_type, data, created_at
+		FROM tool_use_attachments
+		WHERE id = $1 AND tool_use_id = $2`
+
+	a := &domain.ToolUseAttachment{}
+	err := s.conn(ctx).QueryRow(ctx, query, id, toolUseID).Scan(
+		&a.ID, &a.ToolUseID, &a.MimeType, &a.Data, &a.CreatedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, domain.ErrNotFound
+		}
+		return nil, fmt.Errorf("get tool use attachment: %w", err)
+	}
+	return a, nil
+}
+
 // UpdateToolUse updates a tool use's result and status.
 func (s *Store) UpdateToolUse(ctx context.Context, tu *domain.ToolUse) error {
 	query := `
@@ -196,22 +228,27 @@ func (s *Store) GetToolUsesByMessage(ctx context.Context, messageID string) ([]*
 	return scanToolUses(rows)
 }
 
-// ListToolUses returns all tool uses with pagination and total count.
-func (s *Store) ListToolUses(ctx context.Context, limit, offset int) ([]*domain.ToolUse, int, error) {
+// ListToolUses returns the tool uses in the user's conversations with
+// pagination and total count.
+func (s *Store) ListToolUses(ctx context.Context, userID string, limit, offset int) ([]*domain.ToolUse, int, error) {
+	const owned = `
+		FROM tool_uses t
+		JOIN messages m ON m.id = t.message_id
+		JOIN conversations c ON c.id = m.conversation_id
+		WHERE c.user_id = $1 AND c.deleted_at IS NULL`
+
 	// Get total count
-	countQuery := `SELECT COUNT(*) FROM tool_uses`
 	var total int
-	if err := s.conn(ctx).QueryRow(ctx, countQuery).Scan(&total); err != nil {
+	if err := s.conn(ctx).QueryRow(ctx, `SELECT COUNT(*)`+owned, userID).Scan(&total); err != nil {
 		return nil, 0, fmt.Errorf("count tool uses: %w", err)
 	}
 
 	query := `
-		SELECT id, message_id, tool_name, arguments, result, status, error, created_at
-		FROM tool_uses
-		ORDER BY created_at DESC
-		LIMIT $1 OFFSET $2`
+		SELECT t.id, t.message_id, t.tool_name, t.arguments, t.result, t.status, t.error, t.created_at` + owned + `
+		ORDER BY t.created_at DESC
+		LIMIT $2 OFFSET $3`
 
-	rows, err := s.conn(ctx).Query(ctx, query, limit, offset)
+	rows, err := s.conn(ctx).Query(ctx, query, userID, limit, offset)
 	if err != nil {
 		return nil, 0, fmt.Errorf("list tool uses: %w", err)
 	}
@@ -0,0 +1,162 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/longregen/alicia/api/domain"
+	pgvector "github.com/pgvector/pgvector-go"
+)
+
+// ExportMemories returns all of the user's memories, archived ones included,
+// oldest first. Embeddings are loaded only if withEmbeddings is set.
+func (s *Store) ExportMemories(ctx context.Context, userID string, withEmbeddings bool) ([]*domain.Memory, error) {
+	query := `
+		SELECT id, user_id, content, importance,
+			importance_rating, historical_rating, personal_rating, factual_rating,
+			version, pinned, archived, superseded_by, source_msg_id, tags, created_at, updated_at,
+			CASE WHEN $2 THEN embedding END, COALESCE(embedding_model, '')
+		FROM memories
+		WHERE user_id = $1 AND deleted_at IS NULL
+		ORDER BY created_at, id`
+
+	rows, err := s.conn(ctx).Query(ctx, query, userID, withEmbeddings)
+	if err != nil {
+		return nil, fmt.Errorf("export memories: %w", err)
+	}
+	defer rows.Close()
+
+	var mems []*domain.Memory
+	for rows.Next() {
+		mem := &domain.Memory{}
+		var embedding *pgvector.Vector
+		if err := rows.Scan(
+			&mem.ID, &mem.UserID, &mem.Content, &mem.Importance,
+			&mem.Ratings.Importance, &mem.Ratings.Historical, &mem.Ratings.Personal, &mem.Ratings.Factual,
+			&mem.Version, &mem.Pinned, &mem.Archived, &mem.SupersededBy, &mem.SourceMsgID, &mem.Tags,
+			&mem.CreatedAt, &mem.UpdatedAt, &embedding, &mem.EmbeddingModel); err != nil {
+			return nil, fmt.Errorf("scan memory: %w", err)
+		}
+		if embedding != nil {
+			mem.Embedding = embedding.Slice()
+		}
+		mems = append(mems, mem)
+	}
+	return mems, rows.Err()
+}
+
+// ExportNotes returns all of the user's notes, oldest first. Embeddings are
+// loaded only if withEmbeddings is set.
+func (s *Store) ExportNotes(ctx context.Context, userID string, withEmbeddings bool) ([]*domain.Note, error) {
+	query := `
+		SELECT id, user_id, title, content, created_at, updated_at,
+			CASE WHEN $2 THEN embedding END, COALESCE(embedding_model, '')
+		FROM notes
+		WHERE user_id = $1 AND deleted_at IS NULL
+		ORDER BY created_at, id`
+
+	rows, err := s.conn(ctx).Query(ctx, query, userID, withEmbeddings)
+	if err != nil {
+		return nil, fmt.Errorf("export notes: %w", err)
+	}
+	defer rows.Close()
+
+	var notes []*domain.Note
+	for rows.Next() {
+		note := &domain.Note{}
+		var embedding *pgvector.Vector
+		if err := rows.Scan(&note.ID, &note.UserID, &note.Title, &note.Content,
+			&note.CreatedAt, &note.UpdatedAt, &embedding, &note.EmbeddingModel); err != nil {
+			return nil, fmt.Errorf("scan note: %w", err)
+		}
+		if embedding != nil {
+			note.Embedding = embedding.Slice()
+		}
+		notes = append(notes, note)
+	}
+	return notes, rows.Err()
+}
+
+// FindSimilarMemory returns the user's memory closest to content and how
+// similar it is, 0-1. A memory with the same content, ignoring case and
+// surrounding space, is similarity 1; otherwise memories are compared by
+// embedding, if one is given. It returns nil if there is nothing to
+// compare with.
+func (s *Store) FindSimilarMemory(ctx context.Context, userID, content string, embedding []float32) (*domain.Memory, float64, error) {
+	var vec *pgvector.Vector
+	if len(embedding) > 0 {
+		v := pgvector.NewVector(embedding)
+		vec = &v
+	}
+	query := `
+		SELECT id, user_id, content, similarity
+		FROM (
+			SELECT id, user_id, content,
+				CASE WHEN lower(btrim(content)) = lower(btrim($2)) THEN 1
+				     ELSE 1 - (embedding <=> $3) END AS similarity
+			FROM memories
+			WHERE user_id = $1 AND deleted_at IS NULL
+			  AND (lower(btrim(content)) = lower(btrim($2))
+			       OR ($3::vector IS NOT NULL AND embedding IS NOT NULL))
+		) candidates
+		ORDER BY similarity DESC NULLS LAST
+		LIMIT 1`
+
+	mem := &domain.Memory{}
+	var similarity float64
+	err := s.conn(ctx).QueryRow(ctx, query, userID, content, vec).Scan(&mem.ID, &mem.UserID, &mem.Content, &similarity)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, 0, nil
+	}
+	if err != nil {
+		return nil, 0, fmt.Errorf("find similar memory: %w", err)
+	}
+	return mem, similarity, nil
+}
+
+// FindNotesByTitle returns the user's notes titled title, ignoring case and
+// surrounding space.
+func (s *Store) FindNotesByTitle(ctx context.Context, userID, title string) ([]*domain.Note, error) {
+	query := `
+		SELECT id, user_id, title, content, created_at, updated_at
+		FROM notes
+		WHERE user_id = $1 AND deleted_at IS NULL AND lower(btrim(title)) = lower(btrim($2))
+		ORDER BY updated_at DESC`
+
+	rows, err := s.conn(ctx).Query(ctx, query, userID, title)
+	if err != nil {
+		return nil, fmt.Errorf("find notes by title: %w", err)
+	}
+	defer rows.Close()
+
+	var notes []*domain.Note
+	for rows.Next() {
+		note := &domain.Note{}
+		if err := rows.Scan(&note.ID, &note.UserID, &note.Title, &note.Content,
+			&note.CreatedAt, &note.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("scan note: %w", err)
+		}
+		notes = append(notes, note)
+	}
+	return notes, rows.Err()
+}
+
+// ActiveEmbeddingModel returns the embedding model the stored embeddings are
+// made with and its dimension, or "" if the agent hasn't registered one yet.
+func (s *Store) ActiveEmbeddingModel(ctx context.Context) (string, int, error) {
+	var model string
+	var dims *int
+	err := s.conn(ctx).QueryRow(ctx, `SELECT model, dims FROM embedding_models WHERE status = 'active'`).Scan(&model, &dims)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", 0, nil
+	}
+	if err != nil {
+		return "", 0, fmt.Errorf("get active embedding model: %w", err)
+	}
+	if dims == nil {
+		return model, 0, nil
+	}
+	return model, *dims, nil
+}
@@ -249,7 +249,7 @@ func (b *Bridge) SendToolRequest(ctx context.Context, toolName string, args map[
 		ID:        requestID,
 		ToolName:  toolName,
 		Arguments: args,
-		Execution: "client",
+		Execution: protocol.ToolExecutionClient,
 	}
 	env := protocol.NewEnvelope(AssistantClientID, protocol.TypeToolUseRequest, req)
 	data, err := env.Encode()
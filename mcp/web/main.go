@@ -173,6 +173,22 @@ func (s *Server) handleToolsCall(ctx context.Context, req *mcp.Request) *mcp.Res
 		return mcp.NewErrorResponse(req.ID, mcp.ErrCodeInvalidParams, fmt.Sprintf("unknown tool: %s", params.Name))
 	}
 
+	if ct, ok := tool.(tools.ContentTool); ok {
+		blocks, err := ct.ExecuteContent(ctx, params.Arguments)
+		if err != nil {
+			content := fmt.Sprintf("Error: %v", err)
+			span.RecordError(err)
+			otel.EndMCPToolSpan(span, true, len(content))
+			return mcp.NewResponse(req.ID, mcp.NewToolError(content))
+		}
+		size := 0
+		for _, b := range blocks {
+			size += len(b.Text) + len(b.Data)
+		}
+		otel.EndMCPToolSpan(span, false, size)
+		return mcp.NewResponse(req.ID, mcp.ToolCallResult{Content: blocks})
+	}
+
 	result, err := tool.Execute(ctx, params.Arguments)
 	isError := err != nil
 	var content string
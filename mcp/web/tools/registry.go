@@ -3,6 +3,8 @@ package tools
 import (
 	"context"
 	"sync"
+
+	"github.com/longregen/alicia/shared/mcp"
 )
 
 type Tool interface {
@@ -12,6 +14,13 @@ type Tool interface {
 	Execute(ctx context.Context, args map[string]any) (string, error)
 }
 
+// ContentTool is implemented by tools whose results aren't only text, such as
+// screenshots. The server calls ExecuteContent instead of Execute for them.
+type ContentTool interface {
+	Tool
+	ExecuteContent(ctx context.Context, args map[string]any) ([]mcp.ContentBlock, error)
+}
+
 // ToolDefinition is an MCP tool definition for JSON serialization
 type ToolDefinition struct {
 	Name        string         `json:"name"`
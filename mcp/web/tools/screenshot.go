@@ -8,6 +8,7 @@ import (
 
 	"github.com/longregen/alicia/mcp/web/pipeline"
 	"github.com/longregen/alicia/mcp/web/security"
+	"github.com/longregen/alicia/shared/mcp"
 )
 
 type ScreenshotTool struct{}
@@ -21,7 +22,7 @@ func (t *ScreenshotTool) Name() string {
 }
 
 func (t *ScreenshotTool) Description() string {
-	return "Captures a screenshot of a web page using a headless Chromium browser. Supports full-page screenshots, custom viewport sizes, and waiting for JavaScript to render. Returns base64-encoded PNG image data."
+	return "Captures a screenshot of a web page using a headless Chromium browser. Supports full-page screenshots, custom viewport sizes, and waiting for JavaScript to render. Returns the PNG image."
 }
 
 func (t *ScreenshotTool) InputSchema() map[string]any {
@@ -64,14 +65,48 @@ func (t *ScreenshotTool) InputSchema() map[string]any {
 }
 
 func (t *ScreenshotTool) Execute(ctx context.Context, args map[string]any) (string, error) {
+	result, screenshot, err := t.capture(ctx, args)
+	if err != nil {
+		return "", err
+	}
+	result.Data = base64.StdEncoding.EncodeToString(screenshot)
+
+	output, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal result: %w", err)
+	}
+
+	return string(output), nil
+}
+
+// ExecuteContent returns the screenshot as an MCP image block, after a text
+// block describing the capture, so that clients can show it to the model.
+func (t *ScreenshotTool) ExecuteContent(ctx context.Context, args map[string]any) ([]mcp.ContentBlock, error) {
+	result, screenshot, err := t.capture(ctx, args)
+	if err != nil {
+		return nil, err
+	}
+
+	output, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal result: %w", err)
+	}
+
+	return []mcp.ContentBlock{
+		mcp.NewTextContent(string(output)),
+		mcp.NewImageContent(screenshot, "image/png"),
+	}, nil
+}
+
+func (t *ScreenshotTool) capture(ctx context.Context, args map[string]any) (ScreenshotResult, []byte, error) {
 	targetURL, ok := args["url"].(string)
 	if !ok || targetURL == "" {
-		return "", fmt.Errorf("url is required")
+		return ScreenshotResult{}, nil, fmt.Errorf("url is required")
 	}
 
 	// Validate URL for SSRF protection
 	if err := security.ValidateURL(targetURL); err != nil {
-		return "", fmt.Errorf("URL validation failed: %w", err)
+		return ScreenshotResult{}, nil, fmt.Errorf("URL validation failed: %w", err)
 	}
 
 	// Parse options
@@ -115,10 +150,9 @@ func (t *ScreenshotTool) Execute(ctx context.Context, args map[string]any) (stri
 		WaitMS:   waitMS,
 	})
 	if err != nil {
-		return "", fmt.Errorf("failed to capture screenshot: %w", err)
+		return ScreenshotResult{}, nil, fmt.Errorf("failed to capture screenshot: %w", err)
 	}
 
-	// Build result
 	result := ScreenshotResult{
 		URL:      targetURL,
 		Width:    width,
@@ -126,15 +160,8 @@ func (t *ScreenshotTool) Execute(ctx context.Context, args map[string]any) (stri
 		FullPage: fullPage,
 		Format:   "png",
 		Size:     len(screenshot),
-		Data:     base64.StdEncoding.EncodeToString(screenshot),
 	}
-
-	output, err := json.MarshalIndent(result, "", "  ")
-	if err != nil {
-		return "", fmt.Errorf("failed to marshal result: %w", err)
-	}
-
-	return string(output), nil
+	return result, screenshot, nil
 }
 
 // ScreenshotResult is the output of the screenshot tool
@@ -145,5 +172,5 @@ type ScreenshotResult struct {
 	FullPage bool   `json:"full_page"`
 	Format   string `json:"format"`
 	Size     int    `json:"size_bytes"`
-	Data     string `json:"data"`
+	Data     string `json:"data,omitempty"` // base64 PNG, only in the plain text result
 }
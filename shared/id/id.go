@@ -25,6 +25,20 @@ const (
 	PrefixReasoning   = "rs"
 	PrefixMemoryTrace      = "mt"
 	PrefixMemoryGeneration = "mg"
+	PrefixMemoryVersion    = "mv"
+	PrefixSentence         = "snt"
+
+	PrefixToolUseAttachment = "tuatt"
+	PrefixSummary           = "sum"
+	PrefixMaintenanceRun    = "mrun"
+
+	PrefixUser          = "usr"
+	PrefixSession       = "sess"
+	PrefixAPIKey        = "key"
+	PrefixAuthChallenge = "chal"
+
+	PrefixGenerationJob = "job"
+	PrefixWorker        = "wrk"
 )
 
 func New(prefix string) string {
@@ -50,3 +64,14 @@ func NewThinking() string          { return New(PrefixThinking) }
 func NewReasoning() string         { return New(PrefixReasoning) }
 func NewMemoryTrace() string       { return New(PrefixMemoryTrace) }
 func NewMemoryGeneration() string  { return New(PrefixMemoryGeneration) }
+func NewMemoryVersion() string     { return New(PrefixMemoryVersion) }
+func NewSentence() string          { return New(PrefixSentence) }
+func NewToolUseAttachment() string { return New(PrefixToolUseAttachment) }
+func NewSummary() string           { return New(PrefixSummary) }
+func NewMaintenanceRun() string    { return New(PrefixMaintenanceRun) }
+func NewUser() string              { return New(PrefixUser) }
+func NewSession() string           { return New(PrefixSession) }
+func NewAPIKey() string            { return New(PrefixAPIKey) }
+func NewAuthChallenge() string     { return New(PrefixAuthChallenge) }
+func NewGenerationJob() string     { return New(PrefixGenerationJob) }
+func NewWorker() string            { return New(PrefixWorker) }
@@ -1,7 +1,10 @@
 // Package mcp provides shared types for Model Context Protocol (MCP) services.
 package mcp
 
-import "encoding/json"
+import (
+	"encoding/base64"
+	"encoding/json"
+)
 
 type Request struct {
 	JSONRPC string          `json:"jsonrpc"`
@@ -99,6 +102,10 @@ func NewTextContent(text string) ContentBlock {
 	return ContentBlock{Type: "text", Text: text}
 }
 
+func NewImageContent(data []byte, mimeType string) ContentBlock {
+	return ContentBlock{Type: "image", MimeType: mimeType, Data: base64.StdEncoding.EncodeToString(data)}
+}
+
 func NewToolResult(text string) ToolCallResult {
 	return ToolCallResult{
 		Content: []ContentBlock{NewTextContent(text)},
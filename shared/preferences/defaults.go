@@ -30,6 +30,8 @@ type Defaults struct {
 	ParetoEnableCrossover    bool    `json:"pareto_enable_crossover"`
 	NotesSimilarityThreshold float32 `json:"notes_similarity_threshold"`
 	NotesMaxCount            int     `json:"notes_max_count"`
+	SearchVectorWeight       float32 `json:"search_vector_weight"`
+	SearchKeywordWeight      float32 `json:"search_keyword_weight"`
 	ConfirmDeleteMemory      bool    `json:"confirm_delete_memory"`
 	ShowRelevanceScores      bool    `json:"show_relevance_scores"`
 }
@@ -19,6 +19,11 @@ type Envelope struct {
 	// Langfuse session context
 	SessionID string `msgpack:"session_id,omitempty" json:"sessionId,omitempty"`
 	UserID    string `msgpack:"user_id,omitempty" json:"userId,omitempty"`
+
+	// Seq numbers the events the server sends to a conversation's
+	// subscribers. It increases monotonically per conversation; clients pass
+	// the last one they saw when they subscribe again after a disconnect.
+	Seq uint64 `msgpack:"seq,omitempty" json:"seq,omitempty"`
 }
 
 func (e *Envelope) HasTraceContext() bool {
@@ -13,9 +13,14 @@ const (
 	TypeStartAnswer       MessageType = 13
 	TypeMemoryTrace       MessageType = 14
 	TypeAssistantSentence MessageType = 16
+	TypeAssistantDelta    MessageType = 17
 	TypeGenRequest        MessageType = 33
 	TypeThinkingSummary   MessageType = 34
 	TypeTitleUpdate       MessageType = 35
+	TypeGenerationCancel  MessageType = 36
+	TypeToolApproval      MessageType = 37
+	TypeJobStatus         MessageType = 38
+	TypeJobHeartbeat      MessageType = 39
 	TypeSubscribe         MessageType = 40
 	TypeUnsubscribe       MessageType = 41
 	TypeSubscribeAck      MessageType = 42
@@ -28,6 +33,8 @@ const (
 	TypeVoiceStatus       MessageType = 55
 	TypeVoiceSpeaking     MessageType = 56
 	TypePreferencesUpdate          MessageType = 60
+	TypeMCPConfigUpdate            MessageType = 61
+	TypeMCPToolsReport             MessageType = 62
 	TypeAssistantToolsRegister     MessageType = 70
 	TypeAssistantToolsAck          MessageType = 71
 	TypeAssistantHeartbeat         MessageType = 72
@@ -42,9 +49,18 @@ type GenerationComplete struct {
 	MessageID      string `msgpack:"messageId" json:"messageId"`
 	ConversationID string `msgpack:"conversationId" json:"conversationId"`
 	Success        bool   `msgpack:"success" json:"success"`
+	Cancelled      bool   `msgpack:"cancelled,omitempty" json:"cancelled,omitempty"`
 	Error          string `msgpack:"error,omitempty" json:"error,omitempty"`
 }
 
+// GenerationCancel asks the agent to stop an in-flight generation. MessageID
+// may be the assistant message being generated or the user message that
+// triggered it; when empty, every generation in the conversation is stopped.
+type GenerationCancel struct {
+	ConversationID string `msgpack:"conversationId" json:"conversationId"`
+	MessageID      string `msgpack:"messageId,omitempty" json:"messageId,omitempty"`
+}
+
 type Error struct {
 	Code           string `msgpack:"code" json:"code"`
 	Message        string `msgpack:"message" json:"message"`
@@ -65,6 +81,7 @@ type AssistantMessage struct {
 	Content        string `msgpack:"content" json:"content"`
 	PreviousID     string `msgpack:"previousId,omitempty" json:"previousId,omitempty"`
 	Reasoning      string `msgpack:"reasoning,omitempty" json:"reasoning,omitempty"`
+	Status         string `msgpack:"status,omitempty" json:"status,omitempty"` // empty (completed) or "cancelled"
 	Timestamp      int64  `msgpack:"timestamp,omitempty" json:"timestamp,omitempty"`
 }
 
@@ -78,6 +95,15 @@ type AssistantSentence struct {
 	IsFinal        bool   `msgpack:"isFinal,omitempty" json:"isFinal,omitempty"`
 }
 
+// AssistantDelta carries a raw text fragment of an in-progress answer as it
+// arrives from the model. Sequence increases monotonically per message.
+type AssistantDelta struct {
+	MessageID      string `msgpack:"messageId" json:"messageId"`
+	ConversationID string `msgpack:"conversationId" json:"conversationId"`
+	Sequence       int    `msgpack:"sequence" json:"sequence"`
+	Delta          string `msgpack:"delta" json:"delta"`
+}
+
 type StartAnswer struct {
 	MessageID      string `msgpack:"messageId" json:"messageId"`
 	ConversationID string `msgpack:"conversationId" json:"conversationId"`
@@ -93,6 +119,23 @@ type ToolUseRequest struct {
 	Execution      string         `msgpack:"execution,omitempty" json:"execution,omitempty"`
 }
 
+// Execution states of a ToolUseRequest. Tools run on the server unless they
+// are executed by the client device, and calls that need the user's approval
+// are announced as awaiting approval before they run.
+const (
+	ToolExecutionServer           = "server"
+	ToolExecutionClient           = "client"
+	ToolExecutionAwaitingApproval = "awaiting_approval"
+)
+
+// ToolApproval answers a ToolUseRequest that is awaiting approval.
+type ToolApproval struct {
+	ToolUseID      string `msgpack:"toolUseId" json:"toolUseId"`
+	ConversationID string `msgpack:"conversationId" json:"conversationId"`
+	Approved       bool   `msgpack:"approved" json:"approved"`
+	Reason         string `msgpack:"reason,omitempty" json:"reason,omitempty"`
+}
+
 type ToolUseResult struct {
 	ID             string `msgpack:"id" json:"id"`
 	RequestID      string `msgpack:"requestId" json:"requestId"`
@@ -110,6 +153,9 @@ type MemoryTrace struct {
 	ConversationID string  `msgpack:"conversationId" json:"conversationId"`
 	Content        string  `msgpack:"content" json:"content"`
 	Relevance      float32 `msgpack:"relevance" json:"relevance"`
+	// Action is set when the agent changed the memory rather than retrieved
+	// it: created, updated or deleted.
+	Action string `msgpack:"action,omitempty" json:"action,omitempty"`
 }
 
 type ThinkingSummary struct {
@@ -137,8 +183,32 @@ type GenerationRequest struct {
 	EnableStreaming bool   `msgpack:"enableStreaming" json:"enableStreaming"`
 	UsePareto       bool   `msgpack:"usePareto" json:"usePareto"`
 	Timestamp       int64  `msgpack:"timestamp,omitempty" json:"timestamp,omitempty"`
+	// JobID is set on requests dispatched from the job queue; the worker
+	// reports the job's progress with JobStatus and JobHeartbeat.
+	JobID string `msgpack:"jobId,omitempty" json:"jobId,omitempty"`
+}
+
+// JobStatus is sent by an agent worker when it starts a job ("running") and
+// when it ends ("done" or "failed").
+type JobStatus struct {
+	JobID  string `msgpack:"jobId" json:"jobId"`
+	Status string `msgpack:"status" json:"status"`
+	Error  string `msgpack:"error,omitempty" json:"error,omitempty"`
+}
+
+// JobHeartbeat is sent periodically by an agent worker, listing the jobs it
+// is still working on so that their leases are extended.
+type JobHeartbeat struct {
+	JobIDs []string `msgpack:"jobIds" json:"jobIds"`
 }
 
+// Job states reported in JobStatus.
+const (
+	JobRunning = "running"
+	JobDone    = "done"
+	JobFailed  = "failed"
+)
+
 type Subscribe struct {
 	ConversationID string `msgpack:"conversationId,omitempty" json:"conversationId,omitempty"`
 	AgentMode      bool   `msgpack:"agentMode,omitempty" json:"agentMode,omitempty"`
@@ -146,6 +216,11 @@ type Subscribe struct {
 	MonitorMode    bool   `msgpack:"monitorMode,omitempty" json:"monitorMode,omitempty"`
 	AssistantMode  bool   `msgpack:"assistantMode,omitempty" json:"assistantMode,omitempty"`
 	WhatsAppMode   bool   `msgpack:"whatsappMode,omitempty" json:"whatsappMode,omitempty"`
+	// Concurrency is how many jobs an agent worker takes on at once.
+	Concurrency int `msgpack:"concurrency,omitempty" json:"concurrency,omitempty"`
+	// LastSeq is the last event a reconnecting client saw in the
+	// conversation; the events after it are replayed.
+	LastSeq *uint64 `msgpack:"lastSeq,omitempty" json:"lastSeq,omitempty"`
 }
 
 type Unsubscribe struct {
@@ -157,6 +232,11 @@ type SubscribeAck struct {
 	AgentMode      bool   `msgpack:"agentMode,omitempty" json:"agentMode,omitempty"`
 	Success        bool   `msgpack:"success" json:"success"`
 	Error          string `msgpack:"error,omitempty" json:"error,omitempty"`
+	// LastSeq is the conversation's latest event sequence number.
+	LastSeq uint64 `msgpack:"lastSeq,omitempty" json:"lastSeq,omitempty"`
+	// Resync is set when the events after the requested LastSeq are no
+	// longer buffered; the client should reload the conversation.
+	Resync bool `msgpack:"resync,omitempty" json:"resync,omitempty"`
 }
 
 type UnsubscribeAck struct {
@@ -243,10 +323,62 @@ type PreferencesUpdate struct {
 	ParetoEnableCrossover    bool    `msgpack:"paretoEnableCrossover" json:"paretoEnableCrossover"`
 	NotesSimilarityThreshold float32 `msgpack:"notesSimilarityThreshold" json:"notesSimilarityThreshold"`
 	NotesMaxCount            int     `msgpack:"notesMaxCount" json:"notesMaxCount"`
+	SearchVectorWeight       float32 `msgpack:"searchVectorWeight" json:"searchVectorWeight"`
+	SearchKeywordWeight      float32 `msgpack:"searchKeywordWeight" json:"searchKeywordWeight"`
 	ConfirmDeleteMemory      bool    `msgpack:"confirmDeleteMemory" json:"confirmDeleteMemory"`
 	ShowRelevanceScores      bool    `msgpack:"showRelevanceScores" json:"showRelevanceScores"`
 }
 
+// MCPConfigUpdate carries the full set of enabled MCP servers. The agent
+// diffs it against the servers it is running and starts or stops the rest.
+type MCPConfigUpdate struct {
+	Servers []MCPServerConfig `msgpack:"servers" json:"servers"`
+}
+
+type MCPServerConfig struct {
+	Name          string                   `msgpack:"name" json:"name"`
+	TransportType string                   `msgpack:"transportType" json:"transportType"`
+	Command       string                   `msgpack:"command,omitempty" json:"command,omitempty"`
+	Args          []string                 `msgpack:"args,omitempty" json:"args,omitempty"`
+	URL           string                   `msgpack:"url,omitempty" json:"url,omitempty"`
+	Headers       map[string]string        `msgpack:"headers,omitempty" json:"headers,omitempty"`
+	Limits        MCPToolLimits            `msgpack:"limits" json:"limits"`
+	ToolLimits    map[string]MCPToolLimits `msgpack:"toolLimits,omitempty" json:"toolLimits,omitempty"`
+}
+
+// MCPToolLimits bounds a tool call and the size of the result given back to
+// the model, and says whether the call needs the user's approval. Zero values
+// mean the agent's defaults.
+type MCPToolLimits struct {
+	TimeoutSeconds int    `msgpack:"timeoutSeconds,omitempty" json:"timeoutSeconds,omitempty"`
+	MaxResultBytes int    `msgpack:"maxResultBytes,omitempty" json:"maxResultBytes,omitempty"`
+	ResultPolicy   string `msgpack:"resultPolicy,omitempty" json:"resultPolicy,omitempty"`     // "truncate" or "summarize"
+	ApprovalPolicy string `msgpack:"approvalPolicy,omitempty" json:"approvalPolicy,omitempty"` // "always", "never" or "ask"
+}
+
+// MCPToolsReport is sent by the agent after connecting, after every config
+// update and whenever a server changes status, listing the servers it is
+// running and the tools each one exposes.
+type MCPToolsReport struct {
+	Servers []MCPServerTools `msgpack:"servers" json:"servers"`
+}
+
+// MCPServerTools describes one server in an MCPToolsReport. Status is "up",
+// "restarting" or "failed"; Error is the last error the server went down
+// with and is kept after it recovers.
+type MCPServerTools struct {
+	Name   string    `msgpack:"name" json:"name"`
+	Status string    `msgpack:"status" json:"status"`
+	Tools  []MCPTool `msgpack:"tools" json:"tools"`
+	Error  string    `msgpack:"error,omitempty" json:"error,omitempty"`
+}
+
+type MCPTool struct {
+	Name        string         `msgpack:"name" json:"name"`
+	Description string         `msgpack:"description" json:"description"`
+	Schema      map[string]any `msgpack:"schema,omitempty" json:"schema,omitempty"`
+}
+
 type AssistantToolsRegister struct {
 	Tools []AssistantTool `msgpack:"tools" json:"tools"`
 }
@@ -0,0 +1,62 @@
+// Package search provides the pieces of hybrid search shared by the agent and
+// the API: the full-text query built from free text and reciprocal rank
+// fusion of the lexical and vector rankings.
+package search
+
+import (
+	"strings"
+	"unicode"
+)
+
+// RRFK dampens the advantage of the very top ranks in reciprocal rank fusion.
+// 60 is the value from the original paper and works well in practice.
+const RRFK = 60
+
+// Weights says how much each ranking counts in the fused score.
+type Weights struct {
+	Vector  float64
+	Keyword float64
+}
+
+// Score is the weighted reciprocal rank fusion score of an item ranked
+// vectorRank by similarity and keywordRank by full-text rank. Ranks start
+// at 1; 0 means the item wasn't in that ranking.
+func (w Weights) Score(vectorRank, keywordRank int) float64 {
+	s := 0.0
+	if vectorRank > 0 {
+		s += w.Vector / float64(RRFK+vectorRank)
+	}
+	if keywordRank > 0 {
+		s += w.Keyword / float64(RRFK+keywordRank)
+	}
+	return s
+}
+
+// Relevance is Score scaled to 0-1, where 1 means first in both rankings.
+func (w Weights) Relevance(vectorRank, keywordRank int) float64 {
+	best := w.Score(1, 1)
+	if best == 0 {
+		return 0
+	}
+	return w.Score(vectorRank, keywordRank) / best
+}
+
+// Query turns free text into a tsquery expression for to_tsquery that
+// matches documents containing any of its words. Ranking then favours the
+// documents that match more of them, which suits questions better than the
+// all-words semantics of plainto_tsquery. It returns "" if text has no words.
+// Pass it with the 'english' configuration the search_vector columns use.
+func Query(text string) string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	seen := make(map[string]bool, len(words))
+	terms := words[:0]
+	for _, w := range words {
+		if !seen[w] {
+			seen[w] = true
+			terms = append(terms, w)
+		}
+	}
+	return strings.Join(terms, " | ")
+}
@@ -0,0 +1,40 @@
+package search
+
+import "testing"
+
+func TestQuery(t *testing.T) {
+	tests := map[string]string{
+		"What's Anna's phone number?":  "what | s | anna | phone | number",
+		"order AB-1234, order AB-1234": "order | ab | 1234",
+		"  ?! ":                        "",
+	}
+	for in, want := range tests {
+		if got := Query(in); got != want {
+			t.Errorf("Query(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestWeightsScore(t *testing.T) {
+	w := Weights{Vector: 1, Keyword: 1}
+
+	// Found by both rankings beats first in only one.
+	if both, one := w.Score(3, 3), w.Score(1, 0); both <= one {
+		t.Errorf("Score(3, 3) = %v, want more than Score(1, 0) = %v", both, one)
+	}
+	if got := w.Score(0, 0); got != 0 {
+		t.Errorf("Score(0, 0) = %v, want 0", got)
+	}
+	if got := w.Relevance(1, 1); got != 1 {
+		t.Errorf("Relevance(1, 1) = %v, want 1", got)
+	}
+
+	// A zero weight switches a ranking off.
+	lexical := Weights{Keyword: 1}
+	if got := lexical.Score(1, 0); got != 0 {
+		t.Errorf("vector rank counted with zero weight: %v", got)
+	}
+	if got := (Weights{}).Relevance(1, 1); got != 0 {
+		t.Errorf("Relevance with zero weights = %v, want 0", got)
+	}
+}
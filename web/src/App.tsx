@@ -6,6 +6,8 @@ import WelcomeScreen from './components/organisms/WelcomeScreen';
 import { Settings, type SettingsTab } from './components/Settings';
 import { MemoryManager, MemoryDetail } from './components/organisms/MemoryManager';
 import { NotesPage } from './components/NotesPage';
+import { LoginPage } from './components/LoginPage';
+import { getAuthConfig, getCurrentUser, type AuthConfig } from './services/auth';
 import { useConversations } from './hooks/useConversations';
 import { useChat } from './hooks/useChat';
 import { useTheme } from './hooks/useTheme';
@@ -356,7 +358,46 @@ function AppContent() {
   );
 }
 
+type AuthState =
+  | { status: 'loading' }
+  | { status: 'login'; config: AuthConfig }
+  | { status: 'ready' };
+
+// useAuth decides whether to show the login page: when the server requires
+// auth, or a stored session has stopped working.
+function useAuth() {
+  const [state, setState] = useState<AuthState>({ status: 'loading' });
+
+  const check = useCallback(async () => {
+    try {
+      const [config, user] = await Promise.all([getAuthConfig(), getCurrentUser()]);
+      setState(config.require_auth && !user ? { status: 'login', config } : { status: 'ready' });
+    } catch (err) {
+      // An older server without auth routes; carry on as before.
+      console.warn('Failed to load auth config:', err);
+      setState({ status: 'ready' });
+    }
+  }, []);
+
+  useEffect(() => {
+    check();
+    window.addEventListener('alicia:logout', check);
+    return () => window.removeEventListener('alicia:logout', check);
+  }, [check]);
+
+  return { state, onLogin: () => setState({ status: 'ready' }) };
+}
+
 function App() {
+  const { state, onLogin } = useAuth();
+
+  if (state.status === 'loading') {
+    return null;
+  }
+  if (state.status === 'login') {
+    return <LoginPage config={state.config} onLogin={onLogin} />;
+  }
+
   return (
     <WebSocketProvider>
       <AppContent />
@@ -2,7 +2,7 @@ import {
   Envelope,
   MessageType,
   StartAnswer,
-  AssistantSentence,
+  AssistantDelta,
   AssistantMessage as ProtocolAssistantMessage,
   ErrorMessage as ProtocolErrorMessage,
   ToolUseRequest,
@@ -49,8 +49,8 @@ export function handleChatProtocolMessage(envelope: Envelope): void {
       handleStartAnswer(envelope.body as StartAnswer, store);
       break;
 
-    case MessageType.AssistantSentence:
-      handleAssistantSentence(envelope.body as AssistantSentence, store);
+    case MessageType.AssistantDelta:
+      handleAssistantDelta(envelope.body as AssistantDelta, store);
       break;
 
     case MessageType.ToolUseRequest:
@@ -128,37 +128,14 @@ function handleStartAnswer(msg: StartAnswer, store: ChatStore): void {
   store.startStreaming(conversationId, messageId);
 }
 
-function handleAssistantSentence(msg: AssistantSentence, store: ChatStore): void {
+// Sentence-segmented AssistantSentence frames are meant for TTS; the chat view
+// renders the raw token deltas instead so text appears as it is generated.
+function handleAssistantDelta(msg: AssistantDelta, store: ChatStore): void {
+  const messageId = createMessageId(msg.messageId);
   const conversationId = createConversationId(msg.conversationId);
-  const convState = store.getConversationState(conversationId);
-  const streamingId = convState?.streamingMessageId;
-
-  if (!streamingId) {
-    console.warn(
-      '[chatAdapter] AssistantSentence received but no streaming message active. Text will be lost:',
-      msg.text.substring(0, 50) + (msg.text.length > 50 ? '...' : '')
-    );
-    return;
-  }
-
-  const currentMsg = store.getMessage(conversationId, streamingId);
-  if (!currentMsg) {
-    console.warn(
-      '[chatAdapter] AssistantSentence: streamingMessageId points to non-existent message:',
-      streamingId
-    );
-    return;
-  }
-
-  if (currentMsg.content) {
-    store.appendContent(conversationId, streamingId, ' ' + msg.text);
-  } else {
-    store.appendContent(conversationId, streamingId, msg.text);
-  }
 
-  if (msg.isFinal) {
-    store.finishStreaming(conversationId);
-  }
+  ensureStreamingMessage(store, messageId, conversationId);
+  store.appendContent(conversationId, messageId, msg.delta);
 }
 
 function handleToolUseRequest(msg: ToolUseRequest, store: ChatStore): void {
@@ -171,7 +148,7 @@ function handleToolUseRequest(msg: ToolUseRequest, store: ChatStore): void {
     id: createToolCallId(msg.id),
     tool_name: msg.toolName,
     arguments: msg.arguments,
-    status: 'pending',
+    status: msg.execution === 'awaiting_approval' ? 'awaiting_approval' : 'pending',
     created_at: new Date().toISOString(),
   });
 }
@@ -213,6 +190,7 @@ function handleMemoryTrace(msg: ProtocolMemoryTrace, store: ChatStore): void {
     memory_id: msg.memoryId,
     content: msg.content,
     relevance: msg.relevance,
+    action: msg.action,
   });
 }
 
@@ -310,7 +288,7 @@ function handleBranchUpdate(_msg: BranchUpdate, _store: ChatStore): void {
 function handleGenerationComplete(msg: GenerationComplete, store: ChatStore): void {
   const conversationId = createConversationId(msg.conversationId);
 
-  if (msg.success) {
+  if (msg.success || msg.cancelled) {
     store.finishStreaming(conversationId);
   } else {
     const convState = store.getConversationState(conversationId);
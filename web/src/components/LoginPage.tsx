@@ -0,0 +1,109 @@
+import { useState } from 'react';
+import Button from './atoms/Button';
+import { Input } from './atoms/Input';
+import { Label } from './atoms/Label';
+import {
+  login,
+  register,
+  loginWithPasskey,
+  passkeysSupported,
+  type AuthConfig,
+  type AuthUser,
+} from '../services/auth';
+
+interface LoginPageProps {
+  config: AuthConfig;
+  onLogin: (user: AuthUser) => void;
+}
+
+export function LoginPage({ config, onLogin }: LoginPageProps) {
+  const [mode, setMode] = useState<'login' | 'register'>(config.signup_open ? 'register' : 'login');
+  const [username, setUsername] = useState('');
+  const [password, setPassword] = useState('');
+  const [error, setError] = useState<string | null>(null);
+  const [loading, setLoading] = useState(false);
+
+  const run = async (action: () => Promise<AuthUser>) => {
+    setError(null);
+    setLoading(true);
+    try {
+      onLogin(await action());
+    } catch (err) {
+      setError(err instanceof Error ? err.message : 'Login failed');
+    } finally {
+      setLoading(false);
+    }
+  };
+
+  const handleSubmit = (e: React.FormEvent) => {
+    e.preventDefault();
+    run(() => (mode === 'register' ? register(username, password) : login(username, password)));
+  };
+
+  return (
+    <div className="h-screen flex items-center justify-center bg-background p-8">
+      <form onSubmit={handleSubmit} className="max-w-sm w-full space-y-6">
+        <div className="space-y-2 text-center">
+          <h1 className="text-2xl font-semibold text-foreground">
+            {mode === 'register' ? 'Create your account' : 'Log in to Alicia'}
+          </h1>
+        </div>
+
+        <div className="space-y-2">
+          <Label htmlFor="username">Username</Label>
+          <Input
+            id="username"
+            autoComplete="username webauthn"
+            value={username}
+            onChange={(e) => setUsername(e.target.value)}
+            required
+          />
+        </div>
+
+        <div className="space-y-2">
+          <Label htmlFor="password">Password</Label>
+          <Input
+            id="password"
+            type="password"
+            autoComplete={mode === 'register' ? 'new-password' : 'current-password'}
+            value={password}
+            onChange={(e) => setPassword(e.target.value)}
+            required
+          />
+        </div>
+
+        {error && <p className="text-sm text-destructive">{error}</p>}
+
+        <Button type="submit" size="lg" loading={loading} className="w-full">
+          {mode === 'register' ? 'Create account' : 'Log in'}
+        </Button>
+
+        {mode === 'login' && config.passkeys && passkeysSupported() && (
+          <Button
+            type="button"
+            variant="outline"
+            size="lg"
+            disabled={loading}
+            className="w-full"
+            onClick={() => run(() => loginWithPasskey(username || undefined))}
+          >
+            Log in with a passkey
+          </Button>
+        )}
+
+        {config.signup_open && (
+          <p className="text-sm text-center text-muted-foreground">
+            {mode === 'register' ? 'Already have an account? ' : 'New here? '}
+            <button
+              type="button"
+              className="text-primary hover:underline"
+              onClick={() => setMode(mode === 'register' ? 'login' : 'register')}
+            >
+              {mode === 'register' ? 'Log in' : 'Create an account'}
+            </button>
+          </p>
+        )}
+      </form>
+    </div>
+  );
+}
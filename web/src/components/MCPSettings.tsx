@@ -1,5 +1,5 @@
 import { useState, useEffect } from 'react';
-import { MCPServer, MCPServerConfig, MCPTool } from '../types/mcp';
+import { MCPServer, MCPServerConfig, MCPTool, MCPTransport } from '../types/mcp';
 import { api } from '../services/api';
 
 export function MCPSettings() {
@@ -17,10 +17,11 @@ export function MCPSettings() {
     args: [],
   });
   const [argsInput, setArgsInput] = useState('');
+  const [headersInput, setHeadersInput] = useState('');
   const [submitting, setSubmitting] = useState(false);
 
   // Inline validation state
-  const [fieldErrors, setFieldErrors] = useState<{ name?: string; command?: string }>({});
+  const [fieldErrors, setFieldErrors] = useState<{ name?: string; command?: string; url?: string }>({});
   const [submitStatus, setSubmitStatus] = useState<'idle' | 'success' | 'error'>('idle');
   const [submitError, setSubmitError] = useState<string | null>(null);
 
@@ -68,13 +69,17 @@ export function MCPSettings() {
     setSubmitError(null);
 
     // Validate fields
-    const errors: { name?: string; command?: string } = {};
+    const isRemote = formData.transport_type !== 'stdio';
+    const errors: { name?: string; command?: string; url?: string } = {};
     if (!formData.name.trim()) {
       errors.name = 'Server name is required';
     }
-    if (!formData.command?.trim()) {
+    if (!isRemote && !formData.command?.trim()) {
       errors.command = 'Command is required';
     }
+    if (isRemote && !formData.url?.trim()) {
+      errors.url = 'URL is required';
+    }
     if (Object.keys(errors).length > 0) {
       setFieldErrors(errors);
       return;
@@ -88,10 +93,18 @@ export function MCPSettings() {
         .map((arg) => arg.trim())
         .filter((arg) => arg.length > 0);
 
-      const serverConfig: MCPServerConfig = {
-        ...formData,
-        args,
-      };
+      // One "Name: value" header per line
+      const headers: Record<string, string> = {};
+      for (const line of headersInput.split('\n')) {
+        const idx = line.indexOf(':');
+        if (idx > 0) {
+          headers[line.slice(0, idx).trim()] = line.slice(idx + 1).trim();
+        }
+      }
+
+      const serverConfig: MCPServerConfig = isRemote
+        ? { name: formData.name, transport_type: formData.transport_type, url: formData.url, headers }
+        : { ...formData, args };
 
       await api.addMCPServer(serverConfig);
       await loadServers();
@@ -104,6 +117,7 @@ export function MCPSettings() {
         args: [],
       });
       setArgsInput('');
+      setHeadersInput('');
       setShowAddForm(false);
       setSubmitStatus('success');
     } catch (err) {
@@ -207,48 +221,91 @@ export function MCPSettings() {
               className="input"
               value={formData.transport_type}
               onChange={(e) =>
-                setFormData({ ...formData, transport_type: e.target.value as 'stdio' | 'sse' })
+                setFormData({ ...formData, transport_type: e.target.value as MCPTransport })
               }
               required
             >
               <option value="stdio">stdio</option>
               <option value="sse">SSE</option>
+              <option value="streamable-http">Streamable HTTP</option>
             </select>
           </div>
 
-          <div className="mb-4">
-            <label htmlFor="command" className="block mb-1.5 text-sm font-medium text-foreground">
-              Command *
-            </label>
-            <input
-              id="command"
-              type="text"
-              className={`input ${fieldErrors.command ? 'border-destructive' : ''}`}
-              value={formData.command}
-              onChange={(e) => {
-                setFormData({ ...formData, command: e.target.value });
-                if (fieldErrors.command) setFieldErrors(prev => ({ ...prev, command: undefined }));
-              }}
-              placeholder="/path/to/executable or npx package-name"
-            />
-            {fieldErrors.command && (
-              <span className="text-destructive text-sm mt-1 block">{fieldErrors.command}</span>
-            )}
-          </div>
+          {formData.transport_type !== 'stdio' && (
+            <>
+              <div className="mb-4">
+                <label htmlFor="url" className="block mb-1.5 text-sm font-medium text-foreground">
+                  URL *
+                </label>
+                <input
+                  id="url"
+                  type="text"
+                  className={`input ${fieldErrors.url ? 'border-destructive' : ''}`}
+                  value={formData.url ?? ''}
+                  onChange={(e) => {
+                    setFormData({ ...formData, url: e.target.value });
+                    if (fieldErrors.url) setFieldErrors(prev => ({ ...prev, url: undefined }));
+                  }}
+                  placeholder={formData.transport_type === 'sse' ? 'http://host:port/sse' : 'http://host:port/mcp'}
+                />
+                {fieldErrors.url && (
+                  <span className="text-destructive text-sm mt-1 block">{fieldErrors.url}</span>
+                )}
+              </div>
 
-          <div className="mb-4">
-            <label htmlFor="args" className="block mb-1.5 text-sm font-medium text-foreground">
-              Arguments (comma-separated)
-            </label>
-            <input
-              id="args"
-              type="text"
-              className="input"
-              value={argsInput}
-              onChange={(e) => setArgsInput(e.target.value)}
-              placeholder="arg1, arg2, arg3"
-            />
-          </div>
+              <div className="mb-4">
+                <label htmlFor="headers" className="block mb-1.5 text-sm font-medium text-foreground">
+                  Headers (one per line)
+                </label>
+                <textarea
+                  id="headers"
+                  className="input"
+                  rows={2}
+                  value={headersInput}
+                  onChange={(e) => setHeadersInput(e.target.value)}
+                  placeholder="Authorization: Bearer ..."
+                />
+              </div>
+            </>
+          )}
+
+          {formData.transport_type === 'stdio' && (
+            <>
+              <div className="mb-4">
+                <label htmlFor="command" className="block mb-1.5 text-sm font-medium text-foreground">
+                  Command *
+                </label>
+                <input
+                  id="command"
+                  type="text"
+                  className={`input ${fieldErrors.command ? 'border-destructive' : ''}`}
+                  value={formData.command}
+                  onChange={(e) => {
+                    setFormData({ ...formData, command: e.target.value });
+                    if (fieldErrors.command) setFieldErrors(prev => ({ ...prev, command: undefined }));
+                  }}
+                  placeholder="/path/to/executable or npx package-name"
+                />
+                {fieldErrors.command && (
+                  <span className="text-destructive text-sm mt-1 block">{fieldErrors.command}</span>
+                )}
+              </div>
+
+              <div className="mb-4">
+                <label htmlFor="args" className="block mb-1.5 text-sm font-medium text-foreground">
+                  Arguments (comma-separated)
+                </label>
+                <input
+                  id="args"
+                  type="text"
+                  className="input"
+                  value={argsInput}
+                  onChange={(e) => setArgsInput(e.target.value)}
+                  placeholder="arg1, arg2, arg3"
+                />
+              </div>
+            </>
+          )}
 
           <div className="flex gap-3 justify-end mt-5">
             <button type="button" className="cancel-btn btn btn-secondary" onClick={() => setShowAddForm(false)}>
@@ -289,6 +346,20 @@ export function MCPSettings() {
                     >
                       {server.enabled ? 'Enabled' : 'Disabled'}
                     </span>
+                    {server.status && (
+                      <span
+                        className={`badge ${
+                          server.status === 'up'
+                            ? 'badge-success'
+                            : server.status === 'restarting'
+                              ? 'badge-warning'
+                              : 'badge-destructive'
+                        }`}
+                        title={server.last_error}
+                      >
+                        {server.status === 'up' ? 'Up' : server.status === 'restarting' ? 'Restarting' : 'Failed'}
+                      </span>
+                    )}
                   </div>
                   <button
                     className="remove-server-btn bg-transparent border-0 text-muted-foreground text-[28px] cursor-pointer p-0 w-8 h-8 flex items-center justify-center rounded transition-all hover:bg-destructive/10 hover:text-destructive"
@@ -316,6 +387,12 @@ export function MCPSettings() {
                       <span className="detail-value text-foreground break-all">{server.url}</span>
                     </div>
                   )}
+                  {server.last_error && (
+                    <div className="flex gap-2 text-sm">
+                      <span className="font-semibold text-muted-foreground min-w-[80px]">Last error:</span>
+                      <span className="detail-value text-destructive break-all">{server.last_error}</span>
+                    </div>
+                  )}
                   {server.args && server.args.length > 0 && (
                     <div className="flex gap-2 text-sm">
                       <span className="font-semibold text-muted-foreground min-w-[80px]">Args:</span>
@@ -46,6 +46,8 @@ export function Settings({ defaultTab = 'mcp' }: SettingsProps) {
     pareto_branches_per_gen,
     pareto_archive_size,
     pareto_enable_crossover,
+    search_vector_weight,
+    search_keyword_weight,
     confirm_delete_memory,
     show_relevance_scores,
     updatePreference,
@@ -225,6 +227,38 @@ export function Settings({ defaultTab = 'mcp' }: SettingsProps) {
                       onChange={(e) => updatePreference('memory_retrieval_count', Math.max(1, Math.min(50, parseInt(e.target.value) || 1)))}
                     />
                   </div>
+                  <div className="space-y-2">
+                    <Label htmlFor="search-vector-weight">Meaning Match Weight: {search_vector_weight.toFixed(1)}</Label>
+                    <p className="text-xs text-muted">
+                      How much similarity in meaning counts when searching memories and notes.
+                    </p>
+                    <Slider
+                      id="search-vector-weight"
+                      min={0}
+                      max={1}
+                      step={0.1}
+                      value={[search_vector_weight]}
+                      onValueChange={(values) => {
+                        if (values[0] > 0 || search_keyword_weight > 0) updatePreference('search_vector_weight', values[0]);
+                      }}
+                    />
+                  </div>
+                  <div className="space-y-2">
+                    <Label htmlFor="search-keyword-weight">Keyword Match Weight: {search_keyword_weight.toFixed(1)}</Label>
+                    <p className="text-xs text-muted">
+                      How much matching words, names and numbers count when searching memories and notes.
+                    </p>
+                    <Slider
+                      id="search-keyword-weight"
+                      min={0}
+                      max={1}
+                      step={0.1}
+                      value={[search_keyword_weight]}
+                      onValueChange={(values) => {
+                        if (values[0] > 0 || search_vector_weight > 0) updatePreference('search_keyword_weight', values[0]);
+                      }}
+                    />
+                  </div>
                   <div className="space-y-2">
                     <Label htmlFor="max-tokens">Max Response Tokens</Label>
                     <p className="text-xs text-muted">
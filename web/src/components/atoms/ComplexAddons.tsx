@@ -5,6 +5,7 @@ import { HoverPopover } from './HoverPopover';
 import { cls } from '../../utils/cls';
 import { useFeedback } from '../../hooks/useFeedback';
 import type { BaseComponentProps, MessageAddon, MemoryAddonData } from '../../types/components';
+import type { MemoryAction } from '../../types/protocol';
 
 const TOOL_EMOJIS: Record<string, string> = {
   calculate: '🧮',
@@ -19,6 +20,13 @@ const TOOL_EMOJIS: Record<string, string> = {
   extract_metadata: '🏷️',
   screenshot: '📸',
   memory_search: '🧠',
+  memory_create: '🧠',
+  memory_update: '🧠',
+  memory_delete: '🧠',
+  note_create: '📝',
+  note_search: '📝',
+  note_update: '📝',
+  note_delete: '📝',
   memory_query: '🧠',
   memory: '🧠',
   web_search: '🔎',
@@ -949,17 +957,24 @@ const ToolPopoverContent: React.FC<ToolPopoverContentProps> = ({ toolDetail, sho
   );
 };
 
+// Memories the agent changed are labelled with what it did instead of a relevance
+const MEMORY_ACTION_LABELS: Record<MemoryAction, string> = {
+  created: 'Remembered',
+  updated: 'Updated',
+  deleted: 'Forgotten',
+};
+
 // Popover content component for memory
 interface MemoryPopoverContentProps {
   memory: MemoryAddonData;
-  percentage: number;
+  label: string;
   relevanceBgColor: string;
   relevanceColor: string;
 }
 
 const MemoryPopoverContent: React.FC<MemoryPopoverContentProps> = ({
   memory,
-  percentage,
+  label,
   relevanceBgColor,
   relevanceColor,
 }) => {
@@ -978,7 +993,7 @@ const MemoryPopoverContent: React.FC<MemoryPopoverContentProps> = ({
             relevanceColor
           )}
         >
-          {percentage}% relevant
+          {label}
         </div>
       </div>
 
@@ -1037,6 +1052,7 @@ const ComplexAddons: React.FC<ComplexAddonsProps> = ({
     const percentage = getRelevancePercentage(memory.relevance);
     const relevanceColor = getRelevanceColor(memory.relevance);
     const relevanceBgColor = getRelevanceBgColor(memory.relevance);
+    const label = memory.action ? MEMORY_ACTION_LABELS[memory.action] : `${percentage}% relevant`;
 
     return (
       <HoverPopover
@@ -1044,7 +1060,7 @@ const ComplexAddons: React.FC<ComplexAddonsProps> = ({
         content={
           <MemoryPopoverContent
             memory={memory}
-            percentage={percentage}
+            label={label}
             relevanceBgColor={relevanceBgColor}
             relevanceColor={relevanceColor}
           />
@@ -1064,10 +1080,10 @@ const ComplexAddons: React.FC<ComplexAddonsProps> = ({
             relevanceBgColor,
             relevanceColor
           )}
-          title={`Memory trace (${percentage}% relevant)`}
+          title={`Memory trace (${label})`}
         >
           <span className="text-sm">🧠</span>
-          <span className="font-semibold">{percentage}%</span>
+          <span className="font-semibold">{memory.action ? MEMORY_ACTION_LABELS[memory.action] : `${percentage}%`}</span>
         </button>
       </HoverPopover>
     );
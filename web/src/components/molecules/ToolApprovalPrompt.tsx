@@ -0,0 +1,46 @@
+import React from 'react';
+import Button from '../atoms/Button';
+import { useWebSocket } from '../../contexts/WebSocketContext';
+import { useChatStore } from '../../stores/chatStore';
+import { MessageType, type ToolApproval } from '../../types/protocol';
+import type { ConversationId, MessageId, ToolCall } from '../../types/chat';
+
+export interface ToolApprovalPromptProps {
+  conversationId: ConversationId;
+  messageId: MessageId;
+  toolCall: ToolCall;
+}
+
+// Asks the user to approve or deny a tool call the agent is waiting on.
+const ToolApprovalPrompt: React.FC<ToolApprovalPromptProps> = ({ conversationId, messageId, toolCall }) => {
+  const { send, isConnected } = useWebSocket();
+  const updateToolCall = useChatStore((state) => state.updateToolCall);
+
+  const answer = (approved: boolean) => {
+    const body: ToolApproval = { toolUseId: toolCall.id, conversationId, approved };
+    send({ conversationId, type: MessageType.ToolApproval, body });
+    // The agent confirms by starting or failing the call; until then show it as pending.
+    updateToolCall(conversationId, messageId, toolCall.id, { status: 'pending' });
+  };
+
+  return (
+    <div className="flex flex-col gap-2 rounded-md border border-border bg-muted/40 p-3 text-sm">
+      <div>
+        The assistant wants to run <span className="font-mono">{toolCall.tool_name}</span>
+      </div>
+      <pre className="max-h-40 overflow-auto rounded bg-background p-2 text-xs">
+        {JSON.stringify(toolCall.arguments, null, 2)}
+      </pre>
+      <div className="flex gap-2">
+        <Button size="sm" disabled={!isConnected} onClick={() => answer(true)}>
+          Approve
+        </Button>
+        <Button size="sm" variant="outline" disabled={!isConnected} onClick={() => answer(false)}>
+          Deny
+        </Button>
+      </div>
+    </div>
+  );
+};
+
+export default ToolApprovalPrompt;
@@ -1,5 +1,6 @@
 import React, { useMemo } from 'react';
 import ChatBubble from '../molecules/ChatBubble';
+import ToolApprovalPrompt from '../molecules/ToolApprovalPrompt';
 import { useChatStore, selectConversationStreamingMessage } from '../../stores/chatStore';
 import { getToolEmoji } from '../atoms/ComplexAddons';
 import type { ToolDetail } from '../atoms/ComplexAddons';
@@ -20,7 +21,10 @@ function buildToolDetails(toolCalls: ToolCall[]): ToolDetail[] {
     id: tc.id as string,
     name: tc.tool_name,
     description: `Arguments: ${JSON.stringify(tc.arguments)}`,
-    status: tc.status === 'success' ? 'completed' as const : tc.status === 'error' ? 'error' as const : 'running' as const,
+    status: tc.status === 'success' ? 'completed' as const
+      : tc.status === 'error' ? 'error' as const
+      : tc.status === 'awaiting_approval' ? 'pending' as const
+      : 'running' as const,
     result: tc.status === 'success' ? String(tc.result) : tc.status === 'error' ? tc.error : undefined,
     emoji: getToolEmoji(tc.tool_name),
   }));
@@ -36,6 +40,7 @@ function buildMemoryAddons(memoryTraces: MemoryTrace[]): MessageAddon[] {
       id: trace.id as string,
       content: trace.content,
       relevance: trace.relevance,
+      action: trace.action,
     })),
   }];
 }
@@ -56,6 +61,7 @@ const AssistantMessage: React.FC<AssistantMessageProps> = ({ conversationId, mes
 
   const toolDetails = buildToolDetails(message.tool_calls);
   const addons = buildMemoryAddons(message.memory_traces);
+  const awaitingApproval = message.tool_calls.filter((tc) => tc.status === 'awaiting_approval');
 
   return (
     <div className={`flex flex-col items-start gap-2 ${className}`}>
@@ -74,6 +80,9 @@ const AssistantMessage: React.FC<AssistantMessageProps> = ({ conversationId, mes
         thinkingEntries={message.thinking}
         reasoningSteps={message.reasoning_steps}
       />
+      {conversationId && awaitingApproval.map((tc) => (
+        <ToolApprovalPrompt key={tc.id} conversationId={conversationId} messageId={message.id} toolCall={tc} />
+      ))}
     </div>
   );
 };
@@ -9,6 +9,7 @@ import StarRating, { importanceToStar, starToImportance } from '../../atoms/Star
 import { Dialog, DialogContent, DialogHeader, DialogTitle, DialogDescription, DialogFooter } from '../../atoms/Dialog';
 import Button from '../../atoms/Button';
 import type { MemoryDeletionReason } from '../../../hooks/useMemories';
+import { authFetch } from '../../../services/auth';
 
 export interface MemoryDetailProps {
   memoryId: string;
@@ -100,7 +101,7 @@ export const MemoryDetail: React.FC<MemoryDetailProps> = ({
       const fetchMemory = async () => {
         setIsLoading(true);
         try {
-          const response = await fetch(`/api/v1/memories/${memoryId}`);
+          const response = await authFetch(`/api/v1/memories/${memoryId}`);
           if (!response.ok) {
             if (response.status === 404) {
               setError('Memory not found');
@@ -145,7 +146,7 @@ export const MemoryDetail: React.FC<MemoryDetailProps> = ({
   const handleSave = async (content: string, category: MemoryCategory) => {
     setIsLoading(true);
     try {
-      const response = await fetch(`/api/v1/memories/${memoryId}`, {
+      const response = await authFetch(`/api/v1/memories/${memoryId}`, {
         method: 'PUT',
         headers: { 'Content-Type': 'application/json' },
         body: JSON.stringify({ content }),
@@ -168,7 +169,7 @@ export const MemoryDetail: React.FC<MemoryDetailProps> = ({
     if (!memory) return;
     setIsLoading(true);
     try {
-      const response = await fetch(`/api/v1/memories/${memoryId}/pin`, {
+      const response = await authFetch(`/api/v1/memories/${memoryId}/pin`, {
         method: 'POST',
         headers: { 'Content-Type': 'application/json' },
         body: JSON.stringify({ pinned: !memory.pinned }),
@@ -192,7 +193,7 @@ export const MemoryDetail: React.FC<MemoryDetailProps> = ({
 
     setIsLoading(true);
     try {
-      const response = await fetch(`/api/v1/memories/${memoryId}/archive`, {
+      const response = await authFetch(`/api/v1/memories/${memoryId}/archive`, {
         method: 'POST',
         headers: { 'Content-Type': 'application/json' },
       });
@@ -227,7 +228,7 @@ export const MemoryDetail: React.FC<MemoryDetailProps> = ({
         options.body = JSON.stringify({ reason: selectedDeletionReason });
       }
 
-      const response = await fetch(`/api/v1/memories/${memoryId}`, options);
+      const response = await authFetch(`/api/v1/memories/${memoryId}`, options);
 
       if (!response.ok) {
         throw new Error(`Failed to delete memory: ${response.status}`);
@@ -248,7 +249,7 @@ export const MemoryDetail: React.FC<MemoryDetailProps> = ({
     setIsLoading(true);
     try {
       const importance = starToImportance(stars);
-      const response = await fetch(`/api/v1/memories/${memoryId}/importance`, {
+      const response = await authFetch(`/api/v1/memories/${memoryId}/importance`, {
         method: 'PUT',
         headers: { 'Content-Type': 'application/json' },
         body: JSON.stringify({ importance }),
@@ -33,6 +33,7 @@ import { useVoiceConnectionStore, VoiceConnectionStatus } from '../stores/voiceC
 import { useWhatsAppStore, WhatsAppRole } from '../stores/whatsappStore';
 import { injectTraceContext, startSpan, SpanStatusCode } from '../lib/otel';
 import { getUserId } from '../utils/deviceId';
+import { getAuthToken } from '../services/auth';
 
 interface PendingSubscription {
   resolve: (ack: SubscribeAck) => void;
@@ -98,6 +99,11 @@ function isEnvelope(message: unknown): message is Envelope {
   );
 }
 
+function subscribeRequest(conversationId: string, lastSeq: bigint | undefined): SubscribeRequest {
+  // Leave lastSeq out rather than undefined, which msgpackr encodes in a way Go can't decode
+  return lastSeq === undefined ? { conversationId } : { conversationId, lastSeq };
+}
+
 function wrapInEnvelope(data: unknown, conversationId: string): Envelope {
   if (isEnvelope(data)) {
     return data;
@@ -223,6 +229,9 @@ export function WebSocketProvider({ children }: { children: ReactNode }) {
   const isCleaningUpRef = useRef(false);
 
   const pendingSubscriptionsRef = useRef<Map<string, PendingSubscription>>(new Map());
+  // Last event seen per conversation, sent when re-subscribing so the server
+  // replays what was missed while disconnected
+  const lastSeqRef = useRef<Map<string, bigint>>(new Map());
   const voiceRetryTimeoutRef = useRef<NodeJS.Timeout | null>(null);
   const voiceRetryConversationRef = useRef<string | null>(null);
 
@@ -246,9 +255,30 @@ export function WebSocketProvider({ children }: { children: ReactNode }) {
   const handleEnvelope = useCallback((envelope: Envelope) => {
     const conversationId = envelope.conversationId;
 
+    if (conversationId && envelope.seq !== undefined) {
+      const seq = BigInt(envelope.seq);
+      const last = lastSeqRef.current.get(conversationId);
+      if (last !== undefined && seq <= last) {
+        // Already seen, replayed again by an overlapping subscribe
+        return;
+      }
+      lastSeqRef.current.set(conversationId, seq);
+    }
+
     switch (envelope.type) {
       case MessageType.SubscribeAck: {
         const ack = envelope.body as SubscribeAck;
+        if (ack.success && ack.conversationId) {
+          const last = lastSeqRef.current.get(ack.conversationId);
+          if (ack.lastSeq !== undefined && (last === undefined || BigInt(ack.lastSeq) > last)) {
+            lastSeqRef.current.set(ack.conversationId, BigInt(ack.lastSeq));
+          }
+          if (ack.resync) {
+            window.dispatchEvent(
+              new CustomEvent('alicia:resync', { detail: { conversationId: ack.conversationId } })
+            );
+          }
+        }
         const pending = pendingSubscriptionsRef.current.get(ack.conversationId || '');
         if (pending) {
           pendingSubscriptionsRef.current.delete(ack.conversationId || '');
@@ -282,7 +312,7 @@ export function WebSocketProvider({ children }: { children: ReactNode }) {
         break;
 
       case MessageType.StartAnswer:
-      case MessageType.AssistantSentence:
+      case MessageType.AssistantDelta:
       case MessageType.ToolUseRequest:
       case MessageType.ToolUseResult:
       case MessageType.MemoryTrace:
@@ -409,7 +439,13 @@ export function WebSocketProvider({ children }: { children: ReactNode }) {
     }
 
     const protocol = location.protocol === 'https:' ? 'wss:' : 'ws:';
-    const wsUrl = `${protocol}//${location.host}/api/v1/ws`;
+    // Browsers can't set headers on a WebSocket, so the token (or, without
+    // one, the user id) goes in the URL.
+    const token = getAuthToken();
+    const query = token
+      ? `token=${encodeURIComponent(token)}`
+      : `user_id=${encodeURIComponent(getUserId())}`;
+    const wsUrl = `${protocol}//${location.host}/api/v1/ws?${query}`;
 
     setConnectionStatus(ConnectionStatus.Connecting);
 
@@ -438,7 +474,7 @@ export function WebSocketProvider({ children }: { children: ReactNode }) {
           const subscribeEnvelope: Envelope = {
             conversationId: convId,
             type: MessageType.Subscribe,
-            body: { conversationId: convId } as SubscribeRequest,
+            body: subscribeRequest(convId, lastSeqRef.current.get(convId)),
           };
           try {
             ws.send(pack(subscribeEnvelope));
@@ -521,7 +557,7 @@ export function WebSocketProvider({ children }: { children: ReactNode }) {
       const subscribeEnvelope: Envelope = {
         conversationId,
         type: MessageType.Subscribe,
-        body: { conversationId } as SubscribeRequest,
+        body: subscribeRequest(conversationId, lastSeqRef.current.get(conversationId)),
       };
       try {
         // Inject trace context into the envelope (pass the span since it's not active)
@@ -548,6 +584,7 @@ export function WebSocketProvider({ children }: { children: ReactNode }) {
 
   const unsubscribe = useCallback((conversationId: string) => {
     activeSubscriptionsRef.current.delete(conversationId);
+    lastSeqRef.current.delete(conversationId);
 
     setActiveSubscriptions((prev) => {
       const next = new Set(prev);
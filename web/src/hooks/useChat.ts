@@ -286,6 +286,17 @@ export function useChat(conversationId: string | null) {
     });
   }, [conversationId, convId, setMessages]);
 
+  // The server couldn't replay everything missed while disconnected
+  useEffect(() => {
+    const handleResync = (event: Event) => {
+      if ((event as CustomEvent<{ conversationId: string }>).detail.conversationId === conversationId) {
+        refetch();
+      }
+    };
+    window.addEventListener('alicia:resync', handleResync);
+    return () => window.removeEventListener('alicia:resync', handleResync);
+  }, [conversationId, refetch]);
+
   return {
     messages: activeBranch,
     streamingMessage,
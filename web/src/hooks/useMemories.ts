@@ -4,6 +4,7 @@ import {
   type Memory,
   type MemoryCategory,
 } from '../stores/memoryStore';
+import { authFetch } from '../services/auth';
 
 /** Reasons for deleting a memory */
 export type MemoryDeletionReason = 'wrong' | 'useless' | 'old' | 'duplicate' | 'other';
@@ -79,7 +80,7 @@ export function useMemories() {
     setError(null);
 
     try {
-      const response = await fetch('/api/v1/memories?limit=500');
+      const response = await authFetch('/api/v1/memories?limit=500');
       if (!response.ok) {
         throw new Error(`Failed to fetch memories: ${response.status}`);
       }
@@ -112,7 +113,7 @@ export function useMemories() {
     setError(null);
 
     try {
-      const response = await fetch('/api/v1/memories', {
+      const response = await authFetch('/api/v1/memories', {
         method: 'POST',
         headers: { 'Content-Type': 'application/json' },
         body: JSON.stringify({ content }),
@@ -129,7 +130,7 @@ export function useMemories() {
 
       if (category) {
         try {
-          await fetch(`/api/v1/memories/${apiMemory.id}/tags`, {
+          await authFetch(`/api/v1/memories/${apiMemory.id}/tags`, {
             method: 'POST',
             headers: { 'Content-Type': 'application/json' },
             body: JSON.stringify({ tag: category }),
@@ -158,7 +159,7 @@ export function useMemories() {
       const body: { content: string } = { content };
       const tags = category ? [category] : undefined;
 
-      const response = await fetch(`/api/v1/memories/${id}`, {
+      const response = await authFetch(`/api/v1/memories/${id}`, {
         method: 'PUT',
         headers: { 'Content-Type': 'application/json' },
         body: JSON.stringify(body),
@@ -172,7 +173,7 @@ export function useMemories() {
 
       if (tags) {
         // Simplified: in production you'd manage tags properly (add/remove delta)
-        await fetch(`/api/v1/memories/${id}/tags`, {
+        await authFetch(`/api/v1/memories/${id}/tags`, {
           method: 'POST',
           headers: { 'Content-Type': 'application/json' },
           body: JSON.stringify({ tag: category }),
@@ -198,7 +199,7 @@ export function useMemories() {
     setError(null);
 
     try {
-      const response = await fetch(`/api/v1/memories/${id}/archive`, {
+      const response = await authFetch(`/api/v1/memories/${id}/archive`, {
         method: 'POST',
         headers: { 'Content-Type': 'application/json' },
         body: JSON.stringify({ reason }),
@@ -224,7 +225,7 @@ export function useMemories() {
     setError(null);
 
     try {
-      const response = await fetch(`/api/v1/memories/${id}`, {
+      const response = await authFetch(`/api/v1/memories/${id}`, {
         method: 'DELETE',
       });
 
@@ -248,7 +249,7 @@ export function useMemories() {
     setError(null);
 
     try {
-      const response = await fetch(`/api/v1/memories/${id}/pin`, {
+      const response = await authFetch(`/api/v1/memories/${id}/pin`, {
         method: 'POST',
         headers: { 'Content-Type': 'application/json' },
         body: JSON.stringify({ pinned }),
@@ -276,7 +277,7 @@ export function useMemories() {
     setError(null);
 
     try {
-      const response = await fetch(`/api/v1/memories/${id}/archive`, {
+      const response = await authFetch(`/api/v1/memories/${id}/archive`, {
         method: 'POST',
         headers: { 'Content-Type': 'application/json' },
       });
@@ -306,7 +307,7 @@ export function useMemories() {
     const importance = stars <= 0 ? 0.5 : Math.min(1.0, Math.max(0.2, stars * 0.2));
 
     try {
-      const response = await fetch(`/api/v1/memories/${id}`, {
+      const response = await authFetch(`/api/v1/memories/${id}`, {
         method: 'PUT',
         headers: { 'Content-Type': 'application/json' },
         body: JSON.stringify({ importance }),
@@ -337,7 +338,7 @@ export function useMemories() {
       const memory = rawMemories[id];
       const oldCategory = memory?.category;
 
-      const addResponse = await fetch(`/api/v1/memories/${id}/tags`, {
+      const addResponse = await authFetch(`/api/v1/memories/${id}/tags`, {
         method: 'POST',
         headers: { 'Content-Type': 'application/json' },
         body: JSON.stringify({ tag: category }),
@@ -348,7 +349,7 @@ export function useMemories() {
       }
 
       if (oldCategory && oldCategory !== category) {
-        await fetch(`/api/v1/memories/${id}/tags/${oldCategory}`, {
+        await authFetch(`/api/v1/memories/${id}/tags/${oldCategory}`, {
           method: 'DELETE',
         });
       }
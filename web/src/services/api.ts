@@ -13,7 +13,7 @@ import {
   MCPServersResponse,
   MCPToolsResponse,
 } from '../types/mcp';
-import { getUserId } from '../utils/deviceId';
+import { authFetch } from './auth';
 
 const API_BASE = import.meta.env.VITE_API_URL
   ? `${import.meta.env.VITE_API_URL}/api/v1`
@@ -21,13 +21,7 @@ const API_BASE = import.meta.env.VITE_API_URL
 
 async function fetchWithErrorHandling(url: string, options?: RequestInit): Promise<Response> {
   try {
-    const headers = new Headers(options?.headers);
-    headers.set('X-User-ID', getUserId());
-
-    return await fetch(url, {
-      ...options,
-      headers,
-    });
+    return await authFetch(url, options);
   } catch (err) {
     if (err instanceof TypeError && err.message.includes('fetch')) {
       throw new Error('Network error: Unable to connect to the server. Please check your connection.');
@@ -77,6 +71,8 @@ export interface UserPreferencesResponse {
   pareto_enable_crossover: boolean;
   notes_similarity_threshold: number;
   notes_max_count: number;
+  search_vector_weight: number;
+  search_keyword_weight: number;
   confirm_delete_memory: boolean;
   show_relevance_scores: boolean;
   created_at: string;
@@ -100,6 +96,8 @@ export interface UpdatePreferencesRequest {
   pareto_enable_crossover?: boolean;
   notes_similarity_threshold?: number;
   notes_max_count?: number;
+  search_vector_weight?: number;
+  search_keyword_weight?: number;
   confirm_delete_memory?: boolean;
   show_relevance_scores?: boolean;
 }
@@ -293,7 +291,7 @@ export const api = {
   },
 
   async getMCPTools(): Promise<Record<string, MCPTool[]>> {
-    const response = await fetchWithErrorHandling(`${API_BASE}/tools`);
+    const response = await fetchWithErrorHandling(`${API_BASE}/mcp/tools`);
     const data = await handleResponse<MCPToolsResponse>(response);
     return data.tools || {};
   },
@@ -450,7 +448,7 @@ export interface ToolUse {
   tool_name: string;
   arguments: Record<string, unknown>;
   result?: unknown;
-  status: 'pending' | 'success' | 'error';
+  status: 'awaiting_approval' | 'pending' | 'success' | 'error';
   error?: string;
   created_at: string;
 }
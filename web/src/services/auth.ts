@@ -0,0 +1,240 @@
+import { getUserId, setUserId } from '../utils/deviceId';
+
+const TOKEN_KEY = 'alicia_auth_token';
+
+const AUTH_BASE = import.meta.env.VITE_API_URL
+  ? `${import.meta.env.VITE_API_URL}/api/v1/auth`
+  : '/api/v1/auth';
+
+export interface AuthUser {
+  id: string;
+  username: string;
+  display_name: string;
+  is_admin: boolean;
+  has_password: boolean;
+}
+
+export interface AuthConfig {
+  require_auth: boolean;
+  signup_open: boolean;
+  passkeys: boolean;
+}
+
+interface IssuedSession {
+  token: string;
+  user: AuthUser;
+}
+
+export function getAuthToken(): string | null {
+  try {
+    return localStorage.getItem(TOKEN_KEY);
+  } catch {
+    return null;
+  }
+}
+
+function setSession(session: IssuedSession | null): void {
+  try {
+    if (session) {
+      localStorage.setItem(TOKEN_KEY, session.token);
+    } else {
+      localStorage.removeItem(TOKEN_KEY);
+    }
+  } catch {
+    // localStorage unavailable
+  }
+  // Requests made before logging in act as the stored user id, so keep it
+  // the logged-in user's.
+  setUserId(session ? session.user.id : null);
+}
+
+/** Headers identifying the current user: the session token if logged in. */
+export function authHeaders(headers?: HeadersInit): Headers {
+  const result = new Headers(headers);
+  const token = getAuthToken();
+  if (token) {
+    result.set('Authorization', `Bearer ${token}`);
+  } else {
+    result.set('X-User-ID', getUserId());
+  }
+  return result;
+}
+
+/** fetch with authHeaders; a 401 drops the session so the login screen shows. */
+export async function authFetch(input: string, init?: RequestInit): Promise<Response> {
+  const response = await fetch(input, { ...init, headers: authHeaders(init?.headers) });
+  if (response.status === 401 && getAuthToken()) {
+    setSession(null);
+    window.dispatchEvent(new Event('alicia:logout'));
+  }
+  return response;
+}
+
+async function post<T>(path: string, body: unknown): Promise<T> {
+  const response = await fetch(`${AUTH_BASE}${path}`, {
+    method: 'POST',
+    headers: { 'Content-Type': 'application/json' },
+    body: JSON.stringify(body),
+  });
+  if (!response.ok) {
+    let message = `Request failed: ${response.status}`;
+    try {
+      message = (await response.json()).error || message;
+    } catch {
+      // not JSON
+    }
+    throw new Error(message);
+  }
+  return response.json();
+}
+
+export async function getAuthConfig(): Promise<AuthConfig> {
+  const response = await fetch(`${AUTH_BASE}/config`);
+  if (!response.ok) {
+    throw new Error(`Failed to load auth config: ${response.status}`);
+  }
+  return response.json();
+}
+
+/** The logged-in user, or null if there's no valid session. */
+export async function getCurrentUser(): Promise<AuthUser | null> {
+  if (!getAuthToken()) {
+    return null;
+  }
+  const response = await authFetch(`${AUTH_BASE}/me`);
+  if (!response.ok) {
+    return null;
+  }
+  return (await response.json()).user;
+}
+
+export async function login(username: string, password: string): Promise<AuthUser> {
+  const session = await post<IssuedSession>('/login', { username, password });
+  setSession(session);
+  return session.user;
+}
+
+export async function register(username: string, password: string): Promise<AuthUser> {
+  const session = await post<IssuedSession>('/register', { username, password });
+  setSession(session);
+  return session.user;
+}
+
+export async function logout(): Promise<void> {
+  try {
+    await authFetch(`${AUTH_BASE}/logout`, { method: 'POST' });
+  } finally {
+    setSession(null);
+  }
+}
+
+// --- Passkeys ---
+
+function toBase64Url(buffer: ArrayBuffer): string {
+  const bytes = new Uint8Array(buffer);
+  let binary = '';
+  for (const b of bytes) {
+    binary += String.fromCharCode(b);
+  }
+  return btoa(binary).replace(/\+/g, '-').replace(/\//g, '_').replace(/=+$/, '');
+}
+
+function fromBase64Url(value: string): ArrayBuffer {
+  const base64 = value.replace(/-/g, '+').replace(/_/g, '/');
+  const binary = atob(base64 + '='.repeat((4 - (base64.length % 4)) % 4));
+  const bytes = new Uint8Array(binary.length);
+  for (let i = 0; i < binary.length; i++) {
+    bytes[i] = binary.charCodeAt(i);
+  }
+  return bytes.buffer;
+}
+
+interface CredentialDescriptor {
+  type: 'public-key';
+  id: string;
+}
+
+// Options as the server sends them, with binary fields base64url encoded.
+interface EncodedRequestOptions extends Omit<PublicKeyCredentialRequestOptions, 'challenge' | 'allowCredentials'> {
+  challenge: string;
+  allowCredentials?: CredentialDescriptor[];
+}
+
+function toDescriptors(list: CredentialDescriptor[] | undefined): PublicKeyCredentialDescriptor[] {
+  return (list ?? []).map((c) => ({ type: c.type, id: fromBase64Url(c.id) }));
+}
+
+export function passkeysSupported(): boolean {
+  return typeof window !== 'undefined' && !!window.PublicKeyCredential;
+}
+
+export async function loginWithPasskey(username?: string): Promise<AuthUser> {
+  const { challenge_id, options } = await post<{ challenge_id: string; options: EncodedRequestOptions }>(
+    '/passkeys/login/begin',
+    { username: username ?? '' },
+  );
+
+  const credential = (await navigator.credentials.get({
+    publicKey: {
+      ...options,
+      challenge: fromBase64Url(options.challenge),
+      allowCredentials: toDescriptors(options.allowCredentials),
+    },
+  })) as PublicKeyCredential | null;
+  if (!credential) {
+    throw new Error('Passkey login was cancelled');
+  }
+
+  const response = credential.response as AuthenticatorAssertionResponse;
+  const session = await post<IssuedSession>('/passkeys/login/finish', {
+    challenge_id,
+    credential_id: toBase64Url(credential.rawId),
+    client_data_json: toBase64Url(response.clientDataJSON),
+    authenticator_data: toBase64Url(response.authenticatorData),
+    signature: toBase64Url(response.signature),
+  });
+  setSession(session);
+  return session.user;
+}
+
+/** Registers a passkey for the logged-in user. */
+export async function registerPasskey(name: string): Promise<void> {
+  const begin = await authFetch(`${AUTH_BASE}/passkeys/register/begin`, { method: 'POST' });
+  if (!begin.ok) {
+    throw new Error(`Failed to start passkey registration: ${begin.status}`);
+  }
+  const { challenge_id, options } = await begin.json();
+
+  const credential = (await navigator.credentials.create({
+    publicKey: {
+      ...options,
+      challenge: fromBase64Url(options.challenge),
+      user: { ...options.user, id: fromBase64Url(options.user.id) },
+      excludeCredentials: toDescriptors(options.excludeCredentials),
+    } as PublicKeyCredentialCreationOptions,
+  })) as PublicKeyCredential | null;
+  if (!credential) {
+    throw new Error('Passkey registration was cancelled');
+  }
+
+  const response = credential.response as AuthenticatorAttestationResponse;
+  const publicKey = response.getPublicKey();
+  if (!publicKey) {
+    throw new Error("This authenticator's key type is not supported");
+  }
+  const finish = await authFetch(`${AUTH_BASE}/passkeys/register/finish`, {
+    method: 'POST',
+    headers: { 'Content-Type': 'application/json' },
+    body: JSON.stringify({
+      challenge_id,
+      name,
+      credential_id: toBase64Url(credential.rawId),
+      client_data_json: toBase64Url(response.clientDataJSON),
+      public_key: toBase64Url(publicKey),
+      public_key_algorithm: response.getPublicKeyAlgorithm(),
+    }),
+  });
+  if (!finish.ok) {
+    throw new Error(`Failed to register passkey: ${finish.status}`);
+  }
+}
@@ -19,6 +19,8 @@ export interface UserPreferences {
   pareto_branches_per_gen: number;
   pareto_archive_size: number;
   pareto_enable_crossover: boolean;
+  search_vector_weight: number;
+  search_keyword_weight: number;
   confirm_delete_memory: boolean;
   show_relevance_scores: boolean;
 }
@@ -6,6 +6,7 @@ import {
   createMessageId,
   createConversationId,
 } from './streaming';
+import type { MemoryAction } from './protocol';
 
 export type { MessageId, ConversationId, ToolCallId, MemoryTraceId };
 export { createMessageId, createConversationId };
@@ -14,7 +15,7 @@ export const createToolCallId = (id: string): ToolCallId => id as unknown as Too
 export const createMemoryTraceId = (id: string): MemoryTraceId => id as unknown as MemoryTraceId;
 
 export type MessageStatus = 'pending' | 'streaming' | 'completed' | 'error';
-export type ToolCallStatus = 'pending' | 'success' | 'error';
+export type ToolCallStatus = 'awaiting_approval' | 'pending' | 'success' | 'error';
 
 export interface ToolCall {
   id: ToolCallId;
@@ -31,6 +32,7 @@ export interface MemoryTrace {
   memory_id: string;
   content: string;
   relevance: number;
+  action?: MemoryAction;
 }
 
 export interface ThinkingEntry {
@@ -6,6 +6,7 @@ export interface BaseComponentProps {
 }
 
 import type { MessageRole } from './models';
+import type { MemoryAction } from './protocol';
 export type { MessageRole };
 
 export type MessageState = 'idle' | 'typing' | 'sending' | 'streaming' | 'completed' | 'error';
@@ -30,6 +31,7 @@ export interface MemoryAddonData {
   id: string;
   content: string;
   relevance: number;
+  action?: MemoryAction;
 }
 
 export interface MessageAddon {
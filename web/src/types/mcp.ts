@@ -1,28 +1,48 @@
-export type MCPTransport = 'stdio' | 'sse';
+export type MCPTransport = 'stdio' | 'sse' | 'streamable-http';
 
-export interface MCPServer {
+export type MCPServerStatus = 'up' | 'restarting' | 'failed';
+
+export type MCPResultPolicy = 'truncate' | 'summarize';
+
+export type MCPApprovalPolicy = 'always' | 'never' | 'ask';
+
+export interface MCPToolLimits {
+  timeout_seconds?: number;
+  max_result_bytes?: number;
+  result_policy?: MCPResultPolicy;
+  approval_policy?: MCPApprovalPolicy;
+}
+
+export interface MCPServer extends MCPToolLimits {
   id: string;
   name: string;
   transport_type: MCPTransport;
   command?: string;
   args?: string[];
   url?: string;
+  // Names of the headers sent to the server; their values are never returned
+  header_names?: string[];
+  tool_limits?: Record<string, MCPToolLimits>;
   enabled: boolean;
   created_at: string;
+  status?: MCPServerStatus;
+  last_error?: string;
 }
 
-export interface MCPServerConfig {
+export interface MCPServerConfig extends MCPToolLimits {
   name: string;
   transport_type: MCPTransport;
   command?: string;
   args?: string[];
   url?: string;
+  headers?: Record<string, string>;
+  tool_limits?: Record<string, MCPToolLimits>;
 }
 
 export interface MCPTool {
   name: string;
   description: string;
-  schema: Record<string, unknown>;
+  schema?: Record<string, unknown>;
 }
 
 export interface MCPServersResponse {
@@ -31,4 +51,5 @@ export interface MCPServersResponse {
 
 export interface MCPToolsResponse {
   tools: Record<string, MCPTool[]>;
+  errors?: Record<string, string>;
 }
@@ -9,9 +9,12 @@ export enum MessageType {
   StartAnswer = 13,
   MemoryTrace = 14,
   AssistantSentence = 16,
+  AssistantDelta = 17,
   GenerationRequest = 33,
   ThinkingSummary = 34,
   ConversationTitleUpdate = 35,
+  GenerationCancel = 36,
+  ToolApproval = 37,
   Subscribe = 40,
   Unsubscribe = 41,
   SubscribeAck = 42,
@@ -41,6 +44,9 @@ export interface Envelope {
   trace_flags?: number;
   session_id?: string;
   user_id?: string;
+  // Per-conversation event sequence number, set by the server (a uint64,
+  // which msgpackr decodes as a bigint)
+  seq?: bigint;
 }
 
 export interface ErrorMessage {
@@ -63,14 +69,26 @@ export interface AssistantMessage {
   content: string;
   previousId?: string;
   reasoning?: string;
+  status?: 'cancelled';
 }
 
+export type ToolExecution = 'server' | 'client' | 'awaiting_approval';
+
 export interface ToolUseRequest {
   id: string;
   messageId: string;
   conversationId: string;
   toolName: string;
   arguments: Record<string, unknown>;
+  execution?: ToolExecution;
+}
+
+// Answers a ToolUseRequest whose execution is 'awaiting_approval'.
+export interface ToolApproval {
+  toolUseId: string;
+  conversationId: string;
+  approved: boolean;
+  reason?: string;
 }
 
 export interface ToolUseResult {
@@ -98,8 +116,12 @@ export interface MemoryTrace {
   conversationId: string;
   content: string;
   relevance: number;
+  /** Set when the agent changed the memory rather than retrieved it */
+  action?: MemoryAction;
 }
 
+export type MemoryAction = 'created' | 'updated' | 'deleted';
+
 export interface AssistantSentence {
   id: string;
   messageId: string;
@@ -109,9 +131,18 @@ export interface AssistantSentence {
   isFinal: boolean;
 }
 
+export interface AssistantDelta {
+  messageId: string;
+  conversationId: string;
+  sequence: number;
+  delta: string;
+}
+
 export interface SubscribeRequest {
   conversationId?: string;
   agentMode?: boolean;
+  // Last event seen before reconnecting; the server replays the ones after it
+  lastSeq?: bigint;
 }
 
 export interface UnsubscribeRequest {
@@ -123,6 +154,9 @@ export interface SubscribeAck {
   agentMode?: boolean;
   success: boolean;
   error?: string;
+  lastSeq?: bigint;
+  // The missed events are gone; reload the conversation
+  resync?: boolean;
 }
 
 export interface UnsubscribeAck {
@@ -146,6 +180,11 @@ export interface ThinkingSummary {
   progress?: number; // 0-100 percentage
 }
 
+export interface GenerationCancel {
+  conversationId: string;
+  messageId?: string;
+}
+
 export interface ConversationTitleUpdate {
   conversationId: string;
   title: string;
@@ -206,6 +245,7 @@ export interface GenerationComplete {
   conversationId: string;
   success: boolean;
   error?: string;
+  cancelled?: boolean;
 }
 
 export interface WhatsAppPairRequest {
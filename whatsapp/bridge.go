@@ -42,6 +42,10 @@ func NewBridge(cfg *Config, archive *Archive) *Bridge {
 
 func (b *Bridge) setHeaders(req *http.Request) {
 	req.Header.Set("Content-Type", "application/json")
+	if b.cfg.AliciaAPIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+b.cfg.AliciaAPIKey)
+		return
+	}
 	req.Header.Set("X-User-ID", b.cfg.AliciaUserID)
 	if b.cfg.AgentSecret != "" {
 		req.Header.Set("Authorization", "Bearer "+b.cfg.AgentSecret)
@@ -20,6 +20,7 @@ type Config struct {
 	AgentSecret    string
 	AliciaAPIURL   string
 	AliciaUserID   string
+	AliciaAPIKey   string
 	ReaderDBPath   string
 	AliciaDBPath   string
 	ArchiveDBPath  string
@@ -44,6 +45,7 @@ func LoadConfig() *Config {
 		AgentSecret:    config.GetEnv("AGENT_SECRET", ""),
 		AliciaAPIURL:   config.GetEnv("ALICIA_API_URL", "http://localhost:8090/api/v1"),
 		AliciaUserID:   config.GetEnv("ALICIA_USER_ID", "default_user"),
+		AliciaAPIKey:   config.GetEnv("ALICIA_API_KEY", ""),
 		ReaderDBPath:   config.GetEnv("WHATSAPP_READER_DB_PATH", "whatsapp-reader-session.db"),
 		AliciaDBPath:   config.GetEnv("WHATSAPP_ALICIA_DB_PATH", "whatsapp-alicia-session.db"),
 		ArchiveDBPath:  config.GetEnv("WHATSAPP_ARCHIVE_DB_PATH", "whatsapp-archive.db"),
@@ -160,6 +162,8 @@ Environment Variables:
   Alicia API:
     ALICIA_API_URL              REST API base URL (default: http://localhost:8090/api/v1)
     ALICIA_USER_ID              User ID for API requests (default: default_user)
+    ALICIA_API_KEY              Device API key for API requests; acts as its user
+                                instead of AGENT_SECRET and ALICIA_USER_ID (default: "")
 
   WhatsApp:
     WHATSAPP_READER_DB_PATH     Reader whatsmeow session DB (default: whatsapp-reader-session.db)
@@ -185,6 +189,7 @@ func logConfig(cfg *Config) {
 		"agent_secret", maskSecret(cfg.AgentSecret),
 		"alicia_api_url", cfg.AliciaAPIURL,
 		"alicia_user_id", cfg.AliciaUserID,
+		"alicia_api_key", maskSecret(cfg.AliciaAPIKey),
 		"reader_db_path", cfg.ReaderDBPath,
 		"alicia_db_path", cfg.AliciaDBPath,
 		"archive_db_path", cfg.ArchiveDBPath,